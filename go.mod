@@ -3,9 +3,11 @@ module github.com/kon-pap/noobcash
 go 1.17
 
 require (
+	filippo.io/edwards25519 v1.0.0
 	github.com/gorilla/mux v1.8.0
 	github.com/joho/godotenv v1.4.0
 	github.com/spf13/cobra v1.3.0
+	golang.org/x/crypto v0.1.0
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
 )
 
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"github.com/kon-pap/noobcash/pkg/node"
+	"github.com/spf13/cobra"
+)
+
+var accountsCmd = &cobra.Command{
+	Use:   "accounts",
+	Short: "List the named accounts hosted by the node",
+	Long: `List the named accounts hosted by the node.
+Any other command acts on one of them with --account.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ip, port, err := getAddress(cmd)
+		if err != nil {
+			return err
+		}
+		body, err := node.GetResponseBody(
+			http.DefaultClient.Get(fmt.Sprintf("http://%s:%d/accounts", ip, port)),
+		)
+		if err != nil {
+			return err
+		}
+		var accounts []struct {
+			Name      string `json:"name"`
+			Address   string `json:"address"`
+			HD        bool   `json:"hd"`
+			WatchOnly bool   `json:"watchOnly"`
+			Spendable int    `json:"spendable"`
+			UtxoCount int    `json:"utxoCount"`
+		}
+		if err := json.Unmarshal([]byte(body), &accounts); err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ACCOUNT\tADDRESS\tKIND\tSPENDABLE\tUTXOS")
+		for _, a := range accounts {
+			kind := "key"
+			if a.HD {
+				kind = "hd"
+			} else if a.WatchOnly {
+				kind = "watch-only"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\n", a.Name, a.Address, kind, a.Spendable, a.UtxoCount)
+		}
+		tw.Flush()
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(accountsCmd)
+}
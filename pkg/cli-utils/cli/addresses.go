@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/kon-pap/noobcash/pkg/node"
+	"github.com/spf13/cobra"
+)
+
+var addressesCmd = &cobra.Command{
+	Use:   "addresses",
+	Short: "List the receiving addresses of your wallet",
+	Long: `List the receiving addresses of your wallet.
+With an HD wallet, --new hands out a fresh receiving address and --rescan
+looks for payments to derived addresses in the chain.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ip, port, err := getAddress(cmd)
+		if err != nil {
+			return err
+		}
+		query, err := getAccountQuery(cmd)
+		if err != nil {
+			return err
+		}
+		if newAddress, _ := cmd.Flags().GetBool("new"); newAddress {
+			body, err := node.GetResponseBody(
+				http.Post(fmt.Sprintf("http://%s:%d/wallet/addresses?%s", ip, port, query.Encode()), "application/json", nil),
+			)
+			if err != nil {
+				return err
+			}
+			fmt.Println(body)
+			return nil
+		}
+		if rescan, _ := cmd.Flags().GetBool("rescan"); rescan {
+			body, err := node.GetResponseBody(
+				http.Post(fmt.Sprintf("http://%s:%d/wallet/rescan?%s", ip, port, query.Encode()), "application/json", nil),
+			)
+			if err != nil {
+				return err
+			}
+			fmt.Println(body)
+			return nil
+		}
+		body, err := node.GetResponseBody(
+			http.Get(fmt.Sprintf("http://%s:%d/wallet/addresses?%s", ip, port, query.Encode())),
+		)
+		if err != nil {
+			return err
+		}
+		var reply struct {
+			HD        bool     `json:"hd"`
+			Addresses []string `json:"addresses"`
+		}
+		if err := json.Unmarshal([]byte(body), &reply); err != nil {
+			return err
+		}
+		for i, address := range reply.Addresses {
+			if reply.HD {
+				fmt.Printf("%3d  %s\n", i, address)
+			} else {
+				fmt.Println(address)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(addressesCmd)
+
+	addressesCmd.PersistentFlags().Bool("new", false, "hand out a new receiving address (HD wallets only)")
+	addressesCmd.PersistentFlags().Bool("rescan", false, "scan the chain for payments to the wallet")
+}
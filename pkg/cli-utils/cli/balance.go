@@ -1,8 +1,13 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
 
 	"github.com/kon-pap/noobcash/pkg/node"
 	"github.com/spf13/cobra"
@@ -16,17 +21,79 @@ var balanceCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		if of, err := cmd.Flags().GetString("of"); err != nil {
+			return err
+		} else if of != "" {
+			return printRingMemberBalance(ip, port, of)
+		}
+		minConf, err := cmd.Flags().GetInt("min-conf")
+		if err != nil {
+			return err
+		}
+		query, err := getAccountQuery(cmd)
+		if err != nil {
+			return err
+		}
+		query.Set("minConf", strconv.Itoa(minConf))
 		body, err := node.GetResponseBody(
-			http.DefaultClient.Get(fmt.Sprintf("http://%s:%d/balance", ip, port)),
+			http.DefaultClient.Get(fmt.Sprintf("http://%s:%d/balance?%s", ip, port, query.Encode())),
 		)
 		if err != nil {
 			return err
 		}
-		fmt.Println(string(body))
+		var balance node.BalanceBreakdown
+		if err := json.Unmarshal([]byte(body), &balance); err != nil {
+			return err
+		}
+		printBalance(&balance)
 		return nil
 	},
 }
 
+func printBalance(balance *node.BalanceBreakdown) {
+	if balance.WatchOnly {
+		fmt.Printf("Balance of %s (watch-only)\n", balance.Address)
+	} else {
+		fmt.Printf("Balance of %s\n", balance.Address)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "Confirmed (%d+ conf):\t%d\t\n", balance.MinConfirmations, balance.Confirmed)
+	fmt.Fprintf(tw, "Unconfirmed incoming:\t%d\t\n", balance.UnconfirmedIncoming)
+	fmt.Fprintf(tw, "Unconfirmed outgoing:\t%d\t\n", balance.UnconfirmedOutgoing)
+	fmt.Fprintf(tw, "Reserved:\t%d\t\n", balance.Reserved)
+	fmt.Fprintf(tw, "Locked:\t%d\t\n", balance.Locked)
+	fmt.Fprintf(tw, "Spendable:\t%d\t\n", balance.Spendable)
+	tw.Flush()
+	if len(balance.Tokens) > 0 {
+		fmt.Println()
+		printTokenBalances(balance.Tokens)
+	}
+}
+
+// Prints the balance of another member of the ring, as validated by the queried node
+func printRingMemberBalance(ip string, port int, member string) error {
+	body, err := node.GetResponseBody(
+		http.DefaultClient.Get(fmt.Sprintf("http://%s:%d/wallets/%s", ip, port, url.PathEscape(member))),
+	)
+	if err != nil {
+		return err
+	}
+	var wallet struct {
+		Id        int    `json:"id"`
+		Address   string `json:"address"`
+		Balance   int    `json:"balance"`
+		UtxoCount int    `json:"utxoCount"`
+	}
+	if err := json.Unmarshal([]byte(body), &wallet); err != nil {
+		return err
+	}
+	fmt.Printf("Balance of node %d (%s): %d in %d UTXO(s)\n", wallet.Id, wallet.Address, wallet.Balance, wallet.UtxoCount)
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(balanceCmd)
+
+	balanceCmd.PersistentFlags().Int("min-conf", 1, "minimum confirmations for a UTXO to count as confirmed")
+	balanceCmd.PersistentFlags().String("of", "", "view the balance of another ring member, by node id or address")
 }
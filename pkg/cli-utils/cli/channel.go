@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/kon-pap/noobcash/pkg/node"
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+	"github.com/spf13/cobra"
+)
+
+var channelCmd = &cobra.Command{
+	Use:   "channel",
+	Short: "Pay another node through a payment channel",
+	Long: `Lock coins in a channel to another node and pay it off-chain, settling
+only the total on chain:
+
+  channel open <recipient> 100
+  channel pay <channel-id> 5
+  channel close <channel-id>     (by the payee)
+  channel refund <channel-id>    (by the payer, after the timeout)
+  channel status [channel-id]`,
+}
+
+var channelOpenCmd = &cobra.Command{
+	Use:   "open <recipient> <capacity>",
+	Short: "Fund a channel paying a node id or the address of its wallet",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("invalid number of arguments. expected 2, got %d", len(args))
+		}
+		request := map[string]interface{}{}
+		if recipient, err := strconv.Atoi(args[0]); err == nil {
+			request["recipient"] = recipient
+		} else if _, err := backend.ParseAddress(args[0]); err != nil {
+			return fmt.Errorf("recipient is neither a node id nor an address: %s", err)
+		} else {
+			request["address"] = args[0]
+		}
+		capacity, err := strconv.Atoi(args[1])
+		if err != nil {
+			return err
+		}
+		request["capacity"] = capacity
+		lifetime, err := cmd.Flags().GetInt64("lifetime")
+		if err != nil {
+			return err
+		}
+		request["lifetime"] = lifetime
+		ip, port, err := getAddress(cmd)
+		if err != nil {
+			return err
+		}
+		query, err := getAccountQuery(cmd)
+		if err != nil {
+			return err
+		}
+		requestJson, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body, err := node.GetResponseBody(
+			http.Post(fmt.Sprintf("http://%s:%d/channels?%s", ip, port, query.Encode()), "application/json", bytes.NewBuffer(requestJson)),
+		)
+		if err != nil {
+			return err
+		}
+		var entry node.ChannelEntry
+		if err := json.Unmarshal([]byte(body), &entry); err != nil {
+			return err
+		}
+		fmt.Printf("Opened channel %s of %d, timing out at block %d\n", entry.Id, entry.Channel.Capacity, entry.Channel.Timeout)
+		return nil
+	},
+}
+
+var channelPayCmd = &cobra.Command{
+	Use:   "pay <channel-id> <amount>",
+	Short: "Pay the payee of a channel off-chain",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("invalid number of arguments. expected 2, got %d", len(args))
+		}
+		amount, err := strconv.Atoi(args[1])
+		if err != nil {
+			return err
+		}
+		ip, port, err := getAddress(cmd)
+		if err != nil {
+			return err
+		}
+		requestJson, err := json.Marshal(map[string]interface{}{"amount": amount})
+		if err != nil {
+			return err
+		}
+		body, err := node.GetResponseBody(
+			http.Post(fmt.Sprintf("http://%s:%d/channels/%s/pay", ip, port, args[0]), "application/json", bytes.NewBuffer(requestJson)),
+		)
+		if err != nil {
+			return err
+		}
+		var entry node.ChannelEntry
+		if err := json.Unmarshal([]byte(body), &entry); err != nil {
+			return err
+		}
+		fmt.Printf("Paid %d, %d of %d in total\n", amount, entry.Paid, entry.Channel.Capacity)
+		return nil
+	},
+}
+
+// Returns a command posting to the given action of a channel
+func channelActionCmd(action, short string) *cobra.Command {
+	return &cobra.Command{
+		Use:   action + " <channel-id>",
+		Short: short,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("invalid number of arguments. expected 1, got %d", len(args))
+			}
+			ip, port, err := getAddress(cmd)
+			if err != nil {
+				return err
+			}
+			body, err := node.GetResponseBody(
+				http.Post(fmt.Sprintf("http://%s:%d/channels/%s/%s", ip, port, args[0], action), "application/json", nil),
+			)
+			if err != nil {
+				return err
+			}
+			fmt.Println(body)
+			return nil
+		},
+	}
+}
+
+var channelCloseCmd = channelActionCmd("close", "Settle the latest payment of a channel on chain, as its payee")
+var channelRefundCmd = channelActionCmd("refund", "Take back the capacity of a timed out channel, as its payer")
+
+var channelStatusCmd = &cobra.Command{
+	Use:   "status [channel-id]",
+	Short: "View a channel, or list the channels of the account",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return fmt.Errorf("invalid number of arguments. expected at most 1, got %d", len(args))
+		}
+		ip, port, err := getAddress(cmd)
+		if err != nil {
+			return err
+		}
+		var url string
+		if len(args) == 1 {
+			url = fmt.Sprintf("http://%s:%d/channels/%s", ip, port, args[0])
+		} else {
+			query, err := getAccountQuery(cmd)
+			if err != nil {
+				return err
+			}
+			url = fmt.Sprintf("http://%s:%d/channels?%s", ip, port, query.Encode())
+		}
+		body, err := node.GetResponseBody(http.DefaultClient.Get(url))
+		if err != nil {
+			return err
+		}
+		var entries []node.ChannelEntry
+		if len(args) == 1 {
+			entries = make([]node.ChannelEntry, 1)
+			err = json.Unmarshal([]byte(body), &entries[0])
+		} else {
+			err = json.Unmarshal([]byte(body), &entries)
+		}
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tROLE\tSTATUS\tPAID\tCAPACITY\tUPDATES\tTIMEOUT")
+		for i := range entries {
+			e := &entries[i]
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\n", e.Id, e.Role, e.Status, e.Paid, e.Channel.Capacity, e.Updates, e.Channel.Timeout)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	channelOpenCmd.Flags().Int64("lifetime", node.DefaultChannelLifetime, "blocks until the payer can take the capacity back")
+
+	for _, cmd := range []*cobra.Command{channelOpenCmd, channelPayCmd, channelCloseCmd, channelRefundCmd, channelStatusCmd} {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		channelCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(channelCmd)
+}
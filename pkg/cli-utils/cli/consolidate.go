@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/kon-pap/noobcash/pkg/node"
+	"github.com/spf13/cobra"
+)
+
+var consolidateCmd = &cobra.Command{
+	Use:   "consolidate",
+	Short: "Merge small UTXOs of your wallet",
+	Long:  `Merge up to max-inputs UTXOs of your wallet below threshold into one, with a payment to yourself.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ip, port, err := getAddress(cmd)
+		if err != nil {
+			return err
+		}
+		maxInputs, err := cmd.Flags().GetInt("max-inputs")
+		if err != nil {
+			return err
+		}
+		threshold, err := cmd.Flags().GetInt("threshold")
+		if err != nil {
+			return err
+		}
+		query, err := getAccountQuery(cmd)
+		if err != nil {
+			return err
+		}
+		requestJson, err := json.Marshal(map[string]int{
+			"maxInputs": maxInputs,
+			"threshold": threshold,
+		})
+		if err != nil {
+			return err
+		}
+		body, err := node.GetResponseBody(
+			http.Post(fmt.Sprintf("http://%s:%d/consolidate?%s", ip, port, query.Encode()), "application/json", bytes.NewBuffer(requestJson)),
+		)
+		if err != nil {
+			return err
+		}
+		var reply struct {
+			TxId        string `json:"txId"`
+			Inputs      int    `json:"inputs"`
+			Amount      int    `json:"amount"`
+			UtxosBefore int    `json:"utxosBefore"`
+			UtxosAfter  int    `json:"utxosAfter"`
+			Reduction   int    `json:"reduction"`
+		}
+		if err := json.Unmarshal([]byte(body), &reply); err != nil {
+			return err
+		}
+		fmt.Printf("Submitted consolidation %s\n", reply.TxId)
+		fmt.Printf("Merged %d UTXOs worth %d\n", reply.Inputs, reply.Amount)
+		fmt.Printf("UTXO count: %d -> %d (reduced by %d once confirmed)\n", reply.UtxosBefore, reply.UtxosAfter, reply.Reduction)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(consolidateCmd)
+
+	consolidateCmd.PersistentFlags().IntP("max-inputs", "m", 50, "max number of UTXOs to merge")
+	consolidateCmd.PersistentFlags().IntP("threshold", "t", 10, "only merge UTXOs below this amount (0 for any amount)")
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kon-pap/noobcash/pkg/node"
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "View the transaction history of your wallet",
+	Long: `View every confirmed and pending transaction touching your wallet, newest first.
+Times can be given in RFC3339 or as unix seconds.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ip, port, err := getAddress(cmd)
+		if err != nil {
+			return err
+		}
+		query, err := getAccountQuery(cmd)
+		if err != nil {
+			return err
+		}
+		for flag, param := range map[string]string{
+			"since":       "since",
+			"until":       "until",
+			"from-height": "fromHeight",
+			"to-height":   "toHeight",
+			"offset":      "offset",
+			"limit":       "limit",
+		} {
+			if cmd.Flags().Changed(flag) {
+				query.Set(param, cmd.Flags().Lookup(flag).Value.String())
+			}
+		}
+		body, err := node.GetResponseBody(
+			http.DefaultClient.Get(fmt.Sprintf("http://%s:%d/wallet/history?%s", ip, port, query.Encode())),
+		)
+		if err != nil {
+			return err
+		}
+		var page struct {
+			Address   string               `json:"address"`
+			WatchOnly bool                 `json:"watchOnly"`
+			Total     int                  `json:"total"`
+			Offset    int                  `json:"offset"`
+			Entries   []*node.HistoryEntry `json:"entries"`
+		}
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			return err
+		}
+		if page.WatchOnly {
+			page.Address += " (watch-only)"
+		}
+		if len(page.Entries) == 0 {
+			fmt.Printf("No transactions found out of %d of %s\n", page.Total, page.Address)
+			return nil
+		}
+		printHistory(page.Entries)
+		fmt.Printf("Showing %d-%d of %d transaction(s) of %s\n",
+			page.Offset+1, page.Offset+len(page.Entries), page.Total, page.Address)
+		return nil
+	},
+}
+
+func printHistory(entries []*node.HistoryEntry) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tHEIGHT\tSTATUS\tDIRECTION\tAMOUNT\tFEE\tCOUNTERPARTY\tTX\tMEMO")
+	for _, e := range entries {
+		height := "-"
+		if e.BlockHeight >= 0 {
+			height = strconv.Itoa(e.BlockHeight)
+		}
+		counterparty := "-"
+		if len(e.Counterparties) > 0 {
+			c := e.Counterparties[0]
+			counterparty = c.Address.Short()
+			if c.NodeId >= 0 {
+				counterparty = fmt.Sprintf("node %d", c.NodeId)
+			}
+			if len(e.Counterparties) > 1 {
+				counterparty += fmt.Sprintf(" (+%d)", len(e.Counterparties)-1)
+			}
+		}
+		memo := "-"
+		if e.Memo != "" {
+			memo = strconv.Quote(e.Memo)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\n",
+			e.Timestamp.Format(time.RFC3339), height, e.Status, e.Direction, e.Amount, e.Fee, counterparty, e.TxId[:16], memo)
+	}
+	tw.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.PersistentFlags().String("since", "", "only show transactions after this time")
+	historyCmd.PersistentFlags().String("until", "", "only show transactions before this time")
+	historyCmd.PersistentFlags().Int("from-height", 0, "only show transactions confirmed at or above this height")
+	historyCmd.PersistentFlags().Int("to-height", 0, "only show transactions confirmed at or below this height")
+	historyCmd.PersistentFlags().Int("offset", 0, "number of transactions to skip")
+	historyCmd.PersistentFlags().Int("limit", 50, "max number of transactions to show")
+}
@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kon-pap/noobcash/pkg/node"
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+	"github.com/spf13/cobra"
+)
+
+var invoiceCmd = &cobra.Command{
+	Use:   "invoice",
+	Short: "Request payments with invoices",
+	Long: `Request payments with invoices, settled automatically by the node once
+a block paying them is applied:
+
+  invoice create 100 --expires 30m --description "2 coffees"
+  invoice pay noobcash:<address>?amount=100&expiry=...&id=...
+  invoice status <id>`,
+}
+
+var invoiceCreateCmd = &cobra.Command{
+	Use:   "create <amount>",
+	Short: "Create an invoice to share with the payer",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("invalid number of arguments. expected 1, got %d", len(args))
+		}
+		amount, err := strconv.Atoi(args[0])
+		if err != nil {
+			return err
+		}
+		expires, err := cmd.Flags().GetDuration("expires")
+		if err != nil {
+			return err
+		}
+		description, err := cmd.Flags().GetString("description")
+		if err != nil {
+			return err
+		}
+		ip, port, err := getAddress(cmd)
+		if err != nil {
+			return err
+		}
+		query, err := getAccountQuery(cmd)
+		if err != nil {
+			return err
+		}
+		requestJson, err := json.Marshal(map[string]interface{}{
+			"amount":      amount,
+			"expiresIn":   expires.String(),
+			"description": description,
+		})
+		if err != nil {
+			return err
+		}
+		body, err := node.GetResponseBody(
+			http.Post(fmt.Sprintf("http://%s:%d/invoices?%s", ip, port, query.Encode()), "application/json", bytes.NewBuffer(requestJson)),
+		)
+		if err != nil {
+			return err
+		}
+		var entry invoiceReply
+		if err := json.Unmarshal([]byte(body), &entry); err != nil {
+			return err
+		}
+		if asJson, _ := cmd.Flags().GetBool("json"); asJson {
+			b, err := json.MarshalIndent(entry.Invoice, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+			return nil
+		}
+		fmt.Printf("Created invoice %s for %d to %s, expiring at %s\n", entry.Invoice.Id, entry.Invoice.Amount, entry.Invoice.Address, entry.Invoice.Expiry.Format(time.RFC3339))
+		fmt.Println(entry.Encoded)
+		return nil
+	},
+}
+
+var invoicePayCmd = &cobra.Command{
+	Use:   "pay <invoice>",
+	Short: "Pay an invoice, given in its shareable form or as JSON",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("invalid number of arguments. expected 1, got %d", len(args))
+		}
+		invoice, err := backend.ParseInvoice(args[0])
+		if err != nil {
+			return err
+		}
+		if invoice.IsExpired(time.Now()) {
+			return fmt.Errorf("invoice %s expired at %s", invoice.Id, invoice.Expiry.Format(time.RFC3339))
+		}
+		ip, port, err := getAddress(cmd)
+		if err != nil {
+			return err
+		}
+		opts, err := getSubmitOptions(cmd)
+		if err != nil {
+			return err
+		}
+		query, err := getAccountQuery(cmd)
+		if err != nil {
+			return err
+		}
+		submit := createSubmitter(ip, port, query, opts)
+		reply, err := submit(string(invoice.Address), strconv.Itoa(invoice.Amount))
+		if err != nil {
+			return err
+		}
+		fmt.Println(reply)
+		return nil
+	},
+}
+
+var invoiceStatusCmd = &cobra.Command{
+	Use:   "status [id]",
+	Short: "View the status of an invoice, or list the invoices of the account",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return fmt.Errorf("invalid number of arguments. expected at most 1, got %d", len(args))
+		}
+		ip, port, err := getAddress(cmd)
+		if err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			body, err := node.GetResponseBody(
+				http.DefaultClient.Get(fmt.Sprintf("http://%s:%d/invoices/%s", ip, port, args[0])),
+			)
+			if err != nil {
+				return err
+			}
+			var entry invoiceReply
+			if err := json.Unmarshal([]byte(body), &entry); err != nil {
+				return err
+			}
+			fmt.Println(entry)
+			for _, payment := range entry.Payments {
+				fmt.Printf("  %d paid by %s in block %d\n", payment.Amount, payment.TxId, payment.BlockHeight)
+			}
+			return nil
+		}
+		query, err := getAccountQuery(cmd)
+		if err != nil {
+			return err
+		}
+		body, err := node.GetResponseBody(
+			http.DefaultClient.Get(fmt.Sprintf("http://%s:%d/invoices?%s", ip, port, query.Encode())),
+		)
+		if err != nil {
+			return err
+		}
+		var entries []invoiceReply
+		if err := json.Unmarshal([]byte(body), &entries); err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSTATUS\tRECEIVED\tAMOUNT\tEXPIRY\tDESCRIPTION")
+		for _, entry := range entries {
+			description := entry.Invoice.Description
+			if description == "" {
+				description = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n", entry.Invoice.Id, entry.Status, entry.Received, entry.Invoice.Amount, entry.Invoice.Expiry.Format(time.RFC3339), description)
+		}
+		return w.Flush()
+	},
+}
+
+type invoiceReply struct {
+	Invoice  backend.Invoice       `json:"invoice"`
+	Encoded  string                `json:"encoded"`
+	Status   string                `json:"status"`
+	Received int                   `json:"received"`
+	Payments []node.InvoicePayment `json:"payments"`
+}
+
+func (e invoiceReply) String() string {
+	return fmt.Sprintf("Invoice %s is %s, received %d of %d", e.Invoice.Id, e.Status, e.Received, e.Invoice.Amount)
+}
+
+func init() {
+	invoiceCreateCmd.Flags().Duration("expires", time.Hour, "how long the invoice can be paid for")
+	invoiceCreateCmd.Flags().String("description", "", "what the payment is for")
+	invoiceCreateCmd.Flags().Bool("json", false, "print the invoice as JSON instead of its shareable form")
+	addSubmitFlags(invoicePayCmd)
+
+	for _, cmd := range []*cobra.Command{invoiceCreateCmd, invoicePayCmd, invoiceStatusCmd} {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		invoiceCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(invoiceCmd)
+}
@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+	"github.com/spf13/cobra"
+)
+
+var jointCmd = &cobra.Command{
+	Use:   "joint",
+	Short: "Pay with the coins of several owners in one transaction",
+	Long: `Build a transaction spending the coins of several owners, e.g. a coinjoin.
+Every input is signed by its own owner, so the transaction is passed around
+until all of them signed their inputs, then submitted:
+
+  joint create --from <alice_address>=60 --from <bob_address>=40 --pay <carol_address>=100 -o tx.json
+  joint sign tx.json --key alice.pem
+  joint sign tx.json --key bob.pem
+  submit-raw tx.json`,
+}
+
+var jointCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an unsigned transaction spending the coins of several owners",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return fmt.Errorf("invalid number of arguments. expected 0, got %d", len(args))
+		}
+		from, err := cmd.Flags().GetStringArray("from")
+		if err != nil {
+			return err
+		}
+		pay, err := cmd.Flags().GetStringArray("pay")
+		if err != nil {
+			return err
+		}
+		var contributions []*backend.Contribution
+		for _, share := range from {
+			owner, amount, err := parseAddressAmount(share)
+			if err != nil {
+				return fmt.Errorf("invalid --from %s: %s", share, err)
+			}
+			utxos, err := getSignerUtxos(cmd, owner)
+			if err != nil {
+				return err
+			}
+			contributions = append(contributions, &backend.Contribution{Owner: owner, Utxos: utxos, Amount: amount})
+		}
+		lockUntil, err := getLockTimeFlag(cmd, "lock-until")
+		if err != nil {
+			return err
+		}
+		var targets []*backend.TxTargetTy
+		for _, payment := range pay {
+			address, amount, err := parseAddressAmount(payment)
+			if err != nil {
+				return fmt.Errorf("invalid --pay %s: %s", payment, err)
+			}
+			targets = append(targets, &backend.TxTargetTy{Address: address, Amount: amount, LockTime: lockUntil})
+		}
+		opts, err := getTxOptions(cmd)
+		if err != nil {
+			return err
+		}
+		tx, err := backend.BuildJointTx(contributions, opts, targets...)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created transaction %s spending %d input(s) of %d owner(s)\n", backend.HexEncodeByteSlice(tx.Id), len(tx.Inputs), len(tx.Owners()))
+		out, _ := cmd.Flags().GetString("out")
+		return writeTxFile(out, tx)
+	},
+}
+
+var jointSignCmd = &cobra.Command{
+	Use:   "sign <tx.json>",
+	Short: "Sign your inputs of a transaction spending the coins of several owners",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("invalid number of arguments. expected 1, got %d", len(args))
+		}
+		txJson, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		var tx backend.Transaction
+		if err := json.Unmarshal(txJson, &tx); err != nil {
+			return fmt.Errorf("invalid transaction file: %s", err)
+		}
+		if !tx.SignsPerInput() {
+			return fmt.Errorf("transaction is signed as a whole by %s, use 'sign' instead", tx.Sender())
+		}
+		key, err := readPrivKeyFlag(cmd)
+		if err != nil {
+			return err
+		}
+		signed, err := tx.SignInputsWithKey(key)
+		if err != nil {
+			return err
+		}
+		unsigned := tx.UnsignedInputs()
+		fmt.Printf("Signed %d input(s), %d more input(s) to sign\n", signed, len(unsigned))
+		if len(unsigned) == 0 {
+			if err := tx.VerifySignatures(); err != nil {
+				return err
+			}
+			fmt.Println("Every input is signed, submit it with 'submit-raw'")
+		}
+		out, _ := cmd.Flags().GetString("out")
+		if out == "" {
+			out = args[0]
+		}
+		return writeTxFile(out, &tx)
+	},
+}
+
+// Parses <address>=<amount>
+func parseAddressAmount(s string) (backend.Address, int, error) {
+	i := strings.LastIndex(s, "=")
+	if i < 0 {
+		return "", 0, fmt.Errorf("expected <address>=<amount>")
+	}
+	address, err := backend.ParseAddress(s[:i])
+	if err != nil {
+		return "", 0, err
+	}
+	amount, err := strconv.Atoi(s[i+1:])
+	if err != nil {
+		return "", 0, err
+	}
+	return address, amount, nil
+}
+
+// Writes the transaction to path, or to stdout if path is empty
+func writeTxFile(path string, tx *backend.Transaction) error {
+	b, err := json.MarshalIndent(tx, "", "  ")
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		fmt.Println(string(b))
+		return nil
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+func init() {
+	jointCreateCmd.Flags().StringArray("from", nil, "<address>=<amount> paid from the coins of address, its change going back to it")
+	jointCreateCmd.Flags().StringArray("pay", nil, "<address>=<amount> paid to address")
+	jointCreateCmd.Flags().StringP("out", "o", "", "write the transaction to this file instead of stdout")
+	addSubmitFlags(jointCreateCmd)
+	jointSignCmd.Flags().StringP("key", "k", "", "unencrypted PEM private key of an owner of inputs")
+	jointSignCmd.Flags().StringP("out", "o", "", "write the signed transaction to this file instead of updating it in place")
+
+	for _, cmd := range []*cobra.Command{jointCreateCmd, jointSignCmd} {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		jointCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(jointCmd)
+}
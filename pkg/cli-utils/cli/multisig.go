@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+	"github.com/spf13/cobra"
+)
+
+var multisigCmd = &cobra.Command{
+	Use:   "multisig <m> <key.pem>...",
+	Short: "Create an m-of-n multisig policy and print its address",
+	Long: `Create a policy spendable with the signatures of any m of the given keys.
+The keys can be given as public or private PEM key files, only their public
+part is used. Coins paid to the printed address are spent with 'psbt'.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return fmt.Errorf("invalid number of arguments. expected at least 2, got %d", len(args))
+		}
+		m, err := strconv.Atoi(args[0])
+		if err != nil {
+			return err
+		}
+		keys := make([]backend.PublicKey, 0, len(args)-1)
+		for _, keyFile := range args[1:] {
+			key, err := readPubKeyFile(keyFile)
+			if err != nil {
+				return fmt.Errorf("%s: %s", keyFile, err)
+			}
+			keys = append(keys, key)
+		}
+		policy, err := backend.NewMultisigKey(m, keys)
+		if err != nil {
+			return err
+		}
+		policyPem := backend.PubKeyToPem(policy)
+		if out, _ := cmd.Flags().GetString("out"); out != "" {
+			if err := ioutil.WriteFile(out, []byte(policyPem), 0644); err != nil {
+				return err
+			}
+			fmt.Printf("Wrote the %d-of-%d policy to %s\n", policy.M, len(policy.Keys), out)
+		} else {
+			fmt.Print(policyPem)
+		}
+		fmt.Println("Address:", backend.AddressFromPubKey(policy))
+		return nil
+	},
+}
+
+// Reads a public key from a PEM file holding either the public or the private key
+func readPubKeyFile(path string) (backend.PublicKey, error) {
+	pemBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if pubKey, err := backend.ParsePubKeyPem(string(pemBytes)); err == nil && pubKey != nil {
+		return pubKey, nil
+	}
+	privKey, err := backend.ParsePrivKeyPem(string(pemBytes))
+	if err != nil {
+		return nil, fmt.Errorf("expected a PEM public or private key")
+	}
+	return privKey.Public(), nil
+}
+
+func init() {
+	rootCmd.AddCommand(multisigCmd)
+
+	multisigCmd.PersistentFlags().StringP("out", "o", "", "write the policy to this file instead of stdout")
+}
@@ -0,0 +1,243 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+	"github.com/spf13/cobra"
+)
+
+var psbtCmd = &cobra.Command{
+	Use:   "psbt",
+	Short: "Spend multisig coins with partially signed transactions",
+	Long: `Spend coins of a multisig policy with a partially signed transaction.
+One co-signer creates the transaction, every co-signer signs their copy, the
+copies are combined and the transaction is finalized once it has enough
+signatures:
+
+  psbt create policy.pem <recipient_address> <amount> -o tx.psbt
+  psbt sign tx.psbt --key alice.pem
+  psbt combine tx.psbt bob.psbt -o tx.psbt
+  psbt finalize tx.psbt`,
+}
+
+var psbtCreateCmd = &cobra.Command{
+	Use:   "create <policy.pem> <recipient_address> <amount>",
+	Short: "Create an unsigned transaction spending coins of a multisig policy",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 3 {
+			return fmt.Errorf("invalid number of arguments. expected 3, got %d", len(args))
+		}
+		policy, err := readPubKeyFile(args[0])
+		if err != nil {
+			return err
+		}
+		if policy.Type() != backend.KeyMultisig {
+			return fmt.Errorf("%s is not a multisig policy", args[0])
+		}
+		recipient, err := backend.ParseAddress(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid recipient address: %s", err)
+		}
+		amount, err := strconv.Atoi(args[2])
+		if err != nil {
+			return err
+		}
+		utxos, err := getSignerUtxos(cmd, backend.AddressFromPubKey(policy))
+		if err != nil {
+			return err
+		}
+		opts, err := getTxOptions(cmd)
+		if err != nil {
+			return err
+		}
+		lockUntil, err := getLockTimeFlag(cmd, "lock-until")
+		if err != nil {
+			return err
+		}
+		tx, selection, err := backend.BuildTx(policy, utxos, opts, &backend.TxTargetTy{
+			Address:  recipient,
+			Amount:   amount,
+			LockTime: lockUntil,
+		})
+		if err != nil {
+			return err
+		}
+		partial, err := backend.NewPartialTx(tx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created transaction %s to %s for %d (%s)\n", backend.HexEncodeByteSlice(tx.Id), recipient, amount, selection)
+		out, _ := cmd.Flags().GetString("out")
+		return writePartialTx(out, partial)
+	},
+}
+
+var psbtSignCmd = &cobra.Command{
+	Use:   "sign <tx.psbt>",
+	Short: "Add your signature to a partially signed transaction",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("invalid number of arguments. expected 1, got %d", len(args))
+		}
+		partial, err := readPartialTx(args[0])
+		if err != nil {
+			return err
+		}
+		key, err := readPrivKeyFlag(cmd)
+		if err != nil {
+			return err
+		}
+		if err := partial.Sign(key); err != nil {
+			return err
+		}
+		fmt.Printf("Signed, %d more signature(s) needed\n", partial.Missing())
+		out, _ := cmd.Flags().GetString("out")
+		if out == "" {
+			out = args[0]
+		}
+		return writePartialTx(out, partial)
+	},
+}
+
+var psbtCombineCmd = &cobra.Command{
+	Use:   "combine <tx.psbt>...",
+	Short: "Merge the signatures of copies of the same partially signed transaction",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return fmt.Errorf("invalid number of arguments. expected at least 2, got %d", len(args))
+		}
+		combined, err := readPartialTx(args[0])
+		if err != nil {
+			return err
+		}
+		for _, path := range args[1:] {
+			partial, err := readPartialTx(path)
+			if err != nil {
+				return err
+			}
+			if err := combined.Combine(partial); err != nil {
+				return fmt.Errorf("%s: %s", path, err)
+			}
+		}
+		fmt.Printf("Combined %d signature(s), %d more needed\n", len(combined.Signatures), combined.Missing())
+		out, _ := cmd.Flags().GetString("out")
+		return writePartialTx(out, combined)
+	},
+}
+
+var psbtInspectCmd = &cobra.Command{
+	Use:   "inspect <tx.psbt>",
+	Short: "Show a partially signed transaction and who signed it",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("invalid number of arguments. expected 1, got %d", len(args))
+		}
+		partial, err := readPartialTx(args[0])
+		if err != nil {
+			return err
+		}
+		policy := partial.Policy()
+		fmt.Printf("Transaction %s\n", backend.HexEncodeByteSlice(partial.Tx.Id))
+		fmt.Printf("From %s (%d-of-%d) spending %d input(s)\n", partial.Tx.Sender(), policy.M, len(policy.Keys), len(partial.Tx.Inputs))
+		if partial.Tx.LockTime > 0 {
+			fmt.Printf("Not valid before %s\n", backend.FormatLockTime(partial.Tx.LockTime))
+		}
+		for _, txOut := range partial.Tx.Outputs {
+			if txOut.LockTime > 0 {
+				fmt.Printf("  %d to %s, locked until %s\n", txOut.Amount, txOut.OwnerAddress(), backend.FormatLockTime(txOut.LockTime))
+				continue
+			}
+			fmt.Printf("  %d to %s\n", txOut.Amount, txOut.OwnerAddress())
+		}
+		for i, key := range policy.Keys {
+			status := "missing"
+			if _, ok := partial.Signatures[i]; ok {
+				status = "signed"
+			}
+			fmt.Printf("Key %d %s: %s\n", i, backend.AddressFromPubKey(key), status)
+		}
+		fmt.Printf("%d more signature(s) needed\n", partial.Missing())
+		return nil
+	},
+}
+
+var psbtFinalizeCmd = &cobra.Command{
+	Use:   "finalize <tx.psbt>",
+	Short: "Finalize a transaction with enough signatures and submit it",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("invalid number of arguments. expected 1, got %d", len(args))
+		}
+		partial, err := readPartialTx(args[0])
+		if err != nil {
+			return err
+		}
+		tx, err := partial.Finalize()
+		if err != nil {
+			return err
+		}
+		txJson, err := json.Marshal(tx)
+		if err != nil {
+			return err
+		}
+		if out, _ := cmd.Flags().GetString("out"); out != "" {
+			if err := ioutil.WriteFile(out, txJson, 0644); err != nil {
+				return err
+			}
+			fmt.Printf("Wrote the signed transaction to %s, submit it with 'submit-raw'\n", out)
+			return nil
+		}
+		reply, err := submitRawTx(cmd, txJson)
+		if err != nil {
+			return err
+		}
+		fmt.Println(reply)
+		return nil
+	},
+}
+
+func readPartialTx(path string) (*backend.PartialTx, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var partial backend.PartialTx
+	if err := json.Unmarshal(b, &partial); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return &partial, nil
+}
+
+// Writes the partial transaction to path, or to stdout if path is empty
+func writePartialTx(path string, partial *backend.PartialTx) error {
+	b, err := json.MarshalIndent(partial, "", "  ")
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		fmt.Println(string(b))
+		return nil
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+func init() {
+	psbtCreateCmd.Flags().String("utxos", "", "read the UTXOs of the policy from this file instead of the node")
+	psbtCreateCmd.Flags().StringP("out", "o", "", "write the transaction to this file instead of stdout")
+	addSubmitFlags(psbtCreateCmd)
+	psbtSignCmd.Flags().StringP("key", "k", "", "unencrypted PEM private key of a co-signer")
+	psbtSignCmd.Flags().StringP("out", "o", "", "write the signed transaction to this file instead of updating it in place")
+	psbtCombineCmd.Flags().StringP("out", "o", "", "write the combined transaction to this file instead of stdout")
+	psbtFinalizeCmd.Flags().StringP("out", "o", "", "write the finalized transaction to this file instead of submitting it")
+
+	for _, cmd := range []*cobra.Command{psbtCreateCmd, psbtSignCmd, psbtCombineCmd, psbtInspectCmd, psbtFinalizeCmd} {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		psbtCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(psbtCmd)
+}
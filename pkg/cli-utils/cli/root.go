@@ -2,6 +2,7 @@ package cli
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -30,6 +31,16 @@ func getAddress(cmd *cobra.Command) (ip string, port int, err error) {
 	return
 }
 
+// Returns the query selecting the account given by --account, empty for the default one
+func getAccountQuery(cmd *cobra.Command) (url.Values, error) {
+	query := url.Values{}
+	account, err := cmd.Flags().GetString("account")
+	if account != "" {
+		query.Set("account", account)
+	}
+	return query, err
+}
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -41,6 +52,7 @@ func init() {
 	// persistent global app flags here
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 	rootCmd.PersistentFlags().StringP("address", "a", "localhost:9090", "server address of noobcash node api to query")
+	rootCmd.PersistentFlags().String("account", "", "named account of the node to act on (default: the node wallet)")
 
 	balanceCmd.SilenceUsage = true
 	submitCmd.SilenceUsage = true
@@ -48,6 +60,15 @@ func init() {
 	submitManyCmd.SilenceUsage = true
 	utxosCmd.SilenceUsage = true
 	statsCmd.SilenceUsage = true
+	consolidateCmd.SilenceUsage = true
+	txCmd.SilenceUsage = true
+	historyCmd.SilenceUsage = true
+	addressesCmd.SilenceUsage = true
+	accountsCmd.SilenceUsage = true
+	watchCmd.SilenceUsage = true
+	signCmd.SilenceUsage = true
+	submitRawCmd.SilenceUsage = true
+	multisigCmd.SilenceUsage = true
 
 	balanceCmd.SilenceErrors = true
 	submitCmd.SilenceErrors = true
@@ -55,4 +76,13 @@ func init() {
 	submitManyCmd.SilenceErrors = true
 	utxosCmd.SilenceErrors = true
 	statsCmd.SilenceErrors = true
+	consolidateCmd.SilenceErrors = true
+	txCmd.SilenceErrors = true
+	historyCmd.SilenceErrors = true
+	addressesCmd.SilenceErrors = true
+	accountsCmd.SilenceErrors = true
+	watchCmd.SilenceErrors = true
+	signCmd.SilenceErrors = true
+	submitRawCmd.SilenceErrors = true
+	multisigCmd.SilenceErrors = true
 }
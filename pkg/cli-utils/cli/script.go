@@ -0,0 +1,224 @@
+package cli
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+	"github.com/kon-pap/noobcash/pkg/node/script"
+	"github.com/spf13/cobra"
+)
+
+var scriptCmd = &cobra.Command{
+	Use:   "script",
+	Short: "Lock coins to custom spending conditions",
+	Long: `Lock coins to a script, and spend them with unlocking scripts.
+Scripts are written as opcodes (OP_CHECKSIG), hex data (0x2a) and numbers (42).
+Keys are written as KEY(key.pem), their hashes as KEYHASH(key.pem), and in
+unlocking scripts signatures of the spending transaction as SIG(key.pem):
+
+  script compile "OP_DUP OP_KEYHASH KEYHASH(bob.pem) OP_EQUALVERIFY OP_CHECKSIG" -o lock.pem
+  t <address of the script> 100
+  script spend lock.pem <recipient_address> 100 --unlock "SIG(bob.pem) KEY(bob.pem)"
+
+Opcodes: ` + opcodeList(),
+}
+
+var scriptCompileCmd = &cobra.Command{
+	Use:   "compile <script>",
+	Short: "Compile a locking script and print its address",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("invalid number of arguments. expected 1, got %d", len(args))
+		}
+		lock, err := assembleScript(args[0], nil)
+		if err != nil {
+			return err
+		}
+		key, err := backend.NewScriptKey(lock)
+		if err != nil {
+			return err
+		}
+		keyPem := backend.PubKeyToPem(key)
+		if out, _ := cmd.Flags().GetString("out"); out != "" {
+			if err := ioutil.WriteFile(out, []byte(keyPem), 0644); err != nil {
+				return err
+			}
+			fmt.Println("Wrote the locking script to", out)
+		} else {
+			fmt.Print(keyPem)
+		}
+		asm, _ := script.Disassemble(lock)
+		fmt.Println("Script:", asm)
+		fmt.Println("Address:", backend.AddressFromPubKey(key))
+		return nil
+	},
+}
+
+var scriptSpendCmd = &cobra.Command{
+	Use:   "spend <lock.pem> <recipient_address> <amount>",
+	Short: "Spend coins locked to a script",
+	Long: `Spend coins locked to a script, unlocking every input with --unlock.
+The change is locked to the same script.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 3 {
+			return fmt.Errorf("invalid number of arguments. expected 3, got %d", len(args))
+		}
+		key, err := readPubKeyFile(args[0])
+		if err != nil {
+			return fmt.Errorf("%s: %s", args[0], err)
+		}
+		lock, ok := key.(*backend.ScriptKey)
+		if !ok {
+			return fmt.Errorf("%s is not a locking script", args[0])
+		}
+		recipient, err := backend.ParseAddress(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid recipient address: %s", err)
+		}
+		amount, err := strconv.Atoi(args[2])
+		if err != nil {
+			return err
+		}
+		unlockAsm, err := cmd.Flags().GetString("unlock")
+		if err != nil {
+			return err
+		}
+		utxos, err := getSignerUtxos(cmd, backend.AddressFromPubKey(lock))
+		if err != nil {
+			return err
+		}
+		opts, err := getTxOptions(cmd)
+		if err != nil {
+			return err
+		}
+		lockUntil, err := getLockTimeFlag(cmd, "lock-until")
+		if err != nil {
+			return err
+		}
+		// inputs locked to a script are unlocked one by one
+		contribution := &backend.Contribution{
+			Owner:  backend.AddressFromPubKey(lock),
+			Utxos:  utxos,
+			Amount: amount,
+		}
+		tx, err := backend.BuildJointTx([]*backend.Contribution{contribution}, opts, &backend.TxTargetTy{
+			Address:  recipient,
+			Amount:   amount,
+			LockTime: lockUntil,
+		})
+		if err != nil {
+			return err
+		}
+		// the signatures are over the signing hash, so the same unlocking script fits every input
+		unlock, err := assembleScript(unlockAsm, tx.SigningHash())
+		if err != nil {
+			return err
+		}
+		for id := range tx.Inputs {
+			if err := tx.UnlockInput(id, lock, unlock); err != nil {
+				return err
+			}
+		}
+		if err := tx.VerifySignatures(); err != nil {
+			return err
+		}
+		fmt.Printf("Unlocked transaction %s to %s for %d with %d input(s)\n", backend.HexEncodeByteSlice(tx.Id), recipient, amount, len(tx.Inputs))
+		txJson, err := json.Marshal(tx)
+		if err != nil {
+			return err
+		}
+		if out, _ := cmd.Flags().GetString("out"); out != "" {
+			if err := ioutil.WriteFile(out, txJson, 0644); err != nil {
+				return err
+			}
+			fmt.Printf("Wrote the unlocked transaction to %s, submit it with 'submit-raw'\n", out)
+			return nil
+		}
+		reply, err := submitRawTx(cmd, txJson)
+		if err != nil {
+			return err
+		}
+		fmt.Println(reply)
+		return nil
+	},
+}
+
+// Compiles a script, replacing KEY(), KEYHASH() and SIG() with the keys,
+// hashes and signatures they refer to. Signatures are only allowed if
+// signingHash is given.
+func assembleScript(asm string, signingHash []byte) ([]byte, error) {
+	tokens := strings.Fields(asm)
+	for i, token := range tokens {
+		open := strings.Index(token, "(")
+		if open < 0 || !strings.HasSuffix(token, ")") {
+			continue
+		}
+		function, path := strings.ToUpper(token[:open]), token[open+1:len(token)-1]
+		var data []byte
+		switch function {
+		case "KEY", "KEYHASH":
+			key, err := readPubKeyFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", path, err)
+			}
+			if !key.Type().IsSingle() {
+				return nil, fmt.Errorf("%s: expected a single key, got a %s key", path, key.Type())
+			}
+			data = backend.EncodeTypedKey(key)
+			if function == "KEYHASH" {
+				data = script.KeyHash(data)
+			}
+		case "SIG":
+			if signingHash == nil {
+				return nil, fmt.Errorf("%s can only be used in unlocking scripts", token)
+			}
+			pemBytes, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			key, err := backend.ParsePrivKeyPem(string(pemBytes))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", path, err)
+			}
+			if data, err = key.Sign(signingHash); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unknown function %s", token)
+		}
+		tokens[i] = "0x" + hex.EncodeToString(data)
+	}
+	return script.Assemble(strings.Join(tokens, " "))
+}
+
+func opcodeList() string {
+	var names []string
+	for op := 0; op <= 0xff; op++ {
+		name := script.Opcode(op).String()
+		if strings.HasPrefix(name, "OP_UNKNOWN") || strings.HasPrefix(name, "OP_PUSHDATA") {
+			continue
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, " ")
+}
+
+func init() {
+	scriptCompileCmd.Flags().StringP("out", "o", "", "write the locking script to this file instead of stdout")
+	scriptSpendCmd.Flags().String("unlock", "", "unlocking script of the inputs")
+	scriptSpendCmd.Flags().String("utxos", "", "read the UTXOs of the script from this file instead of the node")
+	scriptSpendCmd.Flags().StringP("out", "o", "", "write the unlocked transaction to this file instead of submitting it")
+	addSubmitFlags(scriptSpendCmd)
+
+	for _, cmd := range []*cobra.Command{scriptCompileCmd, scriptSpendCmd} {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		scriptCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(scriptCmd)
+}
@@ -0,0 +1,194 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/kon-pap/noobcash/pkg/node"
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+	"github.com/spf13/cobra"
+)
+
+var signCmd = &cobra.Command{
+	Use:   "sign <recipient_address> <amount>",
+	Short: "Build and sign a transaction locally with a key file",
+	Long: `Build and sign a transaction locally with an unencrypted PEM key file, so
+that the key never touches the node. The signed transaction is submitted right
+away, unless --out is given.
+The UTXOs of the key are fetched from the node, or read from --utxos on a machine
+without network access (see 'utxos --raw').`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("invalid number of arguments. expected 2, got %d", len(args))
+		}
+		recipient, err := backend.ParseAddress(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid recipient address: %s", err)
+		}
+		amount, err := strconv.Atoi(args[1])
+		if err != nil {
+			return err
+		}
+		key, err := readPrivKeyFlag(cmd)
+		if err != nil {
+			return err
+		}
+		utxos, err := getSignerUtxos(cmd, backend.AddressFromPubKey(key.Public()))
+		if err != nil {
+			return err
+		}
+		opts, err := getTxOptions(cmd)
+		if err != nil {
+			return err
+		}
+		lockUntil, err := getLockTimeFlag(cmd, "lock-until")
+		if err != nil {
+			return err
+		}
+		tx, selection, err := backend.BuildTx(key.Public(), utxos, opts, &backend.TxTargetTy{
+			Address:  recipient,
+			Amount:   amount,
+			LockTime: lockUntil,
+		})
+		if err != nil {
+			return err
+		}
+		if err := backend.SignTxWithKey(tx, key); err != nil {
+			return err
+		}
+		fmt.Printf("Signed transaction %s to %s for %d (%s)\n", backend.HexEncodeByteSlice(tx.Id), recipient, amount, selection)
+		txJson, err := json.Marshal(tx)
+		if err != nil {
+			return err
+		}
+		if out, _ := cmd.Flags().GetString("out"); out != "" {
+			if err := ioutil.WriteFile(out, txJson, 0644); err != nil {
+				return err
+			}
+			fmt.Printf("Wrote the signed transaction to %s, submit it with 'submit-raw'\n", out)
+			return nil
+		}
+		reply, err := submitRawTx(cmd, txJson)
+		if err != nil {
+			return err
+		}
+		fmt.Println(reply)
+		return nil
+	},
+}
+
+// Reads the unencrypted PEM private key file given by --key
+func readPrivKeyFlag(cmd *cobra.Command) (backend.PrivateKey, error) {
+	keyFile, err := cmd.Flags().GetString("key")
+	if err != nil {
+		return nil, err
+	}
+	if keyFile == "" {
+		return nil, fmt.Errorf("no key file given, set --key")
+	}
+	pemBytes, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return backend.ParsePrivKeyPem(string(pemBytes))
+}
+
+// Reads the utxos of address from the file given by --utxos, or fetches them from the node
+func getSignerUtxos(cmd *cobra.Command, address backend.Address) ([]*backend.TxOut, error) {
+	var body []byte
+	if utxosFile, _ := cmd.Flags().GetString("utxos"); utxosFile != "" {
+		var err error
+		if body, err = ioutil.ReadFile(utxosFile); err != nil {
+			return nil, err
+		}
+	} else {
+		ip, port, err := getAddress(cmd)
+		if err != nil {
+			return nil, err
+		}
+		reply, err := node.GetResponseBody(
+			http.DefaultClient.Get(fmt.Sprintf("http://%s:%d/utxos/%s", ip, port, url.PathEscape(address.String()))),
+		)
+		if err != nil {
+			return nil, err
+		}
+		body = []byte(reply)
+	}
+	var utxos []*backend.TxOut
+	if err := json.Unmarshal(body, &utxos); err != nil {
+		return nil, err
+	}
+	return utxos, nil
+}
+
+// Parses the transaction options set through the submit flags
+func getTxOptions(cmd *cobra.Command) (*backend.TxOptions, error) {
+	opts := &backend.TxOptions{}
+	strategy, err := cmd.Flags().GetString("coin-selection")
+	if err != nil {
+		return nil, err
+	}
+	if opts.CoinSelector, err = backend.GetCoinSelector(strategy); err != nil {
+		return nil, err
+	}
+	split, err := cmd.Flags().GetString("split")
+	if err != nil {
+		return nil, err
+	}
+	if opts.SplitPolicy, err = backend.ParseSplitPolicy(split); err != nil {
+		return nil, err
+	}
+	if opts.LockTime, err = getLockTimeFlag(cmd, "not-before"); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+func submitRawTx(cmd *cobra.Command, txJson []byte) (string, error) {
+	ip, port, err := getAddress(cmd)
+	if err != nil {
+		return "", err
+	}
+	return node.GetResponseBody(
+		http.Post(fmt.Sprintf("http://%s:%d/submit-raw", ip, port), "application/json", bytes.NewBuffer(txJson)),
+	)
+}
+
+var submitRawCmd = &cobra.Command{
+	Use:   "submit-raw <signed_tx.json>",
+	Short: "Submit a transaction signed with 'sign --out'",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("invalid number of arguments. expected 1, got %d", len(args))
+		}
+		txJson, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		var tx backend.Transaction
+		if err := json.Unmarshal(txJson, &tx); err != nil {
+			return fmt.Errorf("invalid transaction file: %s", err)
+		}
+		reply, err := submitRawTx(cmd, txJson)
+		if err != nil {
+			return err
+		}
+		fmt.Println(reply)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(signCmd)
+	rootCmd.AddCommand(submitRawCmd)
+
+	signCmd.PersistentFlags().StringP("key", "k", "", "unencrypted PEM private key of the sender")
+	signCmd.PersistentFlags().String("utxos", "", "read the UTXOs of the key from this file instead of the node")
+	signCmd.PersistentFlags().StringP("out", "o", "", "write the signed transaction to this file instead of submitting it")
+	addSubmitFlags(signCmd)
+}
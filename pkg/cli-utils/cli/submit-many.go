@@ -3,6 +3,7 @@ package cli
 import (
 	"bufio"
 	"fmt"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -34,15 +35,23 @@ var submitManyCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		opts, err := getSubmitOptions(cmd)
+		if err != nil {
+			return err
+		}
+		query, err := getAccountQuery(cmd)
+		if err != nil {
+			return err
+		}
 		var submit func(string, string) (string, error)
 		if waitEnable {
 			timeout, err := cmd.Flags().GetInt("timeout")
 			if err != nil {
 				return err
 			}
-			submit = createInsistSubmitter(ip, port, timeout)
+			submit = createInsistSubmitter(ip, port, timeout, query, opts)
 		} else {
-			submit = createSubmitter(ip, port)
+			submit = createSubmitter(ip, port, query, opts)
 		}
 		for scanner.Scan() {
 			line := scanner.Text()
@@ -60,8 +69,8 @@ var submitManyCmd = &cobra.Command{
 	},
 }
 
-func createInsistSubmitter(ip string, port, timeout int) func(string, string) (string, error) {
-	submit := createSubmitter(ip, port)
+func createInsistSubmitter(ip string, port, timeout int, query url.Values, opts submitOptions) func(string, string) (string, error) {
+	submit := createSubmitter(ip, port, query, opts)
 	return func(recipient, amount string) (reply string, err error) {
 		for reply, err = submit(recipient, amount); err != nil; reply, err = submit(recipient, amount) {
 			fmt.Println(err)
@@ -82,4 +91,5 @@ func init() {
 
 	submitManyCmd.PersistentFlags().BoolP("wait", "w", false, "retry submitting every transaction until it is accepted")
 	submitManyCmd.PersistentFlags().IntP("timeout", "t", 5, "timeout in seconds")
+	addSubmitFlags(submitManyCmd)
 }
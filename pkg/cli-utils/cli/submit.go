@@ -2,35 +2,54 @@ package cli
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"github.com/kon-pap/noobcash/pkg/node"
+	"github.com/kon-pap/noobcash/pkg/node/backend"
 	"github.com/spf13/cobra"
 )
 
 var submitCmd = &cobra.Command{
 	Use:   "t <recipient_address> <amount>",
 	Short: "Submit a transaction",
-	Long:  `Submit a transaction to the blockchain.`,
+	Long: `Submit a transaction to the blockchain.
+The recipient can be given either as a node id or as an address.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) != 2 {
 			return fmt.Errorf("invalid number of arguments. expected 2, got %d", len(args))
 		}
-		_, err := strconv.Atoi(args[0])
+		if _, err := strconv.Atoi(args[0]); err != nil {
+			if _, err := backend.ParseAddress(args[0]); err != nil {
+				return fmt.Errorf("recipient is neither a node id nor an address: %s", err)
+			}
+		}
+		_, err := strconv.Atoi(args[1])
 		if err != nil {
 			return err
 		}
-		_, err = strconv.Atoi(args[1])
+		ip, port, err := getAddress(cmd)
 		if err != nil {
 			return err
 		}
-		ip, port, err := getAddress(cmd)
+		opts, err := getSubmitOptions(cmd)
+		if err != nil {
+			return err
+		}
+		if memo, _ := cmd.Flags().GetString("memo"); memo != "" {
+			if len(memo) > backend.MaxMemoSize {
+				return fmt.Errorf("memo is longer than %d bytes", backend.MaxMemoSize)
+			}
+			opts["memo"] = memo
+		}
+		query, err := getAccountQuery(cmd)
 		if err != nil {
 			return err
 		}
-		submit := createSubmitter(ip, port)
+		submit := createSubmitter(ip, port, query, opts)
 		reply, err := submit(args[0], args[1])
 		if err != nil {
 			return err
@@ -41,11 +60,82 @@ var submitCmd = &cobra.Command{
 	},
 }
 
-func createSubmitter(ip string, port int) func(string, string) (string, error) {
+// Extra fields of the submitted transaction request, set through flags
+type submitOptions map[string]interface{}
+
+func addSubmitFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("coin-selection", "", "strategy used to select the inputs (largest-first, smallest-first, random-improve, branch-and-bound)")
+	cmd.PersistentFlags().String("split", "", "policy used to split the payment into outputs (none, heuristic, denominations:<d1>,<d2>,...)")
+	cmd.PersistentFlags().String("lock-until", "", "the recipient cannot spend the payment before this block height or time (RFC3339 or unix seconds)")
+	cmd.PersistentFlags().String("not-before", "", "the transaction cannot be included in a block before this height or time")
+}
+
+// Parses the lock time given by flag, 0 if it is not set
+func getLockTimeFlag(cmd *cobra.Command, flag string) (int64, error) {
+	s, err := cmd.Flags().GetString(flag)
+	if err != nil {
+		return 0, err
+	}
+	lockTime, err := backend.ParseLockTime(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --%s: %s", flag, err)
+	}
+	return lockTime, nil
+}
+
+func getSubmitOptions(cmd *cobra.Command) (submitOptions, error) {
+	opts := submitOptions{}
+	strategy, err := cmd.Flags().GetString("coin-selection")
+	if err != nil {
+		return nil, err
+	}
+	if strategy != "" {
+		opts["strategy"] = strategy
+	}
+	split, err := cmd.Flags().GetString("split")
+	if err != nil {
+		return nil, err
+	}
+	if split != "" {
+		if _, err := backend.ParseSplitPolicy(split); err != nil {
+			return nil, err
+		}
+		opts["split"] = split
+	}
+	if lockUntil, err := getLockTimeFlag(cmd, "lock-until"); err != nil {
+		return nil, err
+	} else if lockUntil > 0 {
+		opts["lockUntil"] = lockUntil
+	}
+	if notBefore, err := getLockTimeFlag(cmd, "not-before"); err != nil {
+		return nil, err
+	} else if notBefore > 0 {
+		opts["notBefore"] = notBefore
+	}
+	return opts, nil
+}
+
+func createSubmitter(ip string, port int, query url.Values, opts submitOptions) func(string, string) (string, error) {
 	return func(recipient, amount string) (string, error) {
-		transactionJson := bytes.NewBuffer([]byte(`{"recipient":` + recipient + `,"amount":` + amount + `}`))
+		request := submitOptions{}
+		for k, v := range opts {
+			request[k] = v
+		}
+		var err error
+		if request["amount"], err = strconv.Atoi(amount); err != nil {
+			return "", err
+		}
+		if request["recipient"], err = strconv.Atoi(recipient); err != nil {
+			delete(request, "recipient")
+			request["address"] = recipient
+		}
+		requestJson, err := json.Marshal(request)
+		if err != nil {
+			return "", err
+		}
+		transactionJson := bytes.NewBuffer(requestJson)
 		body, err := node.GetResponseBody(
-			http.Post(fmt.Sprintf("http://%s:%d/submit", ip, port), "application/json", transactionJson),
+			http.Post(fmt.Sprintf("http://%s:%d/submit?%s", ip, port, query.Encode()), "application/json", transactionJson),
 		)
 		if err != nil {
 			return "", err
@@ -56,4 +146,7 @@ func createSubmitter(ip string, port int) func(string, string) (string, error) {
 
 func init() {
 	rootCmd.AddCommand(submitCmd)
+
+	addSubmitFlags(submitCmd)
+	submitCmd.Flags().String("memo", "", "message for the recipient, encrypted so that only they can read it")
 }
@@ -0,0 +1,286 @@
+package cli
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/kon-pap/noobcash/pkg/node"
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+	"github.com/spf13/cobra"
+)
+
+var swapCmd = &cobra.Command{
+	Use:   "swap",
+	Short: "Exchange coins with another ring through hash-time-locked contracts",
+	Long: `Exchange coins between two rings without trusting each other, with a
+hash-time-locked contract on each ring. Alice locks her coins on ring A to Bob
+and Bob locks his coins on ring B to Alice, both with the hash of a secret only
+Alice knows. Alice redeems on ring B, revealing the secret, which lets Bob
+redeem on ring A. If either side stalls, the coins are refunded after the
+timeout, so Bob's contract must time out first:
+
+  alice$ swap initiate bob.pem 100 --key alice.pem --timeout 60 -o a.pem
+  bob$   swap initiate alice.pem 50 --key bob.pem --timeout 40 --hash <hash> -o b.pem
+  alice$ swap redeem b.pem <secret> --key alice.pem
+  bob$   swap secret <id of alice's redeem transaction>
+  bob$   swap redeem a.pem <secret> --key bob.pem
+
+Bob can find the redeem transaction by watching the address of his contract.`,
+}
+
+var swapInitiateCmd = &cobra.Command{
+	Use:   "initiate <recipient_key.pem> <amount>",
+	Short: "Lock coins to a hash-time-locked contract",
+	Long: `Lock coins of --key to a contract, redeemable by the recipient with the
+secret, or refundable after the --timeout height. Without --hash a new secret
+is generated and printed, keep it until you redeem the other side of the swap.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("invalid number of arguments. expected 2, got %d", len(args))
+		}
+		recipient, err := readPubKeyFile(args[0])
+		if err != nil {
+			return fmt.Errorf("%s: %s", args[0], err)
+		}
+		amount, err := strconv.Atoi(args[1])
+		if err != nil {
+			return err
+		}
+		key, err := readPrivKeyFlag(cmd)
+		if err != nil {
+			return err
+		}
+		timeout, err := cmd.Flags().GetInt64("timeout")
+		if err != nil {
+			return err
+		}
+		var hash []byte
+		if hashHex, _ := cmd.Flags().GetString("hash"); hashHex != "" {
+			if hash, err = hex.DecodeString(hashHex); err != nil {
+				return fmt.Errorf("invalid --hash: %s", err)
+			}
+		} else {
+			var secret []byte
+			if secret, hash, err = backend.NewSwapSecret(); err != nil {
+				return err
+			}
+			fmt.Println("Secret:", hex.EncodeToString(secret))
+		}
+		contract, err := backend.NewHTLCKey(hash, recipient, key.Public(), timeout)
+		if err != nil {
+			return err
+		}
+		if err := writeContract(cmd, contract); err != nil {
+			return err
+		}
+
+		utxos, err := getSignerUtxos(cmd, backend.AddressFromPubKey(key.Public()))
+		if err != nil {
+			return err
+		}
+		opts, err := getTxOptions(cmd)
+		if err != nil {
+			return err
+		}
+		tx, selection, err := backend.BuildTx(key.Public(), utxos, opts, &backend.TxTargetTy{
+			Address: backend.AddressFromPubKey(contract),
+			Amount:  amount,
+		})
+		if err != nil {
+			return err
+		}
+		if err := backend.SignTxWithKey(tx, key); err != nil {
+			return err
+		}
+		fmt.Printf("Signed transaction %s locking %d to the contract (%s)\n", backend.HexEncodeByteSlice(tx.Id), amount, selection)
+		return submitSwapTx(cmd, tx)
+	},
+}
+
+var swapRedeemCmd = &cobra.Command{
+	Use:   "redeem <contract.pem> <secret>",
+	Short: "Redeem the coins of a contract with its secret",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("invalid number of arguments. expected 2, got %d", len(args))
+		}
+		contract, err := readContractFile(args[0])
+		if err != nil {
+			return err
+		}
+		secret, err := hex.DecodeString(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid secret: %s", err)
+		}
+		key, err := readPrivKeyFlag(cmd)
+		if err != nil {
+			return err
+		}
+		tx, err := buildContractSpend(cmd, contract, key, 0)
+		if err != nil {
+			return err
+		}
+		if err := contract.SignRedeem(tx, secret, key); err != nil {
+			return err
+		}
+		fmt.Printf("Signed transaction %s redeeming %d\n", backend.HexEncodeByteSlice(tx.Id), tx.Amount)
+		return submitSwapTx(cmd, tx)
+	},
+}
+
+var swapRefundCmd = &cobra.Command{
+	Use:   "refund <contract.pem>",
+	Short: "Take back the coins of a contract after its timeout",
+	Long: `Take back the coins of a contract that was not redeemed. The refund is
+rejected by the ring until the chain reaches the timeout height.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("invalid number of arguments. expected 1, got %d", len(args))
+		}
+		contract, err := readContractFile(args[0])
+		if err != nil {
+			return err
+		}
+		key, err := readPrivKeyFlag(cmd)
+		if err != nil {
+			return err
+		}
+		tx, err := buildContractSpend(cmd, contract, key, contract.Timeout)
+		if err != nil {
+			return err
+		}
+		if err := contract.SignRefund(tx, key); err != nil {
+			return err
+		}
+		fmt.Printf("Signed transaction %s refunding %d, valid from height %d\n", backend.HexEncodeByteSlice(tx.Id), tx.Amount, contract.Timeout)
+		return submitSwapTx(cmd, tx)
+	},
+}
+
+var swapSecretCmd = &cobra.Command{
+	Use:   "secret <tx_id>",
+	Short: "Print the secret revealed by a transaction redeeming a contract",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("invalid number of arguments. expected 1, got %d", len(args))
+		}
+		ip, port, err := getAddress(cmd)
+		if err != nil {
+			return err
+		}
+		body, err := node.GetResponseBody(
+			http.DefaultClient.Get(fmt.Sprintf("http://%s:%d/tx/%s", ip, port, url.PathEscape(args[0]))),
+		)
+		if err != nil {
+			return err
+		}
+		var status struct {
+			Transaction *backend.Transaction `json:"transaction"`
+		}
+		if err := json.Unmarshal([]byte(body), &status); err != nil {
+			return err
+		}
+		secret, err := backend.ExtractSwapSecret(status.Transaction)
+		if err != nil {
+			return err
+		}
+		fmt.Println(hex.EncodeToString(secret))
+		return nil
+	},
+}
+
+// Builds a transaction paying all the coins of the contract to --to, or to key
+func buildContractSpend(cmd *cobra.Command, contract *backend.HTLCKey, key backend.PrivateKey, lockTime int64) (*backend.Transaction, error) {
+	utxos, err := getSignerUtxos(cmd, backend.AddressFromPubKey(contract))
+	if err != nil {
+		return nil, err
+	}
+	var amount int
+	for _, utxo := range utxos {
+		amount += utxo.Amount
+	}
+	if amount == 0 {
+		return nil, fmt.Errorf("contract %s holds no coins", backend.AddressFromPubKey(contract))
+	}
+	to := backend.AddressFromPubKey(key.Public())
+	if toFlag, _ := cmd.Flags().GetString("to"); toFlag != "" {
+		if to, err = backend.ParseAddress(toFlag); err != nil {
+			return nil, fmt.Errorf("invalid --to address: %s", err)
+		}
+	}
+	tx, _, err := backend.BuildTx(contract, utxos, &backend.TxOptions{LockTime: lockTime}, &backend.TxTargetTy{
+		Address: to,
+		Amount:  amount,
+	})
+	return tx, err
+}
+
+func readContractFile(path string) (*backend.HTLCKey, error) {
+	key, err := readPubKeyFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	contract, ok := key.(*backend.HTLCKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a hash-time-locked contract", path)
+	}
+	return contract, nil
+}
+
+// Writes the contract to --out, or to stdout, and prints its terms
+func writeContract(cmd *cobra.Command, contract *backend.HTLCKey) error {
+	contractPem := backend.PubKeyToPem(contract)
+	if out, _ := cmd.Flags().GetString("out"); out != "" {
+		if err := ioutil.WriteFile(out, []byte(contractPem), 0644); err != nil {
+			return err
+		}
+		fmt.Println("Wrote the contract to", out)
+	} else {
+		fmt.Print(contractPem)
+	}
+	fmt.Println("Hash:", hex.EncodeToString(contract.Hash))
+	fmt.Println("Address:", backend.AddressFromPubKey(contract))
+	fmt.Printf("Redeemable by %s, refundable to %s from height %d\n",
+		backend.AddressFromPubKey(contract.Recipient), backend.AddressFromPubKey(contract.Refund), contract.Timeout)
+	return nil
+}
+
+func submitSwapTx(cmd *cobra.Command, tx *backend.Transaction) error {
+	txJson, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	reply, err := submitRawTx(cmd, txJson)
+	if err != nil {
+		return err
+	}
+	fmt.Println(reply)
+	return nil
+}
+
+func init() {
+	swapInitiateCmd.Flags().Int64("timeout", 0, "block height from which the coins can be refunded")
+	swapInitiateCmd.Flags().String("hash", "", "hex sha256 of the secret, when taking the other side of a swap")
+	swapInitiateCmd.Flags().String("utxos", "", "read the UTXOs of the key from this file instead of the node")
+	swapInitiateCmd.Flags().StringP("out", "o", "", "write the contract to this file instead of stdout")
+	addSubmitFlags(swapInitiateCmd)
+	for _, cmd := range []*cobra.Command{swapInitiateCmd, swapRedeemCmd, swapRefundCmd} {
+		cmd.Flags().StringP("key", "k", "", "unencrypted PEM private key of the sender or the recipient")
+	}
+	for _, cmd := range []*cobra.Command{swapRedeemCmd, swapRefundCmd} {
+		cmd.Flags().String("to", "", "pay the coins to this address instead of the address of the key")
+		cmd.Flags().String("utxos", "", "read the UTXOs of the contract from this file instead of the node")
+	}
+
+	for _, cmd := range []*cobra.Command{swapInitiateCmd, swapRedeemCmd, swapRefundCmd, swapSecretCmd} {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		swapCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(swapCmd)
+}
@@ -0,0 +1,211 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/kon-pap/noobcash/pkg/node"
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+	"github.com/spf13/cobra"
+)
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Issue and transfer tokens",
+	Long: `Issue tokens with a fixed supply and transfer them like native coins:
+
+  token issue "lab credits" 1000
+  token send <token-id> <recipient> 10
+  token balance
+  token list`,
+}
+
+var tokenIssueCmd = &cobra.Command{
+	Use:   "issue <name> <supply>",
+	Short: "Issue a new token, its whole supply paid to you",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("invalid number of arguments. expected 2, got %d", len(args))
+		}
+		if !backend.IsValidTokenName(args[0]) {
+			return fmt.Errorf("invalid token name %q", args[0])
+		}
+		supply, err := strconv.Atoi(args[1])
+		if err != nil {
+			return err
+		}
+		ip, port, err := getAddress(cmd)
+		if err != nil {
+			return err
+		}
+		query, err := getAccountQuery(cmd)
+		if err != nil {
+			return err
+		}
+		requestJson, err := json.Marshal(map[string]interface{}{
+			"name":   args[0],
+			"supply": supply,
+		})
+		if err != nil {
+			return err
+		}
+		body, err := node.GetResponseBody(
+			http.Post(fmt.Sprintf("http://%s:%d/tokens?%s", ip, port, query.Encode()), "application/json", bytes.NewBuffer(requestJson)),
+		)
+		if err != nil {
+			return err
+		}
+		var reply struct {
+			TxId  string `json:"txId"`
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal([]byte(body), &reply); err != nil {
+			return err
+		}
+		fmt.Printf("Submitted issuance %s of %d %s, token id %s\n", reply.TxId, supply, args[0], reply.Token)
+		return nil
+	},
+}
+
+var tokenSendCmd = &cobra.Command{
+	Use:   "send <token-id> <recipient> <amount>",
+	Short: "Send tokens to a node id or an address",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 3 {
+			return fmt.Errorf("invalid number of arguments. expected 3, got %d", len(args))
+		}
+		request := map[string]interface{}{}
+		if recipient, err := strconv.Atoi(args[1]); err == nil {
+			request["recipient"] = recipient
+		} else if _, err := backend.ParseAddress(args[1]); err != nil {
+			return fmt.Errorf("recipient is neither a node id nor an address: %s", err)
+		} else {
+			request["address"] = args[1]
+		}
+		amount, err := strconv.Atoi(args[2])
+		if err != nil {
+			return err
+		}
+		request["amount"] = amount
+		strategy, err := cmd.Flags().GetString("coin-selection")
+		if err != nil {
+			return err
+		}
+		if strategy != "" {
+			request["strategy"] = strategy
+		}
+		if lockUntil, err := getLockTimeFlag(cmd, "lock-until"); err != nil {
+			return err
+		} else if lockUntil > 0 {
+			request["lockUntil"] = lockUntil
+		}
+		ip, port, err := getAddress(cmd)
+		if err != nil {
+			return err
+		}
+		query, err := getAccountQuery(cmd)
+		if err != nil {
+			return err
+		}
+		requestJson, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body, err := node.GetResponseBody(
+			http.Post(fmt.Sprintf("http://%s:%d/tokens/%s/send?%s", ip, port, args[0], query.Encode()), "application/json", bytes.NewBuffer(requestJson)),
+		)
+		if err != nil {
+			return err
+		}
+		fmt.Println(body)
+		return nil
+	},
+}
+
+var tokenBalanceCmd = &cobra.Command{
+	Use:   "balance",
+	Short: "View your balance in every token",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ip, port, err := getAddress(cmd)
+		if err != nil {
+			return err
+		}
+		query, err := getAccountQuery(cmd)
+		if err != nil {
+			return err
+		}
+		body, err := node.GetResponseBody(
+			http.DefaultClient.Get(fmt.Sprintf("http://%s:%d/wallet/tokens?%s", ip, port, query.Encode())),
+		)
+		if err != nil {
+			return err
+		}
+		var balances []*node.TokenBalance
+		if err := json.Unmarshal([]byte(body), &balances); err != nil {
+			return err
+		}
+		if len(balances) == 0 {
+			fmt.Println("No tokens")
+			return nil
+		}
+		printTokenBalances(balances)
+		return nil
+	},
+}
+
+var tokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List every token issued in the chain",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ip, port, err := getAddress(cmd)
+		if err != nil {
+			return err
+		}
+		body, err := node.GetResponseBody(
+			http.DefaultClient.Get(fmt.Sprintf("http://%s:%d/tokens", ip, port)),
+		)
+		if err != nil {
+			return err
+		}
+		var tokens []node.TokenInfo
+		if err := json.Unmarshal([]byte(body), &tokens); err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSUPPLY\tISSUER")
+		for _, token := range tokens {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", token.Id, token.Name, token.Supply, token.Issuer)
+		}
+		return w.Flush()
+	},
+}
+
+func printTokenBalances(balances []*node.TokenBalance) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOKEN\tNAME\tBALANCE\tSPENDABLE\tUTXOS")
+	for _, balance := range balances {
+		name := balance.Token.Name
+		if name == "" {
+			name = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\n", balance.Token.Id, name, balance.Balance, balance.Spendable, len(balance.Utxos))
+	}
+	w.Flush()
+}
+
+func init() {
+	tokenSendCmd.Flags().String("coin-selection", "", "strategy used to select the inputs (largest-first, smallest-first, random-improve, branch-and-bound)")
+	tokenSendCmd.Flags().String("lock-until", "", "the recipient cannot spend the tokens before this block height or time (RFC3339 or unix seconds)")
+
+	for _, cmd := range []*cobra.Command{tokenIssueCmd, tokenSendCmd, tokenBalanceCmd, tokenListCmd} {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		tokenCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(tokenCmd)
+}
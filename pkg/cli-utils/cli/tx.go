@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kon-pap/noobcash/pkg/node"
+	"github.com/spf13/cobra"
+)
+
+var txCmd = &cobra.Command{
+	Use:   "tx <id>",
+	Short: "View the status of a transaction",
+	Long: `View the status of a transaction (pending, confirmed, orphaned, dropped or replaced).
+With --wait-confirmations, block until the transaction is buried under that many blocks.
+
+A pending transaction of your wallet can be replaced by one spending the same
+inputs, with 'tx replace', or cancelled with 'tx cancel'.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("invalid number of arguments. expected 1, got %d", len(args))
+		}
+		ip, port, err := getAddress(cmd)
+		if err != nil {
+			return err
+		}
+		waitConfirmations, err := cmd.Flags().GetInt("wait-confirmations")
+		if err != nil {
+			return err
+		}
+		interval, err := cmd.Flags().GetDuration("interval")
+		if err != nil {
+			return err
+		}
+
+		var lastStatus txStatusReply
+		for {
+			status, err := getTxStatus(ip, port, args[0])
+			if err != nil {
+				return err
+			}
+			if status.Status != lastStatus.Status || status.Confirmations != lastStatus.Confirmations {
+				fmt.Println(status)
+			}
+			lastStatus = status
+			if status.Status == "dropped" {
+				return fmt.Errorf("transaction %s was dropped", status.Id)
+			}
+			if status.Status == "replaced" {
+				return fmt.Errorf("transaction %s was replaced by %s", status.Id, status.ReplacedBy)
+			}
+			if status.Confirmations >= waitConfirmations {
+				return nil
+			}
+			time.Sleep(interval)
+		}
+	},
+}
+
+type txStatusReply struct {
+	Id            string `json:"id"`
+	Status        string `json:"status"`
+	BlockHeight   int    `json:"blockHeight"`
+	Confirmations int    `json:"confirmations"`
+	ReplacedBy    string `json:"replacedBy"`
+}
+
+func (s txStatusReply) String() string {
+	if s.Status == "replaced" {
+		return fmt.Sprintf("Transaction %s is replaced by %s", s.Id, s.ReplacedBy)
+	}
+	if s.Status != "confirmed" {
+		return fmt.Sprintf("Transaction %s is %s", s.Id, s.Status)
+	}
+	return fmt.Sprintf("Transaction %s is confirmed in block %d with %d confirmation(s)", s.Id, s.BlockHeight, s.Confirmations)
+}
+
+func getTxStatus(ip string, port int, txId string) (status txStatusReply, err error) {
+	body, err := node.GetResponseBody(
+		http.DefaultClient.Get(fmt.Sprintf("http://%s:%d/tx/%s", ip, port, txId)),
+	)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal([]byte(body), &status)
+	return
+}
+
+var txReplaceCmd = &cobra.Command{
+	Use:   "replace <id>",
+	Short: "Replace a pending transaction with one paying a higher fee or different outputs",
+	Long: `Replace a pending transaction of your wallet with one spending the same inputs.
+Without --pay it keeps the payments of the original and only raises its fee.
+The replacement must pay at least the fee of the original, and either a
+higher fee or different outputs.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("invalid number of arguments. expected 1, got %d", len(args))
+		}
+		fee, err := cmd.Flags().GetInt("fee")
+		if err != nil {
+			return err
+		}
+		request := map[string]interface{}{"fee": fee}
+		if pay, _ := cmd.Flags().GetString("pay"); pay != "" {
+			address, amount, err := parseAddressAmount(pay)
+			if err != nil {
+				return fmt.Errorf("invalid --pay %s: %s", pay, err)
+			}
+			request["address"] = address
+			request["amount"] = amount
+		}
+		return postTxAction(cmd, args[0], "replace", request)
+	},
+}
+
+var txCancelCmd = &cobra.Command{
+	Use:   "cancel <id>",
+	Short: "Cancel a pending transaction by replacing it with a payment to yourself",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("invalid number of arguments. expected 1, got %d", len(args))
+		}
+		return postTxAction(cmd, args[0], "cancel", map[string]interface{}{})
+	},
+}
+
+func postTxAction(cmd *cobra.Command, txId, action string, request map[string]interface{}) error {
+	ip, port, err := getAddress(cmd)
+	if err != nil {
+		return err
+	}
+	query, err := getAccountQuery(cmd)
+	if err != nil {
+		return err
+	}
+	requestJson, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	body, err := node.GetResponseBody(
+		http.Post(fmt.Sprintf("http://%s:%d/tx/%s/%s?%s", ip, port, txId, action, query.Encode()), "application/json", bytes.NewBuffer(requestJson)),
+	)
+	if err != nil {
+		return err
+	}
+	fmt.Println(body)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(txCmd)
+	txReplaceCmd.Flags().Int("fee", 0, "fee of the replacement, at least the fee of the original")
+	txReplaceCmd.Flags().String("pay", "", "<address>=<amount> paid instead of the payments of the original")
+	for _, cmd := range []*cobra.Command{txReplaceCmd, txCancelCmd} {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		txCmd.AddCommand(cmd)
+	}
+
+	txCmd.PersistentFlags().IntP("wait-confirmations", "w", 0, "block until the transaction reaches this many confirmations")
+	txCmd.PersistentFlags().Duration("interval", time.Second, "polling interval while waiting")
+}
@@ -3,6 +3,7 @@ package cli
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/kon-pap/noobcash/pkg/node"
 	"github.com/spf13/cobra"
@@ -16,8 +17,25 @@ var utxosCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		query, err := getAccountQuery(cmd)
+		if err != nil {
+			return err
+		}
+		endpoint := "/view/utxos?" + query.Encode()
+		of, err := cmd.Flags().GetString("of")
+		if err != nil {
+			return err
+		}
+		if raw, _ := cmd.Flags().GetBool("raw"); raw {
+			if of == "" {
+				return fmt.Errorf("--raw needs the address given with --of")
+			}
+			endpoint = fmt.Sprintf("/utxos/%s", url.PathEscape(of))
+		} else if of != "" {
+			endpoint = fmt.Sprintf("/wallets/%s/utxos", url.PathEscape(of))
+		}
 		body, err := node.GetResponseBody(
-			http.DefaultClient.Get(fmt.Sprintf("http://%s:%d/view/utxos", ip, port)),
+			http.DefaultClient.Get(fmt.Sprintf("http://%s:%d%s", ip, port, endpoint)),
 		)
 		if err != nil {
 			return err
@@ -29,4 +47,7 @@ var utxosCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(utxosCmd)
+
+	utxosCmd.PersistentFlags().String("of", "", "view the UTXOs of another ring member, by node id or address")
+	utxosCmd.PersistentFlags().Bool("raw", false, "print the full unspent outputs of the address given with --of, as needed by 'sign --utxos'")
 }
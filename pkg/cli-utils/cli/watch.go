@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/kon-pap/noobcash/pkg/node"
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+	"github.com/spf13/cobra"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch <account_name> <address|public_key.pem>",
+	Short: "Follow an external address as a watch-only account",
+	Long: `Follow an external address as a watch-only account of the node.
+Its balance and history can then be queried with --account, but the node
+refuses to create or sign transactions for it.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("invalid number of arguments. expected 2, got %d", len(args))
+		}
+		target := args[1]
+		if pemBytes, err := ioutil.ReadFile(target); err == nil {
+			target = string(pemBytes)
+		}
+		if _, _, err := backend.ParseWatchTarget(target); err != nil {
+			return err
+		}
+		ip, port, err := getAddress(cmd)
+		if err != nil {
+			return err
+		}
+		requestJson, err := json.Marshal(map[string]string{
+			"name":   args[0],
+			"target": target,
+		})
+		if err != nil {
+			return err
+		}
+		body, err := node.GetResponseBody(
+			http.Post(fmt.Sprintf("http://%s:%d/accounts/watch", ip, port), "application/json", bytes.NewBuffer(requestJson)),
+		)
+		if err != nil {
+			return err
+		}
+		fmt.Println(body)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+}
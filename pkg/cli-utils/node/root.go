@@ -65,11 +65,59 @@ func getNodeApiHostDetails(cmd *cobra.Command) (string, string) {
 func setupNode(cmd *cobra.Command) (*node.Node, func()) {
 	ip, nodeport := getNodeApiHostDetails(cmd)
 	apiport, _ := cmd.Flags().GetString("apiport")
-	newNode := node.NewNode(0, 1024, ip, nodeport, apiport)
+	w, err := setupWallet(cmd, node.DefaultAccount)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	newNode := node.NewNodeWithWallet(w, ip, nodeport, apiport)
+	accounts, _ := cmd.Flags().GetStringSlice("accounts")
+	for _, account := range accounts {
+		if !node.IsValidAccountName(account) {
+			fmt.Printf("invalid account name %q\n", account)
+			os.Exit(1)
+		}
+		w, err := setupWallet(cmd, account)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := newNode.Accounts.Add(account, w); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	watches, _ := cmd.Flags().GetStringSlice("watch")
+	for _, watch := range watches {
+		if err := setupWatch(newNode, watch); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	strategy, _ := cmd.Flags().GetString("coin-selection")
+	selector, err := backend.GetCoinSelector(strategy)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	split, _ := cmd.Flags().GetString("split")
+	splitPolicy, err := backend.ParseSplitPolicy(split)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for _, w := range newNode.Accounts.Wallets() {
+		w.CoinSelector = selector
+		w.SplitPolicy = splitPolicy
+	}
 	node.BootstrapHostname, _ = cmd.Flags().GetString("bootstrap")
 	backend.BlockCapacity, _ = cmd.Flags().GetInt("capacity")
 	backend.TmpBlockCapacity = backend.BlockCapacity
 	backend.Difficulty, _ = cmd.Flags().GetInt("difficulty")
+	backend.ReservationTimeout, _ = cmd.Flags().GetDuration("reservation-timeout")
+	node.AutoConsolidateLimit, _ = cmd.Flags().GetInt("auto-consolidate")
+	node.ConsolidateMaxInputs, _ = cmd.Flags().GetInt("consolidate-max-inputs")
+	node.ConsolidateThreshold, _ = cmd.Flags().GetInt("consolidate-threshold")
 
 	return newNode, saveLogs(apiport)
 }
@@ -89,4 +137,17 @@ func init() {
 	rootCmd.PersistentFlags().StringP("bootstrap", "b", "localhost:7070", "Hostname of the bootstrap node")
 	rootCmd.PersistentFlags().IntP("capacity", "c", 10, "Transaction capacity of a block")
 	rootCmd.PersistentFlags().IntP("difficulty", "d", 1, "Difficulty of mining a block")
+	rootCmd.PersistentFlags().StringP("wallet", "w", "", "Encrypted keystore of the node wallet (default: wallet-<apiport>.json under WALLET_PATH)")
+	rootCmd.PersistentFlags().String("account", "", "Named account whose keystore the wallet commands act on (default: the node wallet)")
+	rootCmd.PersistentFlags().StringSlice("accounts", nil, "Named accounts hosted by the node next to its own wallet, each with its own keystore")
+	rootCmd.PersistentFlags().StringSlice("watch", nil, "Watch-only accounts hosted by the node, as <name>=<address or PEM public key file>")
+	rootCmd.PersistentFlags().String("key-type", string(backend.DefaultKeyType), "Key type of newly created wallets (ed25519, ecdsa, rsa)")
+	rootCmd.PersistentFlags().Int("rsa-bits", backend.RSAKeyBits, "Size of newly created RSA keys")
+	rootCmd.PersistentFlags().String("env-file", "./config/node.env", "File to read env vars such as WALLET_PATH from, if it exists")
+	rootCmd.PersistentFlags().String("coin-selection", backend.DefaultCoinSelector.Name(), "Default strategy used to select the inputs of new transactions")
+	rootCmd.PersistentFlags().String("split", backend.DefaultSplitPolicy.String(), "Policy used to split payments into outputs (none, heuristic, denominations:<d1>,<d2>,...)")
+	rootCmd.PersistentFlags().Duration("reservation-timeout", backend.ReservationTimeout, "Time after which UTXOs reserved by an unsubmitted transaction are released")
+	rootCmd.PersistentFlags().Int("auto-consolidate", node.AutoConsolidateLimit, "Consolidate an account when its UTXO count exceeds this limit (0 disables it)")
+	rootCmd.PersistentFlags().Int("consolidate-max-inputs", node.ConsolidateMaxInputs, "Max UTXOs merged by an automatic consolidation")
+	rootCmd.PersistentFlags().Int("consolidate-threshold", node.ConsolidateThreshold, "Only UTXOs below this amount are merged by an automatic consolidation")
 }
@@ -0,0 +1,395 @@
+package node
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kon-pap/noobcash/pkg/env"
+	"github.com/kon-pap/noobcash/pkg/node"
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+	"github.com/spf13/cobra"
+)
+
+const (
+	passphraseEnv    = "NOOBCASH_PASSPHRASE"
+	newPassphraseEnv = "NOOBCASH_NEW_PASSPHRASE"
+)
+
+// Shared, so that consecutive prompts don't lose buffered input
+var stdinReader = bufio.NewReader(os.Stdin)
+
+var walletCmd = &cobra.Command{
+	Use:   "wallet",
+	Short: "Manage the encrypted wallet keystore of the node",
+	Long: `Manage the encrypted wallet keystore of the node.
+The keystore is given with --wallet, or defaults to wallet-<apiport>.json under
+the WALLET_PATH directory. With --account the keystore of that named account is
+used instead, e.g. wallet-<apiport>.<account>.json. The passphrase is read from
+the ` + passphraseEnv + ` env var, or prompted for.`,
+}
+
+var walletCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a keystore with a new key",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := requireWalletPath(cmd)
+		if err != nil {
+			return err
+		}
+		if err := checkOverwrite(cmd, path); err != nil {
+			return err
+		}
+		passphrase, err := getPassphrase(passphraseEnv, "New passphrase: ")
+		if err != nil {
+			return err
+		}
+		var w *backend.Wallet
+		if hd, _ := cmd.Flags().GetBool("hd"); hd {
+			mnemonic, err := backend.NewMnemonic()
+			if err != nil {
+				return err
+			}
+			if w, err = backend.NewHDWallet(mnemonic); err != nil {
+				return err
+			}
+			fmt.Println("Write down this mnemonic, it is the only way to restore the wallet:")
+			fmt.Println(mnemonic)
+		} else if w, err = newWallet(cmd); err != nil {
+			return err
+		}
+		if err := backend.SaveWallet(w, path, passphrase); err != nil {
+			return err
+		}
+		fmt.Printf("Created wallet %s at %s\n", w.Address(), path)
+		return nil
+	},
+}
+
+var walletRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Create a keystore with an HD wallet restored from its mnemonic",
+	Long: `Create a keystore with an HD wallet restored from its mnemonic.
+The mnemonic is in the noobcash format (17 words), not a BIP39 phrase.
+The node finds the coins of the restored addresses as it applies the chain.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := requireWalletPath(cmd)
+		if err != nil {
+			return err
+		}
+		if err := checkOverwrite(cmd, path); err != nil {
+			return err
+		}
+		mnemonic, _ := cmd.Flags().GetString("mnemonic")
+		if mnemonic == "" {
+			fmt.Fprint(os.Stderr, "Mnemonic: ")
+			if mnemonic, err = stdinReader.ReadString('\n'); err != nil && mnemonic == "" {
+				return fmt.Errorf("reading mnemonic: %s", err)
+			}
+		}
+		w, err := backend.NewHDWallet(mnemonic)
+		if err != nil {
+			return err
+		}
+		passphrase, err := getPassphrase(passphraseEnv, "New passphrase: ")
+		if err != nil {
+			return err
+		}
+		if err := backend.SaveWallet(w, path, passphrase); err != nil {
+			return err
+		}
+		fmt.Printf("Restored wallet %s to %s\n", w.Address(), path)
+		return nil
+	},
+}
+
+var walletImportCmd = &cobra.Command{
+	Use:   "import <private_key.pem>",
+	Short: "Create a keystore from an unencrypted PEM private key",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("invalid number of arguments. expected 1, got %d", len(args))
+		}
+		path, err := requireWalletPath(cmd)
+		if err != nil {
+			return err
+		}
+		if err := checkOverwrite(cmd, path); err != nil {
+			return err
+		}
+		pemBytes, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		privKey, err := backend.ParsePrivKeyPem(string(pemBytes))
+		if err != nil {
+			return err
+		}
+		passphrase, err := getPassphrase(passphraseEnv, "New passphrase: ")
+		if err != nil {
+			return err
+		}
+		w := backend.NewWalletFromKey(privKey)
+		if err := backend.SaveWallet(w, path, passphrase); err != nil {
+			return err
+		}
+		fmt.Printf("Imported wallet %s to %s\n", w.Address(), path)
+		return nil
+	},
+}
+
+var walletExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print the unencrypted PEM private key (or the mnemonic of an HD wallet) of the keystore",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		w, _, err := loadWalletFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		secret := backend.PrivKeyToPem(w.PrivKey)
+		if w.IsHD() {
+			mnemonic, _ := w.Mnemonic()
+			secret = mnemonic + "\n"
+		}
+		out, _ := cmd.Flags().GetString("out")
+		if out == "" {
+			fmt.Print(secret)
+			return nil
+		}
+		if err := ioutil.WriteFile(out, []byte(secret), 0600); err != nil {
+			return err
+		}
+		fmt.Printf("Exported the key of wallet %s to %s\n", w.Address(), out)
+		return nil
+	},
+}
+
+var walletRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Re-encrypt the keystore with a new passphrase, or replace its key",
+	Long: `Re-encrypt the keystore with a new passphrase.
+With --new-key a new key is generated as well. The old keystore is kept as a
+backup next to it, since coins owned by the old address are not moved.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		w, path, err := loadWalletFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		newPassphrase, err := getPassphrase(newPassphraseEnv, "New passphrase: ")
+		if err != nil {
+			return err
+		}
+		newKey, _ := cmd.Flags().GetBool("new-key")
+		if newKey {
+			newW, err := newWallet(cmd)
+			if err != nil {
+				return err
+			}
+			backup := fmt.Sprintf("%s.%d.bak", path, time.Now().Unix())
+			if err := os.Rename(path, backup); err != nil {
+				return err
+			}
+			fmt.Printf("Old wallet %s backed up to %s\n", w.Address(), backup)
+			w = newW
+		}
+		if err := backend.SaveWallet(w, path, newPassphrase); err != nil {
+			return err
+		}
+		fmt.Printf("Rotated wallet %s at %s\n", w.Address(), path)
+		return nil
+	},
+}
+
+var walletShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the address of the keystore",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		w, path, err := loadWalletFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s (%s)\n", w.Address(), path)
+		return nil
+	},
+}
+
+// Generates a wallet with the key type given by --key-type
+func newWallet(cmd *cobra.Command) (*backend.Wallet, error) {
+	keyTypeStr, _ := cmd.Flags().GetString("key-type")
+	keyType, err := backend.ParseKeyType(keyTypeStr)
+	if err != nil {
+		return nil, err
+	}
+	backend.RSAKeyBits, _ = cmd.Flags().GetInt("rsa-bits")
+	return backend.NewWallet(keyType), nil
+}
+
+// Loads the env file given by --env-file, if it exists
+func loadEnvFile(cmd *cobra.Command) {
+	envFile, _ := cmd.Flags().GetString("env-file")
+	if _, err := os.Stat(envFile); err == nil {
+		env.Import(envFile)
+	}
+}
+
+// Returns the keystore path of the account given by --account, or "" if none is configured
+func getWalletPath(cmd *cobra.Command) string {
+	account, _ := cmd.Flags().GetString("account")
+	return getAccountWalletPath(cmd, account)
+}
+
+// Returns the keystore path of a named account, or "" if none is configured.
+//
+// The keystores of the accounts sit next to the one of the default account.
+func getAccountWalletPath(cmd *cobra.Command, account string) string {
+	path, _ := cmd.Flags().GetString("wallet")
+	if path == "" {
+		loadEnvFile(cmd)
+		dir := os.Getenv("WALLET_PATH")
+		if dir == "" {
+			return ""
+		}
+		apiport, _ := cmd.Flags().GetString("apiport")
+		path = filepath.Join(dir, "wallet-"+apiport+".json")
+	}
+	if account == "" || account == node.DefaultAccount {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + account + ext
+}
+
+func requireWalletPath(cmd *cobra.Command) (string, error) {
+	if account, _ := cmd.Flags().GetString("account"); account != "" && !node.IsValidAccountName(account) {
+		return "", fmt.Errorf("invalid account name %q", account)
+	}
+	path := getWalletPath(cmd)
+	if path == "" {
+		return "", errors.New("no keystore given, set --wallet or WALLET_PATH")
+	}
+	return path, nil
+}
+
+func checkOverwrite(cmd *cobra.Command, path string) error {
+	force, _ := cmd.Flags().GetBool("force")
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("keystore %s already exists, use --force to overwrite it", path)
+	}
+	return nil
+}
+
+// Reads a passphrase from envVar, or from stdin.
+//
+// There is no flag for it, since the arguments of a process are visible to
+// every user of the host, e.g. in ps.
+func getPassphrase(envVar, prompt string) (string, error) {
+	if passphrase := os.Getenv(envVar); passphrase != "" {
+		return passphrase, nil
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading passphrase: %s", err)
+	}
+	passphrase := strings.TrimRight(line, "\r\n")
+	if passphrase == "" {
+		return "", errors.New("empty passphrase")
+	}
+	return passphrase, nil
+}
+
+func loadWalletFromFlags(cmd *cobra.Command) (*backend.Wallet, string, error) {
+	path, err := requireWalletPath(cmd)
+	if err != nil {
+		return nil, "", err
+	}
+	w, err := loadWallet(cmd, path)
+	if err != nil {
+		return nil, "", err
+	}
+	return w, path, nil
+}
+
+func loadWallet(cmd *cobra.Command, path string) (*backend.Wallet, error) {
+	passphrase, err := getPassphrase(passphraseEnv, "Passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	return backend.LoadWallet(path, passphrase)
+}
+
+// Returns the wallet the given account of the node should run with.
+//
+// Without a keystore a throwaway wallet is generated, as before.
+// A missing keystore is created, so that restarts keep the same key.
+func setupWallet(cmd *cobra.Command, account string) (*backend.Wallet, error) {
+	path := getAccountWalletPath(cmd, account)
+	if path == "" {
+		log.Println("No keystore configured, using a new throwaway wallet")
+		return newWallet(cmd)
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		passphrase, err := getPassphrase(passphraseEnv, "New passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		w, err := newWallet(cmd)
+		if err != nil {
+			return nil, err
+		}
+		if err := backend.SaveWallet(w, path, passphrase); err != nil {
+			return nil, err
+		}
+		log.Printf("Created wallet %s at %s\n", w.Address(), path)
+		return w, nil
+	}
+	w, err := loadWallet(cmd, path)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded wallet %s from %s\n", w.Address(), path)
+	return w, nil
+}
+
+// Hosts the watch-only account given as <name>=<address or PEM public key file>
+func setupWatch(n *node.Node, watch string) error {
+	parts := strings.SplitN(watch, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid watch-only account %q, expected <name>=<target>", watch)
+	}
+	target := parts[1]
+	if pemBytes, err := ioutil.ReadFile(target); err == nil {
+		target = string(pemBytes)
+	}
+	address, pubKey, err := backend.ParseWatchTarget(target)
+	if err != nil {
+		return fmt.Errorf("watch-only account %s: %s", parts[0], err)
+	}
+	if _, err := n.WatchAddress(parts[0], address, pubKey); err != nil {
+		return err
+	}
+	log.Printf("Watching %s as account %s\n", address, parts[0])
+	return nil
+}
+
+func init() {
+	walletCreateCmd.Flags().Bool("force", false, "Overwrite an existing keystore")
+	walletCreateCmd.Flags().Bool("hd", false, "Derive the keys from a new mnemonic (noobcash format, not BIP39)")
+	walletImportCmd.Flags().Bool("force", false, "Overwrite an existing keystore")
+	walletRestoreCmd.Flags().Bool("force", false, "Overwrite an existing keystore")
+	walletRestoreCmd.Flags().String("mnemonic", "", "Mnemonic of the wallet (prompted for if not given)")
+	walletExportCmd.Flags().StringP("out", "o", "", "Write the key to this file instead of stdout")
+	walletRotateCmd.Flags().Bool("new-key", false, "Replace the key of the keystore with a new one")
+
+	for _, cmd := range []*cobra.Command{walletCreateCmd, walletRestoreCmd, walletImportCmd, walletExportCmd, walletRotateCmd, walletShowCmd} {
+		cmd.SilenceUsage = true
+		walletCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(walletCmd)
+}
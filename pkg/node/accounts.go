@@ -0,0 +1,141 @@
+package node
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	bck "github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+// Name of the account holding the wallet the node joined the ring with
+const DefaultAccount = "default"
+
+var accountNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+func IsValidAccountName(name string) bool {
+	return accountNameRegexp.MatchString(name)
+}
+
+// Named wallets hosted by the node, each with its own utxos and reservations.
+//
+// To the rest of the ring the accounts are ordinary payable addresses.
+//
+// Thread-safe
+type Accounts struct {
+	mu      sync.RWMutex
+	wallets map[string]*bck.Wallet
+}
+
+func NewAccounts(defaultWallet *bck.Wallet) *Accounts {
+	return &Accounts{
+		wallets: map[string]*bck.Wallet{
+			DefaultAccount: defaultWallet,
+		},
+	}
+}
+
+func (a *Accounts) Get(name string) (*bck.Wallet, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	w, ok := a.wallets[name]
+	return w, ok
+}
+
+func (a *Accounts) Add(name string, w *bck.Wallet) error {
+	if !IsValidAccountName(name) {
+		return fmt.Errorf("invalid account name %q", name)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.wallets[name]; ok {
+		return fmt.Errorf("account %s already exists", name)
+	}
+	for other, existing := range a.wallets {
+		if existing.Owns(w.Address()) {
+			return fmt.Errorf("wallet of account %s is already hosted as account %s", name, other)
+		}
+	}
+	a.wallets[name] = w
+	return nil
+}
+
+// Returns the account names, sorted
+func (a *Accounts) Names() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	names := make([]string, 0, len(a.wallets))
+	for name := range a.wallets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (a *Accounts) Wallets() []*bck.Wallet {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	wallets := make([]*bck.Wallet, 0, len(a.wallets))
+	for _, w := range a.wallets {
+		wallets = append(wallets, w)
+	}
+	return wallets
+}
+
+// Returns the wallet of the account owning address, if it is hosted by the node
+func (a *Accounts) Owner(address bck.Address) (*bck.Wallet, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, w := range a.wallets {
+		if w.Owns(address) {
+			return w, true
+		}
+	}
+	return nil, false
+}
+
+// Returns the accounts owning inputs of tx, each once
+func (n *Node) inputAccounts(tx *bck.Transaction) []*bck.Wallet {
+	var wallets []*bck.Wallet
+	for _, owner := range tx.Owners() {
+		w, ok := n.Accounts.Owner(owner)
+		if !ok {
+			continue
+		}
+		seen := false
+		for _, other := range wallets {
+			seen = seen || other == w
+		}
+		if !seen {
+			wallets = append(wallets, w)
+		}
+	}
+	return wallets
+}
+
+// Hosts a watch-only account following address, and looks for its utxos in the chain.
+//
+// Returns the number of utxos found.
+func (n *Node) WatchAddress(name string, address bck.Address, pubKey bck.PublicKey) (int, error) {
+	w, err := bck.NewWatchOnlyWallet(address, pubKey)
+	if err != nil {
+		return 0, err
+	}
+	if err := n.Accounts.Add(name, w); err != nil {
+		return 0, err
+	}
+	w.SetChainTip(n.lockContext())
+	return n.RescanWallet(w), nil
+}
+
+// Releases the utxos any account reserved for the transaction, reporting if there were any
+func (a *Accounts) ReleaseTx(txId string) bool {
+	released := false
+	for _, w := range a.Wallets() {
+		if w.ReleaseTx(txId) {
+			released = true
+		}
+	}
+	return released
+}
@@ -0,0 +1,78 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+func TestAccounts(t *testing.T) {
+	defaultWallet := backend.NewWallet(backend.DefaultKeyType)
+	alice := backend.NewWallet(backend.DefaultKeyType)
+	accounts := NewAccounts(defaultWallet)
+	if err := accounts.Add("alice", alice); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Look up the hosted accounts", func(t *testing.T) {
+		if w, ok := accounts.Get("alice"); !ok || w != alice {
+			t.Error("Expected account alice to hold its wallet")
+		}
+		if _, ok := accounts.Get("bob"); ok {
+			t.Error("Expected account bob not to exist")
+		}
+		if names := accounts.Names(); len(names) != 2 || names[0] != "alice" || names[1] != DefaultAccount {
+			t.Errorf("Expected accounts alice and %s, got %v", DefaultAccount, names)
+		}
+		if w, ok := accounts.Owner(alice.Address()); !ok || w != alice {
+			t.Errorf("Expected alice to own %s", alice.Address())
+		}
+	})
+	t.Run("Invalid account names", func(t *testing.T) {
+		for _, name := range []string{"", "with space", "a/b"} {
+			if err := accounts.Add(name, backend.NewWallet(backend.DefaultKeyType)); err == nil {
+				t.Errorf("Expected account name %q to be refused", name)
+			}
+		}
+	})
+	t.Run("Reuse an account name", func(t *testing.T) {
+		if err := accounts.Add("alice", backend.NewWallet(backend.DefaultKeyType)); err == nil {
+			t.Error("Expected an error when reusing an account name")
+		}
+	})
+	t.Run("Host the same wallet twice", func(t *testing.T) {
+		if err := accounts.Add("alice2", alice); err == nil {
+			t.Error("Expected an error when hosting a wallet twice")
+		}
+	})
+}
+
+func TestWatchAddress(t *testing.T) {
+	// a separate node, whose genesis pays a wallet it does not hold
+	external := backend.NewWallet(backend.DefaultKeyType)
+	auditNode := newFundedTestNode(t, external.PrivKey.Public())
+	found, err := auditNode.WatchAddress("audit", external.Address(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != 1 {
+		t.Errorf("Expected to find 1 UTXO of %s, got %d", external.Address(), found)
+	}
+	audit, _ := auditNode.Accounts.Get("audit")
+
+	t.Run("Balance of a watch-only account", func(t *testing.T) {
+		if balance := auditNode.WalletBalance(audit, 1); !balance.WatchOnly || balance.Confirmed != 500 {
+			t.Errorf("Expected a watch-only balance of %d, got %+v", 500, balance)
+		}
+	})
+	t.Run("Spend from a watch-only account", func(t *testing.T) {
+		if _, err := audit.CreateAndSignTx(1, auditNode.Wallet.Address()); err == nil {
+			t.Error("Expected a watch-only account not to sign transactions")
+		}
+	})
+	t.Run("Watch an address twice", func(t *testing.T) {
+		if _, err := auditNode.WatchAddress("audit2", external.Address(), nil); err == nil {
+			t.Error("Expected an error when watching an address twice")
+		}
+	})
+}
@@ -1,12 +1,12 @@
 package node
 
 import (
-	"crypto/rsa"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/kon-pap/noobcash/pkg/node/backend"
@@ -17,8 +17,37 @@ func (n *Node) setupCliHandler() *mux.Router {
 	r.HandleFunc("/balance", n.createGiveBalanceHandler()).Methods("GET")
 	r.HandleFunc("/view", n.createGiveLastBlockHandler()).Methods("GET")
 	r.HandleFunc("/submit", n.createAcceptAndSubmitTx()).Methods("POST")
+	r.HandleFunc("/submit-raw", n.createSubmitRawTxHandler()).Methods("POST")
+	r.HandleFunc("/utxos/{address}", n.createAddressUtxosHandler()).Methods("GET")
 	r.HandleFunc("/view/utxos", n.createGiveUtxosHandler()).Methods("GET")
 	r.HandleFunc("/view/stats", n.createStatsHandler()).Methods("GET")
+	r.HandleFunc("/consolidate", n.createConsolidateHandler()).Methods("POST")
+	r.HandleFunc("/tx/{id}", n.createTxStatusHandler()).Methods("GET")
+	r.HandleFunc("/tx/{id}/replace", n.createReplaceTxHandler()).Methods("POST")
+	r.HandleFunc("/tx/{id}/cancel", n.createCancelTxHandler()).Methods("POST")
+	r.HandleFunc("/wallet/history", n.createWalletHistoryHandler()).Methods("GET")
+	r.HandleFunc("/wallet/addresses", n.createWalletAddressesHandler()).Methods("GET")
+	r.HandleFunc("/wallet/addresses", n.createNewAddressHandler()).Methods("POST")
+	r.HandleFunc("/wallet/rescan", n.createRescanHandler()).Methods("POST")
+	r.HandleFunc("/accounts", n.createAccountsHandler()).Methods("GET")
+	r.HandleFunc("/accounts/watch", n.createWatchHandler()).Methods("POST")
+	r.HandleFunc("/wallets", n.createRingWalletsHandler()).Methods("GET")
+	r.HandleFunc("/wallets/{member}", n.createRingWalletHandler()).Methods("GET")
+	r.HandleFunc("/wallets/{member}/utxos", n.createRingWalletUtxosHandler()).Methods("GET")
+	r.HandleFunc("/invoices", n.createInvoicesHandler()).Methods("GET")
+	r.HandleFunc("/invoices", n.createNewInvoiceHandler()).Methods("POST")
+	r.HandleFunc("/invoices/{id}", n.createInvoiceStatusHandler()).Methods("GET")
+	r.HandleFunc("/tokens", n.createTokensHandler()).Methods("GET")
+	r.HandleFunc("/tokens", n.createIssueTokenHandler()).Methods("POST")
+	r.HandleFunc("/tokens/{id}", n.createTokenHandler()).Methods("GET")
+	r.HandleFunc("/tokens/{id}/send", n.createSendTokenHandler()).Methods("POST")
+	r.HandleFunc("/wallet/tokens", n.createWalletTokensHandler()).Methods("GET")
+	r.HandleFunc("/channels", n.createChannelsHandler()).Methods("GET")
+	r.HandleFunc("/channels", n.createOpenChannelApiHandler()).Methods("POST")
+	r.HandleFunc("/channels/{id}", n.createChannelStatusHandler()).Methods("GET")
+	r.HandleFunc("/channels/{id}/pay", n.createPayChannelHandler()).Methods("POST")
+	r.HandleFunc("/channels/{id}/close", n.createCloseChannelHandler()).Methods("POST")
+	r.HandleFunc("/channels/{id}/refund", n.createRefundChannelHandler()).Methods("POST")
 	return r
 }
 
@@ -34,9 +63,41 @@ func (n *Node) ServeApiForCli(port string) {
 	log.Println("CLI Server exited:", srv.ListenAndServe())
 }
 
+// Finds the account selected by the 'account' query parameter, the default one if missing
+func (n *Node) requestAccount(r *http.Request) (*backend.Wallet, error) {
+	name := r.URL.Query().Get("account")
+	if name == "" {
+		name = DefaultAccount
+	}
+	wallet, ok := n.Accounts.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("account %s not found", name)
+	}
+	return wallet, nil
+}
+
+// Rejects requests that need the account to sign, if it is watch-only
+func refuseWatchOnly(w http.ResponseWriter, wallet *backend.Wallet) bool {
+	if !wallet.IsWatchOnly() {
+		return false
+	}
+	http.Error(w, fmt.Sprintf("Account %s is watch-only, it cannot sign transactions", wallet.Address()), http.StatusForbidden)
+	return true
+}
+
 func (n *Node) createGiveBalanceHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintf(w, "Your balance is: %d", n.Wallet.Balance)
+		wallet, err := n.requestAccount(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		minConf, err := parseIntParam(r.URL.Query().Get("minConf"), 1)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid query: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(n.WalletBalance(wallet, minConf))
 	}
 }
 
@@ -58,27 +119,95 @@ func (n *Node) createGiveLastBlockHandler() http.HandlerFunc {
 }
 
 type reqTx struct {
-	Recipient int `json:"recipient"`
-	Amount    int `json:"amount"`
+	Recipient int             `json:"recipient"`
+	Address   backend.Address `json:"address,omitempty"`
+	Amount    int             `json:"amount"`
+	Strategy  string          `json:"strategy,omitempty"`
+	Split     string          `json:"split,omitempty"`
+	LockUntil int64           `json:"lockUntil,omitempty"` // lock time of the outputs paying the recipient
+	NotBefore int64           `json:"notBefore,omitempty"` // lock time of the transaction itself
+	Memo      string          `json:"memo,omitempty"`      // sealed to the recipient
+}
+
+// Transaction options requested by the cli, on top of the wallet defaults
+func (tx *reqTx) options() (*backend.TxOptions, error) {
+	selector, err := backend.GetCoinSelector(tx.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	splitPolicy, err := backend.ParseSplitPolicy(tx.Split)
+	if err != nil {
+		return nil, err
+	}
+	if tx.LockUntil < 0 || tx.NotBefore < 0 {
+		return nil, fmt.Errorf("lock times must not be negative")
+	}
+	return &backend.TxOptions{CoinSelector: selector, SplitPolicy: splitPolicy, LockTime: tx.NotBefore}, nil
+}
+
+// Finds the address of the recipient, either given directly or by its node id
+func (n *Node) findRecipient(tx *reqTx) (backend.Address, error) {
+	if tx.Address != "" {
+		return backend.ParseAddress(string(tx.Address))
+	}
+	for _, nInfo := range n.Ring {
+		if nInfo.Id == tx.Recipient {
+			return nInfo.WInfo.Address(), nil
+		}
+	}
+	return "", fmt.Errorf("node %d is not in the ring", tx.Recipient)
+}
+
+func (tx *reqTx) recipientString() string {
+	if tx.Address != "" {
+		return fmt.Sprintf("address %s", tx.Address)
+	}
+	return fmt.Sprintf("node %d", tx.Recipient)
 }
 
 func (n *Node) createAcceptAndSubmitTx() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		wallet, err := n.requestAccount(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if refuseWatchOnly(w, wallet) {
+			return
+		}
 		var tx reqTx
-		err := json.NewDecoder(r.Body).Decode(&tx)
+		err = json.NewDecoder(r.Body).Decode(&tx)
 		if err != nil {
 			errMsg := fmt.Sprintf("Body could not be desirialized: %s", err.Error())
 			http.Error(w, errMsg, http.StatusBadRequest)
 			return
 		}
-		var address *rsa.PublicKey
-		for _, nInfo := range n.Ring {
-			if nInfo.Id == tx.Recipient {
-				address = nInfo.WInfo.PubKey
-				break
+		address, err := n.findRecipient(&tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts, err := tx.options()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if tx.Memo != "" {
+			recipientKey, ok := n.Ledger.PublicKey(address)
+			if !ok {
+				http.Error(w, fmt.Sprintf("The public key of %s is not known yet, a memo cannot be sealed to it", address), http.StatusBadRequest)
+				return
+			}
+			if opts.Memo, err = backend.SealMemo(recipientKey, tx.Memo); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
 			}
 		}
-		createdTx, err := n.Wallet.CreateAndSignTx(tx.Amount, address)
+		createdTx, selection, err := wallet.CreateAndSignTxWithOptions(opts, &backend.TxTargetTy{
+			Address:  address,
+			Amount:   tx.Amount,
+			LockTime: tx.LockUntil,
+		})
 		if err != nil {
 			errMsg := fmt.Sprintf("Creating transaction error: %s", err.Error())
 			log.Println(errMsg)
@@ -86,56 +215,109 @@ func (n *Node) createAcceptAndSubmitTx() http.HandlerFunc {
 			return
 		}
 
-		err = n.AcceptTx(createdTx)
+		err = n.SubmitOwnTx(createdTx)
 		if err != nil {
-			errMsg := fmt.Sprintf("Accepting transaction error: %s", err.Error())
-			log.Println(errMsg)
-			http.Error(w, errMsg, http.StatusInternalServerError)
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		fmt.Fprintf(w, "Submitted transaction %s to %s for %d (%s)",
+			backend.HexEncodeByteSlice(createdTx.Id), tx.recipientString(), tx.Amount, selection)
+	}
+}
 
-		err = n.BroadcastTx(createdTx)
-		if err != nil {
+// Accepts a transaction built and signed outside the node, e.g. with a cold storage key
+func (n *Node) createSubmitRawTxHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var tx backend.Transaction
+		if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+			errMsg := fmt.Sprintf("Body could not be desirialized: %s", err.Error())
+			http.Error(w, errMsg, http.StatusBadRequest)
+			return
+		}
+		if tx.IsGenesis() {
+			http.Error(w, "Raw transaction spends no inputs", http.StatusBadRequest)
+			return
+		}
+		if err := n.AcceptTx(&tx); err != nil {
+			http.Error(w, fmt.Sprintf("Accepting transaction error: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		if err := n.BroadcastTx(&tx); err != nil {
 			errMsg := fmt.Sprintf("Broadcasting transaction error: %s", err.Error())
 			log.Println(errMsg)
 			http.Error(w, errMsg, http.StatusInternalServerError)
 			return
 		}
-		fmt.Fprintf(w, "Submitted transaction to node %d for %d", tx.Recipient, tx.Amount)
+		fmt.Fprintf(w, "Submitted raw transaction %s", backend.HexEncodeByteSlice(tx.Id))
 	}
 }
 
-func (n *Node) createGiveUtxosHandler() http.HandlerFunc {
-	type minimalUtxo struct {
-		TxId   string `json:"txId"`
-		Id     string `json:"id"`
-		Amount int    `json:"amount"`
+// Returns the full unspent outputs of any address, for building transactions outside the node.
+//
+// Outputs already spent by pending transactions, or still locked, are left out.
+func (n *Node) createAddressUtxosHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		address, err := backend.ParseAddress(mux.Vars(r)["address"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		utxos := []*backend.TxOut{}
+		if e, ok := n.Ledger.Get(address); ok {
+			spent := n.txIndex.PendingInputs()
+			height, medianTime := n.lockContext()
+			for _, utxo := range e.WalletInfoSnapshot().Utxos {
+				if !spent.Contains(utxo.Id) && backend.IsLockFinal(utxo.LockTime, height, medianTime) {
+					utxos = append(utxos, utxo)
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(utxos)
 	}
-	utxoToMinimal := func(utxo *backend.TxOut) minimalUtxo {
-		return minimalUtxo{
+}
+
+type minimalUtxo struct {
+	TxId   string `json:"txId"`
+	Id     string `json:"id"`
+	Amount int    `json:"amount"`
+	Asset  string `json:"asset,omitempty"`
+}
+
+func utxosToMinimal(utxos []*backend.TxOut) []minimalUtxo {
+	minimalUtxos := make([]minimalUtxo, 0, len(utxos))
+	for _, utxo := range utxos {
+		minimalUtxos = append(minimalUtxos, minimalUtxo{
 			TxId:   utxo.TransactionId,
 			Id:     utxo.Id,
 			Amount: utxo.Amount,
-		}
+			Asset:  utxo.Asset,
+		})
 	}
+	return minimalUtxos
+}
+
+func (n *Node) createGiveUtxosHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		utxos := n.Wallet.Utxos
-		minimalUtxos := make([]minimalUtxo, 0, len(utxos))
-		for _, utxo := range utxos {
-			minimalUtxos = append(minimalUtxos, utxoToMinimal(utxo))
+		wallet, err := n.requestAccount(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
 		}
-		json.NewEncoder(w).Encode(minimalUtxos)
+		unreserved, reserved := wallet.ListUtxos()
+		json.NewEncoder(w).Encode(utxosToMinimal(append(unreserved, reserved...)))
 	}
 }
 
 func (n *Node) createStatsHandler() http.HandlerFunc {
 	type blockTimeInfo struct {
-		Latest       string `json:"latest"`
-		Avg          string `json:"avg"`
-		Total        string `json:"total"`
-		ChainLength  int    `json:"chainLength"`
-		TxCount      int    `json:"txCount"`
-		TxThroughput string `json:"txThroughput"`
+		Address      backend.Address `json:"address"`
+		Latest       string          `json:"latest"`
+		Avg          string          `json:"avg"`
+		Total        string          `json:"total"`
+		ChainLength  int             `json:"chainLength"`
+		TxCount      int             `json:"txCount"`
+		TxThroughput string          `json:"txThroughput"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		var txCount int
@@ -145,6 +327,7 @@ func (n *Node) createStatsHandler() http.HandlerFunc {
 		}
 		txThroughput := fmt.Sprintf("%f txs/s", float64(txCount)/(float64(AllTxsDuration)/1000000000))
 		json.NewEncoder(w).Encode(blockTimeInfo{
+			Address:      n.Wallet.Address(),
 			Latest:       strconv.Itoa(int(LastBlockTime/1000)) + "ms",
 			Avg:          strconv.Itoa(int(AverageBlockTime/1000)) + "ms",
 			Total:        strconv.Itoa(int(TotalBlockTimes/1000)) + "ms",
@@ -154,3 +337,696 @@ func (n *Node) createStatsHandler() http.HandlerFunc {
 		})
 	}
 }
+
+type reqConsolidate struct {
+	MaxInputs int `json:"maxInputs"`
+	Threshold int `json:"threshold"`
+}
+
+func (n *Node) createConsolidateHandler() http.HandlerFunc {
+	type consolidateReply struct {
+		TxId      string `json:"txId"`
+		Reduction int    `json:"reduction"`
+		*backend.Consolidation
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		wallet, err := n.requestAccount(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if refuseWatchOnly(w, wallet) {
+			return
+		}
+		req := reqConsolidate{
+			MaxInputs: ConsolidateMaxInputs,
+			Threshold: ConsolidateThreshold,
+		}
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			errMsg := fmt.Sprintf("Body could not be desirialized: %s", err.Error())
+			http.Error(w, errMsg, http.StatusBadRequest)
+			return
+		}
+		tx, consolidation, err := n.Consolidate(wallet, req.MaxInputs, req.Threshold)
+		if err != nil {
+			errMsg := fmt.Sprintf("Consolidation error: %s", err.Error())
+			log.Println(errMsg)
+			http.Error(w, errMsg, http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(consolidateReply{
+			TxId:          backend.HexEncodeByteSlice(tx.Id),
+			Reduction:     consolidation.Reduction(),
+			Consolidation: consolidation,
+		})
+	}
+}
+
+type txStatusTy struct {
+	Id            string               `json:"id"`
+	Status        TxStatus             `json:"status"`
+	BlockHeight   int                  `json:"blockHeight"`
+	Confirmations int                  `json:"confirmations"`
+	ReplacedBy    string               `json:"replacedBy,omitempty"`
+	Transaction   *backend.Transaction `json:"transaction"`
+}
+
+func (n *Node) createTxStatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txId := mux.Vars(r)["id"]
+		e, ok := n.txIndex.Get(txId)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Transaction %s not found", txId), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(txStatusTy{
+			Id:            txId,
+			Status:        e.Status,
+			BlockHeight:   e.BlockHeight,
+			Confirmations: confirmations(e, len(n.Chain)),
+			ReplacedBy:    e.ReplacedBy,
+			Transaction:   e.Tx,
+		})
+	}
+}
+
+type reqReplaceTx struct {
+	Fee       int             `json:"fee"`
+	Recipient int             `json:"recipient"`
+	Address   backend.Address `json:"address,omitempty"`
+	Amount    int             `json:"amount,omitempty"` // keep the payments of the original if 0
+}
+
+func (n *Node) createReplaceTxHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wallet, err := n.requestAccount(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if refuseWatchOnly(w, wallet) {
+			return
+		}
+		var req reqReplaceTx
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errMsg := fmt.Sprintf("Body could not be desirialized: %s", err.Error())
+			http.Error(w, errMsg, http.StatusBadRequest)
+			return
+		}
+		var targets []*backend.TxTargetTy
+		if req.Amount > 0 {
+			address, err := n.findRecipient(&reqTx{Recipient: req.Recipient, Address: req.Address})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			targets = append(targets, &backend.TxTargetTy{Address: address, Amount: req.Amount})
+		}
+		txId := mux.Vars(r)["id"]
+		tx, err := n.ReplaceTx(txId, func(original *backend.Transaction) (*backend.Transaction, error) {
+			return wallet.CreateAndSignReplacementTx(original, req.Fee, targets...)
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Replacing transaction error: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "Replaced transaction %s with %s, paying a fee of %d", txId, backend.HexEncodeByteSlice(tx.Id), tx.Fee())
+	}
+}
+
+func (n *Node) createCancelTxHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wallet, err := n.requestAccount(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if refuseWatchOnly(w, wallet) {
+			return
+		}
+		txId := mux.Vars(r)["id"]
+		tx, err := n.ReplaceTx(txId, wallet.CreateAndSignCancellationTx)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Cancelling transaction error: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "Cancelled transaction %s with the payment to self %s", txId, backend.HexEncodeByteSlice(tx.Id))
+	}
+}
+
+// Parses a time given either in RFC3339 or as unix seconds
+func parseTimeParam(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func parseIntParam(s string, defaultValue int) (int, error) {
+	if s == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(s)
+}
+
+func parseHistoryFilter(r *http.Request) (filter *HistoryFilter, err error) {
+	query := r.URL.Query()
+	filter = &HistoryFilter{}
+	if filter.Since, err = parseTimeParam(query.Get("since")); err != nil {
+		return
+	}
+	if filter.Until, err = parseTimeParam(query.Get("until")); err != nil {
+		return
+	}
+	if filter.FromHeight, err = parseIntParam(query.Get("fromHeight"), 0); err != nil {
+		return
+	}
+	if filter.ToHeight, err = parseIntParam(query.Get("toHeight"), 0); err != nil {
+		return
+	}
+	if filter.Offset, err = parseIntParam(query.Get("offset"), 0); err != nil {
+		return
+	}
+	if filter.Limit, err = parseIntParam(query.Get("limit"), 50); err != nil {
+		return
+	}
+	if filter.Offset < 0 || filter.Limit < 0 {
+		err = fmt.Errorf("offset and limit must not be negative")
+	}
+	return
+}
+
+func (n *Node) createWalletHistoryHandler() http.HandlerFunc {
+	type historyPage struct {
+		Address   backend.Address `json:"address"`
+		WatchOnly bool            `json:"watchOnly"`
+		Total     int             `json:"total"`
+		Offset    int             `json:"offset"`
+		Limit     int             `json:"limit"`
+		Entries   []*HistoryEntry `json:"entries"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		wallet, err := n.requestAccount(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		filter, err := parseHistoryFilter(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid query: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		address := wallet.Address()
+		entries, total := n.WalletHistory(wallet, filter)
+		json.NewEncoder(w).Encode(historyPage{
+			Address:   address,
+			WatchOnly: wallet.IsWatchOnly(),
+			Total:     total,
+			Offset:    filter.Offset,
+			Limit:     filter.Limit,
+			Entries:   entries,
+		})
+	}
+}
+
+type walletAddressesTy struct {
+	HD        bool              `json:"hd"`
+	Addresses []backend.Address `json:"addresses"`
+}
+
+func (n *Node) createWalletAddressesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wallet, err := n.requestAccount(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(walletAddressesTy{
+			HD:        wallet.IsHD(),
+			Addresses: wallet.Addresses(),
+		})
+	}
+}
+
+func (n *Node) createNewAddressHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wallet, err := n.requestAccount(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		address, err := wallet.NewAddress()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, address)
+	}
+}
+
+func (n *Node) createRescanHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wallet, err := n.requestAccount(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, "Found %d new UTXO(s)", n.RescanWallet(wallet))
+	}
+}
+
+type accountTy struct {
+	Name      string          `json:"name"`
+	Address   backend.Address `json:"address"`
+	HD        bool            `json:"hd"`
+	WatchOnly bool            `json:"watchOnly"`
+	Spendable int             `json:"spendable"`
+	UtxoCount int             `json:"utxoCount"`
+}
+
+func (n *Node) createAccountsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		names := n.Accounts.Names()
+		accounts := make([]accountTy, 0, len(names))
+		for _, name := range names {
+			wallet, _ := n.Accounts.Get(name)
+			accounts = append(accounts, accountTy{
+				Name:      name,
+				Address:   wallet.Address(),
+				HD:        wallet.IsHD(),
+				WatchOnly: wallet.IsWatchOnly(),
+				Spendable: wallet.SpendableBalance(),
+				UtxoCount: wallet.UtxoCount(),
+			})
+		}
+		json.NewEncoder(w).Encode(accounts)
+	}
+}
+
+type reqWatch struct {
+	Name   string `json:"name"`
+	Target string `json:"target"` // address or PEM public key
+}
+
+func (n *Node) createWatchHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req reqWatch
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errMsg := fmt.Sprintf("Body could not be desirialized: %s", err.Error())
+			http.Error(w, errMsg, http.StatusBadRequest)
+			return
+		}
+		address, pubKey, err := backend.ParseWatchTarget(req.Target)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		found, err := n.WatchAddress(req.Name, address, pubKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "Watching %s as account %s, found %d UTXO(s)", address, req.Name, found)
+	}
+}
+
+type ringWalletTy struct {
+	Id        int             `json:"id"`
+	Address   backend.Address `json:"address"`
+	Balance   int             `json:"balance"`
+	UtxoCount int             `json:"utxoCount"`
+	Tokens    map[string]int  `json:"tokens,omitempty"` // balance in every token, by token id
+}
+
+func newRingWallet(id int, wInfo *backend.WalletInfo) ringWalletTy {
+	wallet := ringWalletTy{
+		Id:        id,
+		Address:   wInfo.Address(),
+		Balance:   wInfo.Balance,
+		UtxoCount: len(wInfo.Utxos),
+	}
+	for _, utxo := range wInfo.Utxos {
+		if utxo.IsNative() {
+			continue
+		}
+		if wallet.Tokens == nil {
+			wallet.Tokens = map[string]int{}
+		}
+		wallet.Tokens[utxo.Asset] += utxo.Amount
+	}
+	return wallet
+}
+
+func (n *Node) createRingWalletsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		members := n.ringMembers()
+		wallets := make([]ringWalletTy, 0, len(members))
+		for _, nInfo := range members {
+			wallets = append(wallets, newRingWallet(nInfo.Id, nInfo.WalletInfoSnapshot()))
+		}
+		json.NewEncoder(w).Encode(wallets)
+	}
+}
+
+func (n *Node) createRingWalletHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nInfo, err := n.findRingMember(mux.Vars(r)["member"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(newRingWallet(nInfo.Id, nInfo.WalletInfoSnapshot()))
+	}
+}
+
+func (n *Node) createRingWalletUtxosHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nInfo, err := n.findRingMember(mux.Vars(r)["member"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		wInfo := nInfo.WalletInfoSnapshot()
+		utxos := make([]*backend.TxOut, 0, len(wInfo.Utxos))
+		for _, utxo := range wInfo.Utxos {
+			utxos = append(utxos, utxo)
+		}
+		json.NewEncoder(w).Encode(utxosToMinimal(utxos))
+	}
+}
+
+// Invoices expire after an hour, unless the request sets their expiry
+const defaultInvoiceExpiry = time.Hour
+
+type reqInvoice struct {
+	Amount      int    `json:"amount"`
+	Expiry      string `json:"expiry,omitempty"`    // RFC3339 or unix seconds
+	ExpiresIn   string `json:"expiresIn,omitempty"` // duration from now, e.g. 30m, if expiry is not set
+	Description string `json:"description,omitempty"`
+}
+
+func (req *reqInvoice) expiry() (time.Time, error) {
+	if req.Expiry != "" {
+		return parseTimeParam(req.Expiry)
+	}
+	expiresIn := defaultInvoiceExpiry
+	if req.ExpiresIn != "" {
+		var err error
+		if expiresIn, err = time.ParseDuration(req.ExpiresIn); err != nil {
+			return time.Time{}, err
+		}
+		if expiresIn <= 0 {
+			return time.Time{}, fmt.Errorf("expiresIn must be positive, got %s", req.ExpiresIn)
+		}
+	}
+	return time.Now().Add(expiresIn), nil
+}
+
+func (n *Node) createNewInvoiceHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		account := r.URL.Query().Get("account")
+		if account == "" {
+			account = DefaultAccount
+		}
+		var req reqInvoice
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errMsg := fmt.Sprintf("Body could not be desirialized: %s", err.Error())
+			http.Error(w, errMsg, http.StatusBadRequest)
+			return
+		}
+		expiry, err := req.expiry()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid expiry: %s", err), http.StatusBadRequest)
+			return
+		}
+		if !expiry.After(time.Now()) {
+			http.Error(w, "Invoice would already be expired", http.StatusBadRequest)
+			return
+		}
+		if _, ok := n.Accounts.Get(account); !ok {
+			http.Error(w, fmt.Sprintf("account %s not found", account), http.StatusNotFound)
+			return
+		}
+		entry, err := n.CreateInvoice(account, req.Amount, expiry, req.Description)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(entry)
+	}
+}
+
+func (n *Node) createInvoicesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(n.Invoices.List(r.URL.Query().Get("account")))
+	}
+}
+
+func (n *Node) createInvoiceStatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		entry, ok := n.Invoices.Get(id)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Invoice %s not found", id), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(entry)
+	}
+}
+
+type reqIssueToken struct {
+	Name   string `json:"name"`
+	Supply int    `json:"supply"`
+}
+
+func (n *Node) createIssueTokenHandler() http.HandlerFunc {
+	type issueReply struct {
+		TxId  string `json:"txId"`
+		Token string `json:"token"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		wallet, err := n.requestAccount(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if refuseWatchOnly(w, wallet) {
+			return
+		}
+		var req reqIssueToken
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errMsg := fmt.Sprintf("Body could not be desirialized: %s", err.Error())
+			http.Error(w, errMsg, http.StatusBadRequest)
+			return
+		}
+		tx, err := wallet.CreateAndSignIssuanceTx(req.Name, req.Supply)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Issuing token error: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		if err := n.SubmitOwnTx(tx); err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(issueReply{
+			TxId:  backend.HexEncodeByteSlice(tx.Id),
+			Token: tx.IssuedAsset(),
+		})
+	}
+}
+
+func (n *Node) createTokensHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(n.Tokens.List())
+	}
+}
+
+func (n *Node) createTokenHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		info, ok := n.Tokens.Get(id)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Token %s not found", id), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(info)
+	}
+}
+
+func (n *Node) createSendTokenHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wallet, err := n.requestAccount(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if refuseWatchOnly(w, wallet) {
+			return
+		}
+		asset := mux.Vars(r)["id"]
+		if _, ok := n.Tokens.Get(asset); !ok {
+			http.Error(w, fmt.Sprintf("Token %s not found", asset), http.StatusNotFound)
+			return
+		}
+		var req reqTx
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errMsg := fmt.Sprintf("Body could not be desirialized: %s", err.Error())
+			http.Error(w, errMsg, http.StatusBadRequest)
+			return
+		}
+		address, err := n.findRecipient(&req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts, err := req.options()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tx, err := wallet.CreateAndSignTokenTx(asset, opts, &backend.TxTargetTy{
+			Address:  address,
+			Amount:   req.Amount,
+			LockTime: req.LockUntil,
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Creating transaction error: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		if err := n.SubmitOwnTx(tx); err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "Submitted transaction %s to %s for %d of token %s",
+			backend.HexEncodeByteSlice(tx.Id), req.recipientString(), req.Amount, asset)
+	}
+}
+
+func (n *Node) createWalletTokensHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wallet, err := n.requestAccount(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		balances := n.TokenBalances(wallet)
+		if balances == nil {
+			balances = []*TokenBalance{}
+		}
+		json.NewEncoder(w).Encode(balances)
+	}
+}
+
+type reqOpenChannel struct {
+	Recipient int             `json:"recipient"`
+	Address   backend.Address `json:"address,omitempty"`
+	Capacity  int             `json:"capacity"`
+	Lifetime  int64           `json:"lifetime,omitempty"` // blocks until the timeout, DefaultChannelLifetime if 0
+}
+
+func (n *Node) createOpenChannelApiHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		account := r.URL.Query().Get("account")
+		if account == "" {
+			account = DefaultAccount
+		}
+		wallet, err := n.requestAccount(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if refuseWatchOnly(w, wallet) {
+			return
+		}
+		req := reqOpenChannel{Lifetime: DefaultChannelLifetime}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errMsg := fmt.Sprintf("Body could not be desirialized: %s", err.Error())
+			http.Error(w, errMsg, http.StatusBadRequest)
+			return
+		}
+		member := string(req.Address)
+		if member == "" {
+			member = strconv.Itoa(req.Recipient)
+		}
+		peer, err := n.findRingMember(member)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entry, err := n.OpenChannel(account, peer, req.Capacity, req.Lifetime)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Opening channel error: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(entry)
+	}
+}
+
+func (n *Node) createChannelsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(n.ListChannels(r.URL.Query().Get("account")))
+	}
+}
+
+func (n *Node) createChannelStatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		entry, ok := n.GetChannel(id)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Channel %s not found", id), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(entry)
+	}
+}
+
+type reqPayChannel struct {
+	Amount int `json:"amount"`
+}
+
+func (n *Node) createPayChannelHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req reqPayChannel
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			errMsg := fmt.Sprintf("Body could not be desirialized: %s", err.Error())
+			http.Error(w, errMsg, http.StatusBadRequest)
+			return
+		}
+		entry, err := n.PayChannel(mux.Vars(r)["id"], req.Amount)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Channel payment error: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(entry)
+	}
+}
+
+func (n *Node) createCloseChannelHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		tx, err := n.CloseChannel(id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Closing channel error: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "Submitted transaction %s closing channel %s", backend.HexEncodeByteSlice(tx.Id), id)
+	}
+}
+
+func (n *Node) createRefundChannelHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		tx, err := n.RefundChannel(id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Refunding channel error: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "Submitted transaction %s refunding channel %s", backend.HexEncodeByteSlice(tx.Id), id)
+	}
+}
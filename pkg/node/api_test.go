@@ -0,0 +1,550 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+func TestTxStatusHandler(t *testing.T) {
+	t.Run("Query a pending transaction", func(t *testing.T) {
+		newTx, err := testNode.Wallet.CreateAndSignTx(1, testNode.Wallet.Address())
+		if err != nil {
+			log.Fatalln(err)
+		}
+		txId := backend.HexEncodeByteSlice(newTx.Id)
+		// release the reserved utxos for the rest of the tests
+		defer testNode.EvictTxs([]string{txId})
+		if err := testNode.AcceptTx(newTx); err != nil {
+			log.Fatalln(err)
+		}
+		req := httptest.NewRequest("GET", "/tx/"+txId, nil)
+		w := httptest.NewRecorder()
+		testNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Error("Did not get expected HTTP status code, got", w.Code)
+			return
+		}
+		var status txStatusTy
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+			t.Error(err)
+			return
+		}
+		if status.Status != TxPending {
+			t.Errorf("Expected status %s, got %s", TxPending, status.Status)
+		}
+	})
+	t.Run("Query an unknown transaction", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/tx/unknown", nil)
+		w := httptest.NewRecorder()
+		testNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+}
+
+func TestBalanceHandler(t *testing.T) {
+	t.Run("Balance of the wallet", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/balance?minConf=1", nil)
+		w := httptest.NewRecorder()
+		testNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var balance BalanceBreakdown
+		if err := json.Unmarshal(w.Body.Bytes(), &balance); err != nil {
+			t.Fatal(err)
+		}
+		if balance.Address != testNode.Wallet.Address() {
+			t.Errorf("Expected the balance of %s, got the one of %s", testNode.Wallet.Address(), balance.Address)
+		}
+	})
+	t.Run("Balance with an invalid confirmation count", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/balance?minConf=many", nil)
+		w := httptest.NewRecorder()
+		testNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
+
+func TestRingWalletHandler(t *testing.T) {
+	t.Run("Query the bootstrap wallet by id", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/wallets/0", nil)
+		w := httptest.NewRecorder()
+		testNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Error("Did not get expected HTTP status code, got", w.Code)
+			return
+		}
+		var wallet ringWalletTy
+		if err := json.Unmarshal(w.Body.Bytes(), &wallet); err != nil {
+			t.Error(err)
+			return
+		}
+		if wallet.Address != testNode.Wallet.Address() {
+			t.Errorf("Expected address %s, got %s", testNode.Wallet.Address(), wallet.Address)
+		}
+		if wallet.Balance != 500 {
+			t.Errorf("Expected balance %d, got %d", 500, wallet.Balance)
+		}
+	})
+	t.Run("Query an unknown wallet", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/wallets/42", nil)
+		w := httptest.NewRecorder()
+		testNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+}
+
+func TestWalletAddressesHandler(t *testing.T) {
+	t.Run("List the addresses of a single key wallet", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/wallet/addresses", nil)
+		w := httptest.NewRecorder()
+		testNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Error("Did not get expected HTTP status code, got", w.Code)
+			return
+		}
+		var reply walletAddressesTy
+		if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+			t.Error(err)
+			return
+		}
+		if reply.HD || len(reply.Addresses) != 1 || reply.Addresses[0] != testNode.Wallet.Address() {
+			t.Errorf("Expected only address %s, got %v", testNode.Wallet.Address(), reply)
+		}
+	})
+	t.Run("Ask a single key wallet for a new address", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/wallet/addresses", nil)
+		w := httptest.NewRecorder()
+		testNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
+
+func TestAccountsHandler(t *testing.T) {
+	alice := backend.NewWallet(backend.DefaultKeyType)
+	if err := testNode.Accounts.Add("alice", alice); err != nil {
+		log.Fatalln(err)
+	}
+	t.Run("List the hosted accounts", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/accounts", nil)
+		w := httptest.NewRecorder()
+		testNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Error("Did not get expected HTTP status code, got", w.Code)
+			return
+		}
+		var accounts []accountTy
+		if err := json.Unmarshal(w.Body.Bytes(), &accounts); err != nil {
+			t.Error(err)
+			return
+		}
+		if len(accounts) != 2 || accounts[0].Name != "alice" || accounts[0].Address != alice.Address() {
+			t.Errorf("Expected accounts alice and %s, got %v", DefaultAccount, accounts)
+		}
+	})
+	t.Run("Query the addresses of an account", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/wallet/addresses?account=alice", nil)
+		w := httptest.NewRecorder()
+		testNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Error("Did not get expected HTTP status code, got", w.Code)
+			return
+		}
+		var reply walletAddressesTy
+		if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+			t.Error(err)
+			return
+		}
+		if len(reply.Addresses) != 1 || reply.Addresses[0] != alice.Address() {
+			t.Errorf("Expected only address %s, got %v", alice.Address(), reply.Addresses)
+		}
+	})
+	t.Run("Query an unknown account", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/balance?account=bob", nil)
+		w := httptest.NewRecorder()
+		testNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+}
+
+func TestWatchOnlyAccount(t *testing.T) {
+	// a separate node, whose genesis pays a wallet it does not hold
+	external := backend.NewWallet(backend.DefaultKeyType)
+	auditNode := newFundedTestNode(t, external.PrivKey.Public())
+	t.Run("Watch an external address", func(t *testing.T) {
+		jsReq, err := json.Marshal(reqWatch{Name: "audit", Target: string(external.Address())})
+		if err != nil {
+			log.Fatalln(err)
+		}
+		req := httptest.NewRequest("POST", "/accounts/watch", bytes.NewReader(jsReq))
+		w := httptest.NewRecorder()
+		auditNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Error("Did not get expected HTTP status code, got", w.Code, w.Body.String())
+			return
+		}
+		expected := fmt.Sprintf("Watching %s as account audit, found 1 UTXO(s)", external.Address())
+		if w.Body.String() != expected {
+			t.Errorf("Expected body %s, got %s", expected, w.Body.String())
+		}
+	})
+	t.Run("Query the balance of a watch-only account", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/balance?account=audit", nil)
+		w := httptest.NewRecorder()
+		auditNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Error("Did not get expected HTTP status code, got", w.Code)
+		}
+	})
+	t.Run("Submit from a watch-only account", func(t *testing.T) {
+		jsTx, err := json.Marshal(reqTx{Address: auditNode.Wallet.Address(), Amount: 1})
+		if err != nil {
+			log.Fatalln(err)
+		}
+		req := httptest.NewRequest("POST", "/submit?account=audit", bytes.NewReader(jsTx))
+		w := httptest.NewRecorder()
+		auditNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status code %d, got %d", http.StatusForbidden, w.Code)
+		}
+	})
+}
+
+func TestSubmitRawTxHandler(t *testing.T) {
+	// the cold key is only known to the test, never to the node
+	coldWallet := backend.NewWallet(backend.DefaultKeyType)
+	coldNode := newFundedTestNode(t, coldWallet.PrivKey.Public())
+	getUtxos := func() []*backend.TxOut {
+		req := httptest.NewRequest("GET", "/utxos/"+coldWallet.Address().String(), nil)
+		w := httptest.NewRecorder()
+		coldNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			log.Fatalln("Did not get expected HTTP status code, got", w.Code)
+		}
+		var utxos []*backend.TxOut
+		if err := json.Unmarshal(w.Body.Bytes(), &utxos); err != nil {
+			log.Fatalln(err)
+		}
+		return utxos
+	}
+	t.Run("Submit a malformed transaction", func(t *testing.T) {
+		tx, _, err := backend.BuildTx(coldWallet.PrivKey.Public(), getUtxos(), nil, &backend.TxTargetTy{
+			Address: coldNode.Wallet.Address(),
+			Amount:  10,
+		})
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if err := backend.SignTxWithKey(tx, coldWallet.PrivKey); err != nil {
+			log.Fatalln(err)
+		}
+		jsTx, err := json.Marshal(tx)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for malformed, edit := range map[string]func(m map[string]interface{}){
+			"sender key": func(m map[string]interface{}) {
+				m["senderKey"] = "-----BEGIN PUBLIC KEY-----\nnot a key\n-----END PUBLIC KEY-----\n"
+			},
+			"owner of an output": func(m map[string]interface{}) {
+				m["outputs"].([]interface{})[0].(map[string]interface{})["owner"] = "not a key"
+			},
+			"key of an input signature": func(m map[string]interface{}) {
+				m["inputSigs"] = map[string]interface{}{"input": map[string]interface{}{"key": "not a key", "signature": "00"}}
+			},
+			"signature hex": func(m map[string]interface{}) { m["signature"] = "not hex" },
+			"memo hex":      func(m map[string]interface{}) { m["memo"] = "not hex" },
+		} {
+			var m map[string]interface{}
+			if err := json.Unmarshal(jsTx, &m); err != nil {
+				log.Fatalln(err)
+			}
+			edit(m)
+			body, err := json.Marshal(m)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			req := httptest.NewRequest("POST", "/submit-raw", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			coldNode.setupCliHandler().ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status code %d for a malformed %s, got %d", http.StatusBadRequest, malformed, w.Code)
+			}
+		}
+	})
+	t.Run("Submit a transaction signed outside the node", func(t *testing.T) {
+		utxos := getUtxos()
+		if len(utxos) != 1 {
+			t.Errorf("Expected %d utxo, got %d", 1, len(utxos))
+			return
+		}
+		tx, _, err := backend.BuildTx(coldWallet.PrivKey.Public(), utxos, nil, &backend.TxTargetTy{
+			Address: coldNode.Wallet.Address(),
+			Amount:  10,
+		})
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if err := backend.SignTxWithKey(tx, coldWallet.PrivKey); err != nil {
+			log.Fatalln(err)
+		}
+		jsTx, err := json.Marshal(tx)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		req := httptest.NewRequest("POST", "/submit-raw", bytes.NewReader(jsTx))
+		w := httptest.NewRecorder()
+		coldNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Error("Did not get expected HTTP status code, got", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestSubmitMemoHandler(t *testing.T) {
+	memoNode := newFundedTestNode(t, nil)
+	shop := backend.NewWallet(backend.DefaultKeyType)
+	if err := memoNode.Accounts.Add("shop", shop); err != nil {
+		log.Fatalln(err)
+	}
+	funding, err := memoNode.Wallet.CreateAndSignTx(100, shop.Address())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := memoNode.ApplyTx(funding); err != nil {
+		log.Fatalln(err)
+	}
+	submit := func(account string, request map[string]interface{}) *httptest.ResponseRecorder {
+		jsTx, err := json.Marshal(request)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		req := httptest.NewRequest("POST", "/submit?account="+account, bytes.NewReader(jsTx))
+		w := httptest.NewRecorder()
+		memoNode.setupCliHandler().ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Memo to an address whose key is unknown", func(t *testing.T) {
+		w := submit(DefaultAccount, map[string]interface{}{"address": shop.Address(), "amount": 10, "memo": "invoice 41"})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+	t.Run("Memo sealed to a known key", func(t *testing.T) {
+		w := submit("shop", map[string]interface{}{"recipient": 0, "amount": 10, "memo": "invoice 42"})
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestInvoicesHandler(t *testing.T) {
+	invoiceNode := newFundedTestNode(t, nil)
+	var invoice InvoiceEntry
+	t.Run("Create an invoice", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/invoices", strings.NewReader(`{"amount": 100, "expiresIn": "1h", "description": "2 coffees"}`))
+		w := httptest.NewRecorder()
+		invoiceNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &invoice); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("Create an invoice with an invalid expiry", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/invoices", strings.NewReader(`{"amount": 100, "expiresIn": "soon"}`))
+		w := httptest.NewRecorder()
+		invoiceNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+	t.Run("Query an invoice", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/invoices/"+invoice.Invoice.Id, nil)
+		w := httptest.NewRecorder()
+		invoiceNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+	})
+	t.Run("Unknown invoice", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/invoices/missing", nil)
+		w := httptest.NewRecorder()
+		invoiceNode.setupCliHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+}
+
+func TestReplaceTxHandler(t *testing.T) {
+	rbfNode := newFundedTestNode(t, nil)
+	shop := backend.NewWallet(backend.DefaultKeyType)
+	original, err := rbfNode.Wallet.CreateAndSignTx(30, shop.Address())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := rbfNode.SubmitOwnTx(original); err != nil {
+		log.Fatalln(err)
+	}
+	post := func(url string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", url, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		rbfNode.setupCliHandler().ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Replace with a malformed body", func(t *testing.T) {
+		if w := post("/tx/"+backend.HexEncodeByteSlice(original.Id)+"/replace", "fee"); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+	t.Run("Replace an unknown transaction", func(t *testing.T) {
+		if w := post("/tx/unknown/replace", `{"fee": 5}`); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+	t.Run("Replace with a higher fee", func(t *testing.T) {
+		if w := post("/tx/"+backend.HexEncodeByteSlice(original.Id)+"/replace", `{"fee": 5}`); w.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+	})
+	t.Run("Cancel an unknown transaction", func(t *testing.T) {
+		if w := post("/tx/unknown/cancel", ""); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
+
+func TestTokensHandler(t *testing.T) {
+	tokenNode := newFundedTestNode(t, nil)
+	post := func(url string, request map[string]interface{}) *httptest.ResponseRecorder {
+		jsReq, err := json.Marshal(request)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		req := httptest.NewRequest("POST", url, bytes.NewReader(jsReq))
+		w := httptest.NewRecorder()
+		tokenNode.setupCliHandler().ServeHTTP(w, req)
+		return w
+	}
+
+	var token string
+	t.Run("Issue a token", func(t *testing.T) {
+		w := post("/tokens", map[string]interface{}{"name": "lab credits", "supply": 1000})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var reply struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&reply); err != nil {
+			t.Fatal(err)
+		}
+		token = reply.Token
+	})
+	t.Run("Issue a token with an invalid supply", func(t *testing.T) {
+		w := post("/tokens", map[string]interface{}{"name": "free credits", "supply": 0})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+	t.Run("Send an unknown token", func(t *testing.T) {
+		// the issuance of token is still pending
+		w := post("/tokens/"+token+"/send", map[string]interface{}{"address": tokenNode.Wallet.Address(), "amount": 1})
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+}
+
+func TestChannelsHandler(t *testing.T) {
+	payerNode := newFundedTestNode(t, nil)
+	payeeNode := newTestPeer(t, 1, payerNode)
+	server := httptest.NewServer(payeeNode.setupNodeHandler())
+	defer server.Close()
+	hostname, port, _ := strings.Cut(strings.TrimPrefix(server.URL, "http://"), ":")
+	payerNode.addToRing(payeeNode.Wallet.Address(), NewNodeInfo(1, hostname, port, payeeNode.Wallet.PrivKey.Public()))
+
+	post := func(url string, request map[string]interface{}) *httptest.ResponseRecorder {
+		jsReq, err := json.Marshal(request)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		req := httptest.NewRequest("POST", url, bytes.NewReader(jsReq))
+		w := httptest.NewRecorder()
+		payerNode.setupCliHandler().ServeHTTP(w, req)
+		return w
+	}
+
+	var channel ChannelEntry
+	t.Run("Open a channel", func(t *testing.T) {
+		w := post("/channels", map[string]interface{}{"recipient": 1, "capacity": 100, "lifetime": DefaultChannelLifetime})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		if err := json.NewDecoder(w.Body).Decode(&channel); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("Open a channel to an unknown node", func(t *testing.T) {
+		w := post("/channels", map[string]interface{}{"recipient": 42, "capacity": 100})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+	t.Run("Pay through a channel that is not open yet", func(t *testing.T) {
+		w := post("/channels/"+channel.Id+"/pay", map[string]interface{}{"amount": 3})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+	t.Run("Refund before the timeout", func(t *testing.T) {
+		w := post("/channels/"+channel.Id+"/refund", nil)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
+
+func TestWalletHistoryHandler(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		query string
+		code  int
+	}{
+		{"History of the wallet", "offset=0&limit=10", http.StatusOK},
+		{"Negative limit", "limit=-1", http.StatusBadRequest},
+		{"Malformed date", "since=yesterday", http.StatusBadRequest},
+		{"Unknown account", "account=unknown", http.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/wallet/history?"+tc.query, nil)
+			w := httptest.NewRecorder()
+			testNode.setupCliHandler().ServeHTTP(w, req)
+			if w.Code != tc.code {
+				t.Errorf("Expected status code %d, got %d: %s", tc.code, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package backend
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// Address is the compact, checksummed form of a public key.
+//
+// It is the base58 encoding of a version byte, the first 20 bytes of the
+// sha256 of the key and a 4 byte checksum (base58check). The version byte
+// encodes the key type, so every key type has its own address prefix.
+type Address string
+
+const (
+	addressVersionRSA      byte = 0x35
+	addressVersionEd25519  byte = 0x21
+	addressVersionECDSA    byte = 0x3c
+	addressVersionMultisig byte = 0x05
+	addressVersionHTLC     byte = 0x08
+	addressVersionScript   byte = 0x06
+	addressHashLen              = 20
+	addressChecksumLen          = 4
+	addressDisplayLen           = 10
+	base58Alphabet              = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	addressPayloadLength        = 1 + addressHashLen
+)
+
+var (
+	invalidAddressErr  = errors.New("address is not valid base58")
+	addressLengthErr   = errors.New("address has the wrong length")
+	addressVersionErr  = errors.New("address has an unknown version")
+	addressChecksumErr = errors.New("address checksum mismatch")
+)
+
+// Derives the address of a public key.
+//
+// The nil key (used by the genesis transaction) maps to the empty address.
+func AddressFromPubKey(pubKey PublicKey) Address {
+	if pubKey == nil {
+		return ""
+	}
+	keyHash := sha256.Sum256(pubKey.Bytes())
+	payload := make([]byte, 0, addressPayloadLength+addressChecksumLen)
+	payload = append(payload, addressVersions[pubKey.Type()])
+	payload = append(payload, keyHash[:addressHashLen]...)
+	payload = append(payload, addressChecksum(payload)...)
+	return Address(base58Encode(payload))
+}
+
+// Parses and validates an address given in its string form.
+func ParseAddress(s string) (Address, error) {
+	payload, err := base58Decode(s)
+	if err != nil {
+		return "", err
+	}
+	if len(payload) != addressPayloadLength+addressChecksumLen {
+		return "", addressLengthErr
+	}
+	if _, ok := keyTypeOfVersion(payload[0]); !ok {
+		return "", addressVersionErr
+	}
+	body, checksum := payload[:addressPayloadLength], payload[addressPayloadLength:]
+	if !bytes.Equal(addressChecksum(body), checksum) {
+		return "", addressChecksumErr
+	}
+	return Address(s), nil
+}
+
+// Returns the type of the key the address was derived from
+func (a Address) KeyType() (KeyType, error) {
+	if _, err := ParseAddress(string(a)); err != nil {
+		return "", err
+	}
+	payload, _ := base58Decode(string(a))
+	keyType, _ := keyTypeOfVersion(payload[0])
+	return keyType, nil
+}
+
+func (a Address) IsValid() bool {
+	_, err := ParseAddress(string(a))
+	return err == nil
+}
+
+// Returns true if this is the address derived from pubKey
+func (a Address) IsOwnedBy(pubKey PublicKey) bool {
+	return a == AddressFromPubKey(pubKey)
+}
+
+func (a Address) String() string {
+	return string(a)
+}
+
+// Shortened form of the address, only meant for display purposes
+func (a Address) Short() string {
+	if len(a) <= addressDisplayLen {
+		return string(a)
+	}
+	return string(a[:addressDisplayLen/2]) + "..." + string(a[len(a)-addressDisplayLen/2:])
+}
+
+var addressVersions = map[KeyType]byte{
+	KeyRSA:      addressVersionRSA,
+	KeyEd25519:  addressVersionEd25519,
+	KeyECDSA:    addressVersionECDSA,
+	KeyMultisig: addressVersionMultisig,
+	KeyHTLC:     addressVersionHTLC,
+	KeyScript:   addressVersionScript,
+}
+
+func keyTypeOfVersion(version byte) (KeyType, bool) {
+	for keyType, v := range addressVersions {
+		if v == version {
+			return keyType, true
+		}
+	}
+	return "", false
+}
+
+func addressChecksum(payload []byte) []byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	return second[:addressChecksumLen]
+}
+
+func base58Encode(b []byte) string {
+	num := new(big.Int).SetBytes(b)
+	radix := big.NewInt(int64(len(base58Alphabet)))
+	mod := new(big.Int)
+	var encoded []byte
+	for num.Sign() > 0 {
+		num.DivMod(num, radix, mod)
+		encoded = append(encoded, base58Alphabet[mod.Int64()])
+	}
+	// every leading zero byte is encoded as the first alphabet character
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		encoded = append(encoded, base58Alphabet[0])
+	}
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
+
+func base58Decode(s string) ([]byte, error) {
+	if s == "" {
+		return nil, invalidAddressErr
+	}
+	num := new(big.Int)
+	radix := big.NewInt(int64(len(base58Alphabet)))
+	for _, c := range []byte(s) {
+		digit := bytes.IndexByte([]byte(base58Alphabet), c)
+		if digit < 0 {
+			return nil, invalidAddressErr
+		}
+		num.Mul(num, radix)
+		num.Add(num, big.NewInt(int64(digit)))
+	}
+	decoded := num.Bytes()
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), decoded...), nil
+}
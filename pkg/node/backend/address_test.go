@@ -0,0 +1,67 @@
+package backend
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAddress(t *testing.T) {
+	t.Run("Parse the address of every key type", func(t *testing.T) {
+		for _, keyType := range []KeyType{KeyRSA, KeyEd25519, KeyECDSA} {
+			key, err := GenerateKey(keyType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			address := AddressFromPubKey(key.Public())
+			parsed, err := ParseAddress(string(address))
+			if err != nil || parsed != address {
+				t.Errorf("Expected %s to parse, got %v", address, err)
+			}
+			if got, _ := address.KeyType(); got != keyType {
+				t.Errorf("Expected an address of a %s key, got %s", keyType, got)
+			}
+			if !address.IsOwnedBy(key.Public()) {
+				t.Errorf("Expected %s to be owned by its key", address)
+			}
+		}
+	})
+	address := AddressFromPubKey(NewWallet(DefaultKeyType).PrivKey.Public())
+	t.Run("Address with a typo", func(t *testing.T) {
+		typo := []byte(address)
+		if typo[5] == '2' {
+			typo[5] = '3'
+		} else {
+			typo[5] = '2'
+		}
+		if _, err := ParseAddress(string(typo)); err != addressChecksumErr {
+			t.Errorf("Expected error %v, got %v", addressChecksumErr, err)
+		}
+	})
+	t.Run("Address with invalid characters", func(t *testing.T) {
+		for _, s := range []string{"", string(address[:10]) + "0" + string(address[11:]), string(address) + "l"} {
+			if _, err := ParseAddress(s); err != invalidAddressErr {
+				t.Errorf("Expected error %v for %q, got %v", invalidAddressErr, s, err)
+			}
+		}
+	})
+	t.Run("Address with the wrong length", func(t *testing.T) {
+		if _, err := ParseAddress(string(address[:len(address)-1])); err != addressLengthErr {
+			t.Errorf("Expected error %v, got %v", addressLengthErr, err)
+		}
+	})
+	t.Run("Address with an unknown version", func(t *testing.T) {
+		payload := append([]byte{0x7f}, make([]byte, addressHashLen)...)
+		payload = append(payload, addressChecksum(payload)...)
+		if _, err := ParseAddress(base58Encode(payload)); err != addressVersionErr {
+			t.Errorf("Expected error %v, got %v", addressVersionErr, err)
+		}
+	})
+	t.Run("Base58 round trip with leading zeros", func(t *testing.T) {
+		for _, b := range [][]byte{{0}, {0, 0, 1}, {0, 0xff, 0}, {1, 2, 3}} {
+			decoded, err := base58Decode(base58Encode(b))
+			if err != nil || !bytes.Equal(decoded, b) {
+				t.Errorf("Expected %x back, got %x (%v)", b, decoded, err)
+			}
+		}
+	})
+}
@@ -1,7 +1,6 @@
 package backend
 
 import (
-	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/json"
 	"errors"
@@ -124,7 +123,7 @@ func (b *Block) ComputeAndFillHash() {
 	b.CurrentHash = b.ComputeHash()
 }
 
-func CreateGenesisBlock(n int, pubKey *rsa.PublicKey) *Block {
+func CreateGenesisBlock(n int, pubKey PublicKey) *Block {
 	initTx := NewGenesisTransaction(pubKey, n*100)
 	b := &Block{
 		Index:        0,
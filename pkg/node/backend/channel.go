@@ -0,0 +1,307 @@
+package backend
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/kon-pap/noobcash/pkg/node/script"
+)
+
+// A unidirectional payment channel from Payer to Payee.
+//
+// The payer locks Capacity coins to the script of the channel, see
+// script.PaymentChannel, with a funding transaction. It then pays the payee
+// off-chain, by signing closing transactions that pay it ever more of the
+// capacity, see NewUpdate. Only the latest one needs to reach the chain: the
+// payee adds its own signature and submits it, see SignClose. If the payee
+// never does, the payer takes the capacity back once the chain reaches
+// Timeout, see CreateRefundTx, so the payee must close the channel before then.
+type Channel struct {
+	Payer    PublicKey
+	Payee    PublicKey
+	Capacity int
+	Timeout  int64  // block height
+	Funding  *TxOut // output of the funding transaction locked to the channel, nil until funded
+
+	lock *ScriptKey
+}
+
+func NewChannel(payer, payee PublicKey, capacity int, timeout int64) (*Channel, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("the capacity of a channel must be positive, got %d", capacity)
+	}
+	if timeout <= 0 || timeout >= LockTimeThreshold {
+		return nil, fmt.Errorf("the timeout of a channel must be a block height, got %d", timeout)
+	}
+	for _, key := range []PublicKey{payer, payee} {
+		if key == nil {
+			return nil, errors.New("a channel needs both a payer and a payee key")
+		}
+		if !key.Type().IsSingle() {
+			return nil, fmt.Errorf("the keys of a channel must be single keys, got a %s key", key.Type())
+		}
+	}
+	if SameKey(payer, payee) {
+		return nil, errors.New("the payer of a channel cannot be its payee")
+	}
+	lockScript, err := script.PaymentChannel(EncodeTypedKey(payer), EncodeTypedKey(payee), timeout)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := NewScriptKey(lockScript)
+	if err != nil {
+		return nil, err
+	}
+	return &Channel{Payer: payer, Payee: payee, Capacity: capacity, Timeout: timeout, lock: lock}, nil
+}
+
+// Returns the id of the funding output, empty until the channel is funded
+func (c *Channel) Id() string {
+	if c.Funding == nil {
+		return ""
+	}
+	return c.Funding.Id
+}
+
+func (c *Channel) Lock() *ScriptKey {
+	return c.lock
+}
+
+// Returns the address the funding transaction pays the capacity to
+func (c *Channel) Address() Address {
+	return AddressFromPubKey(c.lock)
+}
+
+// Sets the output of tx that funds the channel. tx must pay the whole
+// capacity to the channel in a single output.
+func (c *Channel) SetFunding(tx *Transaction) error {
+	address := c.Address()
+	for _, txOut := range tx.Outputs {
+		if txOut.OwnerAddress() != address {
+			continue
+		}
+		if txOut.Amount != c.Capacity || !txOut.IsNative() || txOut.LockTime != 0 {
+			return fmt.Errorf("output %s does not lock the capacity of %d to the channel", txOut.Id, c.Capacity)
+		}
+		if c.Funding != nil {
+			return errors.New("the channel is funded by more than one output")
+		}
+		c.Funding = txOut
+	}
+	if c.Funding == nil {
+		return fmt.Errorf("transaction pays nothing to the channel %s", address)
+	}
+	return nil
+}
+
+// An off-chain payment: the closing transaction paying Paid, the total paid
+// so far, to the payee and the rest back to the payer, signed by the payer
+type ChannelUpdate struct {
+	ChannelId string
+	Paid      int
+	Tx        *Transaction
+	PayerSig  []byte
+}
+type channelUpdateJson struct {
+	ChannelId string       `json:"channelId"`
+	Paid      int          `json:"paid"`
+	Tx        *Transaction `json:"tx"`
+	PayerSig  string       `json:"payerSig"`
+}
+
+func (u *ChannelUpdate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(channelUpdateJson{
+		ChannelId: u.ChannelId,
+		Paid:      u.Paid,
+		Tx:        u.Tx,
+		PayerSig:  HexEncodeByteSlice(u.PayerSig),
+	})
+}
+func (u *ChannelUpdate) UnmarshalJSON(b []byte) error {
+	var tmp channelUpdateJson
+	if err := json.Unmarshal(b, &tmp); err != nil {
+		return err
+	}
+	payerSig, err := hex.DecodeString(tmp.PayerSig)
+	if err != nil {
+		return fmt.Errorf("invalid payer signature: %s", err)
+	}
+	u.ChannelId = tmp.ChannelId
+	u.Paid = tmp.Paid
+	u.Tx = tmp.Tx
+	u.PayerSig = payerSig
+	return nil
+}
+
+// Builds the unsigned transaction spending the funding output to the given outputs
+func (c *Channel) spendTx(lockTime int64, outputs ...*TxOut) (*Transaction, error) {
+	if c.Funding == nil {
+		return nil, errors.New("the channel is not funded yet")
+	}
+	tx := NewTransaction(nil, c.Capacity)
+	tx.LockTime = lockTime
+	tx.Inputs.Add(c.Funding)
+	for _, txOut := range outputs {
+		txOut.ComputeAndFillHash()
+		tx.Outputs.Add(txOut)
+	}
+	tx.ComputeAndFillHash()
+	return tx, nil
+}
+
+// Creates the update paying paid in total to the payee, signed with the key of the payer
+func (c *Channel) NewUpdate(paid int, key PrivateKey) (*ChannelUpdate, error) {
+	if paid <= 0 || paid > c.Capacity {
+		return nil, fmt.Errorf("a channel of %d cannot pay %d", c.Capacity, paid)
+	}
+	if !SameKey(key.Public(), c.Payer) {
+		return nil, errors.New("only the payer of the channel can sign its updates")
+	}
+	outputs := []*TxOut{NewTxOut(c.Payee, paid)}
+	if change := c.Capacity - paid; change > 0 {
+		outputs = append(outputs, NewTxOut(c.Payer, change))
+	}
+	tx, err := c.spendTx(0, outputs...)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := key.Sign(tx.SigningHash())
+	if err != nil {
+		return nil, err
+	}
+	return &ChannelUpdate{ChannelId: c.Id(), Paid: paid, Tx: tx, PayerSig: sig}, nil
+}
+
+// Checks that u spends the funding output to pay exactly u.Paid to the payee
+// and the rest to the payer, and that the payer signed it
+func (c *Channel) CheckUpdate(u *ChannelUpdate) error {
+	if c.Funding == nil || u.ChannelId != c.Id() {
+		return fmt.Errorf("update is for channel %s, not %s", u.ChannelId, c.Id())
+	}
+	if u.Paid <= 0 || u.Paid > c.Capacity {
+		return fmt.Errorf("a channel of %d cannot pay %d", c.Capacity, u.Paid)
+	}
+	tx := u.Tx
+	if tx == nil || !tx.SignsPerInput() || len(tx.Inputs) != 1 || !tx.Inputs.Has(c.Funding) {
+		return errors.New("update does not spend the funding output alone")
+	}
+	if tx.LockTime != 0 || len(tx.Memo) > 0 || tx.Issuance != nil {
+		return errors.New("update must have no lock time, memo or issuance")
+	}
+	paid, change := 0, 0
+	payee, payer := AddressFromPubKey(c.Payee), AddressFromPubKey(c.Payer)
+	for _, txOut := range tx.Outputs {
+		if !txOut.IsNative() || txOut.LockTime != 0 {
+			return fmt.Errorf("output %s must hold unlocked native coins", txOut.Id)
+		}
+		switch txOut.OwnerAddress() {
+		case payee:
+			paid += txOut.Amount
+		case payer:
+			change += txOut.Amount
+		default:
+			return fmt.Errorf("output %s pays neither the payer nor the payee", txOut.Id)
+		}
+	}
+	if paid != u.Paid || paid+change != c.Capacity {
+		return fmt.Errorf("update pays %d to the payee and %d to the payer, expected %d and %d", paid, change, u.Paid, c.Capacity-u.Paid)
+	}
+	if err := c.Payer.Verify(tx.SigningHash(), u.PayerSig); err != nil {
+		return fmt.Errorf("update is not signed by the payer: %s", err)
+	}
+	return nil
+}
+
+// Completes the closing transaction of u with the signature of the payee
+func (c *Channel) SignClose(u *ChannelUpdate, key PrivateKey) (*Transaction, error) {
+	if !SameKey(key.Public(), c.Payee) {
+		return nil, errors.New("only the payee of the channel can close it")
+	}
+	if err := c.CheckUpdate(u); err != nil {
+		return nil, err
+	}
+	tx := *u.Tx
+	tx.InputSigs = nil
+	sig, err := key.Sign(tx.SigningHash())
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := script.NewBuilder().AddData(u.PayerSig).AddData(sig).AddInt(1).Script()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.UnlockInput(c.Funding.Id, c.lock, unlock); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// Creates the transaction paying the whole capacity back to the payer, which
+// cannot be included in a block before the timeout of the channel
+func (c *Channel) CreateRefundTx(key PrivateKey) (*Transaction, error) {
+	if !SameKey(key.Public(), c.Payer) {
+		return nil, errors.New("only the payer of the channel can be refunded")
+	}
+	tx, err := c.spendTx(c.Timeout, NewTxOut(c.Payer, c.Capacity))
+	if err != nil {
+		return nil, err
+	}
+	sig, err := key.Sign(tx.SigningHash())
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := script.NewBuilder().AddData(sig).AddInt(0).Script()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.UnlockInput(c.Funding.Id, c.lock, unlock); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+type channelJson struct {
+	Payer    string  `json:"payer"`
+	Payee    string  `json:"payee"`
+	Capacity int     `json:"capacity"`
+	Timeout  int64   `json:"timeout"`
+	Address  Address `json:"address"`
+	Funding  *TxOut  `json:"funding,omitempty"`
+}
+
+func (c *Channel) MarshalJSON() ([]byte, error) {
+	return json.Marshal(channelJson{
+		Payer:    PubKeyToPem(c.Payer),
+		Payee:    PubKeyToPem(c.Payee),
+		Capacity: c.Capacity,
+		Timeout:  c.Timeout,
+		Address:  c.Address(),
+		Funding:  c.Funding,
+	})
+}
+func (c *Channel) UnmarshalJSON(b []byte) error {
+	var tmp channelJson
+	if err := json.Unmarshal(b, &tmp); err != nil {
+		return err
+	}
+	payer, err := ParsePubKeyPem(tmp.Payer)
+	if err != nil {
+		return err
+	}
+	payee, err := ParsePubKeyPem(tmp.Payee)
+	if err != nil {
+		return err
+	}
+	channel, err := NewChannel(payer, payee, tmp.Capacity, tmp.Timeout)
+	if err != nil {
+		return err
+	}
+	if tmp.Funding != nil && tmp.Funding.OwnerAddress() != channel.Address() {
+		return fmt.Errorf("funding output %s is not locked to the channel", tmp.Funding.Id)
+	}
+	channel.Funding = tmp.Funding
+	*c = *channel
+	return nil
+}
@@ -0,0 +1,158 @@
+package backend
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestChannel(t *testing.T) {
+	payer, _ := GenerateKey(DefaultKeyType)
+	payee, _ := GenerateKey(DefaultKeyType)
+	channel, err := NewChannel(payer.Public(), payee.Public(), 100, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	channel.Funding = newUtxo(channel.Lock(), 100)
+
+	t.Run("Invalid channels", func(t *testing.T) {
+		if _, err := NewChannel(payer.Public(), payee.Public(), 0, 50); err == nil {
+			t.Error("Expected a channel without capacity to be refused")
+		}
+		if _, err := NewChannel(payer.Public(), payee.Public(), 100, LockTimeThreshold); err == nil {
+			t.Error("Expected a timeout that is not a block height to be refused")
+		}
+		if _, err := NewChannel(payer.Public(), payer.Public(), 100, 50); err == nil {
+			t.Error("Expected a channel paying its payer to be refused")
+		}
+	})
+	t.Run("Update and close", func(t *testing.T) {
+		update, err := channel.NewUpdate(30, payer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := channel.CheckUpdate(update); err != nil {
+			t.Fatalf("Expected the update to be valid, got %v", err)
+		}
+		if _, err := channel.SignClose(update, payer); err == nil {
+			t.Error("Expected the payer not to be able to close the channel")
+		}
+		tx, err := channel.SignClose(update, payee)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.VerifySignatures(); err != nil {
+			t.Errorf("Expected the closing transaction to be valid, got %v", err)
+		}
+	})
+	t.Run("Tampered close", func(t *testing.T) {
+		update, err := channel.NewUpdate(30, payer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := channel.SignClose(update, payee)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the payee takes 10 more out of the change of the payer
+		payeeAddress, payerAddress := AddressFromPubKey(payee.Public()), AddressFromPubKey(payer.Public())
+		for _, txOut := range tx.Outputs {
+			switch txOut.OwnerAddress() {
+			case payeeAddress:
+				txOut.Amount += 10
+			case payerAddress:
+				txOut.Amount -= 10
+			}
+		}
+		if err := tx.VerifySignatures(); err == nil {
+			t.Error("Expected a close paying other amounts than the update to be refused")
+		}
+	})
+	t.Run("Update over the capacity", func(t *testing.T) {
+		if _, err := channel.NewUpdate(101, payer); err == nil {
+			t.Error("Expected an update paying more than the capacity to fail")
+		}
+		if _, err := channel.NewUpdate(10, payee); err == nil {
+			t.Error("Expected the payee not to be able to sign updates")
+		}
+	})
+	t.Run("Update not signed by the payer", func(t *testing.T) {
+		update, err := channel.NewUpdate(50, payer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		update.PayerSig, _ = payee.Sign(update.Tx.SigningHash())
+		if err := channel.CheckUpdate(update); err == nil {
+			t.Error("Expected an update signed by another key to be refused")
+		}
+	})
+	t.Run("Update claiming another amount", func(t *testing.T) {
+		update, err := channel.NewUpdate(50, payer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		update.Paid = 60
+		if err := channel.CheckUpdate(update); err == nil {
+			t.Error("Expected an update claiming more than its outputs pay to be refused")
+		}
+	})
+	t.Run("Refund", func(t *testing.T) {
+		if _, err := channel.CreateRefundTx(payee); err == nil {
+			t.Error("Expected the payee not to be refunded")
+		}
+		tx, err := channel.CreateRefundTx(payer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tx.LockTime != channel.Timeout {
+			t.Errorf("Expected the refund to be locked until %d, got %d", channel.Timeout, tx.LockTime)
+		}
+		if err := tx.VerifySignatures(); err != nil {
+			t.Errorf("Expected the refund to be valid, got %v", err)
+		}
+	})
+	t.Run("Decode an update and a channel", func(t *testing.T) {
+		update, err := channel.NewUpdate(30, payer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(update)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded ChannelUpdate
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if err := channel.CheckUpdate(&decoded); err != nil {
+			t.Errorf("Expected the decoded update to be valid, got %v", err)
+		}
+		malformed := strings.Replace(string(data), HexEncodeByteSlice(update.PayerSig), "not hex", 1)
+		if err := json.Unmarshal([]byte(malformed), &decoded); err == nil {
+			t.Error("Expected an update with a malformed payer signature to be refused")
+		}
+
+		data, err = json.Marshal(channel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decodedChannel Channel
+		if err := json.Unmarshal(data, &decodedChannel); err != nil {
+			t.Fatal(err)
+		}
+		if decodedChannel.Id() != channel.Id() {
+			t.Errorf("Expected channel %s back, got %s", channel.Id(), decodedChannel.Id())
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Fatal(err)
+		}
+		m["funding"].(map[string]interface{})["owner"] = "not a key"
+		if data, err = json.Marshal(m); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, &decodedChannel); err == nil {
+			t.Error("Expected a channel with a malformed funding output to be refused")
+		}
+	})
+}
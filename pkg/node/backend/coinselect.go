@@ -0,0 +1,233 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Cost assigned to every input of a selection when computing its waste.
+// Each input makes the transaction larger, so fewer inputs are preferred.
+const InputWasteWeight = 1
+
+// Maximum number of branches branch-and-bound explores before giving up
+const bnbMaxTries = 100000
+
+var (
+	notEnoughMoneyErr = errors.New("not enough money")
+	noExactMatchErr   = errors.New("no exact match found")
+)
+
+// The outcome of a coin selection, along with some metrics
+// used to compare the different strategies.
+type CoinSelection struct {
+	Strategy string
+	Inputs   []*TxOut
+	Sum      int
+	Target   int
+}
+
+// Amount that will return to the wallet as change
+func (cs *CoinSelection) Change() int {
+	return cs.Sum - cs.Target
+}
+
+// Waste of the selection: the change that has to be split into new UTXOs,
+// plus a fixed cost for every input used.
+func (cs *CoinSelection) Waste() int {
+	return cs.Change() + InputWasteWeight*len(cs.Inputs)
+}
+
+func (cs *CoinSelection) String() string {
+	return fmt.Sprintf("coin selection: %s, inputs: %d, change: %d, waste: %d",
+		cs.Strategy, len(cs.Inputs), cs.Change(), cs.Waste())
+}
+
+func newCoinSelection(strategy string, target int, inputs []*TxOut) *CoinSelection {
+	cs := &CoinSelection{
+		Strategy: strategy,
+		Inputs:   inputs,
+		Target:   target,
+	}
+	for _, txIn := range inputs {
+		cs.Sum += txIn.Amount
+	}
+	return cs
+}
+
+// Chooses which of the available utxos will be spent to pay targetAmount
+type CoinSelector interface {
+	Name() string
+	Select(utxos []*TxOut, targetAmount int) (*CoinSelection, error)
+}
+
+var DefaultCoinSelector CoinSelector = LargestFirst{}
+
+var CoinSelectors = map[string]CoinSelector{
+	LargestFirst{}.Name():   LargestFirst{},
+	SmallestFirst{}.Name():  SmallestFirst{},
+	RandomImprove{}.Name():  RandomImprove{},
+	BranchAndBound{}.Name(): BranchAndBound{},
+}
+
+// Returns the coin selector registered under name.
+//
+// The empty name returns nil, meaning the wallet default should be used.
+func GetCoinSelector(name string) (CoinSelector, error) {
+	if name == "" {
+		return nil, nil
+	}
+	selector, ok := CoinSelectors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown coin selection strategy '%s'", name)
+	}
+	return selector, nil
+}
+
+func sortedUtxos(utxos []*TxOut, descending bool) []*TxOut {
+	sorted := make([]*TxOut, len(utxos))
+	copy(sorted, utxos)
+	sort.Slice(sorted, func(i, j int) bool {
+		if descending {
+			return sorted[i].Amount > sorted[j].Amount
+		}
+		return sorted[i].Amount < sorted[j].Amount
+	})
+	return sorted
+}
+
+// Accumulates utxos in the given order until the target is reached
+func selectInOrder(strategy string, utxos []*TxOut, targetAmount int) (*CoinSelection, error) {
+	var sum int
+	var chosen []*TxOut
+	for _, utxo := range utxos {
+		if sum >= targetAmount {
+			break
+		}
+		sum += utxo.Amount
+		chosen = append(chosen, utxo)
+	}
+	if sum < targetAmount {
+		return nil, notEnoughMoneyErr
+	}
+	return newCoinSelection(strategy, targetAmount, chosen), nil
+}
+
+// Spends the biggest utxos first, which keeps the number of inputs low.
+type LargestFirst struct{}
+
+func (LargestFirst) Name() string { return "largest-first" }
+
+func (s LargestFirst) Select(utxos []*TxOut, targetAmount int) (*CoinSelection, error) {
+	return selectInOrder(s.Name(), sortedUtxos(utxos, true), targetAmount)
+}
+
+// Spends the smallest utxos first, consolidating the wallet over time.
+type SmallestFirst struct{}
+
+func (SmallestFirst) Name() string { return "smallest-first" }
+
+func (s SmallestFirst) Select(utxos []*TxOut, targetAmount int) (*CoinSelection, error) {
+	return selectInOrder(s.Name(), sortedUtxos(utxos, false), targetAmount)
+}
+
+// Picks random utxos until the target is covered, then keeps adding random
+// utxos as long as they bring the sum closer to twice the target, without
+// exceeding three times the target. The change then tends to be similar to
+// the payment, which keeps the utxo distribution healthy.
+type RandomImprove struct{}
+
+func (RandomImprove) Name() string { return "random-improve" }
+
+func (s RandomImprove) Select(utxos []*TxOut, targetAmount int) (*CoinSelection, error) {
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	shuffled := make([]*TxOut, len(utxos))
+	for i, j := range rng.Perm(len(utxos)) {
+		shuffled[i] = utxos[j]
+	}
+
+	var sum, used int
+	var chosen []*TxOut
+	for ; used < len(shuffled) && sum < targetAmount; used++ {
+		sum += shuffled[used].Amount
+		chosen = append(chosen, shuffled[used])
+	}
+	if sum < targetAmount {
+		return nil, notEnoughMoneyErr
+	}
+
+	ideal, upperBound := 2*targetAmount, 3*targetAmount
+	distance := func(x int) int {
+		if x > ideal {
+			return x - ideal
+		}
+		return ideal - x
+	}
+	for ; used < len(shuffled); used++ {
+		candidate := sum + shuffled[used].Amount
+		if candidate > upperBound || distance(candidate) >= distance(sum) {
+			continue
+		}
+		sum = candidate
+		chosen = append(chosen, shuffled[used])
+	}
+	return newCoinSelection(s.Name(), targetAmount, chosen), nil
+}
+
+// Searches for a set of utxos that pays the target exactly, so that no change
+// output is needed. Falls back to largest-first if there is no exact match.
+type BranchAndBound struct{}
+
+func (BranchAndBound) Name() string { return "branch-and-bound" }
+
+func (s BranchAndBound) Select(utxos []*TxOut, targetAmount int) (*CoinSelection, error) {
+	chosen, err := s.selectExact(sortedUtxos(utxos, true), targetAmount)
+	if err == nil {
+		return newCoinSelection(s.Name(), targetAmount, chosen), nil
+	}
+	return LargestFirst{}.Select(utxos, targetAmount)
+}
+
+func (BranchAndBound) selectExact(sorted []*TxOut, targetAmount int) ([]*TxOut, error) {
+	// remaining[i] holds the sum of sorted[i:], used to prune branches that can't reach the target
+	remaining := make([]int, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].Amount
+	}
+	if remaining[0] < targetAmount {
+		return nil, notEnoughMoneyErr
+	}
+
+	tries := 0
+	included := make([]bool, len(sorted))
+	var search func(depth, sum int) bool
+	search = func(depth, sum int) bool {
+		tries++
+		if sum == targetAmount {
+			return true
+		}
+		if depth == len(sorted) || tries > bnbMaxTries ||
+			sum > targetAmount || sum+remaining[depth] < targetAmount {
+			return false
+		}
+		included[depth] = true
+		if search(depth+1, sum+sorted[depth].Amount) {
+			return true
+		}
+		included[depth] = false
+		return search(depth+1, sum)
+	}
+	if !search(0, 0) {
+		return nil, noExactMatchErr
+	}
+
+	var chosen []*TxOut
+	for i, utxo := range sorted {
+		if included[i] {
+			chosen = append(chosen, utxo)
+		}
+	}
+	return chosen, nil
+}
@@ -0,0 +1,127 @@
+package backend
+
+import (
+	"sort"
+	"testing"
+)
+
+func newUtxo(owner PublicKey, amount int) *TxOut {
+	txOut := NewTxOut(owner, amount)
+	txOut.ComputeAndFillHash()
+	return txOut
+}
+
+func utxosOf(amounts ...int) []*TxOut {
+	owner := NewWallet(DefaultKeyType).PrivKey.Public()
+	utxos := make([]*TxOut, 0, len(amounts))
+	for _, amount := range amounts {
+		utxos = append(utxos, newUtxo(owner, amount))
+	}
+	return utxos
+}
+
+func amountsOf(utxos []*TxOut) []int {
+	amounts := make([]int, 0, len(utxos))
+	for _, utxo := range utxos {
+		amounts = append(amounts, utxo.Amount)
+	}
+	sort.Ints(amounts)
+	return amounts
+}
+
+func equalAmounts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCoinSelectors(t *testing.T) {
+	utxos := utxosOf(1, 5, 10, 20, 50)
+
+	t.Run("Largest first", func(t *testing.T) {
+		selection, err := LargestFirst{}.Select(utxos, 60)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := amountsOf(selection.Inputs); !equalAmounts(got, []int{20, 50}) {
+			t.Errorf("Expected inputs [20 50], got %v", got)
+		}
+		if selection.Sum != 70 || selection.Change() != 10 || selection.Waste() != 10+2*InputWasteWeight {
+			t.Errorf("Expected a sum of 70 with a change of 10, got %s", selection)
+		}
+	})
+	t.Run("Smallest first", func(t *testing.T) {
+		selection, err := SmallestFirst{}.Select(utxos, 12)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := amountsOf(selection.Inputs); !equalAmounts(got, []int{1, 5, 10}) {
+			t.Errorf("Expected inputs [1 5 10], got %v", got)
+		}
+	})
+	t.Run("Random improve", func(t *testing.T) {
+		for i := 0; i < 20; i++ {
+			selection, err := RandomImprove{}.Select(utxos, 15)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if selection.Sum < 15 {
+				t.Fatalf("Expected the selection to cover 15, got %d", selection.Sum)
+			}
+			// the inputs are in the order they were picked, the ones after
+			// the target is covered being improvements
+			covered, picked := 0, 0
+			for ; covered < 15; picked++ {
+				covered += selection.Inputs[picked].Amount
+			}
+			if picked < len(selection.Inputs) && selection.Sum > 45 {
+				t.Errorf("Expected improvements to stay within three times the target, got %d", selection.Sum)
+			}
+		}
+	})
+	t.Run("Branch and bound exact match", func(t *testing.T) {
+		selection, err := BranchAndBound{}.Select(utxos, 31)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := amountsOf(selection.Inputs); !equalAmounts(got, []int{1, 10, 20}) || selection.Change() != 0 {
+			t.Errorf("Expected inputs [1 10 20] with no change, got %v", got)
+		}
+		if selection.Strategy != "branch-and-bound" {
+			t.Errorf("Expected the exact match to be reported by branch-and-bound, got %s", selection.Strategy)
+		}
+	})
+	t.Run("Branch and bound without exact match", func(t *testing.T) {
+		selection, err := BranchAndBound{}.Select(utxosOf(10, 20), 25)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if selection.Strategy != "largest-first" || selection.Sum != 30 {
+			t.Errorf("Expected a largest-first fallback of 30, got %s", selection)
+		}
+	})
+	t.Run("Not enough money", func(t *testing.T) {
+		for _, selector := range CoinSelectors {
+			if _, err := selector.Select(utxos, 87); err != notEnoughMoneyErr {
+				t.Errorf("Expected %s to fail with %v, got %v", selector.Name(), notEnoughMoneyErr, err)
+			}
+		}
+	})
+	t.Run("Get a selector by name", func(t *testing.T) {
+		if selector, err := GetCoinSelector("smallest-first"); err != nil || selector.Name() != "smallest-first" {
+			t.Errorf("Expected smallest-first, got %v (%v)", selector, err)
+		}
+		if selector, err := GetCoinSelector(""); err != nil || selector != nil {
+			t.Errorf("Expected no selector for the empty name, got %v (%v)", selector, err)
+		}
+		if _, err := GetCoinSelector("first-come"); err == nil {
+			t.Error("Expected an unknown strategy to fail")
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package backend
+
+import (
+	"fmt"
+	"log"
+)
+
+// Outcome of merging many small utxos of a wallet into a single one
+type Consolidation struct {
+	Inputs      int `json:"inputs"`
+	Amount      int `json:"amount"`
+	UtxosBefore int `json:"utxosBefore"`
+	UtxosAfter  int `json:"utxosAfter"` // once the transaction is confirmed
+}
+
+func (c *Consolidation) Reduction() int {
+	return c.UtxosBefore - c.UtxosAfter
+}
+
+func (c *Consolidation) String() string {
+	return fmt.Sprintf("merged %d utxos worth %d, utxo count %d -> %d",
+		c.Inputs, c.Amount, c.UtxosBefore, c.UtxosAfter)
+}
+
+// Creates a payment to self, merging up to maxInputs of the smallest unreserved
+// utxos of the primary key with an amount below threshold. A threshold <= 0
+// accepts any amount.
+func (w *Wallet) CreateConsolidationTx(maxInputs, threshold int) (*Transaction, *Consolidation, error) {
+	if w.IsWatchOnly() {
+		return nil, nil, watchOnlyErr
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var sum int
+	var candidates []*TxOut
+	for _, utxo := range sortedUtxos(w.unreservedUtxosOf(w.Address()), false) {
+		if len(candidates) == maxInputs || (threshold > 0 && utxo.Amount >= threshold) {
+			break
+		}
+		sum += utxo.Amount
+		candidates = append(candidates, utxo)
+	}
+	if len(candidates) < 2 {
+		return nil, nil, fmt.Errorf("found %d utxo(s) to consolidate, need at least 2", len(candidates))
+	}
+
+	log.Println("Consolidating", len(candidates), "utxos worth", sum)
+	tx := NewTransaction(w.PrivKey.Public(), sum)
+	for _, txIn := range candidates {
+		tx.Inputs.Add(txIn)
+	}
+	mergedTxOut := NewTxOut(w.PrivKey.Public(), sum)
+	mergedTxOut.ComputeAndFillHash()
+	tx.Outputs.Add(mergedTxOut)
+	tx.ComputeAndFillHash()
+	w.reserve(tx)
+
+	return tx, &Consolidation{
+		Inputs:      len(candidates),
+		Amount:      sum,
+		UtxosBefore: len(w.Utxos),
+		UtxosAfter:  len(w.Utxos) - len(candidates) + 1,
+	}, nil
+}
+
+func (w *Wallet) CreateAndSignConsolidationTx(maxInputs, threshold int) (*Transaction, *Consolidation, error) {
+	tx, consolidation, err := w.CreateConsolidationTx(maxInputs, threshold)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = w.SignTx(tx)
+	if err != nil {
+		w.ReleaseTx(HexEncodeByteSlice(tx.Id))
+		return nil, nil, err
+	}
+	return tx, consolidation, nil
+}
+
+func (w *Wallet) UtxoCount() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.Utxos)
+}
+
+// Number of utxos that are not used by pending transactions of the wallet
+func (w *Wallet) UnreservedUtxoCount() (count int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, utxo := range w.Utxos {
+		if !w.isReserved(utxo) {
+			count++
+		}
+	}
+	return
+}
@@ -0,0 +1,236 @@
+package backend
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Hierarchical deterministic wallets: every key of the wallet is derived from
+// a seed, which is backed up as a mnemonic phrase of mnemonicWordCount words.
+//
+// Each word encodes one byte (the wordlist has 256 words), and the last word
+// is a checksum of the others. Keys are hardened Ed25519 children of the
+// master key, derived in the style of SLIP-0010.
+//
+// This is a noobcash-specific format: the mnemonic is NOT a BIP39 phrase and
+// the master key uses its own salt instead of the SLIP-0010 one, so wallets
+// cannot be exchanged with other BIP39/SLIP-0010 software, in either direction.
+
+const (
+	MnemonicEntropyLen = 16 // bytes of randomness in a mnemonic
+	mnemonicWordCount  = MnemonicEntropyLen + 1
+
+	// Number of consecutive unused addresses derived ahead of the last used one.
+	// Payments to addresses further away are not noticed when restoring a wallet.
+	HDGapLimit = 20
+
+	mnemonicSeedSalt       = "noobcash mnemonic"
+	mnemonicSeedIterations = 2048
+	hdMasterKeySalt        = "noobcash hd seed"
+	hdHardenedOffset       = 0x80000000
+)
+
+var mnemonicWordlist = strings.Fields(`
+able acid area army baby ball band base bath beat bell belt bill bird
+blue body bond book boom boss bowl bulk bush cake call camp card case
+cast cell chip city coal code cold cook cool copy cost crew dark data
+dawn dear debt deny dial diet dock door down drop dual duty earn east
+edge exit fact fail fall fast fate feed feet fell file fill find fire
+firm five flat food form fort free fuel fund game gate gift girl glad
+gold golf gray grow gulf half hall hang head hear help hero hill hold
+hole home hope hour hunt idea iron item jump just keen kick king knee
+lack lady land last late left less lift line link live load lock long
+look lose lost love mail main male mass meal meat meet mere milk mill
+mine miss mood move name near neck news nice nine nose okay open pace
+pack pain palm park pass past peak pink pipe play plot plus pool poor
+post pull push rail rain rare read real rely rent rice ride ring risk
+road role roof room rose rule safe sale salt save seed seek seen self
+send shop shot shut side site skin slip snow soft sole soon sort spot
+star step suit sure tale tall tank task team tell term test thin till
+tiny tone tool town tree true turn twin unit user vast view vote wait
+walk wall ward warm wave wear week west wide wild wind wine wire wise
+wood work yard zero
+`)
+
+var (
+	mnemonicLengthErr   = fmt.Errorf("mnemonic must have %d words", mnemonicWordCount)
+	mnemonicChecksumErr = errors.New("mnemonic checksum mismatch")
+	notHDWalletErr      = errors.New("wallet is not a hierarchical deterministic wallet")
+)
+
+// Returns a new random mnemonic phrase
+func NewMnemonic() (string, error) {
+	entropy := make([]byte, MnemonicEntropyLen)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", err
+	}
+	return mnemonicFromEntropy(entropy), nil
+}
+
+func mnemonicChecksum(entropy []byte) byte {
+	h := sha256.Sum256(entropy)
+	return h[0]
+}
+
+func mnemonicFromEntropy(entropy []byte) string {
+	words := make([]string, 0, mnemonicWordCount)
+	for _, b := range entropy {
+		words = append(words, mnemonicWordlist[b])
+	}
+	words = append(words, mnemonicWordlist[mnemonicChecksum(entropy)])
+	return strings.Join(words, " ")
+}
+
+// Validates a mnemonic phrase and returns the entropy it encodes
+func ParseMnemonic(mnemonic string) ([]byte, error) {
+	words := strings.Fields(strings.ToLower(mnemonic))
+	if len(words) != mnemonicWordCount {
+		return nil, mnemonicLengthErr
+	}
+	decoded := make([]byte, 0, mnemonicWordCount)
+	for _, word := range words {
+		index := -1
+		for i, w := range mnemonicWordlist {
+			if w == word {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("unknown mnemonic word '%s'", word)
+		}
+		decoded = append(decoded, byte(index))
+	}
+	entropy, checksum := decoded[:MnemonicEntropyLen], decoded[MnemonicEntropyLen]
+	if mnemonicChecksum(entropy) != checksum {
+		return nil, mnemonicChecksumErr
+	}
+	return entropy, nil
+}
+
+// Derives the keys of an HD wallet and keeps track of the used ones.
+//
+// Not thread-safe, guarded by the lock of the wallet
+type hdKeychain struct {
+	entropy   []byte
+	masterKey []byte
+	chainCode []byte
+	keys      []PrivateKey    // derived keys, by index
+	indexes   map[Address]int // index of every derived key
+	next      int             // index of the first address not handed out yet
+}
+
+func newHDKeychain(entropy []byte) *hdKeychain {
+	seed := pbkdf2.Key([]byte(mnemonicFromEntropy(entropy)), []byte(mnemonicSeedSalt), mnemonicSeedIterations, sha512.Size, sha512.New)
+	mac := hmac.New(sha512.New, []byte(hdMasterKeySalt))
+	mac.Write(seed)
+	master := mac.Sum(nil)
+	hd := &hdKeychain{
+		entropy:   entropy,
+		masterKey: master[:32],
+		chainCode: master[32:],
+		indexes:   map[Address]int{},
+		next:      1, // the first key is the primary key of the wallet
+	}
+	hd.extend()
+	return hd
+}
+
+// Derives the hardened child key with the given index
+func (hd *hdKeychain) derive(index int) PrivateKey {
+	data := make([]byte, 0, 1+len(hd.masterKey)+4)
+	data = append(data, 0)
+	data = append(data, hd.masterKey...)
+	data = append(data, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[len(data)-4:], uint32(index)|hdHardenedOffset)
+	mac := hmac.New(sha512.New, hd.chainCode)
+	mac.Write(data)
+	return ed25519PrivateKey(ed25519.NewKeyFromSeed(mac.Sum(nil)[:ed25519.SeedSize]))
+}
+
+// Derives keys up to HDGapLimit past the last handed out address
+func (hd *hdKeychain) extend() {
+	for len(hd.keys) < hd.next+HDGapLimit {
+		key := hd.derive(len(hd.keys))
+		hd.indexes[AddressFromPubKey(key.Public())] = len(hd.keys)
+		hd.keys = append(hd.keys, key)
+	}
+}
+
+// Marks the address as used, so that it is not handed out again
+func (hd *hdKeychain) markUsed(address Address) {
+	if index, ok := hd.indexes[address]; ok && index >= hd.next {
+		hd.next = index + 1
+		hd.extend()
+	}
+}
+
+func (hd *hdKeychain) mnemonic() string {
+	return mnemonicFromEntropy(hd.entropy)
+}
+
+// Creates (or restores) the HD wallet with the given mnemonic phrase
+func NewHDWallet(mnemonic string) (*Wallet, error) {
+	entropy, err := ParseMnemonic(mnemonic)
+	if err != nil {
+		return nil, err
+	}
+	return newHDWallet(entropy, 1), nil
+}
+
+func newHDWallet(entropy []byte, next int) *Wallet {
+	hd := newHDKeychain(entropy)
+	if next > hd.next {
+		hd.next = next
+		hd.extend()
+	}
+	w := NewWalletFromKey(hd.keys[0])
+	w.hd = hd
+	for address, index := range hd.indexes {
+		w.keys[address] = hd.keys[index]
+	}
+	return w
+}
+
+func (w *Wallet) IsHD() bool {
+	return w.hd != nil
+}
+
+// Returns the mnemonic phrase of an HD wallet
+func (w *Wallet) Mnemonic() (string, error) {
+	if w.hd == nil {
+		return "", notHDWalletErr
+	}
+	return w.hd.mnemonic(), nil
+}
+
+// Hands out the next unused receiving address of an HD wallet
+func (w *Wallet) NewAddress() (Address, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.hd == nil {
+		return "", notHDWalletErr
+	}
+	address := AddressFromPubKey(w.hd.keys[w.hd.next].Public())
+	w.hd.markUsed(address)
+	w.addDerivedKeys()
+	return address, nil
+}
+
+// Registers the keys derived by the keychain since the last call
+//
+// Must be called with the wallet lock held
+func (w *Wallet) addDerivedKeys() {
+	for _, key := range w.hd.keys[len(w.keys):] {
+		w.keys[AddressFromPubKey(key.Public())] = key
+	}
+}
@@ -0,0 +1,259 @@
+package backend
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Size of the secrets of hash-time-locked contracts
+const SwapSecretSize = 32
+
+// Branches of a hash-time-locked contract, the first byte of its signatures
+const (
+	htlcRedeem byte = 1 // the recipient reveals the preimage of the hash
+	htlcRefund byte = 2 // the sender takes the funds back after the timeout
+)
+
+var (
+	htlcEncodingErr  = errors.New("malformed hash-time-locked contract")
+	htlcSignatureErr = errors.New("malformed hash-time-locked contract signature")
+)
+
+// A hash-time-locked contract (HTLC).
+//
+// Outputs locked to it can be redeemed by Recipient with the preimage of Hash,
+// or refunded to Refund once the chain reaches the Timeout height. Two of them
+// with the same hash, on two separate rings, make an atomic swap: redeeming
+// one reveals the secret that redeems the other.
+//
+// Like MultisigKey, it implements PublicKey and has no private key. Its
+// signatures carry the branch taken, see SignRedeem and SignRefund.
+type HTLCKey struct {
+	Hash      []byte // sha256 of the secret
+	Recipient PublicKey
+	Refund    PublicKey
+	Timeout   int64 // block height
+}
+
+func NewHTLCKey(hash []byte, recipient, refund PublicKey, timeout int64) (*HTLCKey, error) {
+	if len(hash) != sha256.Size {
+		return nil, fmt.Errorf("the hash of a contract must be %d bytes, got %d", sha256.Size, len(hash))
+	}
+	if timeout <= 0 || timeout >= LockTimeThreshold {
+		return nil, fmt.Errorf("the timeout of a contract must be a block height, got %d", timeout)
+	}
+	for _, key := range []PublicKey{recipient, refund} {
+		if key == nil {
+			return nil, errors.New("a contract needs both a recipient and a refund key")
+		}
+		if !key.Type().IsSingle() {
+			return nil, fmt.Errorf("the keys of a contract must be single keys, got a %s key", key.Type())
+		}
+	}
+	return &HTLCKey{Hash: hash, Recipient: recipient, Refund: refund, Timeout: timeout}, nil
+}
+
+// Generates a random secret, along with the hash that locks a contract to it
+func NewSwapSecret() (secret, hash []byte, err error) {
+	secret = make([]byte, SwapSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256(secret)
+	return secret, sum[:], nil
+}
+
+func (k *HTLCKey) Type() KeyType { return KeyHTLC }
+
+// Encodes the hash, the timeout and the recipient and refund keys
+func (k *HTLCKey) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.Write(k.Hash)
+	binary.Write(&buf, binary.BigEndian, uint64(k.Timeout))
+	writeTypedKey(&buf, k.Recipient)
+	writeTypedKey(&buf, k.Refund)
+	return buf.Bytes()
+}
+
+func parseHTLCKey(b []byte) (*HTLCKey, error) {
+	r := bytes.NewReader(b)
+	hash := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(r, hash); err != nil {
+		return nil, htlcEncodingErr
+	}
+	var timeout uint64
+	if err := binary.Read(r, binary.BigEndian, &timeout); err != nil {
+		return nil, htlcEncodingErr
+	}
+	keys := make([]PublicKey, 2)
+	for i := range keys {
+		keyType, keyBytes, err := readTypedKey(r)
+		if err != nil {
+			return nil, htlcEncodingErr
+		}
+		if !keyType.IsSingle() {
+			return nil, fmt.Errorf("the keys of a contract must be single keys, got a %s key", keyType)
+		}
+		if keys[i], err = pubKeyFromBytes(keyType, keyBytes); err != nil {
+			return nil, err
+		}
+	}
+	if r.Len() != 0 {
+		return nil, htlcEncodingErr
+	}
+	return NewHTLCKey(hash, keys[0], keys[1], int64(timeout))
+}
+
+// Checks the signature of the branch taken.
+//
+// The timeout of the refund branch depends on the chain, so it is checked by
+// CheckSpend instead.
+func (k *HTLCKey) Verify(digest, sig []byte) error {
+	branch, preimage, s, err := decodeHTLCSignature(sig)
+	if err != nil {
+		return err
+	}
+	switch branch {
+	case htlcRedeem:
+		if sum := sha256.Sum256(preimage); !bytes.Equal(sum[:], k.Hash) {
+			return errors.New("the preimage does not match the hash of the contract")
+		}
+		return k.Recipient.Verify(digest, s)
+	case htlcRefund:
+		return k.Refund.Verify(digest, s)
+	}
+	return htlcSignatureErr
+}
+
+// Refunds cannot be included in a block before the timeout, which is enforced
+// by requiring a transaction lock time of at least the timeout height
+func (k *HTLCKey) CheckSpend(tx *Transaction, sig []byte) error {
+	branch, _, _, err := decodeHTLCSignature(sig)
+	if err != nil {
+		return err
+	}
+	if branch == htlcRefund && (tx.LockTime < k.Timeout || tx.LockTime >= LockTimeThreshold) {
+		return fmt.Errorf("a refund must be locked until height %d, got %s", k.Timeout, FormatLockTime(tx.LockTime))
+	}
+	return nil
+}
+
+// Signs tx, which spends outputs of the contract, with the key of the
+// recipient, revealing secret
+func (k *HTLCKey) SignRedeem(tx *Transaction, secret []byte, key PrivateKey) error {
+	if sum := sha256.Sum256(secret); !bytes.Equal(sum[:], k.Hash) {
+		return errors.New("the secret does not match the hash of the contract")
+	}
+	if !SameKey(key.Public(), k.Recipient) {
+		return errors.New("only the recipient of the contract can redeem it")
+	}
+	return k.sign(tx, htlcRedeem, secret, key)
+}
+
+// Signs tx, which spends outputs of the contract, with the refund key.
+//
+// The lock time of tx must be at least the timeout of the contract.
+func (k *HTLCKey) SignRefund(tx *Transaction, key PrivateKey) error {
+	if !SameKey(key.Public(), k.Refund) {
+		return errors.New("only the sender of the contract can be refunded")
+	}
+	if tx.LockTime < k.Timeout {
+		return fmt.Errorf("a refund must be locked until height %d", k.Timeout)
+	}
+	return k.sign(tx, htlcRefund, nil, key)
+}
+
+// Signs tx as its sender, or every input of tx owned by the contract if tx is
+// signed per input
+func (k *HTLCKey) sign(tx *Transaction, branch byte, preimage []byte, key PrivateKey) error {
+	sig, err := key.Sign(tx.SigningHash())
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(branch)
+	if branch == htlcRedeem {
+		binary.Write(&buf, binary.BigEndian, uint16(len(preimage)))
+		buf.Write(preimage)
+	}
+	buf.Write(sig)
+
+	if !tx.SignsPerInput() {
+		if !SameKey(tx.SenderAddress, k) {
+			return fmt.Errorf("transaction is sent by %s, not by the contract %s", tx.Sender(), AddressFromPubKey(k))
+		}
+		tx.Signature = buf.Bytes()
+		return nil
+	}
+	address := AddressFromPubKey(k)
+	signed := 0
+	for _, id := range tx.inputIds() {
+		if tx.Inputs[id].OwnerAddress() != address {
+			continue
+		}
+		if err := tx.setInputSig(id, k, buf.Bytes()); err != nil {
+			return err
+		}
+		signed++
+	}
+	if signed == 0 {
+		return fmt.Errorf("transaction spends nothing from the contract %s", address)
+	}
+	return nil
+}
+
+// Returns the secret revealed by a transaction redeeming a contract, so that
+// the other side of a swap can redeem its own contract
+func ExtractSwapSecret(tx *Transaction) ([]byte, error) {
+	var sigs [][]byte
+	if _, ok := tx.SenderAddress.(*HTLCKey); ok {
+		sigs = append(sigs, tx.Signature)
+	}
+	for _, id := range tx.inputIds() {
+		if sig, ok := tx.InputSigs[id]; ok {
+			if _, ok := sig.Key.(*HTLCKey); ok {
+				sigs = append(sigs, sig.Signature)
+			}
+		}
+	}
+	if len(sigs) == 0 {
+		return nil, errors.New("the transaction spends no contract")
+	}
+	for _, sig := range sigs {
+		branch, preimage, _, err := decodeHTLCSignature(sig)
+		if err != nil {
+			return nil, err
+		}
+		if branch == htlcRedeem {
+			return preimage, nil
+		}
+	}
+	return nil, errors.New("the transaction refunds the contract, it reveals no secret")
+}
+
+func decodeHTLCSignature(sig []byte) (branch byte, preimage, s []byte, err error) {
+	r := bytes.NewReader(sig)
+	if branch, err = r.ReadByte(); err != nil {
+		return 0, nil, nil, htlcSignatureErr
+	}
+	if branch == htlcRedeem {
+		var preimageLen uint16
+		if err := binary.Read(r, binary.BigEndian, &preimageLen); err != nil {
+			return 0, nil, nil, htlcSignatureErr
+		}
+		preimage = make([]byte, preimageLen)
+		if _, err := io.ReadFull(r, preimage); err != nil {
+			return 0, nil, nil, htlcSignatureErr
+		}
+	} else if branch != htlcRefund {
+		return 0, nil, nil, htlcSignatureErr
+	}
+	s = make([]byte, r.Len())
+	r.Read(s)
+	return branch, preimage, s, nil
+}
@@ -0,0 +1,83 @@
+package backend
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHTLC(t *testing.T) {
+	alice := NewWallet(DefaultKeyType)
+	bob := NewWallet(DefaultKeyType)
+	secret, hash, err := NewSwapSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract, err := NewHTLCKey(hash, bob.PrivKey.Public(), alice.PrivKey.Public(), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := []*TxOut{newUtxo(contract, 100)}
+	spendContract := func(to Address, lockTime int64) *Transaction {
+		tx, _, err := BuildTx(contract, locked, &TxOptions{LockTime: lockTime}, &TxTargetTy{
+			Address: to,
+			Amount:  100,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	t.Run("Redeem with the wrong secret", func(t *testing.T) {
+		tx := spendContract(bob.Address(), 0)
+		if err := contract.SignRedeem(tx, []byte("not the secret"), bob.PrivKey); err == nil {
+			t.Error("Expected signing with the wrong secret to fail")
+		}
+		if err := contract.SignRedeem(tx, secret, alice.PrivKey); err == nil {
+			t.Error("Expected redeeming with the refund key to fail")
+		}
+	})
+	t.Run("Redeem with the secret", func(t *testing.T) {
+		tx := spendContract(bob.Address(), 0)
+		if err := contract.SignRedeem(tx, secret, bob.PrivKey); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.VerifySignatures(); err != nil {
+			t.Errorf("Expected the redeem to be valid, got %v", err)
+		}
+		revealed, err := ExtractSwapSecret(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(revealed, secret) {
+			t.Error("Expected the redeem transaction to reveal the secret")
+		}
+	})
+	t.Run("Refund before the timeout", func(t *testing.T) {
+		tx := spendContract(alice.Address(), contract.Timeout-1)
+		if err := contract.SignRefund(tx, alice.PrivKey); err == nil {
+			t.Error("Expected signing a refund locked before the timeout to fail")
+		}
+		// signed by hand, the lock time is still enforced
+		sig, _ := alice.PrivKey.Sign(tx.SigningHash())
+		tx.Signature = append([]byte{htlcRefund}, sig...)
+		if err := tx.VerifySignatures(); err == nil {
+			t.Error("Expected a refund locked before the timeout to be invalid")
+		}
+	})
+	t.Run("Refund after the timeout", func(t *testing.T) {
+		tx := spendContract(alice.Address(), contract.Timeout)
+		if err := contract.SignRedeem(tx, secret, alice.PrivKey); err == nil {
+			t.Error("Expected the refund key not to redeem the contract")
+		}
+		if err := contract.SignRefund(tx, alice.PrivKey); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.VerifySignatures(); err != nil {
+			t.Errorf("Expected the refund to be valid, got %v", err)
+		}
+		if _, err := ExtractSwapSecret(tx); err == nil {
+			t.Error("Expected a refund to reveal no secret")
+		}
+	})
+}
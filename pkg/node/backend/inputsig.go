@@ -0,0 +1,295 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Signature of a single input of a transaction, by the key owning it.
+//
+// A transaction with a sender is signed as a whole by that key, so all its
+// inputs must belong to it. A transaction without a sender carries one
+// signature per input instead, so that it can spend the coins of several
+// owners, e.g. in coinjoin-style payments or from several addresses of a wallet.
+type InputSig struct {
+	Key       PublicKey
+	Signature []byte
+}
+
+type inputSigJson struct {
+	Key       string `json:"key"`
+	Signature string `json:"signature"`
+}
+
+// Returns true if every input of tx carries its own signature, instead of tx
+// being signed as a whole by its sender
+func (tx *Transaction) SignsPerInput() bool {
+	return tx.SenderAddress == nil && len(tx.Inputs) > 0
+}
+
+// The hash that signatures of the transaction, or of its inputs, are made over.
+//
+// It is the sha256 of a canonical encoding of what the transaction does: the
+// ids of its inputs, sorted, its outputs, sorted by id, with their owner,
+// amount, asset and lock time, and its lock time, memo and issuance. The id is
+// left out since nodes do not recompute it, so none of these can be changed
+// without invalidating the signatures.
+func (tx *Transaction) SigningHash() []byte {
+	h := sha256.New()
+	writeBytes := func(b []byte) {
+		binary.Write(h, binary.BigEndian, uint32(len(b)))
+		h.Write(b)
+	}
+	writeInt := func(n int64) {
+		binary.Write(h, binary.BigEndian, n)
+	}
+	h.Write([]byte("noobcash tx"))
+	inputIds := tx.inputIds()
+	writeInt(int64(len(inputIds)))
+	for _, id := range inputIds {
+		writeBytes([]byte(id))
+	}
+	outputIds := make([]string, 0, len(tx.Outputs))
+	for id := range tx.Outputs {
+		outputIds = append(outputIds, id)
+	}
+	sort.Strings(outputIds)
+	writeInt(int64(len(outputIds)))
+	for _, id := range outputIds {
+		txOut := tx.Outputs[id]
+		writeBytes([]byte(id))
+		writeBytes([]byte(txOut.OwnerAddress()))
+		writeInt(int64(txOut.Amount))
+		writeBytes([]byte(txOut.Asset))
+		writeInt(txOut.LockTime)
+	}
+	writeInt(tx.LockTime)
+	writeBytes(tx.Memo)
+	if tx.Issuance == nil {
+		h.Write([]byte{0})
+	} else {
+		h.Write([]byte{1})
+		writeBytes([]byte(tx.Issuance.Name))
+		writeInt(int64(tx.Issuance.Supply))
+	}
+	return h.Sum(nil)
+}
+
+// Returns the address owning txIn, an input of tx
+func (tx *Transaction) InputOwner(txIn *TxOut) Address {
+	if tx.SignsPerInput() {
+		return txIn.OwnerAddress()
+	}
+	return tx.Sender()
+}
+
+// Returns the addresses owning the inputs of tx, sorted
+func (tx *Transaction) Owners() []Address {
+	if tx.IsGenesis() {
+		return nil
+	}
+	if !tx.SignsPerInput() {
+		return []Address{tx.Sender()}
+	}
+	seen := map[Address]bool{}
+	var owners []Address
+	for _, txIn := range tx.Inputs {
+		if owner := txIn.OwnerAddress(); !seen[owner] {
+			seen[owner] = true
+			owners = append(owners, owner)
+		}
+	}
+	sort.Slice(owners, func(i, j int) bool { return owners[i] < owners[j] })
+	return owners
+}
+
+func (tx *Transaction) inputIds() []string {
+	ids := make([]string, 0, len(tx.Inputs))
+	for id := range tx.Inputs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Returns the ids of the inputs that are not signed yet
+func (tx *Transaction) UnsignedInputs() []string {
+	var unsigned []string
+	for _, id := range tx.inputIds() {
+		if _, ok := tx.InputSigs[id]; !ok {
+			unsigned = append(unsigned, id)
+		}
+	}
+	return unsigned
+}
+
+// Sets the signature of an input, checking that key owns it
+func (tx *Transaction) setInputSig(inputId string, key PublicKey, sig []byte) error {
+	if !tx.SignsPerInput() {
+		return fmt.Errorf("transaction is signed as a whole by %s", tx.Sender())
+	}
+	txIn, ok := tx.Inputs[inputId]
+	if !ok {
+		return fmt.Errorf("transaction has no input %s", inputId)
+	}
+	if !txIn.OwnerAddress().IsOwnedBy(key) {
+		return fmt.Errorf("input %s is owned by %s, not by %s", inputId, txIn.OwnerAddress(), AddressFromPubKey(key))
+	}
+	if tx.InputSigs == nil {
+		tx.InputSigs = map[string]*InputSig{}
+	}
+	tx.InputSigs[inputId] = &InputSig{Key: key, Signature: sig}
+	return nil
+}
+
+// Signs the input with the given id with key, which must own it
+func (tx *Transaction) SignInput(inputId string, key PrivateKey) error {
+	sig, err := key.Sign(tx.SigningHash())
+	if err != nil {
+		return err
+	}
+	return tx.setInputSig(inputId, key.Public(), sig)
+}
+
+// Signs every input owned by key, and returns how many there were
+func (tx *Transaction) SignInputsWithKey(key PrivateKey) (int, error) {
+	address := AddressFromPubKey(key.Public())
+	signed := 0
+	for _, id := range tx.inputIds() {
+		if tx.Inputs[id].OwnerAddress() != address {
+			continue
+		}
+		if err := tx.SignInput(id, key); err != nil {
+			return signed, err
+		}
+		signed++
+	}
+	if signed == 0 {
+		return 0, fmt.Errorf("transaction has no input owned by %s", address)
+	}
+	return signed, nil
+}
+
+// Checks the signatures of tx: the one of its sender, or the one of every
+// input, along with the conditions their keys put on spending, see SpendCondition
+func (tx *Transaction) VerifySignatures() error {
+	if tx.IsGenesis() {
+		return nil
+	}
+	if !tx.SignsPerInput() {
+		if len(tx.InputSigs) > 0 {
+			return errors.New("a transaction with a sender is signed as a whole")
+		}
+		if err := tx.SenderAddress.Verify(tx.SigningHash(), tx.Signature); err != nil {
+			return err
+		}
+		if condition, ok := tx.SenderAddress.(SpendCondition); ok {
+			return condition.CheckSpend(tx, tx.Signature)
+		}
+		return nil
+	}
+	if len(tx.Signature) > 0 {
+		return errors.New("a transaction without a sender is signed per input")
+	}
+	for _, id := range tx.inputIds() {
+		if err := tx.verifyInput(id); err != nil {
+			return fmt.Errorf("input %s: %s", id, err)
+		}
+	}
+	for id := range tx.InputSigs {
+		if _, ok := tx.Inputs[id]; !ok {
+			return fmt.Errorf("signature for %s, which is not an input", id)
+		}
+	}
+	return nil
+}
+
+func (tx *Transaction) verifyInput(inputId string) error {
+	sig, ok := tx.InputSigs[inputId]
+	if !ok || sig.Key == nil {
+		return errors.New("not signed")
+	}
+	owner := tx.Inputs[inputId].OwnerAddress()
+	if !owner.IsOwnedBy(sig.Key) {
+		return fmt.Errorf("signed by %s instead of its owner %s", AddressFromPubKey(sig.Key), owner)
+	}
+	if lock, ok := sig.Key.(*ScriptKey); ok {
+		return lock.Unlock(tx, sig.Signature)
+	}
+	if err := sig.Key.Verify(tx.SigningHash(), sig.Signature); err != nil {
+		return err
+	}
+	if condition, ok := sig.Key.(SpendCondition); ok {
+		return condition.CheckSpend(tx, sig.Signature)
+	}
+	return nil
+}
+
+// The share of one owner in a transaction signed per input: the utxos its
+// inputs are picked from, and the amount it pays. Its change goes back to Owner.
+type Contribution struct {
+	Owner  Address
+	Utxos  []*TxOut
+	Amount int
+}
+
+// Builds an unsigned transaction paying every target with the coins of several
+// owners, e.g. a coinjoin. The contributions must add up to the targets.
+//
+// Like BuildTx it needs no wallet. Every owner then signs its own inputs, see
+// SignInputsWithKey.
+func BuildJointTx(contributions []*Contribution, opts *TxOptions, targets ...*TxTargetTy) (*Transaction, error) {
+	var totalAmount, contributed int
+	for _, target := range targets {
+		totalAmount += target.Amount
+	}
+	if totalAmount <= 0 {
+		return nil, fmt.Errorf("tried to create transaction for %d", totalAmount)
+	}
+	for _, c := range contributions {
+		contributed += c.Amount
+	}
+	if contributed != totalAmount {
+		return nil, fmt.Errorf("contributions add up to %d, but the targets to %d", contributed, totalAmount)
+	}
+	selector, splitPolicy := DefaultCoinSelector, DefaultSplitPolicy
+	if opts != nil && opts.CoinSelector != nil {
+		selector = opts.CoinSelector
+	}
+	if opts != nil && opts.SplitPolicy != nil {
+		splitPolicy = opts.SplitPolicy
+	}
+	tx := newTxToTargets(nil, splitPolicy, targets, opts)
+	for _, c := range contributions {
+		if c.Amount <= 0 {
+			return nil, fmt.Errorf("%s contributes %d", c.Owner, c.Amount)
+		}
+		for _, utxo := range c.Utxos {
+			if utxo.OwnerAddress() != c.Owner {
+				return nil, fmt.Errorf("utxo %s is not owned by %s", utxo.Id, c.Owner)
+			}
+			if tx.Inputs.Has(utxo) {
+				return nil, fmt.Errorf("utxo %s is contributed twice", utxo.Id)
+			}
+		}
+		var native []*TxOut
+		for _, utxo := range c.Utxos {
+			if utxo.IsNative() {
+				native = append(native, utxo)
+			}
+		}
+		selection, err := selector.Select(native, c.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", c.Owner, err)
+		}
+		owner := c.Owner
+		tx.addSelection(selection, splitPolicy, func(amount int) *TxOut {
+			return NewTxOutToAddress(owner, amount)
+		})
+	}
+	tx.ComputeAndFillHash()
+	return tx, nil
+}
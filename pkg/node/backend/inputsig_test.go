@@ -0,0 +1,113 @@
+package backend
+
+import (
+	"testing"
+)
+
+func TestSigningHash(t *testing.T) {
+	alice := NewWallet(DefaultKeyType)
+	bob := NewWallet(DefaultKeyType)
+	shop := NewWallet(DefaultKeyType)
+	aliceUtxos := []*TxOut{newUtxo(alice.PrivKey.Public(), 100)}
+	bobUtxos := []*TxOut{newUtxo(bob.PrivKey.Public(), 100)}
+
+	// a transaction signed as a whole by its sender
+	signedTx := func() *Transaction {
+		tx, _, err := BuildTx(alice.PrivKey.Public(), aliceUtxos, &TxOptions{SplitPolicy: NoSplit{}}, &TxTargetTy{
+			Address: shop.Address(),
+			Amount:  40,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := SignTxWithKey(tx, alice.PrivKey); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	// a transaction signed per input by both owners
+	jointTx := func() *Transaction {
+		tx, err := BuildJointTx([]*Contribution{
+			{Owner: alice.Address(), Utxos: aliceUtxos, Amount: 20},
+			{Owner: bob.Address(), Utxos: bobUtxos, Amount: 20},
+		}, &TxOptions{SplitPolicy: NoSplit{}}, &TxTargetTy{Address: shop.Address(), Amount: 40})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []PrivateKey{alice.PrivKey, bob.PrivKey} {
+			if err := SignTxWithKey(tx, key); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return tx
+	}
+	paidTo := func(tx *Transaction, address Address) *TxOut {
+		for _, txOut := range tx.Outputs {
+			if txOut.OwnerAddress() == address {
+				return txOut
+			}
+		}
+		t.Fatalf("Expected an output paying %s", address)
+		return nil
+	}
+
+	for name, build := range map[string]func() *Transaction{"sender": signedTx, "input": jointTx} {
+		if err := build().VerifySignatures(); err != nil {
+			t.Fatalf("Expected the transaction signed per %s to be valid, got %v", name, err)
+		}
+		for change, tamper := range map[string]func(tx *Transaction){
+			"the amount of an output": func(tx *Transaction) {
+				paidTo(tx, shop.Address()).Amount = 60
+			},
+			"the owner of an output": func(tx *Transaction) {
+				txOut := paidTo(tx, shop.Address())
+				txOut.Address = bob.Address()
+				txOut.Owner = bob.PrivKey.Public()
+			},
+			"the asset of an output": func(tx *Transaction) {
+				paidTo(tx, shop.Address()).Asset = "30be7dcf420f7d1c479f01f15d29bc66"
+			},
+			"the lock time of an output": func(tx *Transaction) {
+				paidTo(tx, shop.Address()).LockTime = 100
+			},
+			"an added output": func(tx *Transaction) {
+				tx.Outputs.Add(newUtxo(bob.PrivKey.Public(), 1))
+			},
+			"a removed output": func(tx *Transaction) {
+				tx.Outputs.Remove(paidTo(tx, shop.Address()))
+			},
+			"the lock time": func(tx *Transaction) {
+				tx.LockTime = 100
+			},
+			"the memo": func(tx *Transaction) {
+				tx.Memo = []byte("invoice 43")
+			},
+			"the issuance": func(tx *Transaction) {
+				tx.Issuance = &Issuance{Name: "lab credits", Supply: 1000}
+			},
+		} {
+			tx := build()
+			tamper(tx)
+			if err := tx.VerifySignatures(); err == nil {
+				t.Errorf("Expected changing %s after signing per %s to invalidate the signatures", change, name)
+			}
+		}
+	}
+	t.Run("Independent of the order of the maps", func(t *testing.T) {
+		tx := jointTx()
+		copied := *tx
+		copied.Inputs, copied.Outputs = TxOutMap{}, TxOutMap{}
+		for _, m := range []TxOutMap{tx.Inputs, tx.Outputs} {
+			for _, txOut := range m {
+				copied.Outputs.Add(txOut)
+			}
+		}
+		for _, txIn := range tx.Inputs {
+			copied.Outputs.Remove(txIn)
+			copied.Inputs.Add(txIn)
+		}
+		if string(copied.SigningHash()) != string(tx.SigningHash()) {
+			t.Error("Expected the same signing hash for the same contents")
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package backend
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scheme of the shareable form of invoices, see Invoice.Encode
+const InvoiceScheme = "noobcash"
+
+// A request for a payment of Amount to Address, before Expiry.
+//
+// It is shared with the payer either as JSON or in its encoded form,
+// noobcash:<address>?amount=<amount>&expiry=<unix seconds>&id=<id>
+type Invoice struct {
+	Id          string    `json:"id"`
+	Address     Address   `json:"address"`
+	Amount      int       `json:"amount"`
+	Expiry      time.Time `json:"expiry"`
+	Description string    `json:"description,omitempty"`
+}
+
+func NewInvoice(address Address, amount int, expiry time.Time, description string) (*Invoice, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	invoice := &Invoice{
+		Id:          HexEncodeByteSlice(id),
+		Address:     address,
+		Amount:      amount,
+		Expiry:      expiry.Truncate(time.Second),
+		Description: description,
+	}
+	if err := invoice.Validate(); err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+func (inv *Invoice) Validate() error {
+	if inv.Id == "" {
+		return errors.New("invoice has no id")
+	}
+	if _, err := ParseAddress(string(inv.Address)); err != nil {
+		return err
+	}
+	if inv.Amount <= 0 {
+		return fmt.Errorf("invoice amount must be positive, got %d", inv.Amount)
+	}
+	if inv.Expiry.IsZero() {
+		return errors.New("invoice has no expiry")
+	}
+	return nil
+}
+
+func (inv *Invoice) IsExpired(at time.Time) bool {
+	return at.After(inv.Expiry)
+}
+
+// Returns the shareable form of the invoice
+func (inv *Invoice) Encode() string {
+	query := url.Values{}
+	query.Set("amount", strconv.Itoa(inv.Amount))
+	query.Set("expiry", strconv.FormatInt(inv.Expiry.Unix(), 10))
+	query.Set("id", inv.Id)
+	if inv.Description != "" {
+		query.Set("description", inv.Description)
+	}
+	u := url.URL{Scheme: InvoiceScheme, Opaque: string(inv.Address), RawQuery: query.Encode()}
+	return u.String()
+}
+
+// Parses an invoice given either in its shareable form or as JSON
+func ParseInvoice(s string) (*Invoice, error) {
+	s = strings.TrimSpace(s)
+	invoice := &Invoice{}
+	if strings.HasPrefix(s, "{") {
+		if err := json.Unmarshal([]byte(s), invoice); err != nil {
+			return nil, fmt.Errorf("invalid invoice: %s", err)
+		}
+	} else {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid invoice: %s", err)
+		}
+		if u.Scheme != InvoiceScheme || u.Opaque == "" {
+			return nil, fmt.Errorf("invalid invoice: expected %s:<address>?...", InvoiceScheme)
+		}
+		query := u.Query()
+		invoice.Id = query.Get("id")
+		invoice.Address = Address(u.Opaque)
+		invoice.Description = query.Get("description")
+		if invoice.Amount, err = strconv.Atoi(query.Get("amount")); err != nil {
+			return nil, fmt.Errorf("invalid invoice amount: %s", err)
+		}
+		expiry, err := strconv.ParseInt(query.Get("expiry"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid invoice expiry: %s", err)
+		}
+		invoice.Expiry = time.Unix(expiry, 0)
+	}
+	if err := invoice.Validate(); err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
@@ -0,0 +1,401 @@
+package backend
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Signature scheme of a key pair
+type KeyType string
+
+const (
+	KeyRSA     KeyType = "rsa"     // PKCS#1 v1.5 signatures over sha256, kept for existing chains
+	KeyEd25519 KeyType = "ed25519" // the default
+	KeyECDSA   KeyType = "ecdsa"   // P-256, ASN.1 signatures
+	// m-of-n policy over keys of the other types, see MultisigKey.
+	// It has no private key, its signatures are combined from the ones of its keys.
+	KeyMultisig KeyType = "multisig"
+	// hash-time-locked contract between two keys, see HTLCKey
+	KeyHTLC KeyType = "htlc"
+	// outputs locked by a script, see ScriptKey
+	KeyScript KeyType = "script"
+)
+
+var DefaultKeyType = KeyEd25519
+
+// Size of newly generated RSA keys
+var RSAKeyBits = 2048
+
+// PEM block types, which encode the key type in the serialized keys
+const (
+	pemRSAPublic      = "RSA PUBLIC KEY"
+	pemRSAPrivate     = "RSA PRIVATE KEY"
+	pemEd25519Public  = "ED25519 PUBLIC KEY"
+	pemEd25519Private = "ED25519 PRIVATE KEY"
+	pemECDSAPublic    = "ECDSA PUBLIC KEY"
+	pemECDSAPrivate   = "ECDSA PRIVATE KEY"
+	pemMultisigPolicy = "MULTISIG POLICY"
+	pemHTLCContract   = "HTLC CONTRACT"
+	pemLockingScript  = "LOCKING SCRIPT"
+)
+
+var invalidSignatureErr = errors.New("invalid signature")
+
+type PublicKey interface {
+	Type() KeyType
+	// Canonical encoding of the key, hashed into its address
+	Bytes() []byte
+	// Checks sig against the digest signed by the matching private key
+	Verify(digest, sig []byte) error
+}
+
+type PrivateKey interface {
+	Type() KeyType
+	Public() PublicKey
+	Sign(digest []byte) ([]byte, error)
+}
+
+// Returns true for the types of keys that have a private key and sign on
+// their own, as opposed to policies built on top of them
+func (kt KeyType) IsSingle() bool {
+	switch kt {
+	case KeyRSA, KeyEd25519, KeyECDSA:
+		return true
+	}
+	return false
+}
+
+func ParseKeyType(s string) (KeyType, error) {
+	switch kt := KeyType(s); kt {
+	case KeyRSA, KeyEd25519, KeyECDSA:
+		return kt, nil
+	}
+	return "", fmt.Errorf("unknown key type '%s' (rsa, ed25519, ecdsa)", s)
+}
+
+func GenerateKey(keyType KeyType) (PrivateKey, error) {
+	switch keyType {
+	case KeyRSA:
+		key, err := rsa.GenerateKey(rand.Reader, RSAKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		return &rsaPrivateKey{key}, nil
+	case KeyEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519PrivateKey(key), nil
+	case KeyECDSA:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsaPrivateKey{key}, nil
+	}
+	return nil, fmt.Errorf("unknown key type '%s'", keyType)
+}
+
+// Wraps an RSA key, e.g. one generated outside of the package
+func NewRSAPublicKey(pubKey *rsa.PublicKey) PublicKey {
+	if pubKey == nil {
+		return nil
+	}
+	return &rsaPublicKey{pubKey}
+}
+
+func NewRSAPrivateKey(privKey *rsa.PrivateKey) PrivateKey {
+	if privKey == nil {
+		return nil
+	}
+	return &rsaPrivateKey{privKey}
+}
+
+// Returns true if both keys are the same key
+func SameKey(a, b PublicKey) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Type() == b.Type() && string(a.Bytes()) == string(b.Bytes())
+}
+
+////
+// RSA
+////
+type rsaPublicKey struct{ key *rsa.PublicKey }
+type rsaPrivateKey struct{ key *rsa.PrivateKey }
+
+func (k *rsaPublicKey) Type() KeyType { return KeyRSA }
+func (k *rsaPublicKey) Bytes() []byte { return x509.MarshalPKCS1PublicKey(k.key) }
+func (k *rsaPublicKey) Verify(digest, sig []byte) error {
+	return rsa.VerifyPKCS1v15(k.key, crypto.SHA256, digest, sig)
+}
+
+func (k *rsaPrivateKey) Type() KeyType     { return KeyRSA }
+func (k *rsaPrivateKey) Public() PublicKey { return &rsaPublicKey{&k.key.PublicKey} }
+func (k *rsaPrivateKey) Sign(digest []byte) ([]byte, error) {
+	return rsa.SignPKCS1v15(rand.Reader, k.key, crypto.SHA256, digest)
+}
+
+////
+// Ed25519
+////
+type ed25519PublicKey ed25519.PublicKey
+type ed25519PrivateKey ed25519.PrivateKey
+
+func (k ed25519PublicKey) Type() KeyType { return KeyEd25519 }
+func (k ed25519PublicKey) Bytes() []byte { return []byte(k) }
+func (k ed25519PublicKey) Verify(digest, sig []byte) error {
+	if !ed25519.Verify(ed25519.PublicKey(k), digest, sig) {
+		return invalidSignatureErr
+	}
+	return nil
+}
+
+func (k ed25519PrivateKey) Type() KeyType { return KeyEd25519 }
+func (k ed25519PrivateKey) Public() PublicKey {
+	return ed25519PublicKey(ed25519.PrivateKey(k).Public().(ed25519.PublicKey))
+}
+func (k ed25519PrivateKey) Sign(digest []byte) ([]byte, error) {
+	return ed25519.Sign(ed25519.PrivateKey(k), digest), nil
+}
+
+////
+// ECDSA
+////
+type ecdsaPublicKey struct{ key *ecdsa.PublicKey }
+type ecdsaPrivateKey struct{ key *ecdsa.PrivateKey }
+
+func (k *ecdsaPublicKey) Type() KeyType { return KeyECDSA }
+func (k *ecdsaPublicKey) Bytes() []byte { return elliptic.Marshal(k.key.Curve, k.key.X, k.key.Y) }
+func (k *ecdsaPublicKey) Verify(digest, sig []byte) error {
+	if !ecdsa.VerifyASN1(k.key, digest, sig) {
+		return invalidSignatureErr
+	}
+	return nil
+}
+
+func (k *ecdsaPrivateKey) Type() KeyType     { return KeyECDSA }
+func (k *ecdsaPrivateKey) Public() PublicKey { return &ecdsaPublicKey{&k.key.PublicKey} }
+func (k *ecdsaPrivateKey) Sign(digest []byte) ([]byte, error) {
+	return ecdsa.SignASN1(rand.Reader, k.key, digest)
+}
+
+////
+// Serialization and deserialization
+////
+func PubKeyToPem(pubKey PublicKey) string {
+	if pubKey == nil {
+		return "0"
+	}
+	var blockType string
+	switch pubKey.Type() {
+	case KeyRSA:
+		blockType = pemRSAPublic
+	case KeyEd25519:
+		blockType = pemEd25519Public
+	case KeyECDSA:
+		blockType = pemECDSAPublic
+	case KeyMultisig:
+		blockType = pemMultisigPolicy
+	case KeyHTLC:
+		blockType = pemHTLCContract
+	case KeyScript:
+		blockType = pemLockingScript
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: pubKey.Bytes()}))
+}
+
+// Parses a public key of any supported type; "0" is the nil key
+func ParsePubKeyPem(s string) (PublicKey, error) {
+	if s == "0" {
+		return nil, nil
+	}
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block containing the key")
+	}
+	switch block.Type {
+	case pemRSAPublic:
+		return pubKeyFromBytes(KeyRSA, block.Bytes)
+	case pemEd25519Public:
+		return pubKeyFromBytes(KeyEd25519, block.Bytes)
+	case pemECDSAPublic:
+		return pubKeyFromBytes(KeyECDSA, block.Bytes)
+	case pemMultisigPolicy:
+		return pubKeyFromBytes(KeyMultisig, block.Bytes)
+	case pemHTLCContract:
+		return pubKeyFromBytes(KeyHTLC, block.Bytes)
+	case pemLockingScript:
+		return pubKeyFromBytes(KeyScript, block.Bytes)
+	}
+	return nil, fmt.Errorf("public key is of the wrong type %s", block.Type)
+}
+
+// Parses the canonical encoding of a key, as returned by PublicKey.Bytes()
+func pubKeyFromBytes(keyType KeyType, b []byte) (PublicKey, error) {
+	switch keyType {
+	case KeyRSA:
+		key, err := x509.ParsePKCS1PublicKey(b)
+		if err != nil {
+			return nil, err
+		}
+		return &rsaPublicKey{key}, nil
+	case KeyEd25519:
+		if len(b) != ed25519.PublicKeySize {
+			return nil, errors.New("ed25519 public key has the wrong size")
+		}
+		return ed25519PublicKey(b), nil
+	case KeyECDSA:
+		x, y := elliptic.Unmarshal(elliptic.P256(), b)
+		if x == nil {
+			return nil, errors.New("invalid ecdsa public key")
+		}
+		return &ecdsaPublicKey{&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
+	case KeyMultisig:
+		return parseMultisigKey(b)
+	case KeyHTLC:
+		return parseHTLCKey(b)
+	case KeyScript:
+		return NewScriptKey(b)
+	}
+	return nil, fmt.Errorf("unknown key type '%s'", keyType)
+}
+
+// Writes the type and the bytes of key, each prefixed by its length
+func writeTypedKey(buf *bytes.Buffer, key PublicKey) {
+	keyBytes := key.Bytes()
+	buf.WriteByte(byte(len(key.Type())))
+	buf.WriteString(string(key.Type()))
+	binary.Write(buf, binary.BigEndian, uint16(len(keyBytes)))
+	buf.Write(keyBytes)
+}
+
+// Encodes a single key along with its type, as it appears in scripts
+func EncodeTypedKey(key PublicKey) []byte {
+	var buf bytes.Buffer
+	writeTypedKey(&buf, key)
+	return buf.Bytes()
+}
+
+// Parses a single key encoded by EncodeTypedKey
+func ParseTypedKey(b []byte) (PublicKey, error) {
+	r := bytes.NewReader(b)
+	keyType, keyBytes, err := readTypedKey(r)
+	if err != nil || r.Len() != 0 {
+		return nil, errors.New("malformed typed key")
+	}
+	if !keyType.IsSingle() {
+		return nil, fmt.Errorf("expected a single key, got a %s key", keyType)
+	}
+	return pubKeyFromBytes(keyType, keyBytes)
+}
+
+// Reads a key written by writeTypedKey, without parsing it
+func readTypedKey(r *bytes.Reader) (KeyType, []byte, error) {
+	typeLen, err := r.ReadByte()
+	if err != nil {
+		return "", nil, err
+	}
+	keyType := make([]byte, typeLen)
+	if _, err := io.ReadFull(r, keyType); err != nil {
+		return "", nil, err
+	}
+	var keyLen uint16
+	if err := binary.Read(r, binary.BigEndian, &keyLen); err != nil {
+		return "", nil, err
+	}
+	keyBytes := make([]byte, keyLen)
+	if _, err := io.ReadFull(r, keyBytes); err != nil {
+		return "", nil, err
+	}
+	return KeyType(keyType), keyBytes, nil
+}
+
+// Like ParsePubKeyPem, but exits on failure
+func PubKeyFromPem(s string) PublicKey {
+	key, err := ParsePubKeyPem(s)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return key
+}
+
+func PrivKeyToPem(privKey PrivateKey) string {
+	if privKey == nil {
+		return "0"
+	}
+	var block *pem.Block
+	switch k := privKey.(type) {
+	case *rsaPrivateKey:
+		block = &pem.Block{Type: pemRSAPrivate, Bytes: x509.MarshalPKCS1PrivateKey(k.key)}
+	case ed25519PrivateKey:
+		block = &pem.Block{Type: pemEd25519Private, Bytes: ed25519.PrivateKey(k).Seed()}
+	case *ecdsaPrivateKey:
+		der, err := x509.MarshalECPrivateKey(k.key)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		block = &pem.Block{Type: pemECDSAPrivate, Bytes: der}
+	}
+	return string(pem.EncodeToMemory(block))
+}
+
+// Parses a private key of any supported type
+func ParsePrivKeyPem(s string) (PrivateKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block containing the key")
+	}
+	switch block.Type {
+	case pemRSAPrivate:
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return &rsaPrivateKey{key}, nil
+	case pemEd25519Private:
+		if len(block.Bytes) != ed25519.SeedSize {
+			return nil, errors.New("ed25519 private key has the wrong size")
+		}
+		return ed25519PrivateKey(ed25519.NewKeyFromSeed(block.Bytes)), nil
+	case pemECDSAPrivate:
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if key.Curve != elliptic.P256() {
+			return nil, errors.New("ecdsa private key is not on P-256")
+		}
+		return &ecdsaPrivateKey{key}, nil
+	}
+	return nil, fmt.Errorf("private key is of the wrong type %s", block.Type)
+}
+
+// Like ParsePrivKeyPem, but exits on failure
+func PrivKeyFromPem(s string) PrivateKey {
+	if s == "0" {
+		return nil
+	}
+	key, err := ParsePrivKeyPem(s)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return key
+}
@@ -0,0 +1,195 @@
+package backend
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	keystoreVersion    = 1
+	keystoreKdf        = "pbkdf2-sha256"
+	keystoreIterations = 100000
+	// bounds on the iterations read from a keystore, so that a tampered file
+	// can neither weaken the kdf nor hang the node
+	keystoreMinIterations = 10000
+	keystoreMaxIterations = 10000000
+	keystoreSaltLen       = 16
+	keystoreKeyLen        = 32 // AES-256
+)
+
+var wrongPassphraseErr = errors.New("wrong passphrase or corrupted keystore")
+
+// On-disk format of a wallet: its private key (or HD entropy) encrypted with
+// AES-GCM, under a key derived from a passphrase.
+type keystoreJson struct {
+	Version    int     `json:"version"`
+	Address    Address `json:"address"`
+	Kdf        string  `json:"kdf"`
+	Iterations int     `json:"iterations"`
+	Salt       string  `json:"salt"`
+	Nonce      string  `json:"nonce"`
+	Ciphertext string  `json:"ciphertext"`
+}
+
+func newKeystoreCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, iterations, keystoreKeyLen, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// PEM block holding the mnemonic entropy of an HD wallet
+const pemHDEntropy = "NOOBCASH HD ENTROPY"
+
+// Serializes the secret of the wallet: its private key, or the entropy of an HD wallet
+func walletSecretToPem(w *Wallet) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.hd == nil {
+		return PrivKeyToPem(w.PrivKey)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:    pemHDEntropy,
+		Headers: map[string]string{"Next": strconv.Itoa(w.hd.next)},
+		Bytes:   w.hd.entropy,
+	}))
+}
+
+func walletFromSecretPem(s string) (*Wallet, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil || block.Type != pemHDEntropy {
+		privKey, err := ParsePrivKeyPem(s)
+		if err != nil {
+			return nil, err
+		}
+		return NewWalletFromKey(privKey), nil
+	}
+	if len(block.Bytes) != MnemonicEntropyLen {
+		return nil, errors.New("hd wallet entropy has the wrong size")
+	}
+	next, err := strconv.Atoi(block.Headers["Next"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid hd wallet index: %s", err)
+	}
+	return newHDWallet(block.Bytes, next), nil
+}
+
+// Encrypts the secret of the wallet with the passphrase, in the keystore format
+func EncryptWallet(w *Wallet, passphrase string) ([]byte, error) {
+	if w.IsWatchOnly() {
+		return nil, watchOnlyErr
+	}
+	salt := make([]byte, keystoreSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := newKeystoreCipher(passphrase, salt, keystoreIterations)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	address := w.Address()
+	// the address is authenticated, so that it cannot be swapped in the file
+	ciphertext := aead.Seal(nil, nonce, []byte(walletSecretToPem(w)), []byte(address))
+	return json.MarshalIndent(keystoreJson{
+		Version:    keystoreVersion,
+		Address:    address,
+		Kdf:        keystoreKdf,
+		Iterations: keystoreIterations,
+		Salt:       HexEncodeByteSlice(salt),
+		Nonce:      HexEncodeByteSlice(nonce),
+		Ciphertext: HexEncodeByteSlice(ciphertext),
+	}, "", "  ")
+}
+
+// Decrypts a wallet stored in the keystore format
+func DecryptWallet(data []byte, passphrase string) (*Wallet, error) {
+	var ks keystoreJson
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, err
+	}
+	if ks.Version != keystoreVersion || ks.Kdf != keystoreKdf {
+		return nil, fmt.Errorf("unsupported keystore version %d (%s)", ks.Version, ks.Kdf)
+	}
+	if ks.Iterations < keystoreMinIterations || ks.Iterations > keystoreMaxIterations {
+		return nil, fmt.Errorf("keystore iterations must be between %d and %d, got %d", keystoreMinIterations, keystoreMaxIterations, ks.Iterations)
+	}
+	salt, err := hex.DecodeString(ks.Salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hex.DecodeString(ks.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := hex.DecodeString(ks.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newKeystoreCipher(passphrase, salt, ks.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, wrongPassphraseErr
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(ks.Address))
+	if err != nil {
+		return nil, wrongPassphraseErr
+	}
+	w, err := walletFromSecretPem(string(plaintext))
+	if err != nil {
+		return nil, err
+	}
+	if w.Address() != ks.Address {
+		return nil, errors.New("keystore address does not match its key")
+	}
+	return w, nil
+}
+
+// Writes the wallet secret to path, encrypted with the passphrase
+func SaveWallet(w *Wallet, path, passphrase string) error {
+	data, err := EncryptWallet(w, passphrase)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// write to a temporary file first, so that a crash can't leave a half-written keystore
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Reads the wallet stored at path
+func LoadWallet(path, passphrase string) (*Wallet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := DecryptWallet(data, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("loading wallet %s: %s", path, err)
+	}
+	return w, nil
+}
@@ -0,0 +1,94 @@
+package backend
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeystore(t *testing.T) {
+	t.Run("Save and load a wallet", func(t *testing.T) {
+		w := NewWallet(DefaultKeyType)
+		path := filepath.Join(t.TempDir(), "wallet.json")
+		if err := SaveWallet(w, path, "correct horse"); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadWallet(path, "correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.Address() != w.Address() || PrivKeyToPem(loaded.PrivKey) != PrivKeyToPem(w.PrivKey) {
+			t.Errorf("Expected the wallet %s back, got %s", w.Address(), loaded.Address())
+		}
+	})
+	t.Run("Save and load an HD wallet", func(t *testing.T) {
+		mnemonic, err := NewMnemonic()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := NewHDWallet(mnemonic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err := w.NewAddress()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := EncryptWallet(w, "correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := DecryptWallet(data, "correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.Address() != w.Address() || !loaded.Owns(next) {
+			t.Errorf("Expected the HD wallet %s with its derived address %s back", w.Address(), next)
+		}
+	})
+
+	data, err := EncryptWallet(NewWallet(DefaultKeyType), "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := func(edit func(ks *keystoreJson)) []byte {
+		var ks keystoreJson
+		if err := json.Unmarshal(data, &ks); err != nil {
+			t.Fatal(err)
+		}
+		edit(&ks)
+		b, err := json.Marshal(ks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	t.Run("Wrong passphrase", func(t *testing.T) {
+		if _, err := DecryptWallet(data, "battery staple"); err != wrongPassphraseErr {
+			t.Errorf("Expected error %v, got %v", wrongPassphraseErr, err)
+		}
+	})
+	t.Run("Swapped address", func(t *testing.T) {
+		other := NewWallet(DefaultKeyType).Address()
+		if _, err := DecryptWallet(tampered(func(ks *keystoreJson) { ks.Address = other }), "correct horse"); err != wrongPassphraseErr {
+			t.Errorf("Expected error %v, got %v", wrongPassphraseErr, err)
+		}
+	})
+	t.Run("Iterations out of bounds", func(t *testing.T) {
+		for _, iterations := range []int{0, 1, keystoreMinIterations - 1, keystoreMaxIterations + 1} {
+			data := tampered(func(ks *keystoreJson) { ks.Iterations = iterations })
+			if _, err := DecryptWallet(data, "correct horse"); err == nil {
+				t.Errorf("Expected a keystore with %d iterations to be refused", iterations)
+			}
+		}
+	})
+	t.Run("Watch-only wallet", func(t *testing.T) {
+		w, err := NewWatchOnlyWallet(NewWallet(DefaultKeyType).Address(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := EncryptWallet(w, "correct horse"); err != watchOnlyErr {
+			t.Errorf("Expected error %v, got %v", watchOnlyErr, err)
+		}
+	})
+}
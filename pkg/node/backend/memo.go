@@ -0,0 +1,266 @@
+package backend
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"io"
+
+	"filippo.io/edwards25519"
+	"golang.org/x/crypto/curve25519"
+)
+
+// Limits of memos, the plain text set by the sender and the sealed memo
+// carried by the transaction. A memo of MaxMemoSize sealed to any supported
+// key fits in MaxSealedMemoSize.
+const (
+	MaxMemoSize       = 256
+	MaxSealedMemoSize = 1024
+)
+
+var (
+	memoKeyErr    = errors.New("memos can only be sealed to rsa, ed25519 and ecdsa keys")
+	sealedMemoErr = errors.New("malformed sealed memo")
+)
+
+// Keys memos can be sealed to, and opened with
+type memoRecipient interface {
+	sealMemo(memo []byte) ([]byte, error)
+}
+type memoOpener interface {
+	openMemo(sealed []byte) ([]byte, error)
+}
+
+// Encrypts memo so that only the owner of key can read it.
+//
+// The memo is encrypted with AES-GCM under a fresh key, agreed with an
+// ephemeral key for ed25519 and ecdsa keys, and encrypted with RSA-OAEP for
+// rsa keys.
+func SealMemo(key PublicKey, memo string) ([]byte, error) {
+	if len(memo) == 0 {
+		return nil, errors.New("memo is empty")
+	}
+	if len(memo) > MaxMemoSize {
+		return nil, fmt.Errorf("memo is longer than %d bytes", MaxMemoSize)
+	}
+	recipient, ok := key.(memoRecipient)
+	if !ok {
+		return nil, memoKeyErr
+	}
+	return recipient.sealMemo([]byte(memo))
+}
+
+// Decrypts a memo sealed to the public key of key
+func OpenMemo(key PrivateKey, sealed []byte) (string, error) {
+	opener, ok := key.(memoOpener)
+	if !ok {
+		return "", memoKeyErr
+	}
+	memo, err := opener.openMemo(sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(memo), nil
+}
+
+// Checks the size of the memo of tx, if any
+func (tx *Transaction) CheckMemo() error {
+	if len(tx.Memo) > MaxSealedMemoSize {
+		return fmt.Errorf("memo is %d bytes, more than %d", len(tx.Memo), MaxSealedMemoSize)
+	}
+	return nil
+}
+
+// Returns the memo of tx, if it was sealed to one of the addresses of the
+// wallet receiving outputs of tx
+func (w *Wallet) OpenMemo(tx *Transaction) (string, error) {
+	if len(tx.Memo) == 0 {
+		return "", nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	tried := map[Address]bool{}
+	for _, txOut := range tx.Outputs {
+		address := txOut.OwnerAddress()
+		key, ok := w.keys[address]
+		if !ok || tried[address] {
+			continue
+		}
+		tried[address] = true
+		if memo, err := OpenMemo(key, tx.Memo); err == nil {
+			return memo, nil
+		}
+	}
+	return "", errors.New("memo is not sealed to this wallet")
+}
+
+// AES-256-GCM under key, the nonce prepended to the ciphertext
+func sealWithKey(key, memo []byte) ([]byte, error) {
+	aead, err := newMemoAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, memo, nil), nil
+}
+
+func openWithKey(key, sealed []byte) ([]byte, error) {
+	aead, err := newMemoAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, sealedMemoErr
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+func newMemoAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Derives the AES key from the shared secret of a key agreement, bound to
+// both public keys
+func memoKey(shared, ephemeral, recipient []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("noobcash memo"))
+	h.Write(shared)
+	h.Write(ephemeral)
+	h.Write(recipient)
+	return h.Sum(nil)
+}
+
+////
+// RSA
+////
+func (k *rsaPublicKey) sealMemo(memo []byte) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, k.key, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealWithKey(key, memo)
+	if err != nil {
+		return nil, err
+	}
+	return append(encryptedKey, sealed...), nil
+}
+
+func (k *rsaPrivateKey) openMemo(sealed []byte) ([]byte, error) {
+	size := k.key.PublicKey.Size()
+	if len(sealed) < size {
+		return nil, sealedMemoErr
+	}
+	key, err := rsa.DecryptOAEP(sha256.New(), nil, k.key, sealed[:size], nil)
+	if err != nil {
+		return nil, err
+	}
+	return openWithKey(key, sealed[size:])
+}
+
+////
+// ECDSA
+////
+func (k *ecdsaPublicKey) sealMemo(memo []byte) ([]byte, error) {
+	curve := k.key.Curve
+	ephemeral, x, y, err := elliptic.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ephemeralPub := elliptic.Marshal(curve, x, y)
+	sharedX, _ := curve.ScalarMult(k.key.X, k.key.Y, ephemeral)
+	shared := sharedX.FillBytes(make([]byte, (curve.Params().BitSize+7)/8))
+	sealed, err := sealWithKey(memoKey(shared, ephemeralPub, k.Bytes()), memo)
+	if err != nil {
+		return nil, err
+	}
+	return append(ephemeralPub, sealed...), nil
+}
+
+func (k *ecdsaPrivateKey) openMemo(sealed []byte) ([]byte, error) {
+	curve := k.key.Curve
+	size := 1 + 2*((curve.Params().BitSize+7)/8)
+	if len(sealed) < size {
+		return nil, sealedMemoErr
+	}
+	x, y := elliptic.Unmarshal(curve, sealed[:size])
+	if x == nil {
+		return nil, sealedMemoErr
+	}
+	sharedX, _ := curve.ScalarMult(x, y, k.key.D.Bytes())
+	shared := sharedX.FillBytes(make([]byte, (curve.Params().BitSize+7)/8))
+	return openWithKey(memoKey(shared, sealed[:size], k.Public().Bytes()), sealed[size:])
+}
+
+////
+// Ed25519
+////
+
+// Ed25519 keys are converted to their X25519 form, so that the same key both
+// signs and agrees on memo keys
+func (k ed25519PublicKey) sealMemo(memo []byte) ([]byte, error) {
+	u, err := ed25519ToX25519(k)
+	if err != nil {
+		return nil, err
+	}
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, ephemeral); err != nil {
+		return nil, err
+	}
+	ephemeralPub, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := curve25519.X25519(ephemeral, u)
+	if err != nil {
+		return nil, errors.New("cannot seal a memo to a low order key")
+	}
+	sealed, err := sealWithKey(memoKey(shared, ephemeralPub, u), memo)
+	if err != nil {
+		return nil, err
+	}
+	return append(ephemeralPub, sealed...), nil
+}
+
+func (k ed25519PrivateKey) openMemo(sealed []byte) ([]byte, error) {
+	if len(sealed) < curve25519.PointSize {
+		return nil, sealedMemoErr
+	}
+	u, err := ed25519ToX25519(k.Public().(ed25519PublicKey))
+	if err != nil {
+		return nil, err
+	}
+	// the scalar of an ed25519 key is the first half of the hash of its seed
+	h := sha512.Sum512(k[:ed25519.SeedSize])
+	shared, err := curve25519.X25519(h[:curve25519.ScalarSize], sealed[:curve25519.PointSize])
+	if err != nil {
+		return nil, sealedMemoErr
+	}
+	return openWithKey(memoKey(shared, sealed[:curve25519.PointSize], u), sealed[curve25519.PointSize:])
+}
+
+// Returns the u coordinate of the Montgomery form of an ed25519 public key
+func ed25519ToX25519(pub ed25519PublicKey) ([]byte, error) {
+	point, err := new(edwards25519.Point).SetBytes(pub)
+	if err != nil {
+		return nil, errors.New("invalid ed25519 public key")
+	}
+	return point.BytesMontgomery(), nil
+}
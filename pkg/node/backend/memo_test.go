@@ -0,0 +1,95 @@
+package backend
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+func TestMemo(t *testing.T) {
+	for _, keyType := range []KeyType{KeyEd25519, KeyECDSA, KeyRSA} {
+		t.Run("Seal and open with "+string(keyType)+" keys", func(t *testing.T) {
+			key, err := GenerateKey(keyType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, err := GenerateKey(keyType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			memo := strings.Repeat("m", MaxMemoSize)
+			sealed, err := SealMemo(key.Public(), memo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sealed) > MaxSealedMemoSize {
+				t.Errorf("Expected a sealed memo of at most %d bytes, got %d", MaxSealedMemoSize, len(sealed))
+			}
+			if opened, err := OpenMemo(key, sealed); err != nil || opened != memo {
+				t.Errorf("Expected the recipient to read the memo, got %q (%v)", opened, err)
+			}
+			if _, err := OpenMemo(other, sealed); err == nil {
+				t.Error("Expected another key not to read the memo")
+			}
+			sealed[len(sealed)-1] ^= 1
+			if _, err := OpenMemo(key, sealed); err == nil {
+				t.Error("Expected a tampered memo not to open")
+			}
+		})
+	}
+	t.Run("X25519 form of ed25519 keys", func(t *testing.T) {
+		key, err := GenerateKey(KeyEd25519)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := ed25519ToX25519(key.Public().(ed25519PublicKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := sha512.Sum512(key.(ed25519PrivateKey)[:32])
+		expected, err := curve25519.X25519(h[:32], curve25519.Basepoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(u, expected) {
+			t.Error("Expected the converted public key to match the scalar of the private key")
+		}
+		if _, err := ed25519ToX25519(make(ed25519PublicKey, 31)); err == nil {
+			t.Error("Expected a truncated key to be refused")
+		}
+	})
+	t.Run("Memo size", func(t *testing.T) {
+		key := NewWallet(DefaultKeyType).PrivKey.Public()
+		for _, memo := range []string{"", strings.Repeat("m", MaxMemoSize+1)} {
+			if _, err := SealMemo(key, memo); err == nil {
+				t.Errorf("Expected a memo of %d bytes to be refused", len(memo))
+			}
+		}
+		tx := NewTransaction(key, 10)
+		tx.Memo = make([]byte, MaxSealedMemoSize+1)
+		if err := tx.CheckMemo(); err == nil {
+			t.Error("Expected a sealed memo over the size cap to be refused")
+		}
+	})
+	t.Run("Wallet reads the memos sealed to its addresses", func(t *testing.T) {
+		w := newFundedWallet(50)
+		shop := NewWallet(DefaultKeyType)
+		sealed, err := SealMemo(shop.PrivKey.Public(), "invoice 42")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, _, err := w.CreateAndSignTxWithOptions(&TxOptions{Memo: sealed}, &TxTargetTy{Address: shop.Address(), Amount: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if memo, err := shop.OpenMemo(tx); err != nil || memo != "invoice 42" {
+			t.Errorf("Expected the shop to read the memo, got %q (%v)", memo, err)
+		}
+		if _, err := w.OpenMemo(tx); err == nil {
+			t.Error("Expected the sender not to read the memo")
+		}
+	})
+}
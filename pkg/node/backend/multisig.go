@@ -0,0 +1,297 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Max number of keys of a multisig policy, so that indexes fit in a byte
+const MaxMultisigKeys = 16
+
+var (
+	multisigEncodingErr  = errors.New("malformed multisig policy")
+	multisigSignatureErr = errors.New("malformed multisig signature")
+)
+
+// An m-of-n policy, spendable with the signatures of any m of its n keys.
+//
+// It implements PublicKey, so outputs are locked to it like to any other key
+// and its address is derived the same way. The keys are sorted, so that the
+// policy and its address do not depend on the order they were given in.
+type MultisigKey struct {
+	M    int
+	Keys []PublicKey
+}
+
+func NewMultisigKey(m int, keys []PublicKey) (*MultisigKey, error) {
+	if len(keys) == 0 || len(keys) > MaxMultisigKeys {
+		return nil, fmt.Errorf("a multisig policy needs 1 to %d keys, got %d", MaxMultisigKeys, len(keys))
+	}
+	if m < 1 || m > len(keys) {
+		return nil, fmt.Errorf("a multisig policy over %d keys needs 1 to %d signatures, got %d", len(keys), len(keys), m)
+	}
+	sorted := make([]PublicKey, len(keys))
+	copy(sorted, keys)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Type() != sorted[j].Type() {
+			return sorted[i].Type() < sorted[j].Type()
+		}
+		return bytes.Compare(sorted[i].Bytes(), sorted[j].Bytes()) < 0
+	})
+	for i, key := range sorted {
+		if !key.Type().IsSingle() {
+			return nil, fmt.Errorf("the keys of a multisig policy must be single keys, got a %s key", key.Type())
+		}
+		if i > 0 && SameKey(sorted[i-1], key) {
+			return nil, fmt.Errorf("key %s appears twice in the policy", AddressFromPubKey(key))
+		}
+	}
+	return &MultisigKey{M: m, Keys: sorted}, nil
+}
+
+func (k *MultisigKey) Type() KeyType { return KeyMultisig }
+
+// Encodes m, n and every key as its type and bytes, each prefixed by its length
+func (k *MultisigKey) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(byte(k.M))
+	buf.WriteByte(byte(len(k.Keys)))
+	for _, key := range k.Keys {
+		writeTypedKey(&buf, key)
+	}
+	return buf.Bytes()
+}
+
+func parseMultisigKey(b []byte) (*MultisigKey, error) {
+	r := bytes.NewReader(b)
+	m, err1 := r.ReadByte()
+	n, err2 := r.ReadByte()
+	if err1 != nil || err2 != nil {
+		return nil, multisigEncodingErr
+	}
+	keys := make([]PublicKey, 0, n)
+	for i := 0; i < int(n); i++ {
+		keyType, keyBytes, err := readTypedKey(r)
+		if err != nil {
+			return nil, multisigEncodingErr
+		}
+		if !keyType.IsSingle() {
+			return nil, fmt.Errorf("the keys of a multisig policy must be single keys, got a %s key", keyType)
+		}
+		key, err := pubKeyFromBytes(keyType, keyBytes)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if r.Len() != 0 {
+		return nil, multisigEncodingErr
+	}
+	policy, err := NewMultisigKey(int(m), keys)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(policy.Bytes(), b) {
+		return nil, errors.New("multisig policy keys are not sorted")
+	}
+	return policy, nil
+}
+
+// Returns the index of key in the policy, or -1 if it is not one of its keys
+func (k *MultisigKey) IndexOf(key PublicKey) int {
+	for i, other := range k.Keys {
+		if SameKey(key, other) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Checks that sig holds at least M valid signatures of distinct keys
+func (k *MultisigKey) Verify(digest, sig []byte) error {
+	sigs, err := decodeMultisigSignature(sig)
+	if err != nil {
+		return err
+	}
+	valid := 0
+	for index, s := range sigs {
+		if index >= len(k.Keys) {
+			return fmt.Errorf("signature of key %d, but the policy has %d keys", index, len(k.Keys))
+		}
+		if err := k.Keys[index].Verify(digest, s); err != nil {
+			return fmt.Errorf("invalid signature of key %d: %s", index, err)
+		}
+		valid++
+	}
+	if valid < k.M {
+		return fmt.Errorf("got %d of the %d required signatures", valid, k.M)
+	}
+	return nil
+}
+
+// Encodes the signatures by key index, as checked by MultisigKey.Verify
+func encodeMultisigSignature(sigs map[int][]byte) []byte {
+	indexes := make([]int, 0, len(sigs))
+	for index := range sigs {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	var buf bytes.Buffer
+	for _, index := range indexes {
+		buf.WriteByte(byte(index))
+		binary.Write(&buf, binary.BigEndian, uint16(len(sigs[index])))
+		buf.Write(sigs[index])
+	}
+	return buf.Bytes()
+}
+
+func decodeMultisigSignature(sig []byte) (map[int][]byte, error) {
+	sigs := map[int][]byte{}
+	r := bytes.NewReader(sig)
+	for r.Len() > 0 {
+		index, err := r.ReadByte()
+		if err != nil {
+			return nil, multisigSignatureErr
+		}
+		var sigLen uint16
+		if err := binary.Read(r, binary.BigEndian, &sigLen); err != nil {
+			return nil, multisigSignatureErr
+		}
+		s := make([]byte, sigLen)
+		if _, err := io.ReadFull(r, s); err != nil {
+			return nil, multisigSignatureErr
+		}
+		if _, ok := sigs[int(index)]; ok {
+			return nil, fmt.Errorf("key %d signed twice", index)
+		}
+		sigs[int(index)] = s
+	}
+	return sigs, nil
+}
+
+// A transaction spending multisig outputs, passed between the co-signers
+// until it gathers enough signatures to be finalized.
+type PartialTx struct {
+	Tx         *Transaction
+	Signatures map[int][]byte // by index of the signing key in the policy
+}
+
+type partialTxJson struct {
+	Transaction *Transaction      `json:"transaction"`
+	Signatures  map[string]string `json:"signatures"`
+}
+
+func NewPartialTx(tx *Transaction) (*PartialTx, error) {
+	if _, ok := tx.SenderAddress.(*MultisigKey); !ok {
+		return nil, errors.New("the sender of the transaction is not a multisig policy")
+	}
+	return &PartialTx{Tx: tx, Signatures: map[int][]byte{}}, nil
+}
+
+func (p *PartialTx) Policy() *MultisigKey {
+	return p.Tx.SenderAddress.(*MultisigKey)
+}
+
+// Adds the signature of key, which must be one of the keys of the policy
+func (p *PartialTx) Sign(key PrivateKey) error {
+	index := p.Policy().IndexOf(key.Public())
+	if index < 0 {
+		return fmt.Errorf("key %s is not a co-signer of %s", AddressFromPubKey(key.Public()), p.Tx.Sender())
+	}
+	sig, err := key.Sign(p.Tx.SigningHash())
+	if err != nil {
+		return err
+	}
+	p.Signatures[index] = sig
+	return nil
+}
+
+// Merges the valid signatures of other, which must be the same transaction
+func (p *PartialTx) Combine(other *PartialTx) error {
+	if !bytes.Equal(p.Tx.SigningHash(), other.Tx.SigningHash()) {
+		return fmt.Errorf("cannot combine different transactions %s and %s",
+			HexEncodeByteSlice(p.Tx.Id), HexEncodeByteSlice(other.Tx.Id))
+	}
+	policy := p.Policy()
+	for index, sig := range other.Signatures {
+		if index < 0 || index >= len(policy.Keys) {
+			return fmt.Errorf("signature of key %d, but the policy has %d keys", index, len(policy.Keys))
+		}
+		if err := policy.Keys[index].Verify(p.Tx.SigningHash(), sig); err != nil {
+			return fmt.Errorf("invalid signature of key %d: %s", index, err)
+		}
+		p.Signatures[index] = sig
+	}
+	return nil
+}
+
+// Number of signatures still needed to finalize the transaction
+func (p *PartialTx) Missing() int {
+	if missing := p.Policy().M - len(p.Signatures); missing > 0 {
+		return missing
+	}
+	return 0
+}
+
+// Returns the transaction with its multisig signature, once it has enough signatures
+func (p *PartialTx) Finalize() (*Transaction, error) {
+	if missing := p.Missing(); missing > 0 {
+		return nil, fmt.Errorf("transaction needs %d more signature(s)", missing)
+	}
+	// only the first M signatures are needed
+	indexes := make([]int, 0, len(p.Signatures))
+	for index := range p.Signatures {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	sigs := map[int][]byte{}
+	for _, index := range indexes[:p.Policy().M] {
+		sigs[index] = p.Signatures[index]
+	}
+	p.Tx.Signature = encodeMultisigSignature(sigs)
+	if err := p.Tx.SenderAddress.Verify(p.Tx.SigningHash(), p.Tx.Signature); err != nil {
+		return nil, err
+	}
+	return p.Tx, nil
+}
+
+func (p *PartialTx) MarshalJSON() ([]byte, error) {
+	sigs := make(map[string]string, len(p.Signatures))
+	for index, sig := range p.Signatures {
+		sigs[fmt.Sprint(index)] = HexEncodeByteSlice(sig)
+	}
+	return json.Marshal(partialTxJson{Transaction: p.Tx, Signatures: sigs})
+}
+
+func (p *PartialTx) UnmarshalJSON(b []byte) error {
+	var tmp partialTxJson
+	if err := json.Unmarshal(b, &tmp); err != nil {
+		return err
+	}
+	if tmp.Transaction == nil {
+		return errors.New("partial transaction has no transaction")
+	}
+	partial, err := NewPartialTx(tmp.Transaction)
+	if err != nil {
+		return err
+	}
+	for indexStr, sigHex := range tmp.Signatures {
+		var index int
+		if _, err := fmt.Sscan(indexStr, &index); err != nil {
+			return fmt.Errorf("invalid signature index %s", indexStr)
+		}
+		sig, err := hex.DecodeString(sigHex)
+		if err != nil {
+			return fmt.Errorf("invalid signature of key %d: %s", index, err)
+		}
+		partial.Signatures[index] = sig
+	}
+	*p = *partial
+	return nil
+}
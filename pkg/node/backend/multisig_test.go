@@ -0,0 +1,108 @@
+package backend
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMultisig(t *testing.T) {
+	signers := make([]PrivateKey, 3)
+	pubKeys := make([]PublicKey, 3)
+	for i := range signers {
+		signers[i], _ = GenerateKey(DefaultKeyType)
+		pubKeys[i] = signers[i].Public()
+	}
+	policy, err := NewMultisigKey(2, pubKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spendTx, _, err := BuildTx(policy, []*TxOut{newUtxo(policy, 100)}, nil, &TxTargetTy{
+		Address: NewWallet(DefaultKeyType).Address(),
+		Amount:  60,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Invalid policies", func(t *testing.T) {
+		for _, m := range []int{0, 4} {
+			if _, err := NewMultisigKey(m, pubKeys); err == nil {
+				t.Errorf("Expected a %d of 3 policy to be refused", m)
+			}
+		}
+		if _, err := NewMultisigKey(1, []PublicKey{pubKeys[0], pubKeys[0]}); err == nil {
+			t.Error("Expected a policy with a duplicate key to be refused")
+		}
+		if _, err := NewMultisigKey(1, []PublicKey{policy}); err == nil {
+			t.Error("Expected a policy nesting another policy to be refused")
+		}
+	})
+	t.Run("Key order does not change the policy", func(t *testing.T) {
+		reversed, err := NewMultisigKey(2, []PublicKey{pubKeys[2], pubKeys[1], pubKeys[0]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if AddressFromPubKey(reversed) != AddressFromPubKey(policy) {
+			t.Error("Expected the same policy for the keys in another order")
+		}
+	})
+	t.Run("Finalize with a single signature", func(t *testing.T) {
+		partial, err := NewPartialTx(spendTx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := partial.Sign(signers[0]); err != nil {
+			t.Fatal(err)
+		}
+		if partial.Missing() != 1 {
+			t.Errorf("Expected 1 missing signature, got %d", partial.Missing())
+		}
+		if _, err := partial.Finalize(); err == nil {
+			t.Error("Expected finalizing with 1 of 2 signatures to fail")
+		}
+	})
+	t.Run("Sign with a key outside the policy", func(t *testing.T) {
+		partial, _ := NewPartialTx(spendTx)
+		outsider, _ := GenerateKey(DefaultKeyType)
+		if err := partial.Sign(outsider); err == nil {
+			t.Error("Expected signing with a key outside the policy to fail")
+		}
+	})
+	t.Run("Combine an invalid signature", func(t *testing.T) {
+		first, _ := NewPartialTx(spendTx)
+		second, _ := NewPartialTx(spendTx)
+		second.Signatures[policy.IndexOf(pubKeys[1])], _ = signers[0].Sign(spendTx.SigningHash())
+		if err := first.Combine(second); err == nil {
+			t.Error("Expected combining a signature by the wrong key to fail")
+		}
+	})
+	t.Run("Combine two signatures", func(t *testing.T) {
+		first, _ := NewPartialTx(spendTx)
+		second, _ := NewPartialTx(spendTx)
+		if err := first.Sign(signers[0]); err != nil {
+			t.Fatal(err)
+		}
+		if err := second.Sign(signers[2]); err != nil {
+			t.Fatal(err)
+		}
+		// the copies travel between co-signers as json
+		jsSecond, err := json.Marshal(second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var received PartialTx
+		if err := json.Unmarshal(jsSecond, &received); err != nil {
+			t.Fatal(err)
+		}
+		if err := first.Combine(&received); err != nil {
+			t.Fatal(err)
+		}
+		tx, err := first.Finalize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.VerifySignatures(); err != nil {
+			t.Errorf("Expected the finalized transaction to be valid, got %v", err)
+		}
+	})
+}
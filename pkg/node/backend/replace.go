@@ -0,0 +1,137 @@
+package backend
+
+import (
+	"fmt"
+	"log"
+)
+
+// Returns how much the native coins of the inputs of tx exceed its outputs by.
+// Nobody receives the fee, it only makes a transaction preferable to the ones
+// it replaces.
+//
+// The amounts of the inputs are the ones tx claims, so this is only meant for
+// transactions of the wallet, see FeeFrom for the ones received from others.
+func (tx *Transaction) Fee() int {
+	return tx.FeeFrom(tx.Inputs)
+}
+
+// Returns the fee of tx, with the amounts of its inputs taken from spent, the
+// UTXOs they spend as recorded by the ledger
+func (tx *Transaction) FeeFrom(spent TxOutMap) int {
+	fee := 0
+	for id := range tx.Inputs {
+		if utxo, ok := spent[id]; ok {
+			fee += utxo.NativeAmount()
+		}
+	}
+	for _, txOut := range tx.Outputs {
+		fee -= txOut.NativeAmount()
+	}
+	return fee
+}
+
+// Creates a transaction replacing original, a pending transaction of the
+// wallet, by spending the same inputs with the given fee. It pays targets, or
+// the payments of original to other wallets if there are none, and the rest
+// goes back to the wallet as change.
+func (w *Wallet) CreateReplacementTx(original *Transaction, fee int, targets ...*TxTargetTy) (*Transaction, error) {
+	return w.createReplacementTx(original, fee, targets, len(targets) == 0)
+}
+
+// Creates a replacement of original paying its inputs back to the wallet with
+// the same fee, so that its payments are never made
+func (w *Wallet) CreateCancellationTx(original *Transaction) (*Transaction, error) {
+	return w.createReplacementTx(original, original.Fee(), nil, false)
+}
+
+func (w *Wallet) createReplacementTx(original *Transaction, fee int, targets []*TxTargetTy, keepPayments bool) (*Transaction, error) {
+	if w.IsWatchOnly() {
+		return nil, watchOnlyErr
+	}
+	if fee < 0 {
+		return nil, fmt.Errorf("fee must not be negative, got %d", fee)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	originalId := HexEncodeByteSlice(original.Id)
+	reservation, ok := w.Reserved[originalId]
+	if !ok {
+		return nil, fmt.Errorf("transaction %s is not a pending transaction of the wallet", originalId)
+	}
+	if original.MovesTokens() {
+		return nil, fmt.Errorf("transaction %s moves tokens, it cannot be replaced", originalId)
+	}
+	inputs := make([]*TxOut, 0, len(original.Inputs))
+	for _, txIn := range original.Inputs {
+		if !reservation.Inputs.Has(txIn) {
+			return nil, fmt.Errorf("transaction %s spends inputs of other wallets", originalId)
+		}
+		inputs = append(inputs, txIn)
+	}
+	var payments []*TxTargetTy
+	for _, txOut := range original.Outputs {
+		if !w.owns(txOut.OwnerAddress()) {
+			payments = append(payments, &TxTargetTy{Address: txOut.OwnerAddress(), Amount: txOut.Amount, LockTime: txOut.LockTime})
+		}
+	}
+	if len(payments) == 0 && !keepPayments && len(targets) == 0 {
+		return nil, fmt.Errorf("transaction %s only pays the wallet, there is nothing to cancel", originalId)
+	}
+
+	opts := &TxOptions{LockTime: original.LockTime}
+	splitPolicy := w.splitPolicy(nil)
+	if keepPayments {
+		// the payments are already split, and their memo still applies
+		targets = payments
+		splitPolicy = NoSplit{}
+		opts.Memo = original.Memo
+	}
+	var totalAmount int
+	for _, target := range targets {
+		totalAmount += target.Amount
+	}
+	selection := newCoinSelection("replacement", totalAmount+fee, inputs)
+	if selection.Change() < 0 {
+		return nil, fmt.Errorf("inputs of %s are worth %d, not enough to pay %d with a fee of %d", originalId, reservation.Sum(), totalAmount, fee)
+	}
+
+	sender := original.SenderAddress
+	changeTo := sender
+	if original.SignsPerInput() {
+		changeTo = w.PrivKey.Public()
+	}
+	tx := newTxToTargets(sender, splitPolicy, targets, opts)
+	log.Println("Replacing", originalId, "with a fee of", fee)
+	tx.addSelection(selection, w.splitPolicy(nil), func(amount int) *TxOut {
+		return NewTxOut(changeTo, amount)
+	})
+	tx.ComputeAndFillHash()
+	w.reserve(tx)
+	return tx, nil
+}
+
+func (w *Wallet) CreateAndSignReplacementTx(original *Transaction, fee int, targets ...*TxTargetTy) (*Transaction, error) {
+	tx, err := w.CreateReplacementTx(original, fee, targets...)
+	if err != nil {
+		return nil, err
+	}
+	err = w.SignTx(tx)
+	if err != nil {
+		w.ReleaseTx(HexEncodeByteSlice(tx.Id))
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (w *Wallet) CreateAndSignCancellationTx(original *Transaction) (*Transaction, error) {
+	tx, err := w.CreateCancellationTx(original)
+	if err != nil {
+		return nil, err
+	}
+	err = w.SignTx(tx)
+	if err != nil {
+		w.ReleaseTx(HexEncodeByteSlice(tx.Id))
+		return nil, err
+	}
+	return tx, nil
+}
@@ -0,0 +1,256 @@
+package backend
+
+import (
+	"time"
+)
+
+// How long the inputs of a transaction stay reserved before they are released
+// back to the wallet, if the transaction has not been confirmed nor submitted,
+// e.g. a partially signed one.
+var ReservationTimeout = 2 * time.Minute
+
+// How many times the reservation of a pending transaction is renewed, see
+// ReleaseExpired, before the transaction is given up on
+var MaxReservationRenewals = 5
+
+// UTXOs of the wallet that are used as inputs of a transaction that has been
+// created but not yet confirmed. They cannot be used in new transactions,
+// but are still part of the wallet until the transaction gets applied.
+type Reservation struct {
+	TxId      string
+	Inputs    TxOutMap
+	CreatedAt time.Time
+	Renewals  int
+}
+
+func newReservation(tx *Transaction) *Reservation {
+	inputs := make(TxOutMap, len(tx.Inputs))
+	for _, txIn := range tx.Inputs {
+		inputs.Add(txIn)
+	}
+	return &Reservation{
+		TxId:      HexEncodeByteSlice(tx.Id),
+		Inputs:    inputs,
+		CreatedAt: time.Now(),
+	}
+}
+
+func (r *Reservation) Sum() (sum int) {
+	for _, txIn := range r.Inputs {
+		sum += txIn.NativeAmount()
+	}
+	return
+}
+
+func (r *Reservation) IsExpired(timeout time.Duration) bool {
+	return time.Since(r.CreatedAt) > timeout
+}
+
+// Must be called with the wallet lock held
+func (w *Wallet) isReserved(txOut *TxOut) bool {
+	for _, reservation := range w.Reserved {
+		if reservation.Inputs.Has(txOut) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Wallet) IsReserved(txOut *TxOut) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.isReserved(txOut)
+}
+
+// Must be called with the wallet lock held
+func (w *Wallet) reserve(tx *Transaction) {
+	reservation := newReservation(tx)
+	// the inputs of other owners, in a transaction signed per input, are not ours to reserve
+	for _, txIn := range tx.Inputs {
+		if utxo, ok := w.Utxos[txIn.Id]; ok {
+			reservation.Inputs.Add(utxo)
+		} else {
+			reservation.Inputs.Remove(txIn)
+		}
+	}
+	w.Reserved[reservation.TxId] = reservation
+}
+
+// Returns the ids of the transactions that reserve any of the given UTXOs,
+// excluding the transaction with id skipTxId.
+//
+// Must be called with the wallet lock held
+func (w *Wallet) conflictingReservations(txOuts TxOutMap, skipTxId string) (txIds []string) {
+	for txId, reservation := range w.Reserved {
+		if txId == skipTxId {
+			continue
+		}
+		for _, txOut := range txOuts {
+			if reservation.Inputs.Has(txOut) {
+				txIds = append(txIds, txId)
+				break
+			}
+		}
+	}
+	return
+}
+
+// Must be called with the wallet lock held
+func (w *Wallet) reservedBalance() (sum int) {
+	for _, reservation := range w.Reserved {
+		sum += reservation.Sum()
+	}
+	return
+}
+
+// Sum of all reserved UTXOs
+func (w *Wallet) ReservedBalance() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.reservedBalance()
+}
+
+// Balance that can be used in new transactions
+func (w *Wallet) SpendableBalance() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.Balance - w.reservedBalance() - w.lockedBalance()
+}
+
+// Finalizes the spending of the inputs of tx, once it gets applied.
+//
+// Returns the ids of any other transactions of this wallet that reserved the
+// same inputs. Those can no longer be applied and their reservations are released.
+func (w *Wallet) ConfirmTx(tx *Transaction) (conflicts []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	txId := HexEncodeByteSlice(tx.Id)
+	conflicts = w.conflictingReservations(tx.Inputs, txId)
+	for _, conflict := range conflicts {
+		delete(w.Reserved, conflict)
+	}
+	delete(w.Reserved, txId)
+	spent := TxOutMap{}
+	for _, txIn := range tx.Inputs {
+		utxo, ok := w.Utxos[txIn.Id]
+		if !ok {
+			continue
+		}
+		w.Balance -= utxo.NativeAmount()
+		w.Utxos.Remove(utxo)
+		spent.Add(utxo)
+	}
+	if len(spent) > 0 {
+		w.spent[txId] = spent
+	}
+	return
+}
+
+// Undoes ConfirmTx, when the block containing tx gets reverted.
+//
+// The utxos the wallet had are restored, whatever the inputs of tx claim.
+// The inputs are reserved again since the transaction returns to the pending ones.
+func (w *Wallet) UnconfirmTx(tx *Transaction) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	txId := HexEncodeByteSlice(tx.Id)
+	for _, utxo := range w.spent[txId] {
+		if w.Utxos.Has(utxo) {
+			continue
+		}
+		w.Balance += utxo.NativeAmount()
+		w.Utxos.Add(utxo)
+	}
+	delete(w.spent, txId)
+	// a watch-only wallet did not create tx, so it has nothing to reserve
+	if w.watched == nil {
+		w.reserve(tx)
+	}
+}
+
+// Releases the inputs reserved by the transaction with the given id,
+// making them available again for new transactions.
+func (w *Wallet) ReleaseTx(txId string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.Reserved[txId]
+	delete(w.Reserved, txId)
+	return ok
+}
+
+// Releases every reservation older than timeout and returns the ids of the
+// transactions they belonged to.
+//
+// The reservations of the transactions keep returns true for are renewed
+// instead, and their ids returned in renewed. A reservation renewed
+// MaxReservationRenewals times is released all the same, so that a
+// transaction that never gets mined cannot lock its inputs forever.
+func (w *Wallet) ReleaseExpired(timeout time.Duration, keep func(txId string) bool) (released, renewed []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for txId, reservation := range w.Reserved {
+		if !reservation.IsExpired(timeout) {
+			continue
+		}
+		if keep != nil && reservation.Renewals < MaxReservationRenewals && keep(txId) {
+			reservation.CreatedAt = time.Now()
+			reservation.Renewals++
+			renewed = append(renewed, txId)
+			continue
+		}
+		released = append(released, txId)
+		delete(w.Reserved, txId)
+	}
+	return
+}
+
+// Adds a newly received UTXO to the wallet, unless it already has it.
+//
+// Receiving to a derived address of an HD wallet marks it as used.
+func (w *Wallet) AddUtxo(txOut *TxOut) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.Utxos.Has(txOut) {
+		return false
+	}
+	w.Balance += txOut.NativeAmount()
+	w.Utxos.Add(txOut)
+	if w.hd != nil {
+		w.hd.markUsed(txOut.OwnerAddress())
+		w.addDerivedKeys()
+	}
+	return true
+}
+
+// Removes a UTXO of the wallet, when the transaction that created it is reverted.
+//
+// Returns the ids of the transactions that had reserved it. Their reservations
+// are released since they can no longer be applied.
+func (w *Wallet) RemoveUtxo(txOut *TxOut) (conflicts []string, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.Utxos.Has(txOut) {
+		return nil, false
+	}
+	conflicts = w.conflictingReservations(TxOutMap{txOut.Id: txOut}, "")
+	for _, conflict := range conflicts {
+		delete(w.Reserved, conflict)
+	}
+	w.Utxos.Remove(txOut)
+	w.Balance -= txOut.NativeAmount()
+	return conflicts, true
+}
+
+// Returns the utxos of the wallet, split into unreserved and reserved ones
+func (w *Wallet) ListUtxos() (unreserved, reserved []*TxOut) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, utxo := range w.Utxos {
+		if w.isReserved(utxo) {
+			reserved = append(reserved, utxo)
+		} else {
+			unreserved = append(unreserved, utxo)
+		}
+	}
+	return
+}
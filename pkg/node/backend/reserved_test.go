@@ -0,0 +1,198 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Returns a wallet holding one utxo of every amount
+func newFundedWallet(amounts ...int) *Wallet {
+	w := NewWallet(DefaultKeyType)
+	for _, amount := range amounts {
+		txOut := NewTxOut(w.PrivKey.Public(), amount)
+		txOut.ComputeAndFillHash()
+		w.AddUtxo(txOut)
+	}
+	return w
+}
+
+// A key whose signatures always fail
+type failingKey struct {
+	PrivateKey
+}
+
+func (failingKey) Sign(digest []byte) ([]byte, error) {
+	return nil, errors.New("signing failed")
+}
+
+func TestReservations(t *testing.T) {
+	shop := NewWallet(DefaultKeyType)
+
+	t.Run("Reserve the inputs of a new transaction", func(t *testing.T) {
+		w := newFundedWallet(50, 30, 20)
+		tx, err := w.CreateAndSignTx(40, shop.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, txIn := range tx.Inputs {
+			if !w.IsReserved(txIn) {
+				t.Errorf("Expected input %s to be reserved", txIn.Id)
+			}
+		}
+		if w.Balance != 100 || w.SpendableBalance() != 100-w.ReservedBalance() {
+			t.Errorf("Expected a balance of 100 with %d spendable, got %d and %d", 100-w.ReservedBalance(), w.Balance, w.SpendableBalance())
+		}
+		if _, err := w.CreateAndSignTx(w.SpendableBalance()+1, shop.Address()); err == nil {
+			t.Error("Expected spending the reserved utxos again to fail")
+		}
+	})
+	t.Run("Release the inputs of a transaction that fails to be signed", func(t *testing.T) {
+		key, err := GenerateKey(DefaultKeyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := NewWalletFromKey(failingKey{key})
+		w.AddUtxo(newUtxo(key.Public(), 50))
+		if _, err := w.CreateAndSignTx(10, shop.Address()); err == nil {
+			t.Fatal("Expected signing to fail")
+		}
+		if len(w.Reserved) != 0 || w.SpendableBalance() != 50 {
+			t.Errorf("Expected no reservation and 50 spendable, got %d reservation(s) and %d spendable", len(w.Reserved), w.SpendableBalance())
+		}
+	})
+	t.Run("Confirm a transaction", func(t *testing.T) {
+		w := newFundedWallet(50)
+		tx, err := w.CreateAndSignTx(10, shop.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conflicts := w.ConfirmTx(tx); len(conflicts) != 0 {
+			t.Errorf("Expected no conflicts, got %v", conflicts)
+		}
+		if w.Balance != 0 || len(w.Reserved) != 0 || len(w.Utxos) != 0 {
+			t.Errorf("Expected the input to be spent, got a balance of %d and %d reservation(s)", w.Balance, len(w.Reserved))
+		}
+	})
+	t.Run("Confirm a transaction conflicting with a reservation", func(t *testing.T) {
+		w := newFundedWallet(50)
+		tx, err := w.CreateAndSignTx(10, shop.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		txId := HexEncodeByteSlice(tx.Id)
+		// another transaction of the same wallet spending the same utxo, e.g. created by a restored copy
+		double := *tx
+		double.Id = []byte("double")
+		conflicts := w.ConfirmTx(&double)
+		if len(conflicts) != 1 || conflicts[0] != txId {
+			t.Errorf("Expected %s to conflict, got %v", txId, conflicts)
+		}
+		if len(w.Reserved) != 0 {
+			t.Errorf("Expected the conflicting reservation to be released, got %d", len(w.Reserved))
+		}
+	})
+	t.Run("Unconfirm a transaction", func(t *testing.T) {
+		w := newFundedWallet(50)
+		tx, err := w.CreateAndSignTx(10, shop.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.ConfirmTx(tx)
+		w.UnconfirmTx(tx)
+		if w.Balance != 50 || w.SpendableBalance() != 0 {
+			t.Errorf("Expected the input to return reserved, got a balance of %d with %d spendable", w.Balance, w.SpendableBalance())
+		}
+	})
+	t.Run("Unconfirm a transaction with forged inputs", func(t *testing.T) {
+		w := newFundedWallet(50)
+		var funding *TxOut
+		for _, utxo := range w.Utxos {
+			funding = utxo
+		}
+		tx, err := w.CreateAndSignTx(10, shop.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.ConfirmTx(tx)
+		forged := *tx
+		forged.Inputs = TxOutMap{}
+		for _, txIn := range tx.Inputs {
+			txInCopy := *txIn
+			txInCopy.Amount = 5000
+			forged.Inputs.Add(&txInCopy)
+		}
+		w.UnconfirmTx(&forged)
+		if w.Balance != 50 || w.Utxos[funding.Id] != funding || w.ReservedBalance() != 50 {
+			t.Errorf("Expected the utxo of the wallet back, got a balance of %d with %d reserved", w.Balance, w.ReservedBalance())
+		}
+	})
+	t.Run("Remove a reserved utxo", func(t *testing.T) {
+		w := newFundedWallet(50)
+		tx, err := w.CreateAndSignTx(10, shop.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, txIn := range tx.Inputs {
+			conflicts, ok := w.RemoveUtxo(txIn)
+			if !ok || len(conflicts) != 1 || conflicts[0] != HexEncodeByteSlice(tx.Id) {
+				t.Errorf("Expected the transaction spending the removed utxo to conflict, got %v", conflicts)
+			}
+		}
+		if w.Balance != 0 || len(w.Reserved) != 0 {
+			t.Errorf("Expected an empty wallet, got a balance of %d and %d reservation(s)", w.Balance, len(w.Reserved))
+		}
+	})
+	t.Run("Release expired reservations", func(t *testing.T) {
+		w := newFundedWallet(50, 50)
+		kept, err := w.CreateAndSignTx(50, shop.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		dropped, err := w.CreateAndSignTx(50, shop.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		keptId, droppedId := HexEncodeByteSlice(kept.Id), HexEncodeByteSlice(dropped.Id)
+		keep := func(txId string) bool { return txId == keptId }
+		if released, renewed := w.ReleaseExpired(time.Hour, keep); len(released)+len(renewed) != 0 {
+			t.Errorf("Expected no reservation to expire yet, got %v and %v", released, renewed)
+		}
+		for _, reservation := range w.Reserved {
+			reservation.CreatedAt = time.Now().Add(-2 * time.Hour)
+		}
+		released, renewed := w.ReleaseExpired(time.Hour, keep)
+		if len(released) != 1 || released[0] != droppedId || len(renewed) != 1 || renewed[0] != keptId {
+			t.Errorf("Expected %s to be released and %s renewed, got %v and %v", droppedId, keptId, released, renewed)
+		}
+		if w.SpendableBalance() != 50 {
+			t.Errorf("Expected 50 to be spendable again, got %d", w.SpendableBalance())
+		}
+		if reservation, ok := w.Reserved[keptId]; !ok || reservation.IsExpired(time.Hour) {
+			t.Error("Expected the kept reservation to be renewed")
+		}
+	})
+	t.Run("Stop renewing a reservation", func(t *testing.T) {
+		w := newFundedWallet(50)
+		tx, err := w.CreateAndSignTx(50, shop.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		txId := HexEncodeByteSlice(tx.Id)
+		keep := func(string) bool { return true }
+		for i := 0; i < MaxReservationRenewals; i++ {
+			w.Reserved[txId].CreatedAt = time.Now().Add(-2 * time.Hour)
+			if _, renewed := w.ReleaseExpired(time.Hour, keep); len(renewed) != 1 {
+				t.Fatalf("Expected renewal %d to succeed, got %v", i+1, renewed)
+			}
+		}
+		w.Reserved[txId].CreatedAt = time.Now().Add(-2 * time.Hour)
+		released, renewed := w.ReleaseExpired(time.Hour, keep)
+		if len(released) != 1 || released[0] != txId || len(renewed) != 0 {
+			t.Errorf("Expected %s to be released after %d renewals, got %v and %v", txId, MaxReservationRenewals, released, renewed)
+		}
+		if w.SpendableBalance() != 50 {
+			t.Errorf("Expected 50 to be spendable again, got %d", w.SpendableBalance())
+		}
+	})
+}
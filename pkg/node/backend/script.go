@@ -0,0 +1,79 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kon-pap/noobcash/pkg/node/script"
+)
+
+// A locking script, see package script.
+//
+// Outputs are locked to a script by making it their owner, so that they are
+// tracked under the address of the script like under any other address. A
+// transaction spending them is signed per input: the signature of every such
+// input reveals the script and holds its unlocking script, see UnlockInput.
+type ScriptKey struct {
+	Script []byte
+}
+
+func NewScriptKey(s []byte) (*ScriptKey, error) {
+	if len(s) == 0 {
+		return nil, errors.New("locking script is empty")
+	}
+	if _, err := script.Parse(s); err != nil {
+		return nil, err
+	}
+	return &ScriptKey{Script: s}, nil
+}
+
+func (k *ScriptKey) Type() KeyType { return KeyScript }
+
+func (k *ScriptKey) Bytes() []byte { return k.Script }
+
+// A script cannot sign on its own, its inputs are verified by Unlock
+func (k *ScriptKey) Verify(digest, sig []byte) error {
+	return errors.New("a script cannot sign a transaction, its inputs are unlocked one by one")
+}
+
+// Runs unlock, the unlocking script of an input of tx, against the locking script
+func (k *ScriptKey) Unlock(tx *Transaction, unlock []byte) error {
+	return script.Verify(unlock, k.Script, &txChecker{tx})
+}
+
+// Lets scripts check signatures and lock times against a transaction
+type txChecker struct {
+	tx *Transaction
+}
+
+// Signatures are over the signing hash of the transaction, like the ones of keys
+func (c *txChecker) CheckSig(sig, pubKey []byte) error {
+	key, err := ParseTypedKey(pubKey)
+	if err != nil {
+		return err
+	}
+	return key.Verify(c.tx.SigningHash(), sig)
+}
+
+// The lock time of the transaction itself is enforced by the chain, so it is
+// enough to check that it is at least lockTime, measured in the same unit
+func (c *txChecker) CheckLockTime(lockTime int64) error {
+	if (lockTime < LockTimeThreshold) != (c.tx.LockTime < LockTimeThreshold) {
+		return errors.New("lock time and transaction lock time are not both heights or both times")
+	}
+	if c.tx.LockTime < lockTime {
+		return fmt.Errorf("transaction must be locked until %s", FormatLockTime(lockTime))
+	}
+	return nil
+}
+
+// Sets the unlocking script of the input with the given id, locked to lock.
+//
+// Unlocking scripts usually hold signatures over the signing hash of the
+// transaction, so they are set once the transaction is built.
+func (tx *Transaction) UnlockInput(inputId string, lock *ScriptKey, unlock []byte) error {
+	if !script.IsPushOnly(unlock) {
+		return errors.New("unlocking script must only push data")
+	}
+	return tx.setInputSig(inputId, lock, unlock)
+}
@@ -0,0 +1,117 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Upper bound on the number of outputs a single amount is split into
+const MaxSplitPieces = 20
+
+// Decides into how many outputs, and of which amounts, a payment or its change is split
+type SplitPolicy interface {
+	String() string
+	Split(amount int) []int
+}
+
+var DefaultSplitPolicy SplitPolicy = HeuristicSplit{}
+
+// Parses a split policy as given in the command line:
+// "none", "heuristic" or "denominations:<d1>,<d2>,...".
+//
+// The empty string returns nil, meaning the wallet default should be used.
+func ParseSplitPolicy(s string) (SplitPolicy, error) {
+	name, args := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		name, args = s[:i], s[i+1:]
+	}
+	switch name {
+	case "":
+		return nil, nil
+	case "none":
+		return NoSplit{}, nil
+	case "heuristic":
+		return HeuristicSplit{}, nil
+	case "denominations":
+		var denominations []int
+		for _, d := range strings.Split(args, ",") {
+			denomination, err := strconv.Atoi(strings.TrimSpace(d))
+			if err != nil || denomination <= 0 {
+				return nil, fmt.Errorf("invalid denomination '%s'", d)
+			}
+			denominations = append(denominations, denomination)
+		}
+		return NewDenominationSplit(denominations...), nil
+	}
+	return nil, fmt.Errorf("unknown split policy '%s'", s)
+}
+
+// Pays every amount with a single output
+type NoSplit struct{}
+
+func (NoSplit) String() string { return "none" }
+
+func (NoSplit) Split(amount int) []int {
+	return []int{amount}
+}
+
+// Splits bigger amounts into more, roughly equal, pieces (up to 10)
+type HeuristicSplit struct{}
+
+func (HeuristicSplit) String() string { return "heuristic" }
+
+func (HeuristicSplit) Split(amount int) (split []int) {
+	switch {
+	case amount < 10:
+		split = append(split, amount)
+	case amount >= 10 && amount < 20:
+		split = SplitAmount(amount, 2)
+	case amount >= 20 && amount < 70:
+		split = SplitAmount(amount, 3)
+	case amount >= 70 && amount < 100:
+		split = SplitAmount(amount, 4)
+	default:
+		split = SplitAmount(amount, 10)
+
+	}
+	return
+}
+
+// Splits amounts into a fixed set of denominations, largest first.
+//
+// Whatever is smaller than the smallest denomination, or is left over after
+// MaxSplitPieces-1 pieces, is paid with one extra output.
+type DenominationSplit struct {
+	Denominations []int // sorted in descending order
+}
+
+func NewDenominationSplit(denominations ...int) *DenominationSplit {
+	sorted := make([]int, len(denominations))
+	copy(sorted, denominations)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	return &DenominationSplit{Denominations: sorted}
+}
+
+func (ds *DenominationSplit) String() string {
+	denominations := make([]string, 0, len(ds.Denominations))
+	for _, d := range ds.Denominations {
+		denominations = append(denominations, strconv.Itoa(d))
+	}
+	return "denominations:" + strings.Join(denominations, ",")
+}
+
+func (ds *DenominationSplit) Split(amount int) (split []int) {
+	remaining := amount
+	for _, denomination := range ds.Denominations {
+		for remaining >= denomination && len(split) < MaxSplitPieces-1 {
+			split = append(split, denomination)
+			remaining -= denomination
+		}
+	}
+	if remaining > 0 {
+		split = append(split, remaining)
+	}
+	return
+}
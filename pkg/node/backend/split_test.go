@@ -0,0 +1,82 @@
+package backend
+
+import (
+	"testing"
+)
+
+func sum(amounts []int) (total int) {
+	for _, amount := range amounts {
+		total += amount
+	}
+	return
+}
+
+func TestSplitPolicies(t *testing.T) {
+	t.Run("No split", func(t *testing.T) {
+		if split := (NoSplit{}).Split(123); len(split) != 1 || split[0] != 123 {
+			t.Errorf("Expected [123], got %v", split)
+		}
+	})
+	t.Run("Heuristic split", func(t *testing.T) {
+		for amount, pieces := range map[int]int{5: 1, 15: 2, 50: 3, 80: 4, 500: 10} {
+			split := (HeuristicSplit{}).Split(amount)
+			if len(split) != pieces || sum(split) != amount {
+				t.Errorf("Expected %d to be split into %d pieces, got %v", amount, pieces, split)
+			}
+		}
+		if split := (HeuristicSplit{}).Split(103); !equalAmounts(split, []int{10, 10, 10, 10, 10, 10, 10, 11, 11, 11}) {
+			t.Errorf("Expected the remainder to be spread over the last pieces, got %v", split)
+		}
+	})
+	t.Run("Denomination split", func(t *testing.T) {
+		ds := NewDenominationSplit(5, 50, 10)
+		if split := ds.Split(77); !equalAmounts(split, []int{50, 10, 10, 5, 2}) {
+			t.Errorf("Expected [50 10 10 5 2], got %v", split)
+		}
+		if split := ds.Split(3); !equalAmounts(split, []int{3}) {
+			t.Errorf("Expected [3], got %v", split)
+		}
+		split := NewDenominationSplit(1).Split(100)
+		if len(split) != MaxSplitPieces || sum(split) != 100 || split[len(split)-1] != 100-(MaxSplitPieces-1) {
+			t.Errorf("Expected at most %d pieces with the leftover in the last one, got %v", MaxSplitPieces, split)
+		}
+	})
+	t.Run("Parse split policies", func(t *testing.T) {
+		for s, expected := range map[string]string{
+			"none":                  "none",
+			"heuristic":             "heuristic",
+			"denominations:5,50,10": "denominations:50,10,5",
+		} {
+			policy, err := ParseSplitPolicy(s)
+			if err != nil || policy.String() != expected {
+				t.Errorf("Expected %q to parse as %s, got %v (%v)", s, expected, policy, err)
+			}
+		}
+		if policy, err := ParseSplitPolicy(""); err != nil || policy != nil {
+			t.Errorf("Expected no policy for the empty string, got %v (%v)", policy, err)
+		}
+		for _, s := range []string{"random", "denominations:", "denominations:10,-5", "denominations:a"} {
+			if _, err := ParseSplitPolicy(s); err == nil {
+				t.Errorf("Expected %q to fail to parse", s)
+			}
+		}
+	})
+	t.Run("Outputs of a transaction follow the policy", func(t *testing.T) {
+		w := NewWallet(DefaultKeyType)
+		funding := NewTxOut(w.PrivKey.Public(), 100)
+		funding.ComputeAndFillHash()
+		w.AddUtxo(funding)
+		w.SplitPolicy = NewDenominationSplit(20)
+		tx, err := w.CreateAndSignTx(45, NewWallet(DefaultKeyType).Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var outputs []*TxOut
+		for _, txOut := range tx.Outputs {
+			outputs = append(outputs, txOut)
+		}
+		if got := amountsOf(outputs); !equalAmounts(got, []int{5, 15, 20, 20, 20, 20}) {
+			t.Errorf("Expected outputs [5 15 20 20 20 20], got %v", got)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package backend
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Lock times below the threshold are block heights, the others unix seconds.
+// A lock time of 0 means no lock.
+const LockTimeThreshold = 500000000
+
+// Returns true if something locked until lockTime can be included in the
+// block at height, whose parent chain has the given median time past
+func IsLockFinal(lockTime int64, height int, medianTime int64) bool {
+	if lockTime <= 0 {
+		return true
+	}
+	if lockTime < LockTimeThreshold {
+		return int64(height) >= lockTime
+	}
+	return medianTime >= lockTime
+}
+
+// Parses a lock time given as a block height, as unix seconds or in RFC3339
+func ParseLockTime(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if lockTime, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if lockTime < 0 {
+			return 0, fmt.Errorf("lock time must not be negative")
+		}
+		return lockTime, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, fmt.Errorf("expected a block height, unix seconds or an RFC3339 time, got '%s'", s)
+	}
+	if t.Unix() < LockTimeThreshold {
+		return 0, fmt.Errorf("lock time %s is too early", s)
+	}
+	return t.Unix(), nil
+}
+
+func FormatLockTime(lockTime int64) string {
+	if lockTime <= 0 {
+		return "unlocked"
+	}
+	if lockTime < LockTimeThreshold {
+		return fmt.Sprintf("height %d", lockTime)
+	}
+	return time.Unix(lockTime, 0).Format(time.RFC3339)
+}
+
+// Sets the chain the lock times of the utxos are checked against, given by
+// the height of the next block and the median time past of the chain
+func (w *Wallet) SetChainTip(nextHeight int, medianTime int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.nextHeight = nextHeight
+	w.medianTime = medianTime
+}
+
+// Must be called with the wallet lock held
+func (w *Wallet) isLocked(txOut *TxOut) bool {
+	return !IsLockFinal(txOut.LockTime, w.nextHeight, w.medianTime)
+}
+
+// Returns true if txOut cannot be spent by the next block
+func (w *Wallet) IsLocked(txOut *TxOut) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.isLocked(txOut)
+}
+
+// Must be called with the wallet lock held
+func (w *Wallet) lockedBalance() (sum int) {
+	for _, utxo := range w.Utxos {
+		if w.isLocked(utxo) && !w.isReserved(utxo) {
+			sum += utxo.NativeAmount()
+		}
+	}
+	return
+}
+
+// Sum of the utxos that cannot be spent yet because of their lock time
+func (w *Wallet) LockedBalance() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lockedBalance()
+}
@@ -0,0 +1,269 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+)
+
+var tokenNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9 _-]{1,32}$`)
+
+// Creation of a token with a fixed supply, paid to its issuer, the sender of
+// the transaction.
+//
+// The id of the token is derived from the inputs of the issuance, see
+// IssuedAsset. Its outputs carry that id, and every later transaction must
+// pay exactly the amount of the token its inputs hold.
+type Issuance struct {
+	Name   string `json:"name"`
+	Supply int    `json:"supply"`
+}
+
+func IsValidTokenName(name string) bool {
+	return tokenNameRegexp.MatchString(name)
+}
+
+func (txout *TxOut) IsNative() bool {
+	return txout.Asset == ""
+}
+
+// Returns the amount of native coins of the output, 0 if it holds a token
+func (txout *TxOut) NativeAmount() int {
+	if !txout.IsNative() {
+		return 0
+	}
+	return txout.Amount
+}
+
+// Returns the id of the token issued by tx, empty if it issues none.
+//
+// The id is derived from the inputs, which can only be spent once, so no two
+// issuances create the same token.
+func (tx *Transaction) IssuedAsset() string {
+	if tx.Issuance == nil {
+		return ""
+	}
+	h := sha256.New()
+	h.Write([]byte("noobcash token"))
+	for _, id := range tx.inputIds() {
+		h.Write([]byte(id))
+	}
+	return HexEncodeByteSlice(h.Sum(nil)[:16])
+}
+
+// Returns true if tx issues a token, or spends or pays any
+func (tx *Transaction) MovesTokens() bool {
+	if tx.Issuance != nil {
+		return true
+	}
+	for _, txIn := range tx.Inputs {
+		if !txIn.IsNative() {
+			return true
+		}
+	}
+	for _, txOut := range tx.Outputs {
+		if !txOut.IsNative() {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks that tx creates no value out of spent, the utxos it spends as
+// recorded in the ledger: it pays at most the native coins they are worth,
+// and exactly the amount of every token they hold, besides the supply of a
+// token it issues.
+func (tx *Transaction) CheckAmounts(spent TxOutMap) error {
+	in, out := map[string]int{}, map[string]int{}
+	var err error
+	for _, utxo := range spent {
+		if in[utxo.Asset], err = addAmounts(in[utxo.Asset], utxo.Amount); err != nil {
+			return err
+		}
+	}
+	for _, txOut := range tx.Outputs {
+		if txOut.Amount <= 0 {
+			return fmt.Errorf("output %s pays %d", txOut.Id, txOut.Amount)
+		}
+		if out[txOut.Asset], err = addAmounts(out[txOut.Asset], txOut.Amount); err != nil {
+			return err
+		}
+	}
+	if tx.Issuance != nil {
+		if err := tx.checkIssuance(); err != nil {
+			return err
+		}
+		asset := tx.IssuedAsset()
+		if out[asset] != tx.Issuance.Supply {
+			return fmt.Errorf("issuance pays %d of token %s, instead of its supply of %d", out[asset], asset, tx.Issuance.Supply)
+		}
+		in[asset] = tx.Issuance.Supply
+	}
+	if out[""] > in[""] {
+		return fmt.Errorf("transaction pays %d more than its inputs are worth", out[""]-in[""])
+	}
+	for asset, amount := range out {
+		if asset != "" && in[asset] != amount {
+			return fmt.Errorf("transaction pays %d of token %s, but its inputs hold %d", amount, asset, in[asset])
+		}
+	}
+	for asset, amount := range in {
+		if asset != "" && out[asset] != amount {
+			return fmt.Errorf("transaction pays %d of token %s, but its inputs hold %d", out[asset], asset, amount)
+		}
+	}
+	return nil
+}
+
+// Adds two amounts, which must not be negative, failing instead of overflowing
+func addAmounts(a, b int) (int, error) {
+	if a < 0 || b < 0 || a > math.MaxInt-b {
+		return 0, fmt.Errorf("amounts %d and %d do not add up to a valid amount", a, b)
+	}
+	return a + b, nil
+}
+
+func (tx *Transaction) checkIssuance() error {
+	if tx.SignsPerInput() || tx.SenderAddress == nil {
+		return errors.New("an issuance is signed as a whole by its issuer")
+	}
+	if len(tx.Inputs) == 0 {
+		return errors.New("an issuance must spend a coin of its issuer")
+	}
+	if !IsValidTokenName(tx.Issuance.Name) {
+		return fmt.Errorf("invalid token name %q", tx.Issuance.Name)
+	}
+	if tx.Issuance.Supply <= 0 {
+		return fmt.Errorf("token supply must be positive, got %d", tx.Issuance.Supply)
+	}
+	return nil
+}
+
+// Creates a transaction issuing supply of a new token to the primary key of
+// the wallet, its issuer.
+//
+// It spends the smallest coin of the issuer, which is paid back to it, so that
+// the id of the token is unique.
+func (w *Wallet) CreateIssuanceTx(name string, supply int) (*Transaction, error) {
+	if w.IsWatchOnly() {
+		return nil, watchOnlyErr
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	coins := sortedUtxos(w.unreservedUtxosOf(w.Address()), false)
+	if len(coins) == 0 {
+		return nil, fmt.Errorf("issuing a token spends a coin of the issuer, %s has none", w.Address())
+	}
+	issuer := w.PrivKey.Public()
+	tx := NewTransaction(issuer, supply)
+	tx.Issuance = &Issuance{Name: name, Supply: supply}
+	tx.Inputs.Add(coins[0])
+	if err := tx.checkIssuance(); err != nil {
+		return nil, err
+	}
+	log.Println("Issuing", supply, "of token", name)
+	supplyTxOut := NewTxOut(issuer, supply)
+	supplyTxOut.Asset = tx.IssuedAsset()
+	supplyTxOut.ComputeAndFillHash()
+	tx.Outputs.Add(supplyTxOut)
+	coinTxOut := NewTxOut(issuer, coins[0].Amount)
+	coinTxOut.ComputeAndFillHash()
+	tx.Outputs.Add(coinTxOut)
+	tx.ComputeAndFillHash()
+	w.reserve(tx)
+	return tx, nil
+}
+
+func (w *Wallet) CreateAndSignIssuanceTx(name string, supply int) (*Transaction, error) {
+	tx, err := w.CreateIssuanceTx(name, supply)
+	if err != nil {
+		return nil, err
+	}
+	err = w.SignTx(tx)
+	if err != nil {
+		w.ReleaseTx(HexEncodeByteSlice(tx.Id))
+		return nil, err
+	}
+	return tx, nil
+}
+
+// Creates a transaction paying every target in the token asset. The token
+// change goes back to the sender, and no native coins are spent.
+func (w *Wallet) CreateTokenTx(asset string, opts *TxOptions, targets ...*TxTargetTy) (*Transaction, error) {
+	var totalAmount int
+	tokenTargets := make([]*TxTargetTy, 0, len(targets))
+	for _, target := range targets {
+		totalAmount += target.Amount
+		tokenTarget := *target
+		tokenTarget.Asset = asset
+		tokenTargets = append(tokenTargets, &tokenTarget)
+	}
+	if asset == "" {
+		return nil, errors.New("no token given")
+	}
+	if totalAmount <= 0 {
+		return nil, fmt.Errorf("tried to create transaction for %d", totalAmount)
+	}
+	if w.IsWatchOnly() {
+		return nil, watchOnlyErr
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	utxos := w.unreservedAssetUtxos(asset)
+	spendable := 0
+	for _, utxo := range utxos {
+		spendable += utxo.Amount
+	}
+	if totalAmount > spendable {
+		return nil, fmt.Errorf("tried to send %d of token %s but only have %d", totalAmount, asset, spendable)
+	}
+	sender, selection, err := w.selectSender(w.coinSelector(opts), utxos, totalAmount)
+	if err != nil {
+		return nil, err
+	}
+	splitPolicy := w.splitPolicy(opts)
+	tx := newTxToTargets(sender.Public(), splitPolicy, tokenTargets, opts)
+	log.Println("Selected token inputs of", tx.Sender(), "with", selection)
+	tx.addSelection(selection, splitPolicy, func(amount int) *TxOut {
+		change := NewTxOut(sender.Public(), amount)
+		change.Asset = asset
+		return change
+	})
+	tx.ComputeAndFillHash()
+	w.reserve(tx)
+	return tx, nil
+}
+
+func (w *Wallet) CreateAndSignTokenTx(asset string, opts *TxOptions, targets ...*TxTargetTy) (*Transaction, error) {
+	tx, err := w.CreateTokenTx(asset, opts, targets...)
+	if err != nil {
+		return nil, err
+	}
+	err = w.SignTx(tx)
+	if err != nil {
+		w.ReleaseTx(HexEncodeByteSlice(tx.Id))
+		return nil, err
+	}
+	return tx, nil
+}
+
+// Returns the utxos of the wallet holding tokens, by token id, the largest first
+func (w *Wallet) TokenUtxos() map[string][]*TxOut {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	tokens := map[string][]*TxOut{}
+	for _, utxo := range w.Utxos {
+		if !utxo.IsNative() {
+			tokens[utxo.Asset] = append(tokens[utxo.Asset], utxo)
+		}
+	}
+	for asset := range tokens {
+		utxos := tokens[asset]
+		sort.Slice(utxos, func(i, j int) bool { return utxos[i].Amount > utxos[j].Amount })
+	}
+	return tokens
+}
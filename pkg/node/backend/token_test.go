@@ -0,0 +1,111 @@
+package backend
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTokens(t *testing.T) {
+	student := NewWallet(DefaultKeyType)
+	// pays the token output owned by to an amount, rehashing tx
+	setTokenAmount := func(tx *Transaction, to Address, amount int) {
+		for _, txOut := range tx.Outputs {
+			if !txOut.IsNative() && txOut.OwnerAddress() == to {
+				txOut.Amount = amount
+				txOut.ComputeAndFillHash()
+			}
+		}
+		tx.ComputeAndFillHash()
+	}
+
+	t.Run("Issue a token", func(t *testing.T) {
+		w := newFundedWallet(10)
+		tx, err := w.CreateAndSignIssuanceTx("lab credits", 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tx.IssuedAsset() == "" {
+			t.Fatal("Expected the issuance to create a token")
+		}
+		if err := tx.CheckAmounts(tx.Inputs); err != nil {
+			t.Errorf("Expected the issuance to be valid, got %v", err)
+		}
+		setTokenAmount(tx, w.Address(), 1001)
+		if err := tx.CheckAmounts(tx.Inputs); err == nil {
+			t.Error("Expected an issuance paying more than its supply to be invalid")
+		}
+	})
+	t.Run("Issue a token with an invalid supply or name", func(t *testing.T) {
+		w := newFundedWallet(10)
+		if _, err := w.CreateIssuanceTx("free credits", 0); err == nil {
+			t.Error("Expected a supply of 0 to be refused")
+		}
+		if _, err := w.CreateIssuanceTx("credits!", 10); err == nil {
+			t.Error("Expected an invalid name to be refused")
+		}
+		if _, err := NewWallet(DefaultKeyType).CreateIssuanceTx("credits", 10); err == nil {
+			t.Error("Expected an issuer without coins to be refused")
+		}
+	})
+
+	issuer := newFundedWallet(10)
+	issuance, err := issuer.CreateAndSignIssuanceTx("lab credits", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.ConfirmTx(issuance)
+	for _, txOut := range issuance.Outputs {
+		issuer.AddUtxo(txOut)
+	}
+	token := issuance.IssuedAsset()
+
+	t.Run("Send tokens", func(t *testing.T) {
+		tx, err := issuer.CreateAndSignTokenTx(token, nil, &TxTargetTy{Address: student.Address(), Amount: 30})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer issuer.ReleaseTx(HexEncodeByteSlice(tx.Id))
+		for _, txIn := range tx.Inputs {
+			if txIn.IsNative() {
+				t.Error("Expected a token transaction to spend no native coins")
+			}
+		}
+		if err := tx.CheckAmounts(tx.Inputs); err != nil {
+			t.Errorf("Expected the token transaction to be valid, got %v", err)
+		}
+	})
+	t.Run("Send more tokens than held", func(t *testing.T) {
+		if _, err := issuer.CreateTokenTx(token, nil, &TxTargetTy{Address: student.Address(), Amount: 1001}); err == nil {
+			t.Error("Expected sending more tokens than held to fail")
+		}
+	})
+	t.Run("Transaction creating or burning tokens", func(t *testing.T) {
+		for _, amount := range []int{100, 5} {
+			tx, err := issuer.CreateTokenTx(token, &TxOptions{SplitPolicy: NoSplit{}}, &TxTargetTy{Address: student.Address(), Amount: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			issuer.ReleaseTx(HexEncodeByteSlice(tx.Id))
+			setTokenAmount(tx, student.Address(), amount)
+			if err := tx.CheckAmounts(tx.Inputs); err == nil {
+				t.Errorf("Expected a transaction paying %d tokens out of 10 to be invalid", amount)
+			}
+		}
+	})
+	t.Run("Transaction overflowing the amounts", func(t *testing.T) {
+		w := newFundedWallet(10)
+		tx, _, err := w.CreateTxWithOptions(&TxOptions{SplitPolicy: NoSplit{}}, &TxTargetTy{Address: student.Address(), Amount: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.ReleaseTx(HexEncodeByteSlice(tx.Id))
+		for _, txOut := range tx.Outputs {
+			if txOut.OwnerAddress() == student.Address() {
+				txOut.Amount = math.MaxInt
+			}
+		}
+		if err := tx.CheckAmounts(tx.Inputs); err == nil {
+			t.Error("Expected outputs adding up to more than the largest amount to be invalid")
+		}
+	})
+}
@@ -1,9 +1,10 @@
 package backend
 
 import (
-	"crypto/rsa"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -11,24 +12,43 @@ import (
 )
 
 type TxOut struct {
-	Id            string         `json:"id"`
-	TransactionId string         `json:"transactionId"`
-	Amount        int            `json:"amount"`
-	Owner         *rsa.PublicKey `json:"owner"`
+	Id            string  `json:"id"`
+	TransactionId string  `json:"transactionId"`
+	Amount        int     `json:"amount"`
+	Address       Address `json:"address"` // address of the owner
+	// Public key of the owner, nil if the output was paid to an address only.
+	// The key is revealed by the transaction spending the output.
+	Owner PublicKey `json:"owner"`
+	// The output cannot be spent before this block height or time, see LockTimeThreshold
+	LockTime int64 `json:"lockTime,omitempty"`
+	// Id of the token the output holds, empty for native coins, see Issuance
+	Asset string `json:"asset,omitempty"`
 }
 
-func NewTxOut(owner *rsa.PublicKey, amount int) *TxOut {
+func NewTxOut(owner PublicKey, amount int) *TxOut {
 	return &TxOut{
-		Amount: amount,
-		Owner:  owner,
+		Amount:  amount,
+		Address: AddressFromPubKey(owner),
+		Owner:   owner,
+	}
+}
+
+// Creates an output payable to address, whose public key may not be known yet
+func NewTxOutToAddress(address Address, amount int) *TxOut {
+	return &TxOut{
+		Amount:  amount,
+		Address: address,
 	}
 }
 
 type txOutJson struct {
-	Id            string `json:"id"`
-	TransactionId string `json:"transactionId"`
-	Amount        int    `json:"amount"`
-	Owner         string `json:"owner"`
+	Id            string  `json:"id"`
+	TransactionId string  `json:"transactionId"`
+	Amount        int     `json:"amount"`
+	Address       Address `json:"address"`
+	Owner         string  `json:"owner"`
+	LockTime      int64   `json:"lockTime,omitempty"`
+	Asset         string  `json:"asset,omitempty"`
 }
 
 func (txout *TxOut) MarshalJSON() ([]byte, error) {
@@ -36,7 +56,10 @@ func (txout *TxOut) MarshalJSON() ([]byte, error) {
 		Id:            txout.Id,
 		TransactionId: txout.TransactionId,
 		Amount:        txout.Amount,
+		Address:       txout.OwnerAddress(),
 		Owner:         PubKeyToPem(txout.Owner),
+		LockTime:      txout.LockTime,
+		Asset:         txout.Asset,
 	})
 }
 func (txout *TxOut) UnmarshalJSON(b []byte) error {
@@ -48,10 +71,42 @@ func (txout *TxOut) UnmarshalJSON(b []byte) error {
 	txout.Id = tmpTxOut.Id
 	txout.TransactionId = tmpTxOut.TransactionId
 	txout.Amount = tmpTxOut.Amount
-	txout.Owner = PubKeyFromPem(tmpTxOut.Owner)
+	txout.Address = tmpTxOut.Address
+	if txout.Owner, err = ParsePubKeyPem(tmpTxOut.Owner); err != nil {
+		return fmt.Errorf("invalid owner of output %s: %s", tmpTxOut.Id, err)
+	}
+	txout.LockTime = tmpTxOut.LockTime
+	txout.Asset = tmpTxOut.Asset
 	return nil
 }
 
+func (txout *TxOut) OwnerAddress() Address {
+	if txout.Address == "" {
+		return AddressFromPubKey(txout.Owner)
+	}
+	return txout.Address
+}
+
+// Checks that the output is owned by a valid address, matching its public key if known
+func (txout *TxOut) IsValidOwner() bool {
+	address := txout.OwnerAddress()
+	if !address.IsValid() {
+		return false
+	}
+	return txout.Owner == nil || address.IsOwnedBy(txout.Owner)
+}
+
+// Checks that the input spends utxo exactly as it was paid
+func (txout *TxOut) Spends(utxo *TxOut) bool {
+	return txout.Id == utxo.Id &&
+		txout.TransactionId == utxo.TransactionId &&
+		txout.Amount == utxo.Amount &&
+		txout.Asset == utxo.Asset &&
+		txout.OwnerAddress() == utxo.OwnerAddress() &&
+		PubKeyToPem(txout.Owner) == PubKeyToPem(utxo.Owner) &&
+		txout.LockTime == utxo.LockTime
+}
+
 func (txout *TxOut) ComputeAndFillHash() {
 	bytes, err := json.Marshal(txout)
 	if err != nil {
@@ -68,22 +123,35 @@ func (txout *TxOut) ComputeAndFillHash() {
 }
 
 type Transaction struct {
-	SenderAddress *rsa.PublicKey
-	// ReceiverAddress *rsa.PublicKey
+	SenderAddress PublicKey
+	// ReceiverAddress PublicKey
 	Amount    int
 	Id        []byte
 	Inputs    TxOutMap
 	Outputs   TxOutMap
 	Signature []byte
+	// The transaction cannot be included in a block before this height or time
+	LockTime int64
+	// Signatures by input id, when the transaction has no single sender
+	InputSigs map[string]*InputSig
+	// Message sealed to the recipient, see SealMemo
+	Memo []byte
+	// Token created by the transaction, if any
+	Issuance *Issuance
 }
 type transactionJson struct {
-	Id              string   `json:"id"`
-	SenderAddress   string   `json:"senderAddress"`
-	ReceiverAddress string   `json:"receiverAddress"`
-	Amount          int      `json:"amount"`
-	Inputs          []*TxOut `json:"inputs"`
-	Outputs         []*TxOut `json:"outputs"`
-	Signature       string   `json:"signature"`
+	Id              string                   `json:"id"`
+	SenderAddress   Address                  `json:"senderAddress"`
+	SenderKey       string                   `json:"senderKey"`
+	ReceiverAddress string                   `json:"receiverAddress"`
+	Amount          int                      `json:"amount"`
+	Inputs          []*TxOut                 `json:"inputs"`
+	Outputs         []*TxOut                 `json:"outputs"`
+	Signature       string                   `json:"signature"`
+	LockTime        int64                    `json:"lockTime,omitempty"`
+	InputSigs       map[string]*inputSigJson `json:"inputSigs,omitempty"`
+	Memo            string                   `json:"memo,omitempty"`
+	Issuance        *Issuance                `json:"issuance,omitempty"`
 }
 
 func (tx *Transaction) MarshalJSON() ([]byte, error) {
@@ -95,14 +163,29 @@ func (tx *Transaction) MarshalJSON() ([]byte, error) {
 	for _, txOut := range tx.Outputs {
 		txOuts = append(txOuts, txOut)
 	}
+	var inputSigs map[string]*inputSigJson
+	if len(tx.InputSigs) > 0 {
+		inputSigs = make(map[string]*inputSigJson, len(tx.InputSigs))
+		for id, sig := range tx.InputSigs {
+			inputSigs[id] = &inputSigJson{
+				Key:       PubKeyToPem(sig.Key),
+				Signature: HexEncodeByteSlice(sig.Signature),
+			}
+		}
+	}
 	return json.Marshal(transactionJson{
 		Id:            HexEncodeByteSlice(tx.Id),
-		SenderAddress: PubKeyToPem(tx.SenderAddress),
+		SenderAddress: tx.Sender(),
+		SenderKey:     PubKeyToPem(tx.SenderAddress),
 		// ReceiverAddress: PubKeyToPem(tx.ReceiverAddress),
 		Amount:    tx.Amount,
 		Inputs:    txIns,
 		Outputs:   txOuts,
 		Signature: HexEncodeByteSlice(tx.Signature),
+		LockTime:  tx.LockTime,
+		InputSigs: inputSigs,
+		Memo:      HexEncodeByteSlice(tx.Memo),
+		Issuance:  tx.Issuance,
 	})
 }
 func (tx *Transaction) UnmarshalJSON(b []byte) error {
@@ -120,13 +203,45 @@ func (tx *Transaction) UnmarshalJSON(b []byte) error {
 		txOuts.Add(txOut)
 	}
 
-	tx.Id = HexDecodeByteSlice(txJson.Id)
-	tx.SenderAddress = PubKeyFromPem(txJson.SenderAddress)
+	if tx.Id, err = hex.DecodeString(txJson.Id); err != nil {
+		return fmt.Errorf("invalid transaction id: %s", err)
+	}
+	if tx.SenderAddress, err = ParsePubKeyPem(txJson.SenderKey); err != nil {
+		return fmt.Errorf("invalid sender key: %s", err)
+	}
 	// tx.ReceiverAddress = PubKeyFromPem(txJson.ReceiverAddress)
 	tx.Amount = txJson.Amount
 	tx.Inputs = txIns
 	tx.Outputs = txOuts
-	tx.Signature = HexDecodeByteSlice(txJson.Signature)
+	if tx.Signature, err = hex.DecodeString(txJson.Signature); err != nil {
+		return fmt.Errorf("invalid signature: %s", err)
+	}
+	tx.LockTime = txJson.LockTime
+	if tx.Memo, err = hex.DecodeString(txJson.Memo); err != nil {
+		return fmt.Errorf("invalid memo: %s", err)
+	}
+	tx.Issuance = txJson.Issuance
+	tx.InputSigs = nil
+	for id, sig := range txJson.InputSigs {
+		if tx.InputSigs == nil {
+			tx.InputSigs = make(map[string]*InputSig, len(txJson.InputSigs))
+		}
+		if sig == nil {
+			return fmt.Errorf("missing signature of input %s", id)
+		}
+		key, err := ParsePubKeyPem(sig.Key)
+		if err != nil {
+			return fmt.Errorf("invalid key of input %s: %s", id, err)
+		}
+		signature, err := hex.DecodeString(sig.Signature)
+		if err != nil {
+			return fmt.Errorf("invalid signature of input %s: %s", id, err)
+		}
+		tx.InputSigs[id] = &InputSig{
+			Key:       key,
+			Signature: signature,
+		}
+	}
 	return nil
 }
 func (tx *Transaction) String() string {
@@ -138,7 +253,7 @@ func (tx *Transaction) String() string {
 	return string(strBytes)
 }
 
-func NewTransaction(from *rsa.PublicKey, amount int) *Transaction {
+func NewTransaction(from PublicKey, amount int) *Transaction {
 	return &Transaction{
 		SenderAddress: from,
 		// ReceiverAddress: to,
@@ -148,7 +263,7 @@ func NewTransaction(from *rsa.PublicKey, amount int) *Transaction {
 	}
 }
 
-func NewGenesisTransaction(to *rsa.PublicKey, amount int) *Transaction {
+func NewGenesisTransaction(to PublicKey, amount int) *Transaction {
 	newTx := NewTransaction(nil, amount)
 	newTx.Id = []byte("genesis")
 
@@ -161,8 +276,49 @@ func NewGenesisTransaction(to *rsa.PublicKey, amount int) *Transaction {
 	return newTx
 }
 
+// Implemented by keys that put conditions on the transactions spending their
+// outputs, beyond a valid signature. sig is the signature made with the key,
+// either the one of the whole transaction or the one of an input.
+type SpendCondition interface {
+	CheckSpend(tx *Transaction, sig []byte) error
+}
+
+// Returns the address of the sender, empty for the genesis transaction and
+// for transactions signed per input
+func (tx *Transaction) Sender() Address {
+	return AddressFromPubKey(tx.SenderAddress)
+}
+
 func (tx *Transaction) IsGenesis() bool {
-	return tx.SenderAddress == nil
+	return tx.SenderAddress == nil && len(tx.Inputs) == 0
+}
+
+// Checks that a genesis transaction only creates native coins, as it spends
+// nothing and is not signed. It is only valid in the genesis block.
+func (tx *Transaction) CheckGenesis() error {
+	if !tx.IsGenesis() {
+		return errors.New("transaction spends inputs, it is not a genesis transaction")
+	}
+	if tx.Issuance != nil {
+		return errors.New("a genesis transaction issues no token")
+	}
+	if len(tx.Outputs) == 0 {
+		return errors.New("genesis transaction pays nobody")
+	}
+	total := 0
+	for _, txOut := range tx.Outputs {
+		if !txOut.IsNative() {
+			return fmt.Errorf("genesis output %s pays token %s", txOut.Id, txOut.Asset)
+		}
+		if txOut.Amount <= 0 {
+			return fmt.Errorf("output %s pays %d", txOut.Id, txOut.Amount)
+		}
+		var err error
+		if total, err = addAmounts(total, txOut.Amount); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (tx *Transaction) ComputeAndFillHash() {
@@ -0,0 +1,73 @@
+package backend
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTransactionJson(t *testing.T) {
+	alice := NewWallet(DefaultKeyType)
+	bob := NewWallet(DefaultKeyType)
+	tx, err := BuildJointTx([]*Contribution{
+		{Owner: alice.Address(), Utxos: []*TxOut{newUtxo(alice.PrivKey.Public(), 50)}, Amount: 20},
+		{Owner: bob.Address(), Utxos: []*TxOut{newUtxo(bob.PrivKey.Public(), 50)}, Amount: 20},
+	}, &TxOptions{SplitPolicy: NoSplit{}}, &TxTargetTy{Address: NewWallet(DefaultKeyType).Address(), Amount: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Memo = []byte("invoice 42")
+	for _, key := range []PrivateKey{alice.PrivKey, bob.PrivKey} {
+		if err := SignTxWithKey(tx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Decode an encoded transaction", func(t *testing.T) {
+		var decoded Transaction
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if err := decoded.VerifySignatures(); err != nil {
+			t.Errorf("Expected the decoded transaction to be valid, got %v", err)
+		}
+	})
+	for field, edit := range map[string]func(m map[string]interface{}){
+		"id":        func(m map[string]interface{}) { m["id"] = "not hex" },
+		"signature": func(m map[string]interface{}) { m["signature"] = "not hex" },
+		"memo":      func(m map[string]interface{}) { m["memo"] = "not hex" },
+		"sender key": func(m map[string]interface{}) {
+			m["senderKey"] = "-----BEGIN PUBLIC KEY-----\nnot a key\n-----END PUBLIC KEY-----\n"
+		},
+		"owner of an output": func(m map[string]interface{}) {
+			m["outputs"].([]interface{})[0].(map[string]interface{})["owner"] = "not a key"
+		},
+		"key of an input signature": func(m map[string]interface{}) {
+			for _, sig := range m["inputSigs"].(map[string]interface{}) {
+				sig.(map[string]interface{})["key"] = "not a key"
+			}
+		},
+		"signature of an input": func(m map[string]interface{}) {
+			for _, sig := range m["inputSigs"].(map[string]interface{}) {
+				sig.(map[string]interface{})["signature"] = "not hex"
+			}
+		},
+	} {
+		var m map[string]interface{}
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Fatal(err)
+		}
+		edit(m)
+		malformed, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Transaction
+		if err := json.Unmarshal(malformed, &decoded); err == nil {
+			t.Errorf("Expected a transaction with a malformed %s to be refused", field)
+		}
+	}
+}
@@ -1,63 +1,148 @@
 package backend
 
 import (
-	"crypto"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
 	"encoding/json"
-	"encoding/pem"
-	"errors"
 	"fmt"
 	"log"
 	"os"
 	"sort"
+	"sync"
 )
 
 //const numberOfPieces = 5
 
 type Wallet struct {
-	Balance int
-	PrivKey *rsa.PrivateKey
-	Utxos   TxOutMap
-	// TODO(ORF): Add a map of reserved TxOuts that cannot be used in new txs but are not removed yet
+	Balance  int
+	PrivKey  PrivateKey // primary key, the default sender of new transactions
+	Utxos    TxOutMap
+	Reserved map[string]*Reservation // reservations by the id of the transaction that spends them
+	// Strategy used to choose the inputs of new transactions, DefaultCoinSelector if nil
+	CoinSelector CoinSelector
+	// Policy used to split payments and change into outputs, DefaultSplitPolicy if nil
+	SplitPolicy SplitPolicy
+
+	keys    map[Address]PrivateKey // every key of the wallet, including PrivKey
+	hd      *hdKeychain            // nil unless the keys are derived from a mnemonic
+	watched *WalletInfo            // followed address of a watch-only wallet, which has no keys
+	spent   map[string]TxOutMap    // utxos removed by ConfirmTx, by the id of the transaction that spent them
+
+	// chain tip the lock times of the utxos are checked against, see SetChainTip
+	nextHeight int
+	medianTime int64
+
+	mu sync.Mutex // guards Balance, Utxos, Reserved, keys, hd, spent and the chain tip
 }
 type WalletInfo struct {
 	Balance int
-	PubKey  *rsa.PublicKey
+	PubKey  PublicKey // nil if the wallet has only been paid to its address
 	Utxos   TxOutMap
+
+	address Address
 }
 
-func NewWallet(bits int) *Wallet {
-	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+func NewWallet(keyType KeyType) *Wallet {
+	privateKey, err := GenerateKey(keyType)
 	if err != nil {
 		fmt.Print(err)
 		os.Exit(1)
 	}
+	return NewWalletFromKey(privateKey)
+}
+
+// Creates an empty wallet around an existing private key
+func NewWalletFromKey(privKey PrivateKey) *Wallet {
 	return &Wallet{
-		PrivKey: privateKey,
+		PrivKey:  privKey,
+		Utxos:    TxOutMap{},
+		Reserved: map[string]*Reservation{},
+		keys:     map[Address]PrivateKey{AddressFromPubKey(privKey.Public()): privKey},
+		spent:    map[string]TxOutMap{},
+	}
+}
+
+func NewWalletInfo(pubKey PublicKey) *WalletInfo {
+	return &WalletInfo{
+		PubKey:  pubKey,
 		Utxos:   TxOutMap{},
+		address: AddressFromPubKey(pubKey),
 	}
 }
 
-func NewWalletInfo(pubKey *rsa.PublicKey) *WalletInfo {
+// Creates the info of a wallet only known by its address
+func NewWalletInfoForAddress(address Address) *WalletInfo {
 	return &WalletInfo{
-		PubKey: pubKey,
-		Utxos:  TxOutMap{},
+		Utxos:   TxOutMap{},
+		address: address,
+	}
+}
+
+func (w *Wallet) Address() Address {
+	if w.watched != nil {
+		return w.watched.Address()
+	}
+	return AddressFromPubKey(w.PrivKey.Public())
+}
+
+// Returns true if the wallet holds the key of address.
+//
+// For HD wallets this includes the addresses derived ahead of the used ones,
+// so that payments to them are noticed.
+func (w *Wallet) Owns(address Address) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.owns(address)
+}
+
+// Must be called with the wallet lock held
+func (w *Wallet) owns(address Address) bool {
+	if w.watched != nil {
+		return address == w.watched.Address()
 	}
+	_, ok := w.keys[address]
+	return ok
+}
+
+// Returns the addresses handed out by the wallet, the primary one first
+func (w *Wallet) Addresses() []Address {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.hd == nil {
+		return []Address{w.Address()}
+	}
+	addresses := make([]Address, 0, w.hd.next)
+	for _, key := range w.hd.keys[:w.hd.next] {
+		addresses = append(addresses, AddressFromPubKey(key.Public()))
+	}
+	return addresses
+}
+
+func (w *WalletInfo) Address() Address {
+	if w.PubKey != nil {
+		return AddressFromPubKey(w.PubKey)
+	}
+	return w.address
 }
 
 func (w *Wallet) GetWalletInfo() *WalletInfo {
+	if w.watched != nil {
+		return &WalletInfo{
+			Balance: w.Balance,
+			PubKey:  w.watched.PubKey,
+			Utxos:   w.Utxos,
+			address: w.watched.Address(),
+		}
+	}
 	return &WalletInfo{
 		Balance: w.Balance,
-		PubKey:  &w.PrivKey.PublicKey,
+		PubKey:  w.PrivKey.Public(),
 		Utxos:   w.Utxos,
 	}
 }
 func (w *WalletInfo) MarshalJSON() ([]byte, error) {
 	type printableWallet struct {
 		Balance int      `json:"balance"`
-		PubKey  string   `json:"address"`
+		Address Address  `json:"address"`
+		PubKey  string   `json:"pubKey"`
 		Utxos   []*TxOut `json:"utxos"`
 	}
 	txouts := make([]*TxOut, 0, len(w.Utxos))
@@ -66,6 +151,7 @@ func (w *WalletInfo) MarshalJSON() ([]byte, error) {
 	}
 	return json.Marshal(printableWallet{
 		Balance: w.Balance,
+		Address: w.Address(),
 		PubKey:  PubKeyToPem(w.PubKey),
 		Utxos:   txouts,
 	})
@@ -96,196 +182,308 @@ func (w *WalletInfo) String() string {
 	return string(strBytes)
 }
 
-func PrivKeyToPem(privKey *rsa.PrivateKey) string {
-	if privKey == nil {
-		return "0"
-	}
-	privKeyBytes := x509.MarshalPKCS1PrivateKey(privKey)
-	privKeyBlock := pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: privKeyBytes,
-	}
-	return string(pem.EncodeToMemory(&privKeyBlock))
+// Returns the native utxos of the wallet that are neither reserved by another
+// transaction nor locked
+//
+// Must be called with the wallet lock held
+func (w *Wallet) unreservedUtxos() []*TxOut {
+	return w.unreservedAssetUtxos("")
 }
-func PrivKeyFromPem(s string) *rsa.PrivateKey {
-	if s == "0" {
-		return nil
+
+// Like unreservedUtxos, for the utxos of a token, or native ones if asset is empty
+//
+// Must be called with the wallet lock held
+func (w *Wallet) unreservedAssetUtxos(asset string) []*TxOut {
+	utxos := make([]*TxOut, 0, len(w.Utxos))
+	for _, utxo := range w.Utxos {
+		if utxo.Asset == asset && !w.isReserved(utxo) && !w.isLocked(utxo) {
+			utxos = append(utxos, utxo)
+		}
 	}
-	block, _ := pem.Decode([]byte(s))
-	if block == nil {
-		fmt.Println("Failed to decode PEM block containing the key")
-		os.Exit(1)
+	return utxos
+}
+
+// Returns the unreserved utxos owned by address
+//
+// Must be called with the wallet lock held
+func (w *Wallet) unreservedUtxosOf(address Address) []*TxOut {
+	var utxos []*TxOut
+	for _, utxo := range w.unreservedUtxos() {
+		if utxo.OwnerAddress() == address {
+			utxos = append(utxos, utxo)
+		}
 	}
-	if block.Type != "RSA PRIVATE KEY" {
-		fmt.Println("RSA private key is of the wrong type", block.Type)
-		os.Exit(1)
+	return utxos
+}
+
+// Chooses the key that will pay targetAmount out of utxos, along with its inputs.
+//
+// A transaction with a sender is signed as a whole, so all inputs must belong
+// to the same key. The primary key is tried first, then the others from the richest.
+//
+// Must be called with the wallet lock held
+func (w *Wallet) selectSender(selector CoinSelector, utxos []*TxOut, targetAmount int) (PrivateKey, *CoinSelection, error) {
+	balances := map[Address]int{}
+	for _, utxo := range utxos {
+		balances[utxo.OwnerAddress()] += utxo.Amount
+	}
+	candidates := make([]Address, 0, len(balances))
+	for address := range balances {
+		if address != w.Address() {
+			candidates = append(candidates, address)
+		}
 	}
-	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
-	if err != nil {
-		fmt.Print(err)
-		os.Exit(1)
+	sort.Slice(candidates, func(i, j int) bool {
+		if balances[candidates[i]] != balances[candidates[j]] {
+			return balances[candidates[i]] > balances[candidates[j]]
+		}
+		return candidates[i] < candidates[j]
+	})
+	candidates = append([]Address{w.Address()}, candidates...)
+
+	for _, address := range candidates {
+		key, ok := w.keys[address]
+		if !ok || balances[address] < targetAmount {
+			continue
+		}
+		var owned []*TxOut
+		for _, utxo := range utxos {
+			if utxo.OwnerAddress() == address {
+				owned = append(owned, utxo)
+			}
+		}
+		selection, err := selector.Select(owned, targetAmount)
+		if err == nil {
+			return key, selection, nil
+		}
 	}
-	return key
+	return nil, nil, fmt.Errorf("no single address of the wallet can pay %d", targetAmount)
 }
-func PubKeyToPem(pubKey *rsa.PublicKey) string {
-	if pubKey == nil {
-		return "0"
-	}
-	publicKeyBytes := x509.MarshalPKCS1PublicKey(pubKey)
-	publicKeyBlock := &pem.Block{
-		Type:  "RSA PUBLIC KEY",
-		Bytes: publicKeyBytes,
+
+// Chooses inputs from any addresses of the wallet to pay targetAmount, for a
+// transaction signed per input, when no single address can pay it.
+//
+// Must be called with the wallet lock held
+func (w *Wallet) selectJointInputs(selector CoinSelector, targetAmount int) (*CoinSelection, error) {
+	var utxos []*TxOut
+	for _, utxo := range w.unreservedUtxos() {
+		if _, ok := w.keys[utxo.OwnerAddress()]; ok {
+			utxos = append(utxos, utxo)
+		}
 	}
-	return string(pem.EncodeToMemory(publicKeyBlock))
+	return selector.Select(utxos, targetAmount)
 }
-func PubKeyFromPem(s string) *rsa.PublicKey {
-	if s == "0" {
-		return nil
+
+type TxTargetTy struct {
+	Address Address
+	Amount  int
+	// The outputs paying the target cannot be spent before this height or time
+	LockTime int64
+	// Token the target is paid in, native coins if empty
+	Asset string
+}
+
+// Optional parameters for creating a transaction.
+//
+// Unset fields fall back to the defaults of the wallet.
+type TxOptions struct {
+	CoinSelector CoinSelector
+	SplitPolicy  SplitPolicy
+	// The transaction cannot be included in a block before this height or time
+	LockTime int64
+	// Memo sealed to the recipient, see SealMemo
+	Memo []byte
+}
+
+func (w *Wallet) coinSelector(opts *TxOptions) CoinSelector {
+	if opts != nil && opts.CoinSelector != nil {
+		return opts.CoinSelector
 	}
-	block, _ := pem.Decode([]byte(s))
-	if block == nil {
-		fmt.Println("Failed to decode PEM block containing the key")
-		os.Exit(1)
+	if w.CoinSelector != nil {
+		return w.CoinSelector
 	}
-	if block.Type != "RSA PUBLIC KEY" {
-		fmt.Println("RSA public key is of the wrong type", block.Type)
-		os.Exit(1)
+	return DefaultCoinSelector
+}
+
+func (w *Wallet) splitPolicy(opts *TxOptions) SplitPolicy {
+	if opts != nil && opts.SplitPolicy != nil {
+		return opts.SplitPolicy
 	}
-	key, err := x509.ParsePKCS1PublicKey(block.Bytes)
-	if err != nil {
-		fmt.Print(err)
-		os.Exit(1)
+	if w.SplitPolicy != nil {
+		return w.SplitPolicy
 	}
-	return key
+	return DefaultSplitPolicy
 }
 
-type utxoTmp struct {
-	key string
-	val *TxOut
+func (w *Wallet) CreateTx(amount int, address Address) (*Transaction, error) {
+	log.Println("Creating transaction for amount:", amount)
+	tx, _, err := w.createTx(nil, &TxTargetTy{Address: address, Amount: amount})
+	return tx, err
 }
-type utxoTmpListTy []utxoTmp
 
-func (t utxoTmpListTy) Less(i, j int) bool { return t[i].val.Amount > t[j].val.Amount }
-func (t utxoTmpListTy) Len() int           { return len(t) }
-func (t utxoTmpListTy) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (w *Wallet) CreateMultiTargetTx(targets ...*TxTargetTy) (*Transaction, error) {
+	tx, _, err := w.CreateTxWithOptions(nil, targets...)
+	return tx, err
+}
 
-// func (w *Wallet) selectUTXOsRandomImprove(targetAmount int) (sum int, txIns []*TxOut) {}
+// Creates a transaction paying every target, and reports how its inputs were selected
+func (w *Wallet) CreateTxWithOptions(opts *TxOptions, targets ...*TxTargetTy) (*Transaction, *CoinSelection, error) {
+	var totalAmount int
+	for _, target := range targets {
+		totalAmount += target.Amount
+	}
+	log.Println("Creating transaction for amount:", totalAmount, "and", len(targets), "targets")
+	return w.createTx(opts, targets...)
+}
 
-// Chooses utxos from the wallet that are sufficient to pay the amount,
-// removes them from the utxos map, and returns them along with their sum.
-func (w *Wallet) selectUTXOsLargestFirst(targetAmount int) (sum int, previousTxOuts []*TxOut, err error) {
-	tmp := make(utxoTmpListTy, 0, len(w.Utxos))
-	// TODO(ORF): Do not use the reserved UTXOS for this.
-	for k, v := range w.Utxos {
-		tmp = append(tmp, utxoTmp{k, v})
+func (w *Wallet) createTx(opts *TxOptions, targets ...*TxTargetTy) (*Transaction, *CoinSelection, error) {
+	var totalAmount int
+	for _, target := range targets {
+		totalAmount += target.Amount
 	}
-	sort.Sort(tmp)
-	for _, v := range tmp {
-		if sum >= targetAmount {
-			break
-		}
-		sum += v.val.Amount
-		previousTxOuts = append(previousTxOuts, v.val)
+	if totalAmount <= 0 {
+		return nil, nil, fmt.Errorf("tried to create transaction for %d", totalAmount)
+	}
+	if w.IsWatchOnly() {
+		return nil, nil, watchOnlyErr
 	}
-	if sum < targetAmount {
-		err = errors.New("not enough money")
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if spendable := w.Balance - w.reservedBalance() - w.lockedBalance(); totalAmount > spendable {
+		return nil, nil, fmt.Errorf("tried to create transaction for %d but only have %d", totalAmount, spendable)
+	}
+	var tx *Transaction
+	sender, selection, err := w.selectSender(w.coinSelector(opts), w.unreservedUtxos(), totalAmount)
+	if err == nil {
+		tx = newTxFromSelection(sender.Public(), selection, w.splitPolicy(opts), targets, opts)
 	} else {
-		for _, chosen := range previousTxOuts {
-			// TODO(ORF): Instead of removing them from the UTXOMap, add them to the reserved UTXOs map.
-			w.Utxos.Remove(chosen)
+		// combine the coins of several addresses, the change going to the primary one
+		if selection, err = w.selectJointInputs(w.coinSelector(opts), totalAmount); err != nil {
+			return nil, nil, err
 		}
-		w.Balance -= sum
+		tx = newJointTxFromSelection(w.PrivKey.Public(), selection, w.splitPolicy(opts), targets, opts)
 	}
-	return
+	w.reserve(tx)
+	return tx, selection, nil
 }
 
-func (w *Wallet) CreateTx(amount int, address *rsa.PublicKey) (*Transaction, error) {
-	log.Println("Creating transaction for amount:", amount)
-	if amount <= 0 {
-		return nil, fmt.Errorf("tried to create transaction for %d", amount)
+// Builds an unsigned transaction paying every target with some of the given utxos of sender.
+//
+// It needs no wallet, so that a transaction can be built and signed away from
+// the node holding the utxos, e.g. with a cold storage key.
+func BuildTx(sender PublicKey, utxos []*TxOut, opts *TxOptions, targets ...*TxTargetTy) (*Transaction, *CoinSelection, error) {
+	var totalAmount int
+	for _, target := range targets {
+		totalAmount += target.Amount
+	}
+	if totalAmount <= 0 {
+		return nil, nil, fmt.Errorf("tried to create transaction for %d", totalAmount)
 	}
-	if amount > w.Balance {
-		return nil, fmt.Errorf("tried to create transaction for %d but only have %d", amount, w.Balance)
+	address := AddressFromPubKey(sender)
+	var native []*TxOut
+	for _, utxo := range utxos {
+		if utxo.OwnerAddress() != address {
+			return nil, nil, fmt.Errorf("utxo %s is not owned by %s", utxo.Id, address)
+		}
+		// tokens are only spent by token transactions
+		if utxo.IsNative() {
+			native = append(native, utxo)
+		}
 	}
-	tx := NewTransaction(&w.PrivKey.PublicKey, amount)
-
-	sum, previousTxOuts, err := w.selectUTXOsLargestFirst(amount)
-	if err != nil {
-		return nil, err
+	selector, splitPolicy := DefaultCoinSelector, DefaultSplitPolicy
+	if opts != nil && opts.CoinSelector != nil {
+		selector = opts.CoinSelector
 	}
-	for _, txOut := range previousTxOuts {
-		tx.Inputs.Add(txOut)
+	if opts != nil && opts.SplitPolicy != nil {
+		splitPolicy = opts.SplitPolicy
 	}
-	splitedAmount := Splitter(amount)
-	for _, splAmount := range splitedAmount {
-		targetTxOut := NewTxOut(address, splAmount)
-		targetTxOut.ComputeAndFillHash()
-		tx.Outputs.Add(targetTxOut)
+	selection, err := selector.Select(native, totalAmount)
+	if err != nil {
+		return nil, nil, err
 	}
+	return newTxFromSelection(sender, selection, splitPolicy, targets, opts), selection, nil
+}
 
-	changeAmount := sum - amount
-	if changeAmount > 0 { // if change exists
-		splitChange := Splitter(changeAmount)
-		for _, change := range splitChange {
-			changeTxOut := NewTxOut(&w.PrivKey.PublicKey, change)
-			changeTxOut.ComputeAndFillHash()
-			tx.Outputs.Add(changeTxOut)
-		}
-
+func (opts *TxOptions) lockTime() int64 {
+	if opts == nil {
+		return 0
 	}
+	return opts.LockTime
+}
 
+func newTxFromSelection(sender PublicKey, selection *CoinSelection, splitPolicy SplitPolicy, targets []*TxTargetTy, opts *TxOptions) *Transaction {
+	tx := newTxToTargets(sender, splitPolicy, targets, opts)
+	log.Println("Selected inputs of", tx.Sender(), "with", selection)
+	tx.addSelection(selection, splitPolicy, func(amount int) *TxOut {
+		return NewTxOut(sender, amount)
+	})
 	tx.ComputeAndFillHash()
-	return tx, nil
+	return tx
 }
 
-type TxTargetTy struct {
-	Address *rsa.PublicKey
-	Amount  int
+// Like newTxFromSelection, for a transaction signed per input whose inputs may
+// belong to several owners. The change goes to changeTo.
+func newJointTxFromSelection(changeTo PublicKey, selection *CoinSelection, splitPolicy SplitPolicy, targets []*TxTargetTy, opts *TxOptions) *Transaction {
+	tx := newTxToTargets(nil, splitPolicy, targets, opts)
+	log.Println("Selected joint inputs with", selection)
+	tx.addSelection(selection, splitPolicy, func(amount int) *TxOut {
+		return NewTxOut(changeTo, amount)
+	})
+	tx.ComputeAndFillHash()
+	return tx
 }
 
-func (w *Wallet) CreateMultiTargetTx(targets ...*TxTargetTy) (*Transaction, error) {
+// Creates a transaction without inputs, paying every target
+func newTxToTargets(sender PublicKey, splitPolicy SplitPolicy, targets []*TxTargetTy, opts *TxOptions) *Transaction {
 	var totalAmount int
 	for _, target := range targets {
 		totalAmount += target.Amount
 	}
-	log.Println("Creating transaction for amount:", totalAmount, "and", len(targets), "targets")
-	if totalAmount <= 0 {
-		return nil, fmt.Errorf("tried to create transaction for %d", totalAmount)
-	}
-	if totalAmount > w.Balance {
-		return nil, fmt.Errorf("tried to create transaction for %d but only have %d", totalAmount, w.Balance)
-	}
-	tx := NewTransaction(&w.PrivKey.PublicKey, totalAmount)
-	sum, previousTxOuts, err := w.selectUTXOsLargestFirst(totalAmount)
-	if err != nil {
-		return nil, err
-	}
-	for _, txOut := range previousTxOuts {
-		tx.Inputs.Add(txOut)
+	tx := NewTransaction(sender, totalAmount)
+	tx.LockTime = opts.lockTime()
+	if opts != nil {
+		tx.Memo = opts.Memo
 	}
-	changeAmount := sum - totalAmount
 	for _, target := range targets {
-		amountSplited := Splitter(target.Amount)
+		amountSplited := splitPolicy.Split(target.Amount)
 		for _, amount := range amountSplited {
-			targetTxOut := NewTxOut(target.Address, amount)
+			targetTxOut := NewTxOutToAddress(target.Address, amount)
+			targetTxOut.LockTime = target.LockTime
+			targetTxOut.Asset = target.Asset
 			targetTxOut.ComputeAndFillHash()
 			tx.Outputs.Add(targetTxOut)
 		}
 	}
-	if changeAmount > 0 {
-		changeSplit := Splitter(changeAmount)
+	return tx
+}
+
+// Adds the inputs of selection to tx, paying the change to the outputs made by newChange
+func (tx *Transaction) addSelection(selection *CoinSelection, splitPolicy SplitPolicy, newChange func(amount int) *TxOut) {
+	for _, txOut := range selection.Inputs {
+		tx.Inputs.Add(txOut)
+	}
+	if changeAmount := selection.Change(); changeAmount > 0 {
+		changeSplit := splitPolicy.Split(changeAmount)
 		for _, change := range changeSplit {
-			changeTxOut := NewTxOut(&w.PrivKey.PublicKey, change)
+			changeTxOut := newChange(change)
 			changeTxOut.ComputeAndFillHash()
 			tx.Outputs.Add(changeTxOut)
 		}
 	}
-	tx.ComputeAndFillHash()
-	return tx, nil
 }
 
-func (w *Wallet) SignTx(tx *Transaction) error {
-	signature, err := rsa.SignPKCS1v15(rand.Reader, w.PrivKey, crypto.SHA256, tx.Id)
+// Signs tx with key, which must be the key of its sender.
+//
+// If tx is signed per input, key signs the inputs it owns instead.
+func SignTxWithKey(tx *Transaction, key PrivateKey) error {
+	if tx.SignsPerInput() {
+		_, err := tx.SignInputsWithKey(key)
+		return err
+	}
+	if AddressFromPubKey(key.Public()) != tx.Sender() {
+		return fmt.Errorf("key does not belong to sender %s", tx.Sender())
+	}
+	signature, err := key.Sign(tx.SigningHash())
 	if err != nil {
 		return err
 	}
@@ -293,13 +491,40 @@ func (w *Wallet) SignTx(tx *Transaction) error {
 	return nil
 }
 
-func (w *Wallet) CreateAndSignTx(amount int, address *rsa.PublicKey) (*Transaction, error) {
+func (w *Wallet) SignTx(tx *Transaction) error {
+	if w.IsWatchOnly() {
+		return watchOnlyErr
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if tx.SignsPerInput() {
+		for _, id := range tx.inputIds() {
+			owner := tx.Inputs[id].OwnerAddress()
+			key, ok := w.keys[owner]
+			if !ok {
+				return fmt.Errorf("wallet does not hold the key of %s", owner)
+			}
+			if err := tx.SignInput(id, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	key, ok := w.keys[tx.Sender()]
+	if !ok {
+		return fmt.Errorf("wallet does not hold the key of %s", tx.Sender())
+	}
+	return SignTxWithKey(tx, key)
+}
+
+func (w *Wallet) CreateAndSignTx(amount int, address Address) (*Transaction, error) {
 	tx, err := w.CreateTx(amount, address)
 	if err != nil {
 		return nil, err
 	}
 	err = w.SignTx(tx)
 	if err != nil {
+		w.ReleaseTx(HexEncodeByteSlice(tx.Id))
 		return nil, err
 	}
 	return tx, nil
@@ -312,7 +537,21 @@ func (w *Wallet) CreateAndSignMultiTargetTx(targets ...*TxTargetTy) (*Transactio
 	}
 	err = w.SignTx(tx)
 	if err != nil {
+		w.ReleaseTx(HexEncodeByteSlice(tx.Id))
 		return nil, err
 	}
 	return tx, nil
 }
+
+func (w *Wallet) CreateAndSignTxWithOptions(opts *TxOptions, targets ...*TxTargetTy) (*Transaction, *CoinSelection, error) {
+	tx, selection, err := w.CreateTxWithOptions(opts, targets...)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = w.SignTx(tx)
+	if err != nil {
+		w.ReleaseTx(HexEncodeByteSlice(tx.Id))
+		return nil, nil, err
+	}
+	return tx, selection, nil
+}
@@ -0,0 +1,55 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+)
+
+var watchOnlyErr = errors.New("wallet is watch-only, it holds no private key")
+
+// Creates a wallet following the utxos of address without holding its key.
+//
+// pubKey may be nil if only the address is known. The wallet refuses to
+// create or sign transactions.
+func NewWatchOnlyWallet(address Address, pubKey PublicKey) (*Wallet, error) {
+	if !address.IsValid() {
+		return nil, fmt.Errorf("invalid address %s", address)
+	}
+	if pubKey != nil && !address.IsOwnedBy(pubKey) {
+		return nil, fmt.Errorf("public key does not match address %s", address)
+	}
+	watched := NewWalletInfoForAddress(address)
+	watched.PubKey = pubKey
+	return &Wallet{
+		Utxos:    TxOutMap{},
+		Reserved: map[string]*Reservation{},
+		keys:     map[Address]PrivateKey{},
+		watched:  watched,
+		spent:    map[string]TxOutMap{},
+	}, nil
+}
+
+// Parses a watch-only target, given either as an address or as a PEM public key
+func ParseWatchTarget(s string) (Address, PublicKey, error) {
+	if address, err := ParseAddress(s); err == nil {
+		return address, nil, nil
+	}
+	pubKey, err := ParsePubKeyPem(s)
+	if err != nil || pubKey == nil {
+		return "", nil, errors.New("expected an address or a PEM public key")
+	}
+	return AddressFromPubKey(pubKey), pubKey, nil
+}
+
+func (w *Wallet) IsWatchOnly() bool {
+	return w.watched != nil
+}
+
+// Fails if the wallet is watch-only, before callers outside the package use
+// its private key
+func (w *Wallet) CheckCanSign() error {
+	if w.IsWatchOnly() {
+		return watchOnlyErr
+	}
+	return nil
+}
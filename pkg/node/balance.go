@@ -0,0 +1,80 @@
+package node
+
+import (
+	bck "github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+type BalanceBreakdown struct {
+	Address             bck.Address     `json:"address"`
+	WatchOnly           bool            `json:"watchOnly"` // the node does not hold the keys of the wallet
+	MinConfirmations    int             `json:"minConfirmations"`
+	Confirmed           int             `json:"confirmed"`           // utxos with at least MinConfirmations
+	UnconfirmedIncoming int             `json:"unconfirmedIncoming"` // paid to the wallet by pending transactions of others
+	UnconfirmedOutgoing int             `json:"unconfirmedOutgoing"` // paid to others by pending transactions of the wallet
+	Reserved            int             `json:"reserved"`            // utxos used by pending transactions of the wallet
+	Locked              int             `json:"locked"`              // utxos that cannot be spent before their lock time
+	Spendable           int             `json:"spendable"`           // confirmed utxos that are neither reserved nor locked
+	Tokens              []*TokenBalance `json:"tokens,omitempty"`    // holdings in every token, the amounts above are in native coins
+}
+
+// Number of confirmations of the transaction with the given id
+func (n *Node) txConfirmations(txId string) int {
+	e, ok := n.txIndex.Get(txId)
+	if !ok {
+		return 0
+	}
+	return confirmations(e, len(n.Chain))
+}
+
+// Computes the balances of w, only counting utxos with at least minConf confirmations
+func (n *Node) WalletBalance(w *bck.Wallet, minConf int) *BalanceBreakdown {
+	if minConf < 1 {
+		minConf = 1 // the wallet only holds utxos of applied blocks
+	}
+	address := w.Address()
+	balance := &BalanceBreakdown{
+		Address:          address,
+		WatchOnly:        w.IsWatchOnly(),
+		MinConfirmations: minConf,
+	}
+
+	unreserved, reserved := w.ListUtxos()
+	for _, utxo := range unreserved {
+		locked := w.IsLocked(utxo)
+		if locked {
+			balance.Locked += utxo.NativeAmount()
+		}
+		if n.txConfirmations(utxo.TransactionId) >= minConf {
+			balance.Confirmed += utxo.NativeAmount()
+			if !locked {
+				balance.Spendable += utxo.NativeAmount()
+			}
+		}
+	}
+	for _, utxo := range reserved {
+		balance.Reserved += utxo.NativeAmount()
+		if n.txConfirmations(utxo.TransactionId) >= minConf {
+			balance.Confirmed += utxo.NativeAmount()
+		}
+	}
+
+	for _, e := range n.txIndex.Entries() {
+		if e.Status != TxPending && e.Status != TxOrphaned {
+			continue
+		}
+		sentByUs := false
+		for _, owner := range e.Tx.Owners() {
+			sentByUs = sentByUs || w.Owns(owner)
+		}
+		for _, txOut := range e.Tx.Outputs {
+			toUs := w.Owns(txOut.OwnerAddress())
+			if sentByUs && !toUs {
+				balance.UnconfirmedOutgoing += txOut.NativeAmount()
+			} else if !sentByUs && toUs {
+				balance.UnconfirmedIncoming += txOut.NativeAmount()
+			}
+		}
+	}
+	balance.Tokens = n.TokenBalances(w)
+	return balance
+}
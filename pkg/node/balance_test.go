@@ -0,0 +1,74 @@
+package node
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+func TestWalletBalance(t *testing.T) {
+	balanceNode := NewNode(0, backend.DefaultKeyType, "localhost", "7086", "8096")
+	balanceNode.MakeBootstrap(5)
+	if err := balanceNode.ApplyBlock(backend.CreateGenesisBlock(5, balanceNode.Wallet.PrivKey.Public())); err != nil {
+		t.Fatal(err)
+	}
+	shop := backend.NewWallet(backend.DefaultKeyType)
+	balanceNode.Ring[shop.Address()] = NewNodeInfo(1, "localhost", "7087", shop.PrivKey.Public())
+	// mines the pending transactions of the node and applies the block
+	mine := func() {
+		block := backend.NewBlock(balanceNode.getLastBlock().CurrentHash)
+		block.Transactions = balanceNode.pendingTxs.DequeueMany(balanceNode.pendingTxs.Len())
+		for nonce := 0; !strings.HasPrefix(backend.HexEncodeByteSlice(block.CurrentHash), strings.Repeat("0", backend.Difficulty)); nonce++ {
+			block.Nonce = strconv.Itoa(nonce)
+			block.ComputeAndFillHash()
+		}
+		if err := balanceNode.ApplyBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tx, err := balanceNode.Wallet.CreateAndSignTx(100, shop.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := balanceNode.SubmitOwnTx(tx); err != nil {
+		t.Fatal(err)
+	}
+	t.Run("Balance with a pending payment", func(t *testing.T) {
+		balance := balanceNode.WalletBalance(balanceNode.Wallet, 1)
+		if balance.Confirmed != 500 || balance.Reserved != 500 || balance.Spendable != 0 || balance.UnconfirmedOutgoing != 100 {
+			t.Errorf("Expected 500 confirmed and reserved, 0 spendable and 100 outgoing, got %+v", balance)
+		}
+	})
+	t.Run("Balance after the payment is mined", func(t *testing.T) {
+		mine()
+		balance := balanceNode.WalletBalance(balanceNode.Wallet, 1)
+		if balance.Confirmed != 400 || balance.Spendable != 400 || balance.Reserved != 0 || balance.UnconfirmedOutgoing != 0 {
+			t.Errorf("Expected 400 confirmed and spendable, got %+v", balance)
+		}
+	})
+	t.Run("Balance with more confirmations", func(t *testing.T) {
+		if balance := balanceNode.WalletBalance(balanceNode.Wallet, 2); balance.Confirmed != 0 || balance.Spendable != 0 || balance.MinConfirmations != 2 {
+			t.Errorf("Expected the change of a single block to be unconfirmed, got %+v", balance)
+		}
+	})
+	t.Run("Balance with a pending incoming payment", func(t *testing.T) {
+		for _, txOut := range tx.Outputs {
+			if txOut.OwnerAddress() == shop.Address() {
+				shop.AddUtxo(txOut)
+			}
+		}
+		refund, err := shop.CreateAndSignTx(30, balanceNode.Wallet.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := balanceNode.AcceptTx(refund); err != nil {
+			t.Fatal(err)
+		}
+		if balance := balanceNode.WalletBalance(balanceNode.Wallet, 1); balance.UnconfirmedIncoming != 30 || balance.Confirmed != 400 {
+			t.Errorf("Expected 30 incoming besides the 400 confirmed, got %+v", balance)
+		}
+	})
+}
@@ -0,0 +1,439 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	bck "github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+// Payment channels between the nodes of the ring, see bck.Channel
+var (
+	DefaultChannelLifetime = int64(100) // blocks until the timeout of a new channel
+	// Blocks before the timeout at which the payee stops accepting updates and
+	// closes the channel, so that the closing transaction is mined in time
+	ChannelCloseMargin = int64(5)
+)
+
+type ChannelRole string
+
+const (
+	ChannelPayer ChannelRole = "payer"
+	ChannelPayee ChannelRole = "payee"
+)
+
+type ChannelStatus string
+
+const (
+	ChannelFunding ChannelStatus = "funding" // the funding transaction is not confirmed yet
+	ChannelOpen    ChannelStatus = "open"    // payments can flow off-chain
+	ChannelClosing ChannelStatus = "closing" // the closing or refund transaction is pending
+	ChannelClosed  ChannelStatus = "closed"  // the funding output is spent
+)
+
+type ChannelEntry struct {
+	Id          string        `json:"id"`
+	Channel     *bck.Channel  `json:"channel"`
+	Account     string        `json:"account"` // account of the node taking part in the channel
+	Role        ChannelRole   `json:"role"`
+	Status      ChannelStatus `json:"status"`
+	Paid        int           `json:"paid"`    // total paid to the payee by the latest update
+	Updates     int           `json:"updates"` // off-chain payments so far
+	ClosingTxId string        `json:"closingTxId,omitempty"`
+
+	mu     sync.Mutex         // serializes the payments of the payer
+	latest *bck.ChannelUpdate // kept by the payee, to close the channel with
+	opened time.Time
+}
+
+// Payment channels the accounts of the node take part in, either as payer or as payee.
+//
+// Thread-safe
+type Channels struct {
+	mu      sync.RWMutex
+	entries map[string]*ChannelEntry
+}
+
+func NewChannels() *Channels {
+	return &Channels{
+		entries: map[string]*ChannelEntry{},
+	}
+}
+
+func (cs *Channels) Add(account string, role ChannelRole, channel *bck.Channel) (*ChannelEntry, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	id := channel.Id()
+	if id == "" {
+		return nil, errors.New("channel is not funded")
+	}
+	if _, ok := cs.entries[id]; ok {
+		return nil, fmt.Errorf("channel %s already exists", id)
+	}
+	e := &ChannelEntry{
+		Id:      id,
+		Channel: channel,
+		Account: account,
+		Role:    role,
+		opened:  time.Now(),
+	}
+	cs.entries[id] = e
+	return e, nil
+}
+
+func (cs *Channels) get(id string) (*ChannelEntry, bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	e, ok := cs.entries[id]
+	return e, ok
+}
+
+// Returns the channels of account, or of every account if it is empty, oldest first
+func (cs *Channels) list(account string) []*ChannelEntry {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	entries := make([]*ChannelEntry, 0, len(cs.entries))
+	for _, e := range cs.entries {
+		if account == "" || e.Account == account {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].opened.Before(entries[j].opened) })
+	return entries
+}
+
+// Derives the status of e from the chain
+//
+// Must be called with the entry lock held
+func (n *Node) channelStatus(e *ChannelEntry) ChannelStatus {
+	if e.ClosingTxId != "" {
+		if closing, ok := n.txIndex.Get(e.ClosingTxId); ok {
+			switch closing.Status {
+			case TxConfirmed:
+				return ChannelClosed
+			case TxPending, TxOrphaned:
+				return ChannelClosing
+			}
+		}
+	}
+	channel := e.Channel
+	if funding, ok := n.txIndex.Get(channel.Funding.TransactionId); !ok || funding.Status != TxConfirmed {
+		return ChannelFunding
+	}
+	// closed by the other side, or by this node before a restart
+	if n.txIndex.PendingInputs().Contains(channel.Id()) {
+		return ChannelClosing
+	}
+	if _, unspent := n.fundingUtxo(channel); unspent {
+		return ChannelOpen
+	}
+	return ChannelClosed
+}
+
+// Returns the funding output of channel as found in the ledger, if it is unspent
+func (n *Node) fundingUtxo(channel *bck.Channel) (*bck.TxOut, bool) {
+	entry, ok := n.Ledger.Get(channel.Address())
+	if !ok {
+		return nil, false
+	}
+	utxo, ok := entry.WalletInfoSnapshot().Utxos[channel.Id()]
+	return utxo, ok
+}
+
+// Returns a copy of e with the given status
+//
+// Must be called with the entry lock held
+func (e *ChannelEntry) copyWithStatus(status ChannelStatus) *ChannelEntry {
+	return &ChannelEntry{
+		Id:          e.Id,
+		Channel:     e.Channel,
+		Account:     e.Account,
+		Role:        e.Role,
+		Status:      status,
+		Paid:        e.Paid,
+		Updates:     e.Updates,
+		ClosingTxId: e.ClosingTxId,
+	}
+}
+
+// Returns a copy of e, with its status as of now
+func (n *Node) channelSnapshot(e *ChannelEntry) *ChannelEntry {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.copyWithStatus(n.channelStatus(e))
+}
+
+func (n *Node) GetChannel(id string) (*ChannelEntry, bool) {
+	e, ok := n.Channels.get(id)
+	if !ok {
+		return nil, false
+	}
+	return n.channelSnapshot(e), true
+}
+
+// Returns the channels of account, or of every account if it is empty, oldest first
+func (n *Node) ListChannels(account string) []*ChannelEntry {
+	entries := n.Channels.list(account)
+	snapshots := make([]*ChannelEntry, 0, len(entries))
+	for _, e := range entries {
+		snapshots = append(snapshots, n.channelSnapshot(e))
+	}
+	return snapshots
+}
+
+// Opens a channel from account, the payer, to peer, the payee, holding
+// capacity until lifetime blocks from now.
+//
+// The peer learns of the channel before the funding transaction is submitted,
+// so that it can accept payments once the funding is confirmed.
+func (n *Node) OpenChannel(account string, peer *NodeInfo, capacity int, lifetime int64) (*ChannelEntry, error) {
+	w, ok := n.Accounts.Get(account)
+	if !ok {
+		return nil, fmt.Errorf("account %s not found", account)
+	}
+	if err := w.CheckCanSign(); err != nil {
+		return nil, err
+	}
+	if peer.Id == n.Id {
+		return nil, errors.New("a node cannot open a channel to itself")
+	}
+	if lifetime <= ChannelCloseMargin {
+		return nil, fmt.Errorf("a channel must last more than %d blocks", ChannelCloseMargin)
+	}
+	payee, ok := n.Ledger.PublicKey(peer.WalletInfoSnapshot().Address())
+	if !ok {
+		return nil, fmt.Errorf("the public key of node %d is not known", peer.Id)
+	}
+	height, _ := n.lockContext()
+	channel, err := bck.NewChannel(w.PrivKey.Public(), payee, capacity, int64(height)+lifetime)
+	if err != nil {
+		return nil, err
+	}
+	fundingTx, _, err := w.CreateAndSignTxWithOptions(&bck.TxOptions{SplitPolicy: bck.NoSplit{}}, &bck.TxTargetTy{
+		Address: channel.Address(),
+		Amount:  capacity,
+	})
+	if err != nil {
+		return nil, err
+	}
+	fundingTxId := bck.HexEncodeByteSlice(fundingTx.Id)
+	if err := channel.SetFunding(fundingTx); err != nil {
+		w.ReleaseTx(fundingTxId)
+		return nil, err
+	}
+	channelJson, err := json.Marshal(channel)
+	if err != nil {
+		w.ReleaseTx(fundingTxId)
+		return nil, err
+	}
+	if _, err := n.SendByteSlice(channelJson, peer.Hostname, peer.Port, openChannelEndpoint); err != nil {
+		w.ReleaseTx(fundingTxId)
+		return nil, fmt.Errorf("node %d refused the channel: %s", peer.Id, err)
+	}
+	if err := n.SubmitOwnTx(fundingTx); err != nil {
+		return nil, err
+	}
+	e, err := n.Channels.Add(account, ChannelPayer, channel)
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Opened channel", e.Id, "of", capacity, "to node", peer.Id)
+	return n.channelSnapshot(e), nil
+}
+
+// Registers a channel opened to the node by another member of the ring
+func (n *Node) AcceptChannel(channel *bck.Channel) error {
+	if channel.Funding == nil {
+		return errors.New("channel has no funding output")
+	}
+	if !bck.SameKey(channel.Payee, n.Wallet.PrivKey.Public()) {
+		return errors.New("channel is not paying this node")
+	}
+	if height, _ := n.lockContext(); channel.Timeout-ChannelCloseMargin <= int64(height) {
+		return fmt.Errorf("channel times out at height %d, too soon to accept payments", channel.Timeout)
+	}
+	if _, err := n.Channels.Add(DefaultAccount, ChannelPayee, channel); err != nil {
+		return err
+	}
+	log.Println("Accepted channel", channel.Id(), "of", channel.Capacity, "from", bck.AddressFromPubKey(channel.Payer))
+	return nil
+}
+
+// Pays amount off-chain through a channel the node is the payer of, by
+// sending the next update to the payee
+func (n *Node) PayChannel(id string, amount int) (*ChannelEntry, error) {
+	e, ok := n.Channels.get(id)
+	if !ok || e.Role != ChannelPayer {
+		return nil, fmt.Errorf("channel %s not found", id)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if status := n.channelStatus(e); status != ChannelOpen {
+		return nil, fmt.Errorf("channel %s is %s", id, status)
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("tried to pay %d", amount)
+	}
+	if paid := e.Paid + amount; paid > e.Channel.Capacity {
+		return nil, fmt.Errorf("channel has %d left, cannot pay %d", e.Channel.Capacity-e.Paid, amount)
+	}
+	w, ok := n.Accounts.Get(e.Account)
+	if !ok {
+		return nil, fmt.Errorf("account %s not found", e.Account)
+	}
+	if err := w.CheckCanSign(); err != nil {
+		return nil, err
+	}
+	update, err := e.Channel.NewUpdate(e.Paid+amount, w.PrivKey)
+	if err != nil {
+		return nil, err
+	}
+	peer, err := n.findRingMember(string(bck.AddressFromPubKey(e.Channel.Payee)))
+	if err != nil {
+		return nil, err
+	}
+	updateJson, err := json.Marshal(update)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := n.SendByteSlice(updateJson, peer.Hostname, peer.Port, channelUpdateEndpoint); err != nil {
+		return nil, fmt.Errorf("node %d refused the payment: %s", peer.Id, err)
+	}
+	e.Paid = update.Paid
+	e.Updates++
+	return e.copyWithStatus(ChannelOpen), nil
+}
+
+// Accepts the update of a channel the node is the payee of. Updates must pay
+// more than the previous ones, and only while the funding output is unspent.
+func (n *Node) AcceptChannelUpdate(update *bck.ChannelUpdate) error {
+	e, ok := n.Channels.get(update.ChannelId)
+	if !ok || e.Role != ChannelPayee {
+		return fmt.Errorf("channel %s not found", update.ChannelId)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if status := n.channelStatus(e); status != ChannelOpen {
+		return fmt.Errorf("channel %s is %s", e.Id, status)
+	}
+	if height, _ := n.lockContext(); e.Channel.Timeout-ChannelCloseMargin <= int64(height) {
+		return fmt.Errorf("channel %s is about to time out", e.Id)
+	}
+	if funding, ok := n.fundingUtxo(e.Channel); !ok || funding.Amount != e.Channel.Capacity || !funding.IsNative() {
+		return fmt.Errorf("the funding output of channel %s does not hold its capacity", e.Id)
+	}
+	if update.Paid <= e.Paid {
+		return fmt.Errorf("update pays %d in total, not more than the %d already paid", update.Paid, e.Paid)
+	}
+	if err := e.Channel.CheckUpdate(update); err != nil {
+		return err
+	}
+	e.latest = update
+	e.Paid = update.Paid
+	e.Updates++
+	return nil
+}
+
+// Settles a channel the node is the payee of on chain, with its latest update
+func (n *Node) CloseChannel(id string) (*bck.Transaction, error) {
+	e, ok := n.Channels.get(id)
+	if !ok || e.Role != ChannelPayee {
+		return nil, fmt.Errorf("channel %s not found", id)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if status := n.channelStatus(e); status != ChannelOpen {
+		return nil, fmt.Errorf("channel %s is %s", id, status)
+	}
+	if e.latest == nil {
+		return nil, fmt.Errorf("nothing was paid through channel %s, its payer gets refunded after the timeout", id)
+	}
+	tx, err := e.Channel.SignClose(e.latest, n.Wallet.PrivKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := n.SubmitOwnTx(tx); err != nil {
+		return nil, err
+	}
+	e.ClosingTxId = bck.HexEncodeByteSlice(tx.Id)
+	log.Println("Closing channel", id, "receiving", e.Paid)
+	return tx, nil
+}
+
+// Takes back the capacity of a channel the node is the payer of, once the
+// payee failed to close it before the timeout
+func (n *Node) RefundChannel(id string) (*bck.Transaction, error) {
+	e, ok := n.Channels.get(id)
+	if !ok || e.Role != ChannelPayer {
+		return nil, fmt.Errorf("channel %s not found", id)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if status := n.channelStatus(e); status != ChannelOpen {
+		return nil, fmt.Errorf("channel %s is %s", id, status)
+	}
+	if height, _ := n.lockContext(); int64(height) < e.Channel.Timeout {
+		return nil, fmt.Errorf("channel %s can only be refunded from height %d", id, e.Channel.Timeout)
+	}
+	w, ok := n.Accounts.Get(e.Account)
+	if !ok {
+		return nil, fmt.Errorf("account %s not found", e.Account)
+	}
+	if err := w.CheckCanSign(); err != nil {
+		return nil, err
+	}
+	tx, err := e.Channel.CreateRefundTx(w.PrivKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := n.SubmitOwnTx(tx); err != nil {
+		return nil, err
+	}
+	e.ClosingTxId = bck.HexEncodeByteSlice(tx.Id)
+	log.Println("Refunding channel", id)
+	return tx, nil
+}
+
+// Settles the open channels that are about to time out: the payee closes its
+// channels with the latest update, and the payer takes back the capacity of
+// the ones the payee did not close in time
+func (n *Node) settleExpiringChannels() {
+	height, _ := n.lockContext()
+	for _, e := range n.Channels.list("") {
+		switch {
+		case e.Role == ChannelPayee && int64(height) >= e.Channel.Timeout-ChannelCloseMargin:
+			e.mu.Lock()
+			closable := e.latest != nil && n.channelStatus(e) == ChannelOpen
+			e.mu.Unlock()
+			if closable {
+				if _, err := n.CloseChannel(e.Id); err != nil {
+					log.Println("Closing channel", e.Id, "failed:", err)
+				}
+			}
+		case e.Role == ChannelPayer && int64(height) >= e.Channel.Timeout:
+			e.mu.Lock()
+			refundable := n.channelStatus(e) == ChannelOpen
+			e.mu.Unlock()
+			if refundable {
+				if _, err := n.RefundChannel(e.Id); err != nil {
+					log.Println("Refunding channel", e.Id, "failed:", err)
+				}
+			}
+		}
+	}
+}
+
+// Settles the channels that are about to time out, see settleExpiringChannels
+//
+// Should be called as a goroutine
+func (n *Node) WatchChannels() {
+	ticker := time.NewTicker(time.Second * checkTxCountIntervalSeconds)
+	for range ticker.C {
+		n.settleExpiringChannels()
+	}
+}
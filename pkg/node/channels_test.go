@@ -0,0 +1,149 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+func TestPaymentChannel(t *testing.T) {
+	payerNode := newFundedTestNode(t, nil)
+	payeeNode := newTestPeer(t, 1, payerNode)
+	server := httptest.NewServer(payeeNode.setupNodeHandler())
+	defer server.Close()
+	hostname, port, _ := strings.Cut(strings.TrimPrefix(server.URL, "http://"), ":")
+	payerNode.addToRing(payeeNode.Wallet.Address(), NewNodeInfo(1, hostname, port, payeeNode.Wallet.PrivKey.Public()))
+	balance := payerNode.Wallet.Balance
+
+	// mines the pending transactions of from, and applies the block to both nodes
+	mine := func(from *Node) {
+		block := backend.NewBlock(from.getLastBlock().CurrentHash)
+		block.Transactions = from.pendingTxs.DequeueMany(from.pendingTxs.Len())
+		for nonce := 0; !strings.HasPrefix(backend.HexEncodeByteSlice(block.CurrentHash), strings.Repeat("0", backend.Difficulty)); nonce++ {
+			block.Nonce = strconv.Itoa(nonce)
+			block.ComputeAndFillHash()
+		}
+		jsBlock, err := json.Marshal(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range []*Node{payerNode, payeeNode} {
+			var copied backend.Block
+			if err := json.Unmarshal(jsBlock, &copied); err != nil {
+				t.Fatal(err)
+			}
+			if err := n.ApplyBlock(&copied); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	open := func(capacity int, lifetime int64) *ChannelEntry {
+		entry, err := payerNode.OpenChannel(DefaultAccount, payerNode.getNodeInfoById(1), capacity, lifetime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Status != ChannelFunding {
+			t.Errorf("Expected a new channel to be %s, it is %s", ChannelFunding, entry.Status)
+		}
+		mine(payerNode)
+		return entry
+	}
+
+	var channel *ChannelEntry
+	t.Run("Open a channel", func(t *testing.T) {
+		channel = open(100, DefaultChannelLifetime)
+		for _, n := range []*Node{payerNode, payeeNode} {
+			if e, ok := n.GetChannel(channel.Id); !ok || e.Status != ChannelOpen {
+				t.Errorf("Expected node %d to see channel %s open, got %+v", n.Id, channel.Id, e)
+			}
+		}
+		if payerNode.Wallet.Balance != balance-100 {
+			t.Errorf("Expected a balance of %d after funding the channel, got %d", balance-100, payerNode.Wallet.Balance)
+		}
+	})
+	t.Run("Pay through the channel", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			if _, err := payerNode.PayChannel(channel.Id, 3); err != nil {
+				t.Fatal(err)
+			}
+		}
+		e, _ := payeeNode.GetChannel(channel.Id)
+		if e.Paid != 30 || e.Updates != 10 {
+			t.Errorf("Expected the payee to hold 10 updates paying 30, got %d paying %d", e.Updates, e.Paid)
+		}
+		if payerNode.pendingTxs.Len() != 0 || payeeNode.pendingTxs.Len() != 0 {
+			t.Error("Expected the payments to stay off-chain")
+		}
+	})
+	t.Run("Pay more than the capacity", func(t *testing.T) {
+		if _, err := payerNode.PayChannel(channel.Id, 71); err == nil {
+			t.Error("Expected a payment over the capacity to fail")
+		}
+	})
+	t.Run("Update paying less than before", func(t *testing.T) {
+		payer, _ := payerNode.Channels.get(channel.Id)
+		update, err := payer.Channel.NewUpdate(10, payerNode.Wallet.PrivKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := payeeNode.AcceptChannelUpdate(update); err == nil {
+			t.Error("Expected the payee to refuse an update paying less than the latest one")
+		}
+	})
+	t.Run("Close the channel", func(t *testing.T) {
+		if _, err := payerNode.CloseChannel(channel.Id); err == nil {
+			t.Error("Expected the payer not to be able to close the channel")
+		}
+		if _, err := payeeNode.CloseChannel(channel.Id); err != nil {
+			t.Fatal(err)
+		}
+		mine(payeeNode)
+		for _, n := range []*Node{payerNode, payeeNode} {
+			if e, _ := n.GetChannel(channel.Id); e.Status != ChannelClosed {
+				t.Errorf("Expected node %d to see channel %s closed, it is %s", n.Id, channel.Id, e.Status)
+			}
+		}
+		if payerNode.Wallet.Balance != balance-30 || payeeNode.Wallet.Balance != 30 {
+			t.Errorf("Expected balances of %d and 30 after closing, got %d and %d", balance-30, payerNode.Wallet.Balance, payeeNode.Wallet.Balance)
+		}
+		if _, err := payerNode.PayChannel(channel.Id, 1); err == nil {
+			t.Error("Expected a payment through a closed channel to fail")
+		}
+	})
+	t.Run("Open a channel from a watch-only account", func(t *testing.T) {
+		watched := backend.NewWallet(backend.DefaultKeyType).PrivKey.Public()
+		watcher, err := backend.NewWatchOnlyWallet(backend.AddressFromPubKey(watched), watched)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := payerNode.Accounts.Add("watcher", watcher); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := payerNode.OpenChannel("watcher", payerNode.getNodeInfoById(1), 10, DefaultChannelLifetime); err == nil {
+			t.Error("Expected a watch-only account not to open a channel")
+		}
+	})
+	t.Run("Refund after the timeout", func(t *testing.T) {
+		expiring := open(20, ChannelCloseMargin+1)
+		if _, err := payerNode.RefundChannel(expiring.Id); err == nil {
+			t.Error("Expected a refund before the timeout to fail")
+		}
+		for height, _ := payerNode.lockContext(); int64(height) < expiring.Channel.Timeout; height, _ = payerNode.lockContext() {
+			mine(payerNode)
+		}
+		if _, err := payerNode.RefundChannel(expiring.Id); err != nil {
+			t.Fatal(err)
+		}
+		mine(payerNode)
+		if e, _ := payerNode.GetChannel(expiring.Id); e.Status != ChannelClosed {
+			t.Errorf("Expected the refunded channel to be closed, it is %s", e.Status)
+		}
+		if payerNode.Wallet.Balance != balance-30 {
+			t.Errorf("Expected a balance of %d after the refund, got %d", balance-30, payerNode.Wallet.Balance)
+		}
+	})
+}
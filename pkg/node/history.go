@@ -0,0 +1,184 @@
+package node
+
+import (
+	"sort"
+	"time"
+
+	bck "github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+type HistoryDirection string
+
+const (
+	HistoryIncoming HistoryDirection = "incoming"
+	HistoryOutgoing HistoryDirection = "outgoing"
+	HistorySelf     HistoryDirection = "self"
+)
+
+type Counterparty struct {
+	Address bck.Address `json:"address"`
+	NodeId  int         `json:"nodeId"` // -1 if the address does not belong to a node of the ring
+}
+
+// A transaction as seen from a wallet
+type HistoryEntry struct {
+	TxId           string           `json:"txId"`
+	Status         TxStatus         `json:"status"`
+	Direction      HistoryDirection `json:"direction"`
+	Counterparties []Counterparty   `json:"counterparties"`
+	Amount         int              `json:"amount"` // amount received, sent, or moved for self payments
+	Fee            int              `json:"fee"`
+	BlockHeight    int              `json:"blockHeight"`
+	Timestamp      time.Time        `json:"timestamp"`
+	Memo           string           `json:"memo,omitempty"` // decrypted, if it was sealed to the wallet
+}
+
+// Restricts the history to a time or height range, and paginates it.
+//
+// Zero values mean no restriction. Pending transactions have no height,
+// so they are excluded when a height range is given.
+type HistoryFilter struct {
+	Since      time.Time
+	Until      time.Time
+	FromHeight int
+	ToHeight   int
+	Offset     int
+	Limit      int
+}
+
+func (f *HistoryFilter) matches(e *HistoryEntry) bool {
+	if !f.Since.IsZero() && e.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Timestamp.After(f.Until) {
+		return false
+	}
+	if (f.FromHeight > 0 || f.ToHeight > 0) && e.BlockHeight < 0 {
+		return false
+	}
+	if f.FromHeight > 0 && e.BlockHeight < f.FromHeight {
+		return false
+	}
+	if f.ToHeight > 0 && e.BlockHeight > f.ToHeight {
+		return false
+	}
+	return true
+}
+
+func (n *Node) counterparty(address bck.Address) Counterparty {
+	c := Counterparty{Address: address, NodeId: -1}
+	if nInfo, ok := n.Ring[address]; ok {
+		c.NodeId = nInfo.Id
+	}
+	return c
+}
+
+// The wallet whose history is built
+type historyWallet interface {
+	// Tells whether an address belongs to the wallet
+	Owns(bck.Address) bool
+	// Decrypts the memo of a transaction sealed to the wallet
+	OpenMemo(*bck.Transaction) (string, error)
+}
+
+// Describes e from the point of view of the wallet. Returns nil if the transaction does not touch it.
+func (n *Node) historyEntry(e *TxIndexEntry, wallet historyWallet) *HistoryEntry {
+	tx := e.Tx
+	owns := wallet.Owns
+	var inSum, ourInSum, outSum, received, sentToOthers int
+	for _, txIn := range tx.Inputs {
+		inSum += txIn.NativeAmount()
+		if owns(tx.InputOwner(txIn)) {
+			ourInSum += txIn.NativeAmount()
+		}
+	}
+	others := make(addressSet)
+	var counterparties []Counterparty
+	for _, txOut := range tx.Outputs {
+		outSum += txOut.NativeAmount()
+		if owner := txOut.OwnerAddress(); owns(owner) {
+			received += txOut.NativeAmount()
+		} else {
+			sentToOthers += txOut.NativeAmount()
+			if !others.Contains(owner) {
+				others.Add(owner)
+				counterparties = append(counterparties, n.counterparty(owner))
+			}
+		}
+	}
+
+	entry := &HistoryEntry{
+		TxId:        bck.HexEncodeByteSlice(tx.Id),
+		Status:      e.Status,
+		BlockHeight: e.BlockHeight,
+		Timestamp:   e.Timestamp,
+	}
+	if !tx.IsGenesis() {
+		entry.Fee = inSum - outSum
+	}
+	var sentByUs, sentByOthers bool
+	var senders []Counterparty
+	for _, owner := range tx.Owners() {
+		if owns(owner) {
+			sentByUs = true
+		} else {
+			sentByOthers = true
+			senders = append(senders, n.counterparty(owner))
+		}
+	}
+	// in a transaction joining the coins of several owners, we only pay our share
+	if sentByUs && sentByOthers && sentToOthers > ourInSum-received {
+		sentToOthers = ourInSum - received
+	}
+	switch {
+	case sentByUs && sentToOthers > 0:
+		entry.Direction = HistoryOutgoing
+		entry.Amount = sentToOthers
+		entry.Counterparties = counterparties
+	case sentByUs:
+		entry.Direction = HistorySelf
+		entry.Amount = received
+	case received > 0:
+		entry.Direction = HistoryIncoming
+		entry.Amount = received
+		entry.Counterparties = senders
+	default:
+		return nil
+	}
+	if received > 0 {
+		if memo, err := wallet.OpenMemo(tx); err == nil {
+			entry.Memo = memo
+		}
+	}
+	return entry
+}
+
+// Lists the confirmed and pending transactions that touch the addresses of
+// the wallet, newest first.
+//
+// Returns the requested page and the total number of matching transactions.
+func (n *Node) WalletHistory(wallet historyWallet, filter *HistoryFilter) ([]*HistoryEntry, int) {
+	var history []*HistoryEntry
+	for _, e := range n.txIndex.Entries() {
+		if e.Status == TxDropped || e.Status == TxReplaced {
+			continue
+		}
+		entry := n.historyEntry(&e, wallet)
+		if entry != nil && filter.matches(entry) {
+			history = append(history, entry)
+		}
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Timestamp.After(history[j].Timestamp)
+	})
+
+	total := len(history)
+	if filter.Offset >= total {
+		return []*HistoryEntry{}, total
+	}
+	history = history[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(history) {
+		history = history[:filter.Limit]
+	}
+	return history, total
+}
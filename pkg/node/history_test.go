@@ -0,0 +1,100 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+func TestWalletHistory(t *testing.T) {
+	historyNode := newFundedTestNode(t, nil)
+	shop := backend.NewWallet(backend.DefaultKeyType)
+	if err := historyNode.Accounts.Add("shop", shop); err != nil {
+		t.Fatal(err)
+	}
+
+	// a payment to the shop at height 2, a consolidation at height 3, and a
+	// pending payment replaced with a fee
+	payment, err := historyNode.Wallet.CreateAndSignTx(100, shop.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := historyNode.SubmitOwnTx(payment); err != nil {
+		t.Fatal(err)
+	}
+	mineTestBlock(t, historyNode)
+	if _, _, err := historyNode.Consolidate(historyNode.Wallet, 50, 0); err != nil {
+		t.Fatal(err)
+	}
+	mineTestBlock(t, historyNode)
+	original, err := historyNode.Wallet.CreateAndSignTx(10, shop.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := historyNode.SubmitOwnTx(original); err != nil {
+		t.Fatal(err)
+	}
+	replacement, err := historyNode.Wallet.CreateAndSignReplacementTx(original, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := historyNode.SubmitOwnTx(replacement); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Directions and fees", func(t *testing.T) {
+		entries, total := historyNode.WalletHistory(historyNode.Wallet, &HistoryFilter{})
+		if total != 4 || len(entries) != 4 {
+			t.Fatalf("Expected 4 entries without the replaced transaction, got %d", total)
+		}
+		expected := []struct {
+			direction HistoryDirection
+			status    TxStatus
+			amount    int
+			fee       int
+		}{
+			{HistoryOutgoing, TxPending, 10, 5},
+			{HistorySelf, TxConfirmed, 400, 0},
+			{HistoryOutgoing, TxConfirmed, 100, 0},
+			{HistoryIncoming, TxConfirmed, 500, 0},
+		}
+		for i, e := range entries {
+			if e.Direction != expected[i].direction || e.Status != expected[i].status || e.Amount != expected[i].amount || e.Fee != expected[i].fee {
+				t.Errorf("Expected entry %d to be %+v, got %+v", i, expected[i], e)
+			}
+		}
+		if counterparties := entries[2].Counterparties; len(counterparties) != 1 || counterparties[0].Address != shop.Address() {
+			t.Errorf("Expected the shop to be the counterparty of the payment, got %+v", counterparties)
+		}
+		shopEntries, shopTotal := historyNode.WalletHistory(shop, &HistoryFilter{})
+		if shopTotal != 2 || shopEntries[1].Direction != HistoryIncoming || shopEntries[1].Amount != 100 {
+			t.Errorf("Expected the shop to see 2 incoming payments, got %+v", shopEntries)
+		}
+	})
+	t.Run("Paginate the history", func(t *testing.T) {
+		entries, total := historyNode.WalletHistory(historyNode.Wallet, &HistoryFilter{Offset: 1, Limit: 2})
+		if total != 4 || len(entries) != 2 || entries[0].Direction != HistorySelf {
+			t.Errorf("Expected the second and third of 4 entries, got %d of %d", len(entries), total)
+		}
+		if entries, total := historyNode.WalletHistory(historyNode.Wallet, &HistoryFilter{Offset: 10}); total != 4 || len(entries) != 0 {
+			t.Errorf("Expected no entries past the end, got %d of %d", len(entries), total)
+		}
+	})
+	t.Run("Filter the history", func(t *testing.T) {
+		entries, total := historyNode.WalletHistory(historyNode.Wallet, &HistoryFilter{FromHeight: 2, ToHeight: 2})
+		if total != 1 || entries[0].TxId != backend.HexEncodeByteSlice(payment.Id) {
+			t.Errorf("Expected only the payment at height 2, got %+v", entries)
+		}
+		since := historyNode.Chain[2].Timestamp
+		if _, total := historyNode.WalletHistory(historyNode.Wallet, &HistoryFilter{Since: since}); total != 2 {
+			t.Errorf("Expected the consolidation and the pending payment since %s, got %d entries", since, total)
+		}
+	})
+	t.Run("Rebuild the index from the chain", func(t *testing.T) {
+		historyNode.txIndex = NewTxIndex()
+		historyNode.syncWithChain()
+		if entries, total := historyNode.WalletHistory(historyNode.Wallet, &HistoryFilter{}); total != 3 || entries[0].Status != TxConfirmed {
+			t.Errorf("Expected the 3 confirmed entries back, got %d", total)
+		}
+	})
+}
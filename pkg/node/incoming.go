@@ -20,6 +20,8 @@ const (
 	bootstrapNodeEndpoint = endpointTy("/bootstrap-node")
 	chainLengthEndpoint   = endpointTy("/chain-length")
 	chainTailEndpoint     = endpointTy("/chain-tail/{length}")
+	openChannelEndpoint   = endpointTy("/channels/open")
+	channelUpdateEndpoint = endpointTy("/channels/update")
 )
 
 func (n *Node) setupNodeHandler() *mux.Router {
@@ -34,6 +36,10 @@ func (n *Node) setupNodeHandler() *mux.Router {
 	r.HandleFunc(string(chainLengthEndpoint), n.createChainLengthHandler()).Methods("POST")
 	// Replies with the current chain tail
 	r.HandleFunc(string(chainTailEndpoint), n.createChainTailHandler()).Methods("POST")
+	// Accepts a payment channel opened to this node
+	r.HandleFunc(string(openChannelEndpoint), n.createOpenChannelHandler()).Methods("POST")
+	// Accepts an off-chain payment through a channel opened to this node
+	r.HandleFunc(string(channelUpdateEndpoint), n.createChannelUpdateHandler()).Methods("POST")
 
 	if n.IsBootstrap() { // only bootstrap node can register new nodes
 		r.HandleFunc(string(bootstrapNodeEndpoint), n.createBootstrapNodeHandler()).Methods("POST")
@@ -78,18 +84,20 @@ func (n *Node) createAcceptNodesHandler() http.HandlerFunc {
 		}
 		regCnt := 0
 		for _, currNode := range nodes {
-			if _, ok := n.Ring[currNode.PubKey]; ok {
+			pubKey := bck.PubKeyFromPem(currNode.PubKey)
+			address := bck.AddressFromPubKey(pubKey)
+			if _, ok := n.Ring[address]; ok {
 				log.Println("Incoming node pubkey is already registered:", currNode.Id)
 				continue
 			}
 			// add it to the ring
-			log.Println("Adding node with id:", currNode.Id, "to ring")
-			n.Ring[currNode.PubKey] = NewNodeInfo(
+			log.Println("Adding node with id:", currNode.Id, "and address:", address, "to ring")
+			n.addToRing(address, NewNodeInfo(
 				currNode.Id,
 				currNode.Hostname,
 				currNode.Port,
-				bck.PubKeyFromPem(currNode.PubKey),
-			)
+				pubKey,
+			))
 			regCnt++
 		}
 		fmt.Fprintf(w, "Registered %d node(s)", regCnt)
@@ -166,6 +174,40 @@ func (n *Node) createChainTailHandler() http.HandlerFunc {
 	}
 }
 
+func (n *Node) createOpenChannelHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var channel bck.Channel
+		if err := json.NewDecoder(r.Body).Decode(&channel); err != nil {
+			errMsg := fmt.Sprintf("Body could not be desirialized: %s", err.Error())
+			http.Error(w, errMsg, http.StatusBadRequest)
+			return
+		}
+		if err := n.AcceptChannel(&channel); err != nil {
+			log.Println("Error accepting channel:", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "Accepted channel %s", channel.Id())
+	}
+}
+
+func (n *Node) createChannelUpdateHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var update bck.ChannelUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			errMsg := fmt.Sprintf("Body could not be desirialized: %s", err.Error())
+			http.Error(w, errMsg, http.StatusBadRequest)
+			return
+		}
+		if err := n.AcceptChannelUpdate(&update); err != nil {
+			log.Println("Error accepting channel update:", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "Accepted %d in total through channel %s", update.Paid, update.ChannelId)
+	}
+}
+
 type bootstrapNodeTy struct {
 	Hostname string `json:"hostname"`
 	Port     string `json:"port"`
@@ -186,14 +228,16 @@ func (n *Node) createBootstrapNodeHandler() http.HandlerFunc {
 			http.Error(w, errMsg, http.StatusBadRequest)
 			return
 		}
+		pubKey := bck.PubKeyFromPem(node.PubKey)
+		address := bck.AddressFromPubKey(pubKey)
 		n.BsNextNodeId.Mu.Lock()
-		log.Println("Bootstraping node with id:", n.BsNextNodeId.Value)
-		n.Ring[node.PubKey] = NewNodeInfo(
+		log.Println("Bootstraping node with id:", n.BsNextNodeId.Value, "and address:", address)
+		n.addToRing(address, NewNodeInfo(
 			n.BsNextNodeId.Value,
 			node.Hostname,
 			node.Port,
-			bck.PubKeyFromPem(node.PubKey),
-		)
+			pubKey,
+		))
 		n.BsNextNodeId.Value++
 		n.BsNextNodeId.Mu.Unlock()
 
@@ -202,7 +246,7 @@ func (n *Node) createBootstrapNodeHandler() http.HandlerFunc {
 			go n.DoInitialBootstrapActions()
 		}
 
-		fmt.Fprintf(w, "%d", n.Ring[node.PubKey].Id)
+		fmt.Fprintf(w, "%d", n.Ring[address].Id)
 	}
 
 }
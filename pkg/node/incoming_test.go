@@ -24,7 +24,7 @@ func TestAcceptNodesHandler(t *testing.T) {
 			{
 				Hostname: "localhost",
 				Port:     "8080",
-				PubKey:   backend.PubKeyToPem(&privateKey.PublicKey),
+				PubKey:   backend.PubKeyToPem(backend.NewRSAPublicKey(&privateKey.PublicKey)),
 				Id:       1,
 			},
 		})
@@ -67,6 +67,37 @@ func TestSubmitBlocksHandler(t *testing.T) {
 	})
 }
 
+func TestGenesisBlock(t *testing.T) {
+	attacker := backend.NewWallet(backend.DefaultKeyType)
+
+	t.Run("Genesis block after the first block", func(t *testing.T) {
+		genesisNode := newFundedTestNode(t, nil)
+		if err := genesisNode.ApplyBlock(backend.CreateGenesisBlock(5, attacker.PrivKey.Public())); err != genesisErr {
+			t.Errorf("Expected error %v, got %v", genesisErr, err)
+		}
+		if len(genesisNode.Chain) != 1 {
+			t.Errorf("Expected a chain of 1 block, got %d", len(genesisNode.Chain))
+		}
+		if e, _ := genesisNode.Ledger.Get(attacker.Address()); e != nil {
+			t.Errorf("Expected the attacker never to be paid, it has %d", e.WInfo.Balance)
+		}
+	})
+	t.Run("Genesis block paying a token", func(t *testing.T) {
+		emptyNode := NewNode(1, backend.DefaultKeyType, "localhost", strconv.Itoa(7070+nextTestNodePort), strconv.Itoa(8080+nextTestNodePort))
+		nextTestNodePort++
+		genesis := backend.CreateGenesisBlock(5, attacker.PrivKey.Public())
+		for _, txOut := range genesis.Transactions[0].Outputs {
+			txOut.Asset = "30be7dcf420f7d1c479f01f15d29bc66"
+		}
+		if err := emptyNode.ApplyBlock(genesis); err == nil {
+			t.Error("Expected a genesis block paying a token to be refused")
+		}
+		if len(emptyNode.Chain) != 0 {
+			t.Errorf("Expected an empty chain, got %d block(s)", len(emptyNode.Chain))
+		}
+	})
+}
+
 func TestBootstrapNodeHandler(t *testing.T) {
 	t.Run("Bootstrap a single node", func(t *testing.T) {
 		privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
@@ -76,7 +107,7 @@ func TestBootstrapNodeHandler(t *testing.T) {
 		jsNode, err := json.Marshal(&bootstrapNodeTy{
 			Hostname: "localhost",
 			Port:     "7070",
-			PubKey:   backend.PubKeyToPem(&privateKey.PublicKey),
+			PubKey:   backend.PubKeyToPem(backend.NewRSAPublicKey(&privateKey.PublicKey)),
 		})
 		if err != nil {
 			t.Error(err)
@@ -100,7 +131,7 @@ func TestBootstrapNodeHandler(t *testing.T) {
 
 func TestSubmitTxsHandler(t *testing.T) {
 	t.Run("Send a single transaction", func(t *testing.T) {
-		newTx, err := testNode.Wallet.CreateTx(1, &testNode.Wallet.PrivKey.PublicKey)
+		newTx, err := testNode.Wallet.CreateTx(1, testNode.Wallet.Address())
 		if err != nil {
 			log.Fatalln(err)
 		}
@@ -121,4 +152,21 @@ func TestSubmitTxsHandler(t *testing.T) {
 			t.Errorf("Expected body %s, got %s", "Accepted 1 transaction(s)", w.Body.String())
 		}
 	})
+	t.Run("Send a genesis transaction", func(t *testing.T) {
+		attacker := backend.NewWallet(backend.DefaultKeyType)
+		jsTx, err := json.Marshal([]*backend.Transaction{backend.NewGenesisTransaction(attacker.PrivKey.Public(), 1000)})
+		if err != nil {
+			log.Fatalln(err)
+		}
+		pending := testNode.pendingTxs.Len()
+		req := httptest.NewRequest("POST", "/submit-txs", bytes.NewReader(jsTx))
+		w := httptest.NewRecorder()
+		testNode.setupNodeHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+		}
+		if testNode.pendingTxs.Len() != pending {
+			t.Error("Expected the genesis transaction not to be pending")
+		}
+	})
 }
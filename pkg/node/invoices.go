@@ -0,0 +1,208 @@
+package node
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	bck "github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+type InvoiceStatus string
+
+const (
+	InvoiceOpen      InvoiceStatus = "open"      // waiting to be paid
+	InvoicePaid      InvoiceStatus = "paid"      // paid in full by confirmed transactions
+	InvoiceUnderpaid InvoiceStatus = "underpaid" // paid in part by confirmed transactions
+	InvoiceExpired   InvoiceStatus = "expired"   // expired before any payment was confirmed
+)
+
+// A confirmed transaction paying an invoice
+type InvoicePayment struct {
+	TxId        string `json:"txId"`
+	Amount      int    `json:"amount"`
+	BlockHeight int    `json:"blockHeight"`
+}
+
+type InvoiceEntry struct {
+	Invoice  *bck.Invoice     `json:"invoice"`
+	Encoded  string           `json:"encoded"`
+	Account  string           `json:"account"`
+	Status   InvoiceStatus    `json:"status"`
+	Received int              `json:"received"`
+	Payments []InvoicePayment `json:"payments"`
+
+	created time.Time
+}
+
+func (e *InvoiceEntry) statusAt(now time.Time) InvoiceStatus {
+	switch {
+	case e.Received >= e.Invoice.Amount:
+		return InvoicePaid
+	case e.Received > 0:
+		return InvoiceUnderpaid
+	case e.Invoice.IsExpired(now):
+		return InvoiceExpired
+	}
+	return InvoiceOpen
+}
+
+// Returns a copy of the entry, with its status as of now
+func (e *InvoiceEntry) snapshot(now time.Time) InvoiceEntry {
+	s := *e
+	s.Status = e.statusAt(now)
+	s.Payments = append([]InvoicePayment{}, e.Payments...)
+	return s
+}
+
+// Invoices created by the accounts of the node, settled by the blocks
+// applied to the chain.
+//
+// A payment counts towards an invoice if its transaction pays the invoice
+// address in a block timestamped before the expiry, and does not spend coins
+// of that address, whose change would otherwise count. When several invoices
+// share an address, the oldest one that is not paid yet is credited.
+//
+// Thread-safe
+type Invoices struct {
+	mu      sync.RWMutex
+	entries map[string]*InvoiceEntry
+}
+
+func NewInvoices() *Invoices {
+	return &Invoices{
+		entries: map[string]*InvoiceEntry{},
+	}
+}
+
+func (iv *Invoices) Add(account string, invoice *bck.Invoice) InvoiceEntry {
+	iv.mu.Lock()
+	defer iv.mu.Unlock()
+	e := &InvoiceEntry{
+		Invoice:  invoice,
+		Encoded:  invoice.Encode(),
+		Account:  account,
+		Payments: []InvoicePayment{},
+		created:  time.Now(),
+	}
+	iv.entries[invoice.Id] = e
+	return e.snapshot(e.created)
+}
+
+func (iv *Invoices) Get(id string) (InvoiceEntry, bool) {
+	iv.mu.RLock()
+	defer iv.mu.RUnlock()
+	e, ok := iv.entries[id]
+	if !ok {
+		return InvoiceEntry{}, false
+	}
+	return e.snapshot(time.Now()), true
+}
+
+// Returns the invoices of account, or of every account if it is empty, oldest first
+func (iv *Invoices) List(account string) []InvoiceEntry {
+	iv.mu.RLock()
+	defer iv.mu.RUnlock()
+	now := time.Now()
+	entries := make([]InvoiceEntry, 0, len(iv.entries))
+	for _, e := range iv.entries {
+		if account == "" || e.Account == account {
+			entries = append(entries, e.snapshot(now))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].created.Before(entries[j].created) })
+	return entries
+}
+
+// Returns the invoice a payment to address at the given time goes to
+//
+// Must be called with the invoices lock held
+func (iv *Invoices) payable(address bck.Address, at time.Time) *InvoiceEntry {
+	var oldest *InvoiceEntry
+	for _, e := range iv.entries {
+		if e.Invoice.Address != address || e.Invoice.IsExpired(at) || e.Received >= e.Invoice.Amount {
+			continue
+		}
+		if oldest == nil || e.created.Before(oldest.created) {
+			oldest = e
+		}
+	}
+	return oldest
+}
+
+// Credits the invoices paid by the transactions of an applied block
+func (iv *Invoices) Settle(block *bck.Block) {
+	iv.mu.Lock()
+	defer iv.mu.Unlock()
+	if len(iv.entries) == 0 {
+		return
+	}
+	for _, tx := range block.Transactions {
+		// change going back to an owner of the inputs pays nothing
+		owners := map[bck.Address]bool{}
+		for _, owner := range tx.Owners() {
+			owners[owner] = true
+		}
+		paid := map[bck.Address]int{}
+		for _, txOut := range tx.Outputs {
+			if address := txOut.OwnerAddress(); !owners[address] {
+				paid[address] += txOut.NativeAmount()
+			}
+		}
+		for address, amount := range paid {
+			e := iv.payable(address, block.Timestamp)
+			if e == nil {
+				continue
+			}
+			e.Received += amount
+			e.Payments = append(e.Payments, InvoicePayment{
+				TxId:        bck.HexEncodeByteSlice(tx.Id),
+				Amount:      amount,
+				BlockHeight: block.Index,
+			})
+		}
+	}
+}
+
+// Takes back the payments of the transactions of a reverted block
+func (iv *Invoices) Unsettle(block *bck.Block) {
+	iv.mu.Lock()
+	defer iv.mu.Unlock()
+	reverted := map[string]bool{}
+	for _, tx := range block.Transactions {
+		reverted[bck.HexEncodeByteSlice(tx.Id)] = true
+	}
+	for _, e := range iv.entries {
+		kept := e.Payments[:0]
+		for _, payment := range e.Payments {
+			if reverted[payment.TxId] {
+				e.Received -= payment.Amount
+			} else {
+				kept = append(kept, payment)
+			}
+		}
+		e.Payments = kept
+	}
+}
+
+// Creates an invoice of the account, paid to a fresh address if its wallet is
+// HD and to its address otherwise
+func (n *Node) CreateInvoice(account string, amount int, expiry time.Time, description string) (InvoiceEntry, error) {
+	wallet, ok := n.Accounts.Get(account)
+	if !ok {
+		return InvoiceEntry{}, fmt.Errorf("account %s not found", account)
+	}
+	address := wallet.Address()
+	if wallet.IsHD() {
+		var err error
+		if address, err = wallet.NewAddress(); err != nil {
+			return InvoiceEntry{}, err
+		}
+	}
+	invoice, err := bck.NewInvoice(address, amount, expiry, description)
+	if err != nil {
+		return InvoiceEntry{}, err
+	}
+	return n.Invoices.Add(account, invoice), nil
+}
@@ -0,0 +1,124 @@
+package node
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+func TestInvoices(t *testing.T) {
+	invoiceNode := newFundedTestNode(t, nil)
+	shop := backend.NewWallet(backend.DefaultKeyType)
+	if err := invoiceNode.Accounts.Add("shop", shop); err != nil {
+		t.Fatal(err)
+	}
+	status := func(id string) InvoiceEntry {
+		entry, ok := invoiceNode.Invoices.Get(id)
+		if !ok {
+			t.Fatalf("Invoice %s not found", id)
+		}
+		return entry
+	}
+	// mines a block with tx and applies it
+	mine := func(tx *backend.Transaction) {
+		block := backend.NewBlock(invoiceNode.getLastBlock().CurrentHash)
+		block.Transactions = append(block.Transactions, tx)
+		for nonce := 0; !strings.HasPrefix(backend.HexEncodeByteSlice(block.CurrentHash), strings.Repeat("0", backend.Difficulty)); nonce++ {
+			block.Nonce = strconv.Itoa(nonce)
+			block.ComputeAndFillHash()
+		}
+		if err := invoiceNode.ApplyBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// mines a block paying address and applies it
+	pay := func(address backend.Address, amount int) {
+		tx, err := invoiceNode.Wallet.CreateAndSignTx(amount, address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mine(tx)
+	}
+
+	var invoice InvoiceEntry
+	t.Run("Create an invoice", func(t *testing.T) {
+		var err error
+		invoice, err = invoiceNode.CreateInvoice("shop", 100, time.Now().Add(time.Hour), "2 coffees")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if invoice.Status != InvoiceOpen || invoice.Invoice.Address != shop.Address() {
+			t.Errorf("Expected an open invoice paid to %s, got %s to %s", shop.Address(), invoice.Status, invoice.Invoice.Address)
+		}
+		parsed, err := backend.ParseInvoice(invoice.Encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Id != invoice.Invoice.Id || parsed.Amount != 100 || !parsed.Expiry.Equal(invoice.Invoice.Expiry) || parsed.Description != "2 coffees" {
+			t.Errorf("Expected %s to decode to %+v, got %+v", invoice.Encoded, invoice.Invoice, parsed)
+		}
+	})
+	t.Run("Partial payment", func(t *testing.T) {
+		pay(shop.Address(), 40)
+		if e := status(invoice.Invoice.Id); e.Status != InvoiceUnderpaid || e.Received != 40 {
+			t.Errorf("Expected the invoice underpaid with 40 received, got %s with %d", e.Status, e.Received)
+		}
+	})
+	t.Run("Full payment", func(t *testing.T) {
+		pay(shop.Address(), 60)
+		e := status(invoice.Invoice.Id)
+		if e.Status != InvoicePaid || e.Received != 100 || len(e.Payments) != 2 {
+			t.Errorf("Expected the invoice paid by 2 payments, got %s with %d payment(s)", e.Status, len(e.Payments))
+		}
+	})
+	t.Run("Payment of a reverted block", func(t *testing.T) {
+		if err := invoiceNode.RevertBlock(); err != nil {
+			t.Fatal(err)
+		}
+		if e := status(invoice.Invoice.Id); e.Status != InvoiceUnderpaid || e.Received != 40 {
+			t.Errorf("Expected the invoice underpaid with 40 received, got %s with %d", e.Status, e.Received)
+		}
+	})
+	t.Run("Change of a spend by the invoice address", func(t *testing.T) {
+		if shop.Balance != 40 {
+			t.Fatalf("Expected the shop to hold the 40 received, got %d", shop.Balance)
+		}
+		tx, err := shop.CreateAndSignTx(10, backend.NewWallet(backend.DefaultKeyType).Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		change := 0
+		for _, txOut := range tx.Outputs {
+			if txOut.OwnerAddress() == shop.Address() {
+				change += txOut.Amount
+			}
+		}
+		if change == 0 {
+			t.Fatal("Expected change back to the shop")
+		}
+		mine(tx)
+		if e := status(invoice.Invoice.Id); e.Status != InvoiceUnderpaid || e.Received != 40 {
+			t.Errorf("Expected the change not to pay the invoice, got %s with %d", e.Status, e.Received)
+		}
+	})
+	t.Run("Expired invoice", func(t *testing.T) {
+		address := backend.NewWallet(backend.DefaultKeyType).Address()
+		expired, err := backend.NewInvoice(address, 10, time.Now().Add(-time.Minute), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		invoiceNode.Invoices.Add(DefaultAccount, expired)
+		pay(address, 10)
+		if e := status(expired.Id); e.Status != InvoiceExpired || e.Received != 0 {
+			t.Errorf("Expected the invoice expired with nothing received, got %s with %d", e.Status, e.Received)
+		}
+	})
+	t.Run("Unknown invoice", func(t *testing.T) {
+		if _, ok := invoiceNode.Invoices.Get("missing"); ok {
+			t.Error("Expected an unknown invoice not to be found")
+		}
+	})
+}
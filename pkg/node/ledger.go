@@ -0,0 +1,107 @@
+package node
+
+import (
+	"sync"
+
+	bck "github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+// Validated balance and utxos of an address, as derived from the applied blocks
+type LedgerEntry struct {
+	WInfo *bck.WalletInfo
+	Mu    sync.Mutex
+}
+
+func NewLedgerEntry(pubKey bck.PublicKey) *LedgerEntry {
+	return &LedgerEntry{
+		WInfo: bck.NewWalletInfo(pubKey),
+	}
+}
+
+// Returns a copy of the validated wallet info, taken under the entry lock
+func (e *LedgerEntry) WalletInfoSnapshot() *bck.WalletInfo {
+	e.Mu.Lock()
+	defer e.Mu.Unlock()
+	utxos := make(bck.TxOutMap, len(e.WInfo.Utxos))
+	for _, utxo := range e.WInfo.Utxos {
+		utxos.Add(utxo)
+	}
+	snapshot := *e.WInfo
+	snapshot.Utxos = utxos
+	return &snapshot
+}
+
+// Validated state of every address that has ever been paid, ring members included.
+//
+// Entries are never removed, so that an emptied address keeps being payable.
+//
+// Thread-safe
+type Ledger struct {
+	mu      sync.RWMutex
+	entries map[bck.Address]*LedgerEntry
+}
+
+func NewLedger() *Ledger {
+	return &Ledger{
+		entries: map[bck.Address]*LedgerEntry{},
+	}
+}
+
+func (l *Ledger) Get(address bck.Address) (*LedgerEntry, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	e, ok := l.entries[address]
+	return e, ok
+}
+
+// Registers an entry, unless its address is already known
+func (l *Ledger) Add(e *LedgerEntry) *LedgerEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	address := e.WInfo.Address()
+	if existing, ok := l.entries[address]; ok {
+		return existing
+	}
+	l.entries[address] = e
+	return e
+}
+
+// Returns the entry of the owner of txOut, creating an empty one if needed
+func (l *Ledger) GetOrAdd(txOut *bck.TxOut) *LedgerEntry {
+	if e, ok := l.Get(txOut.OwnerAddress()); ok {
+		return e
+	}
+	if txOut.Owner != nil {
+		return l.Add(NewLedgerEntry(txOut.Owner))
+	}
+	return l.Add(&LedgerEntry{WInfo: bck.NewWalletInfoForAddress(txOut.OwnerAddress())})
+}
+
+// Returns the public key of address, known if it was registered in the ring or
+// revealed by an output paid to the key itself
+func (l *Ledger) PublicKey(address bck.Address) (bck.PublicKey, bool) {
+	e, ok := l.Get(address)
+	if !ok {
+		return nil, false
+	}
+	info := e.WalletInfoSnapshot()
+	if info.PubKey != nil {
+		return info.PubKey, true
+	}
+	for _, utxo := range info.Utxos {
+		if utxo.Owner != nil {
+			return utxo.Owner, true
+		}
+	}
+	return nil, false
+}
+
+func (l *Ledger) Addresses() []bck.Address {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	addresses := make([]bck.Address, 0, len(l.entries))
+	for address := range l.entries {
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
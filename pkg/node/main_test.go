@@ -3,14 +3,82 @@ package node
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
+
+	"github.com/kon-pap/noobcash/pkg/node/backend"
 )
 
 var testNode *Node
 
 func TestMain(m *testing.M) {
 	log.Println("Setting up test environment...")
-	testNode = NewNode(0, 1024, "localhost", "7070", "8080")
+	testNode = NewNode(0, backend.DefaultKeyType, "localhost", "7070", "8080")
 	testNode.MakeBootstrap(5)
+	backend.BlockCapacity = 10
+	backend.TmpBlockCapacity = backend.BlockCapacity
+	testNode.ApplyBlock(backend.CreateGenesisBlock(5, testNode.Wallet.PrivKey.Public()))
 	os.Exit(m.Run())
 }
+
+// Offset of the ports of the next test node from the ones of testNode
+var nextTestNodePort = 1
+
+// Returns a new bootstrap node whose genesis block pays funder, or the node's
+// own wallet if funder is nil
+func newFundedTestNode(t *testing.T, funder backend.PublicKey) *Node {
+	t.Helper()
+	n := NewNode(0, backend.DefaultKeyType, "localhost", strconv.Itoa(7070+nextTestNodePort), strconv.Itoa(8080+nextTestNodePort))
+	nextTestNodePort++
+	n.MakeBootstrap(5)
+	if funder == nil {
+		funder = n.Wallet.PrivKey.Public()
+	}
+	if err := n.ApplyBlock(backend.CreateGenesisBlock(5, funder)); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// Returns a new node with the given id, sharing the genesis block of bootstrap
+func newTestPeer(t *testing.T, id int, bootstrap *Node) *Node {
+	t.Helper()
+	n := NewNode(id, backend.DefaultKeyType, "localhost", strconv.Itoa(7070+nextTestNodePort), strconv.Itoa(8080+nextTestNodePort))
+	nextTestNodePort++
+	genesis := *bootstrap.Chain[0]
+	genesis.Index = 0
+	if err := n.ApplyBlock(&genesis); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// Mines the pending transactions of n into a block and applies it
+func mineTestBlock(t *testing.T, n *Node) *backend.Block {
+	t.Helper()
+	block := backend.NewBlock(n.getLastBlock().CurrentHash)
+	block.Transactions = n.pendingTxs.DequeueMany(n.pendingTxs.Len())
+	for nonce := 0; !strings.HasPrefix(backend.HexEncodeByteSlice(block.CurrentHash), strings.Repeat("0", backend.Difficulty)); nonce++ {
+		block.Nonce = strconv.Itoa(nonce)
+		block.ComputeAndFillHash()
+	}
+	if err := n.ApplyBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+// Returns the utxos of address in the ledger of n
+func ledgerUtxos(t *testing.T, n *Node, address backend.Address) []*backend.TxOut {
+	t.Helper()
+	e, ok := n.Ledger.Get(address)
+	if !ok {
+		t.Fatalf("Address %s was never paid", address)
+	}
+	var utxos []*backend.TxOut
+	for _, utxo := range e.WalletInfoSnapshot().Utxos {
+		utxos = append(utxos, utxo)
+	}
+	return utxos
+}
@@ -3,8 +3,6 @@ package node
 import (
 	"bytes"
 	"context"
-	"crypto"
-	"crypto/rsa"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -34,13 +32,26 @@ var (
 	AllTxsDuration        = time.Duration(0)
 )
 
+// Automatic consolidation of the wallet utxos, disabled if AutoConsolidateLimit is 0
+var (
+	AutoConsolidateLimit = 0  // utxo count above which the wallet gets consolidated
+	ConsolidateMaxInputs = 50 // max utxos merged by a single consolidation
+	ConsolidateThreshold = 10 // only utxos below this amount are merged
+)
+
 type Node struct {
-	Id     int
-	Chain  []*bck.Block
-	Wallet *bck.Wallet
-	Ring   map[string]*NodeInfo
+	Id       int
+	Chain    []*bck.Block
+	Wallet   *bck.Wallet // wallet of the default account, the node's identity in the ring
+	Accounts *Accounts   // every wallet hosted by the node, the default one included
+	Ring     map[bck.Address]*NodeInfo
+	Ledger   *Ledger // every payable address, the ring members included
+	Invoices *Invoices
+	Tokens   *Tokens // every token issued in the chain
+	Channels *Channels
 
 	pendingTxs     *TxQueue
+	txIndex        *TxIndex
 	incBlockChan   chan *bck.Block // send over the block received from the network
 	minedBlockChan chan *bck.Block // send over the block mined by this node
 	stopMiningChan chan struct{}   // send over the block received to stop mining and handle leftover transactions
@@ -58,15 +69,25 @@ type Node struct {
 	nodecnt      int
 }
 
-func NewNode(currBlockId, bits int, ip, port, apiport string) *Node {
-	w := bck.NewWallet(bits)
-	newNodeInfo := NewNodeInfo(-1, ip, port, &w.PrivKey.PublicKey)
+func NewNode(currBlockId int, keyType bck.KeyType, ip, port, apiport string) *Node {
+	return NewNodeWithWallet(bck.NewWallet(keyType), ip, port, apiport)
+}
+
+// Creates a node around an existing wallet, e.g. one loaded from a keystore
+func NewNodeWithWallet(w *bck.Wallet, ip, port, apiport string) *Node {
+	newNodeInfo := NewNodeInfo(-1, ip, port, w.PrivKey.Public())
 	newNode := &Node{
-		Id:     -1,
-		Chain:  []*bck.Block{},
-		Wallet: w,
+		Id:       -1,
+		Chain:    []*bck.Block{},
+		Wallet:   w,
+		Accounts: NewAccounts(w),
+		Invoices: NewInvoices(),
+		Tokens:   NewTokens(),
+		Channels: NewChannels(),
 
 		pendingTxs:     NewTxQueue(),
+		txIndex:        NewTxIndex(),
+		Ledger:         NewLedger(),
 		incBlockChan:   make(chan *bck.Block, 1),
 		minedBlockChan: make(chan *bck.Block, 1),
 		stopMiningChan: make(chan struct{}, 1),
@@ -77,18 +98,25 @@ func NewNode(currBlockId, bits int, ip, port, apiport string) *Node {
 		info:    newNodeInfo,
 		apiport: apiport,
 
-		Ring: map[string]*NodeInfo{
-			bck.PubKeyToPem(&w.PrivKey.PublicKey): newNodeInfo,
+		Ring: map[bck.Address]*NodeInfo{
+			w.Address(): newNodeInfo,
 		},
 	}
+	newNode.Ledger.Add(newNodeInfo.LedgerEntry)
 	return newNode
 }
 
+// Adds a node to the ring, sharing its ledger entry if the address has already been paid
+func (n *Node) addToRing(address bck.Address, nInfo *NodeInfo) {
+	nInfo.LedgerEntry = n.Ledger.Add(nInfo.LedgerEntry)
+	n.Ring[address] = nInfo
+}
+
 // Initialize any fields required for the node to act as bootstrap
 func (n *Node) MakeBootstrap(nodecnt int) {
 	log.Println("Becoming bootstrap...")
 	n.Id = 0
-	n.Ring[bck.PubKeyToPem(&n.Wallet.PrivKey.PublicKey)].Id = 0
+	n.Ring[n.Wallet.Address()].Id = 0
 	n.BsNextNodeId = &MuInt{
 		Value: 1,
 	}
@@ -102,12 +130,12 @@ func (n *Node) IsBootstrap() bool {
 //* TRANSACTION
 func (n *Node) IsValidSig(tx *bck.Transaction) bool {
 	// Genesis transaction is valid
-	if tx.SenderAddress == nil {
+	if tx.IsGenesis() {
 		return true
 	}
-	err := rsa.VerifyPKCS1v15(tx.SenderAddress, crypto.SHA256, tx.Id, tx.Signature)
+	err := tx.VerifySignatures()
 	if err != nil {
-		log.Println("Signature validation failed")
+		log.Println("Signature validation failed:", err)
 	}
 	return err == nil
 }
@@ -116,16 +144,57 @@ func (n *Node) IsValidTx(tx *bck.Transaction) bool {
 	//Step1: isValidSig
 	//Step2: check transaction inputs/outputs
 	return n.IsValidSig(tx) && func() bool {
-		senderNode := n.Ring[bck.PubKeyToPem(tx.SenderAddress)]
-		for _, txIn := range tx.Inputs {
-			if !senderNode.WInfo.Utxos.Has(txIn) {
-				log.Println("Wallet", senderNode.Id, "does not have UTXO", txIn.Id)
+		for _, txOut := range tx.Outputs {
+			if !txOut.IsValidOwner() {
+				log.Println("Output", txOut.Id, "has an invalid owner")
 				return false
 			}
 		}
+		if err := tx.CheckMemo(); err != nil {
+			log.Println("Transaction has an invalid memo:", err)
+			return false
+		}
+		// it is only valid in the genesis block, see IsValidBlock
+		if tx.IsGenesis() {
+			log.Println("Transaction spends no inputs outside the genesis block")
+			return false
+		}
+		spent, err := n.spentUtxos(tx)
+		if err != nil {
+			log.Println(err)
+			return false
+		}
+		if err := tx.CheckAmounts(spent); err != nil {
+			log.Println("Transaction has invalid amounts:", err)
+			return false
+		}
+		if err := n.checkLocks(tx, spent); err != nil {
+			log.Println("Transaction cannot be included yet:", err)
+			return false
+		}
 		return true
 	}()
 }
+// Returns the UTXOs of the ledger spent by the inputs of tx
+func (n *Node) spentUtxos(tx *bck.Transaction) (bck.TxOutMap, error) {
+	spent := make(bck.TxOutMap, len(tx.Inputs))
+	for _, txIn := range tx.Inputs {
+		owner := tx.InputOwner(txIn)
+		entry, ok := n.Ledger.Get(owner)
+		if !ok {
+			return nil, fmt.Errorf("owner %s has never been paid", owner)
+		}
+		utxo, ok := entry.WalletInfoSnapshot().Utxos[txIn.Id]
+		if !ok {
+			return nil, fmt.Errorf("wallet %s does not have UTXO %s", owner, txIn.Id)
+		}
+		if !txIn.Spends(utxo) {
+			return nil, fmt.Errorf("input %s does not match the UTXO of wallet %s", txIn.Id, owner)
+		}
+		spent.Add(utxo)
+	}
+	return spent, nil
+}
 func (n *Node) AcceptTx(tx *bck.Transaction) error {
 	if !n.IsValidTx(tx) {
 		log.Println("AcceptTx: Invalid transaction")
@@ -135,7 +204,25 @@ func (n *Node) AcceptTx(tx *bck.Transaction) error {
 		TxThroughputFlag = true
 		TxThroughputStartTime = time.Now()
 	}
-	n.pendingTxs.Enqueue(tx)
+	replaced, err := n.pendingTxs.EnqueueReplacing(tx, func(conflicts []*bck.Transaction) error {
+		fee, err := n.ledgerFee(tx)
+		if err != nil {
+			return err
+		}
+		conflictFees := make([]int, len(conflicts))
+		for i, conflict := range conflicts {
+			if conflictFees[i], err = n.ledgerFee(conflict); err != nil {
+				return err
+			}
+		}
+		return checkReplacement(tx, fee, conflicts, conflictFees)
+	})
+	if err != nil {
+		log.Println("AcceptTx: Rejected replacement:", err)
+		return err
+	}
+	n.txIndex.MarkPending(tx)
+	n.markReplaced(replaced, tx)
 	return nil
 }
 
@@ -143,71 +230,202 @@ func (n *Node) ApplyTx(tx *bck.Transaction) error {
 	if !n.IsValidTx(tx) {
 		return fmt.Errorf("transaction is not valid")
 	}
-	var nodeAddress string = bck.PubKeyToPem(&n.Wallet.PrivKey.PublicKey)
-	var senderAddress string
-	var senderWalletInfo *bck.WalletInfo
+	return n.applyTx(tx)
+}
 
+// Applies a transaction that was already validated
+func (n *Node) applyTx(tx *bck.Transaction) error {
 	//*DONE(ORF): Ensure thread-safety
 	//!NOTE(ORF): Could be useless to lock here, since chain lock will most likely always block this beforehand
 	n.muRingLock.Lock()
-	UnlockTxParticipants := n.LockTxParticipants(tx)
-	defer UnlockTxParticipants()
+	UnlockTxParticipants, err := n.LockTxParticipants(tx)
 	n.muRingLock.Unlock()
+	if err != nil {
+		return err
+	}
+	defer UnlockTxParticipants()
 
-	// Skip this if tx is the genesis transaction
-	if tx.SenderAddress != nil {
-		senderAddress = bck.PubKeyToPem(tx.SenderAddress)
-		senderWalletInfo = n.Ring[senderAddress].WInfo
+	// the genesis transaction has no inputs
+	for _, txIn := range tx.Inputs {
+		owner, err := n.ledgerEntry(tx.InputOwner(txIn))
+		if err != nil {
+			return err
+		}
+		ownerWalletInfo := owner.WInfo
 
-		for _, txIn := range tx.Inputs {
-			previousUtxo := senderWalletInfo.Utxos[txIn.Id]
-			senderWalletInfo.Balance -= previousUtxo.Amount
-			senderWalletInfo.Utxos.Remove(txIn)
+		previousUtxo, ok := ownerWalletInfo.Utxos[txIn.Id]
+		if !ok {
+			return fmt.Errorf("wallet %s does not have UTXO %s", tx.InputOwner(txIn), txIn.Id)
 		}
-		// TODO(ORF): Finalize removal by removing the UTXOS from the .Wallet.UTXOS as well.
-		// TODO(ORF): and remove them from the reserved UTXOS too.
+		ownerWalletInfo.Balance -= previousUtxo.NativeAmount()
+		ownerWalletInfo.Utxos.Remove(txIn)
+		// RevertTx gives back the spent UTXO, not the copy carried by tx
+		tx.Inputs[txIn.Id] = previousUtxo
+	}
+	// if accounts of this node own inputs then finalize the spending of the reserved UTXOs
+	for _, w := range n.inputAccounts(tx) {
+		n.EvictTxs(w.ConfirmTx(tx))
 	}
 
 	for _, txOut := range tx.Outputs {
-		receiverAddress := bck.PubKeyToPem(txOut.Owner)
-		receiverWalletInfo := n.Ring[receiverAddress].WInfo
+		receiverAddress := txOut.OwnerAddress()
+		receiver, err := n.ledgerEntry(receiverAddress)
+		if err != nil {
+			return err
+		}
+		receiverWalletInfo := receiver.WInfo
 
-		receiverWalletInfo.Balance += txOut.Amount // increase receiver's balance
-		receiverWalletInfo.Utxos.Add(txOut)        // add new UTXO to receiver's UTXOs
-		// if this wallet is the receiver then update the private state as well
-		if receiverAddress == nodeAddress {
-			n.Wallet.Balance += txOut.Amount
-			n.Wallet.Utxos.Add(txOut)
+		receiverWalletInfo.Balance += txOut.NativeAmount() // increase receiver's balance
+		receiverWalletInfo.Utxos.Add(txOut)                // add new UTXO to receiver's UTXOs
+		// if an account of this node is the receiver then update its private state as well
+		if w, ok := n.Accounts.Owner(receiverAddress); ok {
+			w.AddUtxo(txOut)
 		}
 	}
 
+	if tx.Issuance != nil {
+		n.Tokens.Add(tx)
+	}
+
 	AllTxsDuration = time.Since(TxThroughputStartTime)
 	return nil
 
 }
 
-func (n *Node) LockTxParticipants(tx *bck.Transaction) func() {
-	myLockedPubKeys := make(stringSet)
-	if tx.SenderAddress != nil {
-		senderAddress := bck.PubKeyToPem(tx.SenderAddress)
-		n.Ring[senderAddress].Mu.Lock()
-		myLockedPubKeys.Add(senderAddress)
+// Locks the ledger entries of the owners of the inputs and the receivers of tx.
+// Receivers that have never been paid get a new entry.
+func (n *Node) LockTxParticipants(tx *bck.Transaction) (func(), error) {
+	myLockedAddresses := make(addressSet)
+	var locked []*LedgerEntry
+	unlock := func() {
+		for _, e := range locked {
+			e.Mu.Unlock()
+		}
+	}
+	for _, ownerAddress := range tx.Owners() {
+		owner, err := n.ledgerEntry(ownerAddress)
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		owner.Mu.Lock()
+		locked = append(locked, owner)
+		myLockedAddresses.Add(ownerAddress)
 	}
 	for _, txOut := range tx.Outputs {
-		receiverAddress := bck.PubKeyToPem(txOut.Owner)
-		if myLockedPubKeys.Contains(receiverAddress) {
+		receiverAddress := txOut.OwnerAddress()
+		if myLockedAddresses.Contains(receiverAddress) {
 			continue
 		}
-		n.Ring[receiverAddress].Mu.Lock()
-		myLockedPubKeys.Add(receiverAddress)
+		receiver := n.Ledger.GetOrAdd(txOut)
+		receiver.Mu.Lock()
+		locked = append(locked, receiver)
+		myLockedAddresses.Add(receiverAddress)
 	}
-	return func() {
-		for pubKey := range myLockedPubKeys {
-			n.Ring[pubKey].Mu.Unlock()
+	return unlock, nil
+}
+
+// Returns the ledger entry of an address that is known to have been paid
+func (n *Node) ledgerEntry(address bck.Address) (*LedgerEntry, error) {
+	e, ok := n.Ledger.Get(address)
+	if !ok {
+		return nil, fmt.Errorf("unknown address %s in the ledger", address)
+	}
+	return e, nil
+}
+
+// Accepts a transaction created by this node and broadcasts it to the ring
+func (n *Node) SubmitOwnTx(tx *bck.Transaction) error {
+	if err := n.AcceptTx(tx); err != nil {
+		n.dropTx(tx)
+		return fmt.Errorf("Accepting transaction error: %s", err.Error())
+	}
+	if err := n.BroadcastTx(tx); err != nil {
+		return fmt.Errorf("Broadcasting transaction error: %s", err.Error())
+	}
+	return nil
+}
+
+// Merges up to maxInputs utxos of w below threshold into one, with a payment to self
+func (n *Node) Consolidate(w *bck.Wallet, maxInputs, threshold int) (*bck.Transaction, *bck.Consolidation, error) {
+	tx, consolidation, err := w.CreateAndSignConsolidationTx(maxInputs, threshold)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := n.SubmitOwnTx(tx); err != nil {
+		return nil, nil, err
+	}
+	log.Println("Consolidation submitted:", consolidation)
+	return tx, consolidation, nil
+}
+
+// Consolidates every account whose unreserved utxos exceed AutoConsolidateLimit.
+//
+// The inputs of a pending consolidation are reserved, so the account is not
+// consolidated again until it is confirmed.
+func (n *Node) autoConsolidate() {
+	for _, name := range n.Accounts.Names() {
+		w, _ := n.Accounts.Get(name)
+		if w.IsWatchOnly() {
+			continue
+		}
+		if utxoCnt := w.UnreservedUtxoCount(); utxoCnt > AutoConsolidateLimit {
+			log.Println("Account", name, "has", utxoCnt, "unreserved utxos, consolidating...")
+			if _, _, err := n.Consolidate(w, ConsolidateMaxInputs, ConsolidateThreshold); err != nil {
+				log.Println("Automatic consolidation failed:", err)
+			}
 		}
 	}
 }
 
+// Consolidates the accounts with too many utxos, see autoConsolidate
+//
+// Should be called as a goroutine
+func (n *Node) AutoConsolidate() {
+	ticker := time.NewTicker(time.Second * checkTxCountIntervalSeconds)
+	for range ticker.C {
+		n.autoConsolidate()
+	}
+}
+
+// Adds to w the unspent outputs of the chain paid to any of its keys,
+// e.g. after restoring an HD wallet from its mnemonic. Returns how many were found.
+//
+// Finding an output of a derived address extends the addresses an HD wallet
+// looks for, so the chain is scanned again until nothing new is found.
+func (n *Node) RescanWallet(w *bck.Wallet) int {
+	// blocks applied meanwhile would otherwise be missed or scanned half-applied
+	n.muChainLock.Lock()
+	defer n.muChainLock.Unlock()
+	found := 0
+	for {
+		added := 0
+		for _, block := range n.Chain {
+			for _, tx := range block.Transactions {
+				for _, txOut := range tx.Outputs {
+					if !w.Owns(txOut.OwnerAddress()) {
+						continue
+					}
+					e, ok := n.Ledger.Get(txOut.OwnerAddress())
+					if !ok {
+						continue
+					}
+					e.Mu.Lock()
+					unspent := e.WInfo.Utxos.Has(txOut)
+					e.Mu.Unlock()
+					if unspent && w.AddUtxo(txOut) {
+						added++
+					}
+				}
+			}
+		}
+		if added == 0 {
+			return found
+		}
+		found += added
+	}
+}
+
 //*DONE(BILL)
 func (n *Node) BroadcastTx(tx *bck.Transaction) error {
 	txInSlice := []*bck.Transaction{tx}
@@ -223,13 +441,18 @@ var (
 	chainErr         = errors.New("block is not valid for the chain")
 	incorrectMineErr = errors.New("block hash does not fulfill the difficulty requirement")
 	incorrectHashErr = errors.New("block hash does not equal the provided hash")
+	genesisErr       = errors.New("genesis block is only valid as the first block of the chain")
+	lockedTxErr      = errors.New("block contains a transaction that is still locked")
 )
 
 //* BLOCK
 func (n *Node) IsValidBlock(block *bck.Block) (err error) {
-	// GenesisBlock is valid
+	// GenesisBlock is valid as the first block, if it only creates native coins
 	if block.IsGenesis() {
-		return
+		if len(n.Chain) > 0 {
+			return genesisErr
+		}
+		return block.Transactions[0].CheckGenesis()
 	}
 	dif := strings.Repeat("0", bck.Difficulty)
 	lastBlockHash := bck.HexEncodeByteSlice(n.getLastBlock().CurrentHash)
@@ -243,11 +466,92 @@ func (n *Node) IsValidBlock(block *bck.Block) (err error) {
 	} else if bck.HexEncodeByteSlice(block.ComputeHash()) != thisBlockHash {
 		err = incorrectHashErr
 	}
+	if err != nil {
+		return
+	}
+	height, medianTime := n.lockContext()
+	for _, tx := range block.Transactions {
+		if !bck.IsLockFinal(tx.LockTime, height, medianTime) {
+			return lockedTxErr
+		}
+	}
 	return
 }
 
+// Returns the transactions of a block that was not applied to the pending ones.
+//
+// Transactions that are no longer valid are dropped instead.
 func (n *Node) CancelNotAppliedBlock(block *bck.Block) {
-	n.pendingTxs.EnqueueMany(block.Transactions)
+	stillValid := make([]*bck.Transaction, 0, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		if n.IsValidTx(tx) {
+			stillValid = append(stillValid, tx)
+		} else {
+			n.dropTx(tx)
+		}
+	}
+	n.pendingTxs.EnqueueMany(stillValid)
+}
+
+// Marks tx as dropped and releases the UTXOs this node may have reserved for it
+func (n *Node) dropTx(tx *bck.Transaction) {
+	txId := bck.HexEncodeByteSlice(tx.Id)
+	n.txIndex.MarkDropped(txId)
+	if n.Accounts.ReleaseTx(txId) {
+		log.Println("Released reserved UTXOs of dropped transaction", txId)
+	}
+}
+
+// Removes the transactions with the given ids from the pending ones and
+// releases any UTXOs this node had reserved for them
+func (n *Node) EvictTxs(txIds []string) {
+	if len(txIds) == 0 {
+		return
+	}
+	txIdsToEvict := make(stringSet)
+	for _, txId := range txIds {
+		txIdsToEvict.Add(txId)
+		n.txIndex.MarkDropped(txId)
+		n.Accounts.ReleaseTx(txId)
+	}
+	evictedCnt := n.pendingTxs.DequeueManyByValue(txIdsToEvict)
+	log.Println("Evicted", evictedCnt, "pending transaction(s)")
+}
+
+// Drops any pending transactions that are no longer valid
+func (n *Node) evictInvalidPendingTxs() {
+	for _, tx := range n.pendingTxs.RemoveIf(func(tx *bck.Transaction) bool { return !n.IsValidTx(tx) }) {
+		log.Println("Evicting invalid pending transaction", bck.HexEncodeByteSlice(tx.Id))
+		n.dropTx(tx)
+	}
+}
+
+// Releases the reservations that have not been confirmed in time.
+//
+// Their transactions are evicted, so that the UTXOs cannot be spent twice by this node.
+// Pending transactions may still be in the block being mined or at the peers,
+// so they keep their inputs reserved and are broadcast again instead, up to
+// bck.MaxReservationRenewals times.
+func (n *Node) releaseExpiredReservations() {
+	for _, w := range n.Accounts.Wallets() {
+		expired, renewed := w.ReleaseExpired(bck.ReservationTimeout, n.isPendingTx)
+		if len(expired) > 0 {
+			log.Println("Releasing", len(expired), "expired reservation(s)")
+			n.EvictTxs(expired)
+		}
+		for _, txId := range renewed {
+			if e, ok := n.txIndex.Get(txId); ok {
+				log.Println("Broadcasting unconfirmed transaction", txId, "again")
+				go n.BroadcastTx(e.Tx)
+			}
+		}
+	}
+}
+
+// Returns true if the transaction with the given id is waiting to be mined
+func (n *Node) isPendingTx(txId string) bool {
+	e, ok := n.txIndex.Get(txId)
+	return ok && (e.Status == TxPending || e.Status == TxOrphaned)
 }
 
 func (n *Node) fixBlockTime(start time.Time) {
@@ -319,13 +623,25 @@ func (n *Node) ApplyBlock(block *bck.Block) error {
 		return err
 	}
 
-	for _, tx := range block.Transactions {
-		if err := n.ApplyTx(tx); err != nil {
+	// the genesis transaction is checked by IsValidBlock instead
+	applyTx := n.ApplyTx
+	if block.IsGenesis() {
+		applyTx = n.applyTx
+	}
+	for i, tx := range block.Transactions {
+		if err := applyTx(tx); err != nil {
+			// the rest of the block is dropped
+			for _, droppedTx := range block.Transactions[i:] {
+				n.dropTx(droppedTx)
+			}
 			return err
 		}
 	}
 	n.Chain = append(n.Chain, block)
 	block.Index = len(n.Chain) // len will already be inceremented by 1
+	n.txIndex.MarkConfirmed(block)
+	n.Invoices.Settle(block)
+	n.updateChainTip()
 
 	log.Println("Block successfully applied")
 	return nil
@@ -364,57 +680,77 @@ func (n *Node) getNodeInfoById(id int) *NodeInfo {
 	panic("Node.getNodeInfoById() called with invalid id")
 }
 
-func (n *Node) RevertTx(tx *bck.Transaction) {
+func (n *Node) RevertTx(tx *bck.Transaction) error {
 	log.Println("Reverting transaction...")
 	n.muRingLock.Lock()
-	UnlockTxParticipants := n.LockTxParticipants(tx)
-	defer UnlockTxParticipants()
+	UnlockTxParticipants, err := n.LockTxParticipants(tx)
 	n.muRingLock.Unlock()
+	if err != nil {
+		return err
+	}
+	defer UnlockTxParticipants()
+	if tx.Issuance != nil {
+		n.Tokens.Remove(tx.IssuedAsset())
+	}
 
-	if tx.SenderAddress != nil {
-		senderAddress := bck.PubKeyToPem(tx.SenderAddress)
-		senderWalletInfo := n.Ring[senderAddress].WInfo
-
-		for _, txIn := range tx.Inputs {
-			senderWalletInfo.Balance += txIn.Amount
-			senderWalletInfo.Utxos.Add(txIn)
+	for _, txIn := range tx.Inputs {
+		owner, err := n.ledgerEntry(tx.InputOwner(txIn))
+		if err != nil {
+			return err
 		}
+		ownerWalletInfo := owner.WInfo
+
+		ownerWalletInfo.Balance += txIn.NativeAmount()
+		ownerWalletInfo.Utxos.Add(txIn)
+	}
+	for _, w := range n.inputAccounts(tx) {
+		w.UnconfirmTx(tx)
 	}
 	for _, txOut := range tx.Outputs {
-		receiverAddress := bck.PubKeyToPem(txOut.Owner)
-		receiverWalletInfo := n.Ring[receiverAddress].WInfo
+		receiverAddress := txOut.OwnerAddress()
+		receiver, err := n.ledgerEntry(receiverAddress)
+		if err != nil {
+			return err
+		}
+		receiverWalletInfo := receiver.WInfo
 
 		// TODO(ORF): This invariant (I think) is already certain to be true
 		if !receiverWalletInfo.Utxos.Has(txOut) {
 			panic("RevertTx: tried to remove utxo that did not exist in wallet info")
 		}
 		receiverWalletInfo.Utxos.Remove(txOut)
-		receiverWalletInfo.Balance -= txOut.Amount
+		receiverWalletInfo.Balance -= txOut.NativeAmount()
 
-		if receiverAddress == bck.PubKeyToPem(&n.Wallet.PrivKey.PublicKey) {
-			// TODO(ORF): Remove the UTXOS from the reserved UTXOs map, and now this invariant should also be true here
-			if !n.Wallet.Utxos.Has(txOut) {
+		if w, ok := n.Accounts.Owner(receiverAddress); ok {
+			conflicts, ok := w.RemoveUtxo(txOut)
+			if !ok {
 				panic("RevertTx: tried to remove utxo that did not exist in wallet")
 			}
-			n.Wallet.Utxos.Remove(txOut)
-			n.Wallet.Balance -= txOut.Amount
+			// pending transactions spending this utxo can no longer be applied
+			n.EvictTxs(conflicts)
 		}
 	}
-	return
+	return nil
 }
 
-func (n *Node) RevertBlock() {
+func (n *Node) RevertBlock() error {
 	log.Println("Reverting block...")
 	if len(n.Chain) == 0 {
-		return
+		return nil
 	}
 	blockToRemove := n.getLastBlock()
 	log.Println("Trying to revert", len(blockToRemove.Transactions), "transactions")
 	for _, tx := range blockToRemove.Transactions {
-		n.RevertTx(tx)
+		if err := n.RevertTx(tx); err != nil {
+			return err
+		}
 	}
 	n.Chain = n.Chain[:len(n.Chain)-1]
+	n.updateChainTip()
 	n.pendingTxs.EnqueueMany(blockToRemove.Transactions)
+	n.txIndex.MarkOrphaned(blockToRemove)
+	n.Invoices.Unsettle(blockToRemove)
+	return nil
 }
 
 var (
@@ -480,7 +816,9 @@ func (n *Node) ResolveConflict() error {
 	//*DONE: Replace last Block of the chain and replace it with blocks
 	//! Note: It assumes that the block before the one we remove is correct.
 	//! Note: Esentially assume max 1 block branches
-	n.RevertBlock()
+	if err := n.RevertBlock(); err != nil {
+		return err
+	}
 	for _, block := range blocks {
 		//!NOTE: other way would be to `n.incBlockChan <- block`
 		if err := n.ApplyBlock(block); err != nil && err == chainErr {
@@ -489,15 +827,28 @@ func (n *Node) ResolveConflict() error {
 		n.RemoveCompletedTxsFromQueue(block)
 		//!NOTE(ORF): This loop SHOULD be able to fail only at the first iteration.
 	}
+	n.syncWithChain()
 	return nil
 }
 
+// Brings the transaction index and the accounts up to date with a chain
+// received from a peer, e.g. when the node joins or restarts with restored wallets
+func (n *Node) syncWithChain() {
+	n.txIndex.Rebuild(n.Chain)
+	for _, name := range n.Accounts.Names() {
+		w, _ := n.Accounts.Get(name)
+		if found := n.RescanWallet(w); found > 0 {
+			log.Println("Found", found, "UTXO(s) of account", name, "in the chain")
+		}
+	}
+}
+
 //* RING
 func (n *Node) ConnectToBootstrap() error {
 	sendContent, err := json.Marshal(bootstrapNodeTy{
 		Hostname: n.info.Hostname,
 		Port:     n.info.Port,
-		PubKey:   bck.PubKeyToPem(&n.Wallet.PrivKey.PublicKey),
+		PubKey:   bck.PubKeyToPem(n.Wallet.PrivKey.Public()),
 	})
 	if err != nil {
 		return err
@@ -514,7 +865,7 @@ func (n *Node) ConnectToBootstrap() error {
 		return err
 	}
 	n.Id, err = strconv.Atoi(string(body))
-	n.Ring[bck.PubKeyToPem(&n.Wallet.PrivKey.PublicKey)].Id = n.Id
+	n.Ring[n.Wallet.Address()].Id = n.Id
 	if err != nil {
 		return err
 	}
@@ -533,6 +884,8 @@ func (n *Node) CheckTxQueueForMining() {
 		if !n.semaCurrentlyMining.TryAcquire(1) {
 			continue
 		}
+		n.releaseExpiredReservations()
+		n.evictInvalidPendingTxs()
 		if txs := n.pendingTxs.DequeueMany(bck.TmpBlockCapacity); txs != nil {
 			newBlock := bck.NewBlock(n.getLastBlock().CurrentHash)
 			newBlock.AddManyTxs(txs) // error handling unnecessary, newBlock is empty
@@ -602,11 +955,11 @@ func (n *Node) SelectMinedOrIncomingBlock() {
 
 func (n *Node) BroadcastRingInfo() error {
 	var nodes []transferNodeTy
-	for pubKey, nInfo := range n.Ring {
+	for _, nInfo := range n.Ring {
 		nodes = append(nodes, transferNodeTy{
 			Hostname: nInfo.Hostname,
 			Port:     nInfo.Port,
-			PubKey:   pubKey,
+			PubKey:   bck.PubKeyToPem(nInfo.WInfo.PubKey),
 			Id:       nInfo.Id,
 		})
 	}
@@ -652,7 +1005,7 @@ func (n *Node) DoInitialBootstrapActions() {
 	}
 	log.Println("Ring broadcasted successfully")
 
-	genBlock := bck.CreateGenesisBlock(n.nodecnt, &n.Wallet.PrivKey.PublicKey)
+	genBlock := bck.CreateGenesisBlock(n.nodecnt, n.Wallet.PrivKey.Public())
 	if genBlock == nil {
 		log.Println("Error creating genesis block")
 		os.Exit(1)
@@ -674,7 +1027,7 @@ func (n *Node) DoInitialBootstrapActions() {
 			continue
 		}
 		targets = append(targets, &bck.TxTargetTy{
-			Address: nInfo.WInfo.PubKey,
+			Address: nInfo.WInfo.Address(),
 			Amount:  100,
 		})
 	}
@@ -712,10 +1065,16 @@ func (n *Node) Start() error {
 
 	var jg JobGroup
 
+	n.updateChainTip()
+
 	jg.Add(func() { n.ServeApiForCli(n.apiport) })
 	jg.Add(func() { n.ServeApiForNodes(n.info.Port) })
 	jg.Add(n.SelectMinedOrIncomingBlock)
 	jg.Add(n.CheckTxQueueForMining)
+	jg.Add(n.WatchChannels)
+	if AutoConsolidateLimit > 0 {
+		jg.Add(n.AutoConsolidate)
+	}
 
 	if !n.IsBootstrap() {
 		jg.Add(n.ConnectToBootstrapJob)
@@ -0,0 +1,674 @@
+package node
+
+import (
+	"encoding/json"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+	"github.com/kon-pap/noobcash/pkg/node/script"
+)
+
+func TestSpentUtxos(t *testing.T) {
+	ledgerNode := newFundedTestNode(t, nil)
+	shop := backend.NewWallet(backend.DefaultKeyType)
+	if err := ledgerNode.Accounts.Add("shop", shop); err != nil {
+		log.Fatalln(err)
+	}
+	tx, err := ledgerNode.Wallet.CreateAndSignTx(100, shop.Address())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	// returns a copy of tx whose inputs were edited, signed again by the sender
+	forged := func(edit func(txIn *backend.TxOut)) *backend.Transaction {
+		copied := *tx
+		copied.Inputs = backend.TxOutMap{}
+		for _, txIn := range tx.Inputs {
+			txInCopy := *txIn
+			edit(&txInCopy)
+			copied.Inputs.Add(&txInCopy)
+		}
+		if err := backend.SignTxWithKey(&copied, ledgerNode.Wallet.PrivKey); err != nil {
+			log.Fatalln(err)
+		}
+		return &copied
+	}
+
+	t.Run("Inputs differing from the ledger", func(t *testing.T) {
+		for field, edit := range map[string]func(txIn *backend.TxOut){
+			"amount":    func(txIn *backend.TxOut) { txIn.Amount += 1000 },
+			"asset":     func(txIn *backend.TxOut) { txIn.Asset = "30be7dcf420f7d1c479f01f15d29bc66" },
+			"address":   func(txIn *backend.TxOut) { txIn.Address = shop.Address() },
+			"owner":     func(txIn *backend.TxOut) { txIn.Owner = shop.PrivKey.Public() },
+			"lock time": func(txIn *backend.TxOut) { txIn.LockTime = 100 },
+		} {
+			if ledgerNode.IsValidTx(forged(edit)) {
+				t.Errorf("Expected an input with a different %s than its UTXO to be refused", field)
+			}
+		}
+	})
+	t.Run("Revert restores the UTXOs of the ledger", func(t *testing.T) {
+		entry, _ := ledgerNode.Ledger.Get(ledgerNode.Wallet.Address())
+		spent := entry.WalletInfoSnapshot().Utxos
+		applied := forged(func(txIn *backend.TxOut) {})
+		if err := ledgerNode.ApplyTx(applied); err != nil {
+			t.Fatal(err)
+		}
+		if err := ledgerNode.RevertTx(applied); err != nil {
+			t.Fatal(err)
+		}
+		utxos := entry.WalletInfoSnapshot().Utxos
+		for id, utxo := range spent {
+			if utxos[id] != utxo {
+				t.Errorf("Expected UTXO %s of the ledger back, got %+v", id, utxos[id])
+			}
+		}
+	})
+}
+
+func TestPayToHDAddress(t *testing.T) {
+	payerNode := newFundedTestNode(t, nil)
+	mnemonic, err := backend.NewMnemonic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdWallet, err := backend.NewHDWallet(mnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := hdWallet.NewAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := backend.NewHDWallet(mnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restored.Owns(address) {
+		t.Errorf("Restored wallet does not own derived address %s", address)
+	}
+	newTx, err := payerNode.Wallet.CreateAndSignTx(1, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := payerNode.AcceptTx(newTx); err != nil {
+		t.Errorf("Payment to an address outside the ring was rejected: %s", err)
+	}
+}
+
+func TestAcceptRawTx(t *testing.T) {
+	// the cold key is only known to the test, never to the node
+	coldWallet := backend.NewWallet(backend.DefaultKeyType)
+	coldNode := newFundedTestNode(t, coldWallet.PrivKey.Public())
+	buildTx := func() *backend.Transaction {
+		tx, _, err := backend.BuildTx(coldWallet.PrivKey.Public(), ledgerUtxos(t, coldNode, coldWallet.Address()), nil, &backend.TxTargetTy{
+			Address: coldNode.Wallet.Address(),
+			Amount:  10,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	t.Run("Transaction with a forged signature", func(t *testing.T) {
+		// a well-formed transaction spending the cold utxo, signed by the node instead
+		tx := buildTx()
+		var err error
+		if tx.Signature, err = coldNode.Wallet.PrivKey.Sign(tx.SigningHash()); err != nil {
+			t.Fatal(err)
+		}
+		if err := coldNode.AcceptTx(tx); err == nil {
+			t.Error("Expected a transaction with a forged signature to be refused")
+		}
+		if utxos := ledgerUtxos(t, coldNode, coldWallet.Address()); len(utxos) != 1 {
+			t.Errorf("Expected the refused transaction to leave the utxo unspent, got %d utxos", len(utxos))
+		}
+	})
+	t.Run("Transaction signed outside the node", func(t *testing.T) {
+		tx := buildTx()
+		if err := backend.SignTxWithKey(tx, coldWallet.PrivKey); err != nil {
+			t.Fatal(err)
+		}
+		if err := coldNode.AcceptTx(tx); err != nil {
+			t.Fatalf("Expected the transaction to be accepted, got %v", err)
+		}
+		spent := coldNode.txIndex.PendingInputs()
+		for _, txIn := range tx.Inputs {
+			if !spent.Contains(txIn.Id) {
+				t.Errorf("Expected the accepted transaction to spend utxo %s", txIn.Id)
+			}
+		}
+	})
+}
+
+func TestMultisigSpend(t *testing.T) {
+	funder := backend.NewWallet(backend.DefaultKeyType)
+	msNode := newFundedTestNode(t, funder.PrivKey.Public())
+	signers := make([]backend.PrivateKey, 3)
+	pubKeys := make([]backend.PublicKey, 3)
+	for i := range signers {
+		signers[i], _ = backend.GenerateKey(backend.DefaultKeyType)
+		pubKeys[i] = signers[i].Public()
+	}
+	policy, err := backend.NewMultisigKey(2, pubKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	treasury := backend.AddressFromPubKey(policy)
+
+	// fund the treasury
+	fundTx, _, err := backend.BuildTx(funder.PrivKey.Public(), ledgerUtxos(t, msNode, funder.Address()), nil, &backend.TxTargetTy{
+		Address: treasury,
+		Amount:  100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.SignTxWithKey(fundTx, funder.PrivKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := msNode.ApplyTx(fundTx); err != nil {
+		t.Fatal(err)
+	}
+
+	spendTx, _, err := backend.BuildTx(policy, ledgerUtxos(t, msNode, treasury), nil, &backend.TxTargetTy{
+		Address: funder.Address(),
+		Amount:  60,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("Spend with a single signature", func(t *testing.T) {
+		forged := *spendTx
+		forged.Signature, _ = signers[0].Sign(spendTx.SigningHash())
+		if err := msNode.AcceptTx(&forged); err == nil {
+			t.Error("Expected a spend with a single signature to be refused")
+		}
+	})
+	t.Run("Spend with two combined signatures", func(t *testing.T) {
+		first, _ := backend.NewPartialTx(spendTx)
+		second, _ := backend.NewPartialTx(spendTx)
+		if err := first.Sign(signers[0]); err != nil {
+			t.Fatal(err)
+		}
+		if err := second.Sign(signers[2]); err != nil {
+			t.Fatal(err)
+		}
+		// the copies travel between co-signers as json
+		jsSecond, err := json.Marshal(second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var received backend.PartialTx
+		if err := json.Unmarshal(jsSecond, &received); err != nil {
+			t.Fatal(err)
+		}
+		if err := first.Combine(&received); err != nil {
+			t.Error(err)
+			return
+		}
+		tx, err := first.Finalize()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if err := msNode.AcceptTx(tx); err != nil {
+			t.Errorf("Expected the spend to be accepted, got %v", err)
+		}
+	})
+}
+
+func TestHashTimeLockedSwap(t *testing.T) {
+	alice := backend.NewWallet(backend.DefaultKeyType)
+	bob := backend.NewWallet(backend.DefaultKeyType)
+	swapNode := newFundedTestNode(t, alice.PrivKey.Public())
+	secret, hash, err := backend.NewSwapSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract, err := backend.NewHTLCKey(hash, bob.PrivKey.Public(), alice.PrivKey.Public(), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contractAddress := backend.AddressFromPubKey(contract)
+
+	// alice locks her coins to the contract
+	lockTx, _, err := backend.BuildTx(alice.PrivKey.Public(), ledgerUtxos(t, swapNode, alice.Address()), nil, &backend.TxTargetTy{
+		Address: contractAddress,
+		Amount:  100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.SignTxWithKey(lockTx, alice.PrivKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := swapNode.ApplyTx(lockTx); err != nil {
+		t.Fatal(err)
+	}
+	spendContract := func(to backend.Address, lockTime int64) *backend.Transaction {
+		tx, _, err := backend.BuildTx(contract, ledgerUtxos(t, swapNode, contractAddress), &backend.TxOptions{LockTime: lockTime}, &backend.TxTargetTy{
+			Address: to,
+			Amount:  100,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	t.Run("Refund before the timeout", func(t *testing.T) {
+		tx := spendContract(alice.Address(), contract.Timeout)
+		if err := contract.SignRefund(tx, alice.PrivKey); err != nil {
+			t.Fatal(err)
+		}
+		if err := swapNode.AcceptTx(tx); err == nil {
+			t.Error("Expected a refund before the timeout to be refused")
+		}
+	})
+	t.Run("Redeem with the secret", func(t *testing.T) {
+		tx := spendContract(bob.Address(), 0)
+		if err := contract.SignRedeem(tx, secret, bob.PrivKey); err != nil {
+			t.Fatal(err)
+		}
+		if err := swapNode.AcceptTx(tx); err != nil {
+			t.Errorf("Expected the redeem to be accepted, got %v", err)
+		}
+	})
+}
+
+func TestScriptSpend(t *testing.T) {
+	funder := backend.NewWallet(backend.DefaultKeyType)
+	bob := backend.NewWallet(backend.DefaultKeyType)
+	scriptNode := newFundedTestNode(t, funder.PrivKey.Public())
+	bobKey := backend.EncodeTypedKey(bob.PrivKey.Public())
+	lockScript, err := script.PayToPubKeyHash(script.KeyHash(bobKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock, err := backend.NewScriptKey(lockScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockAddress := backend.AddressFromPubKey(lock)
+
+	fundTx, _, err := backend.BuildTx(funder.PrivKey.Public(), ledgerUtxos(t, scriptNode, funder.Address()), nil, &backend.TxTargetTy{
+		Address: lockAddress,
+		Amount:  100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.SignTxWithKey(fundTx, funder.PrivKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := scriptNode.ApplyTx(fundTx); err != nil {
+		t.Fatal(err)
+	}
+	spendScript := func(lock *backend.ScriptKey, opts *backend.TxOptions, target *backend.TxTargetTy) (*backend.Transaction, error) {
+		address := backend.AddressFromPubKey(lock)
+		return backend.BuildJointTx([]*backend.Contribution{{
+			Owner:  address,
+			Utxos:  ledgerUtxos(t, scriptNode, address),
+			Amount: target.Amount,
+		}}, opts, target)
+	}
+	spendTx, err := spendScript(lock, nil, &backend.TxTargetTy{
+		Address: funder.Address(),
+		Amount:  60,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlockWith := func(signer backend.PrivateKey) *backend.Transaction {
+		tx := *spendTx
+		tx.InputSigs = nil
+		sig, err := signer.Sign(tx.SigningHash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		unlock, err := script.NewBuilder().AddData(sig).AddData(bobKey).Script()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for id := range tx.Inputs {
+			if err := tx.UnlockInput(id, lock, unlock); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return &tx
+	}
+
+	t.Run("Unlock with the wrong key", func(t *testing.T) {
+		if err := scriptNode.AcceptTx(unlockWith(funder.PrivKey)); err == nil {
+			t.Error("Expected an unlock with the wrong key to be refused")
+		}
+	})
+	t.Run("Unlock with a script that does more than push data", func(t *testing.T) {
+		tx := unlockWith(bob.PrivKey)
+		for _, sig := range tx.InputSigs {
+			sig.Signature = append(sig.Signature, byte(script.OP_DROP))
+		}
+		if err := scriptNode.AcceptTx(tx); err == nil {
+			t.Error("Expected an unlock script that does more than push data to be refused")
+		}
+	})
+	t.Run("Unlock with the key of the script", func(t *testing.T) {
+		if err := scriptNode.AcceptTx(unlockWith(bob.PrivKey)); err != nil {
+			t.Errorf("Expected the unlock with the key of the script to be accepted, got %v", err)
+		}
+	})
+	t.Run("Time lock before its height", func(t *testing.T) {
+		timeLockScript, err := script.TimeLock(10, bobKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		timeLock, _ := backend.NewScriptKey(timeLockScript)
+		fundTx, _, err := backend.BuildTx(funder.PrivKey.Public(), ledgerUtxos(t, scriptNode, funder.Address()), nil, &backend.TxTargetTy{
+			Address: backend.AddressFromPubKey(timeLock),
+			Amount:  10,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		backend.SignTxWithKey(fundTx, funder.PrivKey)
+		if err := scriptNode.ApplyTx(fundTx); err != nil {
+			t.Fatal(err)
+		}
+		for _, lockTime := range []int64{0, 10} {
+			tx, err := spendScript(timeLock, &backend.TxOptions{LockTime: lockTime}, &backend.TxTargetTy{
+				Address: bob.Address(),
+				Amount:  10,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig, _ := bob.PrivKey.Sign(tx.SigningHash())
+			unlock, _ := script.NewBuilder().AddData(sig).Script()
+			for id := range tx.Inputs {
+				tx.UnlockInput(id, timeLock, unlock)
+			}
+			if err := scriptNode.AcceptTx(tx); err == nil {
+				t.Errorf("Expected a spend with lock time %d to be refused before height 10", lockTime)
+			}
+		}
+	})
+}
+
+func TestJointTransaction(t *testing.T) {
+	funder := backend.NewWallet(backend.DefaultKeyType)
+	alice := backend.NewWallet(backend.DefaultKeyType)
+	bob := backend.NewWallet(backend.DefaultKeyType)
+	carol := backend.NewWallet(backend.DefaultKeyType)
+	jointNode := newFundedTestNode(t, funder.PrivKey.Public())
+	ledgerBalance := func(address backend.Address) int {
+		sum := 0
+		if e, ok := jointNode.Ledger.Get(address); ok {
+			for _, utxo := range e.WalletInfoSnapshot().Utxos {
+				sum += utxo.Amount
+			}
+		}
+		return sum
+	}
+	fundTx, _, err := backend.BuildTx(funder.PrivKey.Public(), ledgerUtxos(t, jointNode, funder.Address()), nil,
+		&backend.TxTargetTy{Address: alice.Address(), Amount: 100},
+		&backend.TxTargetTy{Address: bob.Address(), Amount: 100},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.SignTxWithKey(fundTx, funder.PrivKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := jointNode.ApplyTx(fundTx); err != nil {
+		t.Fatal(err)
+	}
+	jointTx, err := backend.BuildJointTx([]*backend.Contribution{
+		{Owner: alice.Address(), Utxos: ledgerUtxos(t, jointNode, alice.Address()), Amount: 60},
+		{Owner: bob.Address(), Utxos: ledgerUtxos(t, jointNode, bob.Address()), Amount: 40},
+	}, nil, &backend.TxTargetTy{Address: carol.Address(), Amount: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owners := jointTx.Owners(); len(owners) != 2 {
+		t.Fatalf("Expected 2 input owners, got %d", len(owners))
+	}
+
+	t.Run("Sign the inputs of another owner", func(t *testing.T) {
+		tx := *jointTx
+		tx.InputSigs = nil
+		for id, txIn := range tx.Inputs {
+			if txIn.OwnerAddress() != bob.Address() {
+				continue
+			}
+			if err := tx.SignInput(id, alice.PrivKey); err == nil {
+				t.Error("Expected signing an input of bob with the key of alice to fail")
+			}
+		}
+	})
+	t.Run("Submit with unsigned inputs", func(t *testing.T) {
+		tx := *jointTx
+		tx.InputSigs = nil
+		if _, err := tx.SignInputsWithKey(alice.PrivKey); err != nil {
+			t.Fatal(err)
+		}
+		if len(tx.UnsignedInputs()) == 0 {
+			t.Fatal("Expected the inputs of bob to be unsigned")
+		}
+		if err := jointNode.AcceptTx(&tx); err == nil {
+			t.Error("Expected a transaction with unsigned inputs to be refused")
+		}
+	})
+	t.Run("Submit with a signature swapped between inputs", func(t *testing.T) {
+		tx := *jointTx
+		tx.InputSigs = nil
+		backend.SignTxWithKey(&tx, alice.PrivKey)
+		backend.SignTxWithKey(&tx, bob.PrivKey)
+		var aliceSig *backend.InputSig
+		for id, txIn := range tx.Inputs {
+			if txIn.OwnerAddress() == alice.Address() {
+				aliceSig = tx.InputSigs[id]
+			}
+		}
+		for id, txIn := range tx.Inputs {
+			if txIn.OwnerAddress() == bob.Address() {
+				tx.InputSigs[id] = aliceSig
+			}
+		}
+		if err := jointNode.AcceptTx(&tx); err == nil {
+			t.Error("Expected a signature swapped between inputs to be refused")
+		}
+	})
+	t.Run("Submit signed by every owner", func(t *testing.T) {
+		tx := *jointTx
+		tx.InputSigs = nil
+		for _, owner := range []*backend.Wallet{alice, bob} {
+			if err := backend.SignTxWithKey(&tx, owner.PrivKey); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := jointNode.AcceptTx(&tx); err != nil {
+			t.Fatalf("Expected the transaction signed by every owner to be accepted, got %v", err)
+		}
+		if err := jointNode.ApplyTx(&tx); err != nil {
+			t.Fatal(err)
+		}
+		for address, expected := range map[backend.Address]int{alice.Address(): 40, bob.Address(): 60, carol.Address(): 100} {
+			if balance := ledgerBalance(address); balance != expected {
+				t.Errorf("Expected %s to have %d, got %d", address, expected, balance)
+			}
+		}
+		if err := jointNode.RevertTx(&tx); err != nil {
+			t.Fatal(err)
+		}
+		for address, expected := range map[backend.Address]int{alice.Address(): 100, bob.Address(): 100, carol.Address(): 0} {
+			if balance := ledgerBalance(address); balance != expected {
+				t.Errorf("Expected %s to have %d after the revert, got %d", address, expected, balance)
+			}
+		}
+	})
+}
+
+func TestEncryptedMemo(t *testing.T) {
+	memoNode := newFundedTestNode(t, nil)
+	shop := backend.NewWallet(backend.DefaultKeyType)
+	if err := memoNode.Accounts.Add("shop", shop); err != nil {
+		t.Fatal(err)
+	}
+	funding, err := memoNode.Wallet.CreateAndSignTx(100, shop.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := memoNode.ApplyTx(funding); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Memo read by the recipient only", func(t *testing.T) {
+		sealed, err := backend.SealMemo(memoNode.Wallet.PrivKey.Public(), "invoice 42")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, _, err := shop.CreateAndSignTxWithOptions(&backend.TxOptions{Memo: sealed}, &backend.TxTargetTy{
+			Address: memoNode.Wallet.Address(),
+			Amount:  10,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := memoNode.SubmitOwnTx(tx); err != nil {
+			t.Fatal(err)
+		}
+		var found bool
+		entries, _ := memoNode.WalletHistory(memoNode.Wallet, &HistoryFilter{})
+		for _, e := range entries {
+			if e.Direction == HistoryIncoming && e.Amount == 10 {
+				found = true
+				if e.Memo != "invoice 42" {
+					t.Errorf("Expected the recipient to read memo %q, got %q", "invoice 42", e.Memo)
+				}
+			}
+		}
+		if !found {
+			t.Error("Expected the payment in the history of the recipient")
+		}
+		entries, _ = memoNode.WalletHistory(shop, &HistoryFilter{})
+		for _, e := range entries {
+			if e.Memo != "" {
+				t.Errorf("Expected the sender not to read the memo, got %q", e.Memo)
+			}
+		}
+	})
+	t.Run("Change the memo after signing", func(t *testing.T) {
+		sealed, err := backend.SealMemo(memoNode.Wallet.PrivKey.Public(), "invoice 43")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, _, err := shop.CreateAndSignTxWithOptions(&backend.TxOptions{Memo: sealed}, &backend.TxTargetTy{
+			Address: memoNode.Wallet.Address(),
+			Amount:  10,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tx.Memo, err = backend.SealMemo(memoNode.Wallet.PrivKey.Public(), "invoice 44"); err != nil {
+			t.Fatal(err)
+		}
+		if err := memoNode.AcceptTx(tx); err == nil {
+			t.Error("Expected a memo changed after signing to be refused")
+		}
+	})
+	t.Run("Memo over the size cap", func(t *testing.T) {
+		tx, _, err := shop.CreateTxWithOptions(&backend.TxOptions{Memo: make([]byte, backend.MaxSealedMemoSize+1)}, &backend.TxTargetTy{
+			Address: memoNode.Wallet.Address(),
+			Amount:  10,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := shop.SignTx(tx); err != nil {
+			t.Fatal(err)
+		}
+		if err := memoNode.AcceptTx(tx); err == nil {
+			t.Error("Expected a memo over the size cap to be refused")
+		}
+	})
+}
+
+func TestReservationExpiry(t *testing.T) {
+	expiryNode := newFundedTestNode(t, nil)
+	shop := backend.NewWallet(backend.DefaultKeyType)
+
+	submitted, err := expiryNode.Wallet.CreateAndSignTx(10, shop.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := expiryNode.SubmitOwnTx(submitted); err != nil {
+		t.Fatal(err)
+	}
+	// e.g. a partially signed transaction that was never submitted
+	txOut := backend.NewTxOut(expiryNode.Wallet.PrivKey.Public(), 20)
+	txOut.ComputeAndFillHash()
+	expiryNode.Wallet.AddUtxo(txOut)
+	unsubmitted, err := expiryNode.Wallet.CreateAndSignTx(10, shop.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	submittedId, unsubmittedId := backend.HexEncodeByteSlice(submitted.Id), backend.HexEncodeByteSlice(unsubmitted.Id)
+	for _, reservation := range expiryNode.Wallet.Reserved {
+		reservation.CreatedAt = time.Now().Add(-2 * backend.ReservationTimeout)
+	}
+	expiryNode.releaseExpiredReservations()
+
+	if _, ok := expiryNode.Wallet.Reserved[submittedId]; !ok {
+		t.Error("Expected the pending transaction to keep its inputs reserved")
+	}
+	if e, _ := expiryNode.txIndex.Get(submittedId); e.Status != TxPending || expiryNode.pendingTxs.Len() != 1 {
+		t.Errorf("Expected the pending transaction to stay pending, it is %s", e.Status)
+	}
+	if _, ok := expiryNode.Wallet.Reserved[unsubmittedId]; ok {
+		t.Error("Expected the reservation of the unsubmitted transaction to be released")
+	}
+}
+
+func TestAutoConsolidate(t *testing.T) {
+	consolidateNode := newFundedTestNode(t, nil)
+	dust := backend.NewWallet(backend.DefaultKeyType)
+	if err := consolidateNode.Accounts.Add("dust", dust); err != nil {
+		t.Fatal(err)
+	}
+	limit, maxInputs := AutoConsolidateLimit, ConsolidateMaxInputs
+	AutoConsolidateLimit, ConsolidateMaxInputs = 10, 12
+	defer func() { AutoConsolidateLimit, ConsolidateMaxInputs = limit, maxInputs }()
+
+	// pays 20 utxos of 5 to the dust account
+	tx, _, err := consolidateNode.Wallet.CreateAndSignTxWithOptions(&backend.TxOptions{SplitPolicy: backend.NewDenominationSplit(5)}, &backend.TxTargetTy{
+		Address: dust.Address(),
+		Amount:  100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := consolidateNode.SubmitOwnTx(tx); err != nil {
+		t.Fatal(err)
+	}
+	mineTestBlock(t, consolidateNode)
+
+	t.Run("Consolidate an account above the limit", func(t *testing.T) {
+		consolidateNode.autoConsolidate()
+		if len(dust.Reserved) != 1 {
+			t.Fatalf("Expected a single consolidation of the account to be pending, got %d", len(dust.Reserved))
+		}
+		if cnt := dust.UnreservedUtxoCount(); cnt != 20-ConsolidateMaxInputs {
+			t.Errorf("Expected %d unreserved utxos, got %d", 20-ConsolidateMaxInputs, cnt)
+		}
+	})
+	t.Run("Pending consolidation", func(t *testing.T) {
+		pending := consolidateNode.pendingTxs.Len()
+		consolidateNode.autoConsolidate()
+		if len(dust.Reserved) != 1 || consolidateNode.pendingTxs.Len() != pending {
+			t.Errorf("Expected no new consolidation while one is pending, got %d pending for the account", len(dust.Reserved))
+		}
+	})
+}
@@ -2,34 +2,68 @@ package node
 
 import (
 	"bytes"
-	"crypto/rsa"
 	"fmt"
 	"log"
 	"net/http"
-	"sync"
+	"sort"
+	"strconv"
 
 	bck "github.com/kon-pap/noobcash/pkg/node/backend"
 )
 
 type NodeInfo struct {
 	// channels for comms
-	Id       int
-	WInfo    *bck.WalletInfo
-	Hostname string
-	Port     string
-	Mu       sync.Mutex
+	Id           int
+	*LedgerEntry // shared with the ledger of the node
+	Hostname     string
+	Port         string
 }
 
-func NewNodeInfo(id int, hostname, port string, pubKey *rsa.PublicKey) *NodeInfo {
+func NewNodeInfo(id int, hostname, port string, pubKey bck.PublicKey) *NodeInfo {
 	newNodeInfo := &NodeInfo{
-		Id:       id,
-		WInfo:    bck.NewWalletInfo(pubKey),
-		Hostname: hostname,
-		Port:     port,
+		Id:          id,
+		LedgerEntry: NewLedgerEntry(pubKey),
+		Hostname:    hostname,
+		Port:        port,
 	}
 	return newNodeInfo
 }
 
+// Returns the members of the ring ordered by id
+func (n *Node) ringMembers() []*NodeInfo {
+	n.muRingLock.Lock()
+	defer n.muRingLock.Unlock()
+	members := make([]*NodeInfo, 0, len(n.Ring))
+	for _, nInfo := range n.Ring {
+		members = append(members, nInfo)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Id < members[j].Id })
+	return members
+}
+
+// Finds a member of the ring by its node id or its address
+func (n *Node) findRingMember(idOrAddress string) (*NodeInfo, error) {
+	if id, err := strconv.Atoi(idOrAddress); err == nil {
+		for _, nInfo := range n.ringMembers() {
+			if nInfo.Id == id {
+				return nInfo, nil
+			}
+		}
+		return nil, fmt.Errorf("node %d is not in the ring", id)
+	}
+	address, err := bck.ParseAddress(idOrAddress)
+	if err != nil {
+		return nil, err
+	}
+	n.muRingLock.Lock()
+	defer n.muRingLock.Unlock()
+	nInfo, ok := n.Ring[address]
+	if !ok {
+		return nil, fmt.Errorf("address %s is not in the ring", address)
+	}
+	return nInfo, nil
+}
+
 func (n *Node) SendByteSlice(data []byte, hostname, port string, endpoint endpointTy) (string, error) {
 	return GetResponseBody(
 		http.Post(
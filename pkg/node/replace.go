@@ -0,0 +1,103 @@
+package node
+
+import (
+	"fmt"
+	"log"
+
+	bck "github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+// Most pending transactions a single transaction can replace
+const MaxReplacedTxs = 10
+
+// Checks that tx, paying fee, may replace the pending transactions spending
+// any of its inputs, which are then evicted. The replacement must:
+//   - replace at most MaxReplacedTxs transactions
+//   - pay a fee no lower than the sum of their fees
+//   - pay a higher fee than them, or pay different outputs
+//
+// The fees are computed from the UTXOs of the ledger, see Node.ledgerFee, as
+// the amounts the inputs claim are not signed.
+func checkReplacement(tx *bck.Transaction, fee int, conflicts []*bck.Transaction, conflictFees []int) error {
+	if len(conflicts) > MaxReplacedTxs {
+		return fmt.Errorf("transaction would replace %d pending transactions, at most %d can be replaced", len(conflicts), MaxReplacedTxs)
+	}
+	replacedFee := 0
+	for _, conflictFee := range conflictFees {
+		replacedFee += conflictFee
+	}
+	if fee < replacedFee {
+		return fmt.Errorf("transaction pays a fee of %d, lower than the %d of the pending transactions it conflicts with", fee, replacedFee)
+	}
+	if fee == replacedFee && len(conflicts) == 1 && samePayments(tx, conflicts[0]) {
+		return fmt.Errorf("transaction pays the same outputs with the same fee as pending transaction %s", bck.HexEncodeByteSlice(conflicts[0].Id))
+	}
+	return nil
+}
+
+// Returns the fee of tx, with the amounts of its inputs taken from the ledger
+func (n *Node) ledgerFee(tx *bck.Transaction) (int, error) {
+	spent, err := n.spentUtxos(tx)
+	if err != nil {
+		return 0, err
+	}
+	return tx.FeeFrom(spent), nil
+}
+
+type payment struct {
+	address  bck.Address
+	amount   int
+	lockTime int64
+	asset    string
+}
+
+// Returns true if a and b pay the same amounts to the same addresses
+func samePayments(a, b *bck.Transaction) bool {
+	if len(a.Outputs) != len(b.Outputs) {
+		return false
+	}
+	payments := map[payment]int{}
+	for _, txOut := range a.Outputs {
+		payments[payment{txOut.OwnerAddress(), txOut.Amount, txOut.LockTime, txOut.Asset}]++
+	}
+	for _, txOut := range b.Outputs {
+		p := payment{txOut.OwnerAddress(), txOut.Amount, txOut.LockTime, txOut.Asset}
+		if payments[p] == 0 {
+			return false
+		}
+		payments[p]--
+	}
+	return true
+}
+
+// Marks the transactions replaced by tx and releases the UTXOs this node may
+// have reserved for them
+func (n *Node) markReplaced(replaced []*bck.Transaction, by *bck.Transaction) {
+	byTxId := bck.HexEncodeByteSlice(by.Id)
+	for _, tx := range replaced {
+		txId := bck.HexEncodeByteSlice(tx.Id)
+		log.Println("Transaction", txId, "replaced by", byTxId)
+		n.txIndex.MarkReplaced(txId, byTxId)
+		n.Accounts.ReleaseTx(txId)
+	}
+}
+
+// Replaces the pending transaction with the given id with the transaction
+// create makes from it, see checkReplacement
+func (n *Node) ReplaceTx(txId string, create func(original *bck.Transaction) (*bck.Transaction, error)) (*bck.Transaction, error) {
+	e, ok := n.txIndex.Get(txId)
+	if !ok {
+		return nil, fmt.Errorf("transaction %s not found", txId)
+	}
+	if e.Status != TxPending && e.Status != TxOrphaned {
+		return nil, fmt.Errorf("transaction %s is %s, only pending transactions can be replaced", txId, e.Status)
+	}
+	tx, err := create(e.Tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := n.SubmitOwnTx(tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
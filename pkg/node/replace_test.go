@@ -0,0 +1,123 @@
+package node
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+func TestReplaceByFee(t *testing.T) {
+	rbfNode := newFundedTestNode(t, nil)
+	peer := newTestPeer(t, 0, rbfNode)
+	shop := backend.NewWallet(backend.DefaultKeyType)
+	balance := rbfNode.Wallet.Balance
+
+	// replaces the transaction with the given id, as the replace endpoint does
+	replace := func(txId string, fee int, targets ...*backend.TxTargetTy) (*backend.Transaction, error) {
+		return rbfNode.ReplaceTx(txId, func(original *backend.Transaction) (*backend.Transaction, error) {
+			return rbfNode.Wallet.CreateAndSignReplacementTx(original, fee, targets...)
+		})
+	}
+	// returns the pending transaction replacing the one with the given id
+	replacement := func(txId string) *backend.Transaction {
+		e, _ := rbfNode.txIndex.Get(txId)
+		if e.Status != TxReplaced {
+			t.Fatalf("Expected transaction %s to be replaced, it is %s", txId, e.Status)
+		}
+		by, _ := rbfNode.txIndex.Get(e.ReplacedBy)
+		return by.Tx
+	}
+
+	original, err := rbfNode.Wallet.CreateAndSignTx(30, shop.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rbfNode.SubmitOwnTx(original); err != nil {
+		t.Fatal(err)
+	}
+	// relayed to the peer, as broadcasting would
+	if err := peer.AcceptTx(original); err != nil {
+		t.Fatal(err)
+	}
+	originalId := backend.HexEncodeByteSlice(original.Id)
+
+	var bumped *backend.Transaction
+	t.Run("Replacement paying the same outputs and fee", func(t *testing.T) {
+		if _, err := replace(originalId, 0); err == nil {
+			t.Error("Expected a replacement paying the same outputs and fee to be refused")
+		}
+		if e, _ := rbfNode.txIndex.Get(originalId); e.Status != TxPending {
+			t.Errorf("Expected the original to stay pending, it is %s", e.Status)
+		}
+	})
+	t.Run("Replacement paying a higher fee", func(t *testing.T) {
+		var err error
+		if bumped, err = replace(originalId, 5); err != nil {
+			t.Fatal(err)
+		}
+		if by := replacement(originalId); !bytes.Equal(by.Id, bumped.Id) {
+			t.Errorf("Expected the original to be replaced by %x, got %x", bumped.Id, by.Id)
+		}
+		if bumped.Fee() != 5 || rbfNode.pendingTxs.Len() != 1 {
+			t.Errorf("Expected a single pending transaction with a fee of 5, got %d with a fee of %d", rbfNode.pendingTxs.Len(), bumped.Fee())
+		}
+		if err := peer.AcceptTx(bumped); err != nil {
+			t.Errorf("Expected the peer to accept the replacement, got %v", err)
+		}
+		if e, _ := peer.txIndex.Get(originalId); e.Status != TxReplaced {
+			t.Errorf("Expected the peer to evict the original, it is %s", e.Status)
+		}
+	})
+	t.Run("Replacement claiming inflated inputs", func(t *testing.T) {
+		inflated, err := rbfNode.Wallet.CreateReplacementTx(bumped, 0, &backend.TxTargetTy{Address: shop.Address(), Amount: 20})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rbfNode.Wallet.ReleaseTx(backend.HexEncodeByteSlice(inflated.Id))
+		// the amounts of the inputs are not signed, only their ids
+		for id, txIn := range inflated.Inputs {
+			claimed := *txIn
+			claimed.Amount += 10
+			inflated.Inputs[id] = &claimed
+		}
+		inflated.ComputeAndFillHash()
+		if err := backend.SignTxWithKey(inflated, rbfNode.Wallet.PrivKey); err != nil {
+			t.Fatal(err)
+		}
+		if inflated.Fee() <= bumped.Fee() {
+			t.Fatalf("Expected the claimed fee of %d to exceed %d", inflated.Fee(), bumped.Fee())
+		}
+		if err := peer.AcceptTx(inflated); err == nil {
+			t.Error("Expected the peer to refuse a replacement claiming inflated inputs")
+		}
+		if e, _ := peer.txIndex.Get(backend.HexEncodeByteSlice(bumped.Id)); e.Status != TxPending {
+			t.Errorf("Expected the peer to keep the replacement pending, it is %s", e.Status)
+		}
+	})
+	t.Run("Replacement paying a lower fee", func(t *testing.T) {
+		if _, err := replace(backend.HexEncodeByteSlice(bumped.Id), 0, &backend.TxTargetTy{Address: shop.Address(), Amount: 20}); err == nil {
+			t.Error("Expected a replacement paying a lower fee to be refused")
+		}
+		if err := peer.AcceptTx(original); err == nil {
+			t.Error("Expected the peer to refuse the original again")
+		}
+	})
+	t.Run("Cancel a transaction", func(t *testing.T) {
+		bumpedId := backend.HexEncodeByteSlice(bumped.Id)
+		if _, err := rbfNode.ReplaceTx(bumpedId, rbfNode.Wallet.CreateAndSignCancellationTx); err != nil {
+			t.Fatal(err)
+		}
+		cancellation := replacement(bumpedId)
+		block := mineTestBlock(t, rbfNode)
+		if len(block.Transactions) != 1 || !bytes.Equal(block.Transactions[0].Id, cancellation.Id) {
+			t.Errorf("Expected only the cancellation to be mined, got %d transaction(s)", len(block.Transactions))
+		}
+		if e, _ := rbfNode.Ledger.Get(shop.Address()); e != nil {
+			t.Errorf("Expected the shop never to be paid, it has %d", e.WInfo.Balance)
+		}
+		if rbfNode.Wallet.Balance != balance-5 {
+			t.Errorf("Expected a balance of %d after paying the fee, got %d", balance-5, rbfNode.Wallet.Balance)
+		}
+	})
+}
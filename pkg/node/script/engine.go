@@ -0,0 +1,372 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// Checks the parts of the spending transaction a script can refer to.
+//
+// It keeps the language independent of the key types and of the encoding of
+// transactions.
+type Checker interface {
+	// Checks sig against the signing hash of the transaction
+	CheckSig(sig, pubKey []byte) error
+	// Checks that the transaction cannot be included before lockTime
+	CheckLockTime(lockTime int64) error
+}
+
+var (
+	stackUnderflowErr = errors.New("not enough elements on the stack")
+	stackOverflowErr  = fmt.Errorf("more than %d elements on the stack", MaxStackSize)
+	tooManyOpsErr     = fmt.Errorf("more than %d opcodes executed", MaxOps)
+	unbalancedIfErr   = errors.New("unbalanced conditional")
+	verifyErr         = errors.New("verification failed")
+	numberErr         = errors.New("element is not a valid number")
+)
+
+// Checks that unlock satisfies lock.
+//
+// unlock must only push data, so that it cannot change how lock runs.
+func Verify(unlock, lock []byte, checker Checker) error {
+	if !IsPushOnly(unlock) {
+		return errors.New("unlocking script must only push data")
+	}
+	e := &engine{checker: checker}
+	if err := e.run(unlock); err != nil {
+		return fmt.Errorf("unlocking script: %s", err)
+	}
+	if err := e.run(lock); err != nil {
+		return fmt.Errorf("locking script: %s", err)
+	}
+	if len(e.stack) == 0 || !asBool(e.stack[len(e.stack)-1]) {
+		return errors.New("locking script did not end with a true value")
+	}
+	return nil
+}
+
+type engine struct {
+	checker Checker
+	stack   [][]byte
+	ops     int
+}
+
+func (e *engine) push(data []byte) error {
+	if len(e.stack) >= MaxStackSize {
+		return stackOverflowErr
+	}
+	e.stack = append(e.stack, data)
+	return nil
+}
+
+func (e *engine) pop() ([]byte, error) {
+	if len(e.stack) == 0 {
+		return nil, stackUnderflowErr
+	}
+	top := e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
+	return top, nil
+}
+
+func (e *engine) popInt(maxLen int) (int64, error) {
+	data, err := e.pop()
+	if err != nil {
+		return 0, err
+	}
+	return decodeNum(data, maxLen)
+}
+
+func (e *engine) run(s []byte) error {
+	instructions, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	// whether each enclosing conditional branch is being executed
+	var branches []bool
+	executing := func() bool {
+		for _, b := range branches {
+			if !b {
+				return false
+			}
+		}
+		return true
+	}
+	for _, ins := range instructions {
+		if !ins.Op.isPush() {
+			if e.ops++; e.ops > MaxOps {
+				return tooManyOpsErr
+			}
+		}
+		switch ins.Op {
+		case OP_IF, OP_NOTIF:
+			taken := false
+			if executing() {
+				cond, err := e.pop()
+				if err != nil {
+					return err
+				}
+				taken = asBool(cond) == (ins.Op == OP_IF)
+			}
+			branches = append(branches, taken)
+			continue
+		case OP_ELSE:
+			if len(branches) == 0 {
+				return unbalancedIfErr
+			}
+			branches[len(branches)-1] = !branches[len(branches)-1]
+			continue
+		case OP_ENDIF:
+			if len(branches) == 0 {
+				return unbalancedIfErr
+			}
+			branches = branches[:len(branches)-1]
+			continue
+		}
+		if !executing() {
+			continue
+		}
+		if err := e.step(ins); err != nil {
+			return fmt.Errorf("%s: %s", ins.Op, err)
+		}
+	}
+	if len(branches) != 0 {
+		return unbalancedIfErr
+	}
+	return nil
+}
+
+func (e *engine) step(ins Instruction) error {
+	switch op := ins.Op; {
+	case op == OP_0 || (op > OP_0 && op <= OP_PUSHDATA2):
+		return e.push(ins.Data)
+	case op == OP_1NEGATE:
+		return e.push(encodeNum(-1))
+	case op >= OP_1 && op <= OP_16:
+		return e.push(encodeNum(int64(op-OP_1) + 1))
+	}
+
+	switch ins.Op {
+	case OP_VERIFY:
+		top, err := e.pop()
+		if err != nil {
+			return err
+		}
+		if !asBool(top) {
+			return verifyErr
+		}
+	case OP_RETURN:
+		return errors.New("output is unspendable")
+	case OP_DROP:
+		_, err := e.pop()
+		return err
+	case OP_DUP:
+		if len(e.stack) == 0 {
+			return stackUnderflowErr
+		}
+		return e.push(e.stack[len(e.stack)-1])
+	case OP_SWAP:
+		if len(e.stack) < 2 {
+			return stackUnderflowErr
+		}
+		n := len(e.stack)
+		e.stack[n-1], e.stack[n-2] = e.stack[n-2], e.stack[n-1]
+	case OP_SIZE:
+		if len(e.stack) == 0 {
+			return stackUnderflowErr
+		}
+		return e.push(encodeNum(int64(len(e.stack[len(e.stack)-1]))))
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, err := e.pop()
+		if err != nil {
+			return err
+		}
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		equal := bytes.Equal(a, b)
+		if ins.Op == OP_EQUALVERIFY {
+			if !equal {
+				return verifyErr
+			}
+			return nil
+		}
+		return e.push(fromBool(equal))
+	case OP_SHA256, OP_KEYHASH:
+		data, err := e.pop()
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		if ins.Op == OP_KEYHASH {
+			return e.push(sum[:KeyHashSize])
+		}
+		return e.push(sum[:])
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		pubKey, err := e.pop()
+		if err != nil {
+			return err
+		}
+		sig, err := e.pop()
+		if err != nil {
+			return err
+		}
+		valid := e.checker.CheckSig(sig, pubKey) == nil
+		if ins.Op == OP_CHECKSIGVERIFY {
+			if !valid {
+				return verifyErr
+			}
+			return nil
+		}
+		return e.push(fromBool(valid))
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		valid, err := e.checkMultisig()
+		if err != nil {
+			return err
+		}
+		if ins.Op == OP_CHECKMULTISIGVERIFY {
+			if !valid {
+				return verifyErr
+			}
+			return nil
+		}
+		return e.push(fromBool(valid))
+	case OP_CHECKLOCKTIMEVERIFY:
+		if len(e.stack) == 0 {
+			return stackUnderflowErr
+		}
+		// the lock time is left on the stack, usually dropped right after
+		lockTime, err := decodeNum(e.stack[len(e.stack)-1], 5)
+		if err != nil {
+			return err
+		}
+		if lockTime < 0 {
+			return errors.New("negative lock time")
+		}
+		return e.checker.CheckLockTime(lockTime)
+	default:
+		return fmt.Errorf("unknown opcode %#02x", byte(ins.Op))
+	}
+	return nil
+}
+
+// Pops '<sig>... <m> <pubKey>... <n>' and checks that the m signatures match
+// m of the keys, in the same order
+func (e *engine) checkMultisig() (bool, error) {
+	n, err := e.popInt(4)
+	if err != nil {
+		return false, err
+	}
+	if n < 1 || n > MaxMultisigKeys {
+		return false, fmt.Errorf("invalid number of keys %d", n)
+	}
+	if e.ops += int(n); e.ops > MaxOps {
+		return false, tooManyOpsErr
+	}
+	pubKeys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		if pubKeys[i], err = e.pop(); err != nil {
+			return false, err
+		}
+	}
+	m, err := e.popInt(4)
+	if err != nil {
+		return false, err
+	}
+	if m < 1 || m > n {
+		return false, fmt.Errorf("invalid number of signatures %d of %d", m, n)
+	}
+	sigs := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		if sigs[i], err = e.pop(); err != nil {
+			return false, err
+		}
+	}
+	key := 0
+	for _, sig := range sigs {
+		for key < len(pubKeys) && e.checker.CheckSig(sig, pubKeys[key]) != nil {
+			key++
+		}
+		if key == len(pubKeys) {
+			return false, nil
+		}
+		key++
+	}
+	return true, nil
+}
+
+// Size of the hashes pushed by OP_KEYHASH
+const KeyHashSize = 20
+
+func KeyHash(pubKey []byte) []byte {
+	sum := sha256.Sum256(pubKey)
+	return sum[:KeyHashSize]
+}
+
+// Any element other than zero, in any of its encodings, is true
+func asBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			// negative zero
+			return !(i == len(data)-1 && b == 0x80)
+		}
+	}
+	return false
+}
+
+func fromBool(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+	return []byte{}
+}
+
+// Numbers are little endian, with the sign in the highest bit of the last byte
+func encodeNum(n int64) []byte {
+	if n == 0 {
+		return []byte{}
+	}
+	negative := n < 0
+	if negative {
+		n = -n
+	}
+	var data []byte
+	for n > 0 {
+		data = append(data, byte(n&0xff))
+		n >>= 8
+	}
+	if data[len(data)-1]&0x80 != 0 {
+		if negative {
+			data = append(data, 0x80)
+		} else {
+			data = append(data, 0)
+		}
+	} else if negative {
+		data[len(data)-1] |= 0x80
+	}
+	return data
+}
+
+func decodeNum(data []byte, maxLen int) (int64, error) {
+	if len(data) > maxLen {
+		return 0, numberErr
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	// only the minimal encoding is accepted
+	if data[len(data)-1]&0x7f == 0 && (len(data) == 1 || data[len(data)-2]&0x80 == 0) {
+		return 0, numberErr
+	}
+	var n int64
+	for i, b := range data {
+		n |= int64(b) << (8 * uint(i))
+	}
+	if data[len(data)-1]&0x80 != 0 {
+		n &= ^(int64(0x80) << (8 * uint(len(data)-1)))
+		return -n, nil
+	}
+	return n, nil
+}
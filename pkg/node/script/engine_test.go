@@ -0,0 +1,298 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Accepts a signature made of "sig:" and the key, and lock times up to height
+type testChecker struct {
+	height int64
+}
+
+func testSig(pubKey []byte) []byte {
+	return append([]byte("sig:"), pubKey...)
+}
+
+func (c testChecker) CheckSig(sig, pubKey []byte) error {
+	if !bytes.Equal(sig, testSig(pubKey)) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func (c testChecker) CheckLockTime(lockTime int64) error {
+	if lockTime > c.height {
+		return fmt.Errorf("locked until %d", lockTime)
+	}
+	return nil
+}
+
+func sha256Of(s string) []byte {
+	sum := sha256.Sum256([]byte(s))
+	return sum[:]
+}
+
+func mustAssemble(t *testing.T, asm string) []byte {
+	t.Helper()
+	s, err := Assemble(asm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Runs lock with an empty unlocking script
+func verifyLock(t *testing.T, asm string) error {
+	t.Helper()
+	return Verify(nil, mustAssemble(t, asm), testChecker{})
+}
+
+func expectErr(t *testing.T, err, expected error) {
+	t.Helper()
+	if err == nil || !strings.Contains(err.Error(), expected.Error()) {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	t.Run("Script size", func(t *testing.T) {
+		if _, err := Parse(make([]byte, MaxScriptSize)); err != nil {
+			t.Errorf("Expected a script of %d bytes to parse, got %v", MaxScriptSize, err)
+		}
+		_, err := Parse(make([]byte, MaxScriptSize+1))
+		expectErr(t, err, scriptSizeErr)
+	})
+	t.Run("Element size", func(t *testing.T) {
+		if _, err := NewBuilder().AddData(make([]byte, MaxElementSize)).Script(); err != nil {
+			t.Errorf("Expected an element of %d bytes to be pushed, got %v", MaxElementSize, err)
+		}
+		_, err := NewBuilder().AddData(make([]byte, MaxElementSize+1)).Script()
+		expectErr(t, err, elementSizeErr)
+		_, err = Parse([]byte{byte(OP_PUSHDATA1), 10, 1, 2})
+		expectErr(t, err, truncatedErr)
+	})
+	t.Run("Stack size", func(t *testing.T) {
+		if err := verifyLock(t, strings.Repeat("1 ", MaxStackSize)); err != nil {
+			t.Errorf("Expected %d elements to fit on the stack, got %v", MaxStackSize, err)
+		}
+		expectErr(t, verifyLock(t, strings.Repeat("1 ", MaxStackSize+1)), stackOverflowErr)
+		// the unlocking script shares the stack with the locking one
+		unlock := mustAssemble(t, strings.Repeat("1 ", MaxStackSize))
+		expectErr(t, Verify(unlock, mustAssemble(t, "OP_DUP"), testChecker{}), stackOverflowErr)
+	})
+	t.Run("Executed opcodes", func(t *testing.T) {
+		if err := verifyLock(t, "1"+strings.Repeat(" OP_DUP OP_DROP", MaxOps/2)); err != nil {
+			t.Errorf("Expected %d opcodes to run, got %v", MaxOps, err)
+		}
+		expectErr(t, verifyLock(t, "1"+strings.Repeat(" OP_DUP OP_DROP", MaxOps/2)+" OP_DUP"), tooManyOpsErr)
+		// opcodes of branches not taken count as well
+		expectErr(t, verifyLock(t, "0 OP_IF"+strings.Repeat(" OP_DUP", MaxOps)+" OP_ENDIF 1"), tooManyOpsErr)
+	})
+	t.Run("Keys of a multisig count as opcodes", func(t *testing.T) {
+		keys := make([]string, MaxMultisigKeys)
+		for i := range keys {
+			keys[i] = fmt.Sprintf("0x%02x", i+1)
+		}
+		multisig := "1 " + strings.Join(keys, " ") + fmt.Sprintf(" %d OP_CHECKMULTISIG OP_DROP", MaxMultisigKeys)
+		// each multisig runs 2 opcodes and one per key
+		count := MaxOps / (2 + MaxMultisigKeys)
+		asm := strings.Repeat("0x"+fmt.Sprintf("%x", testSig([]byte{1}))+" "+multisig+" ", count)
+		if err := verifyLock(t, asm+"1"); err != nil {
+			t.Fatalf("Expected %d multisigs to run, got %v", count, err)
+		}
+		expectErr(t, verifyLock(t, asm+"0x"+fmt.Sprintf("%x", testSig([]byte{1}))+" "+multisig+" 1"), tooManyOpsErr)
+	})
+}
+
+func TestNumbers(t *testing.T) {
+	t.Run("Minimal encoding", func(t *testing.T) {
+		for n, expected := range map[int64][]byte{
+			0:    {},
+			1:    {0x01},
+			-1:   {0x81},
+			127:  {0x7f},
+			128:  {0x80, 0x00},
+			-128: {0x80, 0x80},
+			255:  {0xff, 0x00},
+			256:  {0x00, 0x01},
+			-256: {0x00, 0x81},
+		} {
+			if data := encodeNum(n); !bytes.Equal(data, expected) {
+				t.Errorf("Expected %d to encode as %x, got %x", n, expected, data)
+			}
+			if decoded, err := decodeNum(expected, 4); err != nil || decoded != n {
+				t.Errorf("Expected %x to decode as %d, got %d (%v)", expected, n, decoded, err)
+			}
+		}
+	})
+	t.Run("Round trip", func(t *testing.T) {
+		for _, n := range []int64{2, -2, 1 << 15, -(1 << 15), 1<<31 - 1, -(1<<31 - 1), 1 << 38, -(1 << 38)} {
+			if decoded, err := decodeNum(encodeNum(n), 5); err != nil || decoded != n {
+				t.Errorf("Expected %d back, got %d (%v)", n, decoded, err)
+			}
+		}
+	})
+	t.Run("Non-minimal encodings", func(t *testing.T) {
+		for _, data := range [][]byte{
+			{0x00},             // zero
+			{0x80},             // negative zero
+			{0x00, 0x80},       // negative zero, padded
+			{0x01, 0x00},       // 1, padded
+			{0x7f, 0x80},       // -127, padded
+			{0x01, 0x00, 0x00}, // 1, padded twice
+		} {
+			if n, err := decodeNum(data, 4); err != numberErr {
+				t.Errorf("Expected %x to be refused, got %d (%v)", data, n, err)
+			}
+		}
+		if _, err := decodeNum([]byte{1, 2, 3, 4, 5}, 4); err != numberErr {
+			t.Errorf("Expected a number longer than 4 bytes to be refused, got %v", err)
+		}
+	})
+	t.Run("Truth of elements", func(t *testing.T) {
+		for _, data := range [][]byte{{}, {0x00}, {0x80}, {0x00, 0x00}, {0x00, 0x80}} {
+			if asBool(data) {
+				t.Errorf("Expected %x to be false", data)
+			}
+		}
+		for _, data := range [][]byte{{0x01}, {0x81}, {0x80, 0x00}, {0x00, 0x01}} {
+			if !asBool(data) {
+				t.Errorf("Expected %x to be true", data)
+			}
+		}
+		// negative zero fails a verification even though it is not empty
+		expectErr(t, verifyLock(t, "0x80 OP_VERIFY 1"), verifyErr)
+	})
+	t.Run("Numbers read by opcodes must be minimal", func(t *testing.T) {
+		expectErr(t, Verify(nil, mustAssemble(t, "0x0100 OP_CHECKLOCKTIMEVERIFY"), testChecker{height: 10}), numberErr)
+		expectErr(t, verifyLock(t, "0x01 0x01 0x0100 OP_CHECKMULTISIG"), numberErr)
+	})
+}
+
+func TestConditionals(t *testing.T) {
+	for asm, expected := range map[string]bool{
+		"1 OP_IF 1 OP_ELSE 0 OP_ENDIF":                                    true,
+		"0 OP_IF 1 OP_ELSE 0 OP_ENDIF":                                    false,
+		"0 OP_NOTIF 1 OP_ELSE 0 OP_ENDIF":                                 true,
+		"1 OP_IF 0 OP_IF 0 OP_ELSE 1 OP_ENDIF OP_ELSE 0 OP_ENDIF":         true,
+		"1 OP_IF 1 OP_IF 0 OP_ELSE 1 OP_ENDIF OP_ELSE 1 OP_ENDIF":         false,
+		"0 OP_IF 1 OP_IF 1 OP_ELSE 1 OP_ENDIF OP_ELSE 0 OP_ENDIF":         false,
+		"1 OP_IF 1 OP_ELSE 0 OP_ELSE 1 OP_ENDIF":                          true,
+		"0 1 OP_IF OP_IF 0 OP_ELSE 1 OP_ENDIF OP_ENDIF":                   true,
+		"1 OP_IF 1 OP_IF 1 OP_IF 1 OP_ENDIF OP_ENDIF OP_ENDIF":            true,
+		"0 OP_IF OP_RETURN OP_ELSE 1 OP_ENDIF":                            true,
+		"1 OP_IF OP_RETURN OP_ELSE 1 OP_ENDIF":                            false,
+		"0 OP_IF OP_IF OP_RETURN OP_ENDIF OP_ELSE 1 OP_ENDIF":             true,
+		"1 OP_NOTIF OP_RETURN OP_ELSE 1 OP_IF 1 OP_ENDIF OP_ENDIF 1":      true,
+		"0 OP_IF 0 OP_ELSE 0 OP_IF 0 OP_ELSE 1 OP_ENDIF OP_ENDIF":         true,
+		"0 OP_IF 1 OP_ELSE 1 OP_IF 0 OP_ELSE 1 OP_ENDIF OP_ENDIF":         false,
+		"1 OP_IF 1 OP_ELSE 0 OP_IF OP_RETURN OP_ELSE 1 OP_ENDIF OP_ENDIF": true,
+	} {
+		err := verifyLock(t, asm)
+		if expected && err != nil {
+			t.Errorf("Expected %q to succeed, got %v", asm, err)
+		} else if !expected && err == nil {
+			t.Errorf("Expected %q to fail", asm)
+		}
+	}
+	t.Run("Unbalanced conditionals", func(t *testing.T) {
+		for _, asm := range []string{
+			"1 OP_IF 1",
+			"1 OP_ENDIF",
+			"1 OP_ELSE 1",
+			"1 OP_IF 1 OP_ENDIF OP_ENDIF",
+			"1 OP_IF 1 OP_IF 1 OP_ENDIF",
+			"0 OP_IF OP_ELSE 1 OP_IF OP_ENDIF",
+			"0 OP_IF OP_ENDIF OP_ELSE 1",
+		} {
+			expectErr(t, verifyLock(t, asm), unbalancedIfErr)
+		}
+	})
+	t.Run("Condition missing", func(t *testing.T) {
+		expectErr(t, verifyLock(t, "OP_IF 1 OP_ENDIF"), stackUnderflowErr)
+	})
+}
+
+func TestCheckMultisig(t *testing.T) {
+	keys := [][]byte{[]byte("key a"), []byte("key b"), []byte("key c")}
+	lock, err := Multisig(2, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlockWith := func(signers ...int) []byte {
+		b := NewBuilder()
+		for _, i := range signers {
+			b.AddData(testSig(keys[i]))
+		}
+		s, err := b.Script()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	for _, signers := range [][]int{{0, 1}, {0, 2}, {1, 2}} {
+		if err := Verify(unlockWith(signers...), lock, testChecker{}); err != nil {
+			t.Errorf("Expected the signatures of keys %v to unlock, got %v", signers, err)
+		}
+	}
+	// signatures must follow the order of their keys, and each key signs once
+	for _, signers := range [][]int{{1, 0}, {2, 0}, {2, 1}, {0, 0}, {2, 2}} {
+		if err := Verify(unlockWith(signers...), lock, testChecker{}); err == nil {
+			t.Errorf("Expected the signatures of keys %v to be refused", signers)
+		}
+	}
+	if err := Verify(unlockWith(0), lock, testChecker{}); err == nil {
+		t.Error("Expected a single signature to be refused")
+	}
+	t.Run("Invalid counts", func(t *testing.T) {
+		for _, asm := range []string{
+			"0x01 0 0x0a 1 OP_CHECKMULTISIG",  // no signatures
+			"0x01 2 0x0a 1 OP_CHECKMULTISIG",  // more signatures than keys
+			"0x01 1 0x0a 0 OP_CHECKMULTISIG",  // no keys
+			"0x01 1 0x0a 17 OP_CHECKMULTISIG", // too many keys
+		} {
+			if err := verifyLock(t, asm); err == nil {
+				t.Errorf("Expected %q to fail", asm)
+			}
+		}
+	})
+}
+
+func TestUnlockingScript(t *testing.T) {
+	lock := mustAssemble(t, "OP_SHA256 0x"+fmt.Sprintf("%x", sha256Of("secret"))+" OP_EQUAL")
+	unlock := NewBuilder().AddData([]byte("secret"))
+	s, err := unlock.Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(s, lock, testChecker{}); err != nil {
+		t.Fatalf("Expected the preimage to unlock, got %v", err)
+	}
+	for _, asm := range []string{
+		"0x736563726574 OP_DUP OP_DROP",
+		"OP_1 OP_VERIFY 0x736563726574",
+		"0x00 OP_IF OP_ENDIF 0x736563726574",
+		"0x736563726574 OP_CHECKSIG",
+	} {
+		unlock := mustAssemble(t, asm)
+		if IsPushOnly(unlock) {
+			t.Errorf("Expected %q not to be push-only", asm)
+		}
+		if err := Verify(unlock, lock, testChecker{}); err == nil {
+			t.Errorf("Expected unlocking with %q to be refused", asm)
+		}
+	}
+	for _, asm := range []string{"0 1 16 -1 0x2a", "1000 0x" + strings.Repeat("ab", 300)} {
+		if !IsPushOnly(mustAssemble(t, asm)) {
+			t.Errorf("Expected %q to be push-only", asm)
+		}
+	}
+	if IsPushOnly([]byte{byte(OP_PUSHDATA1), 5, 1}) {
+		t.Error("Expected a truncated push not to be push-only")
+	}
+}
@@ -0,0 +1,318 @@
+// Package script is a small stack-based language for the spending conditions
+// of outputs, modelled on the scripts of bitcoin.
+//
+// An output is locked by a script, and every input spending it brings an
+// unlocking script that only pushes data, typically signatures. The unlocking
+// script runs first and the locking script runs on the stack it leaves. The
+// input is valid if the locking script ends with a true value on top.
+package script
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Execution limits, so that any script runs in bounded time and memory
+const (
+	MaxScriptSize   = 1024 // bytes of a single script
+	MaxElementSize  = 520  // bytes of a single stack element
+	MaxStackSize    = 100  // elements on the stack
+	MaxOps          = 200  // executed opcodes, pushes excluded
+	MaxMultisigKeys = 16
+)
+
+type Opcode byte
+
+const (
+	OP_0         Opcode = 0x00
+	OP_PUSHDATA1 Opcode = 0x4c // the next byte is the length of the data
+	OP_PUSHDATA2 Opcode = 0x4d // the next 2 bytes, little endian, are the length of the data
+	OP_1NEGATE   Opcode = 0x4f
+	OP_1         Opcode = 0x51
+	OP_16        Opcode = 0x60
+
+	OP_IF     Opcode = 0x63
+	OP_NOTIF  Opcode = 0x64
+	OP_ELSE   Opcode = 0x67
+	OP_ENDIF  Opcode = 0x68
+	OP_VERIFY Opcode = 0x69
+	OP_RETURN Opcode = 0x6a
+
+	OP_DROP Opcode = 0x75
+	OP_DUP  Opcode = 0x76
+	OP_SWAP Opcode = 0x7c
+	OP_SIZE Opcode = 0x82
+
+	OP_EQUAL       Opcode = 0x87
+	OP_EQUALVERIFY Opcode = 0x88
+
+	OP_SHA256  Opcode = 0xa8
+	OP_KEYHASH Opcode = 0xa9 // first 20 bytes of the sha256 of the element
+
+	OP_CHECKSIG            Opcode = 0xac
+	OP_CHECKSIGVERIFY      Opcode = 0xad
+	OP_CHECKMULTISIG       Opcode = 0xae
+	OP_CHECKMULTISIGVERIFY Opcode = 0xaf
+
+	OP_CHECKLOCKTIMEVERIFY Opcode = 0xb1
+)
+
+var opcodeNames = map[Opcode]string{
+	OP_0:                   "OP_0",
+	OP_PUSHDATA1:           "OP_PUSHDATA1",
+	OP_PUSHDATA2:           "OP_PUSHDATA2",
+	OP_1NEGATE:             "OP_1NEGATE",
+	OP_IF:                  "OP_IF",
+	OP_NOTIF:               "OP_NOTIF",
+	OP_ELSE:                "OP_ELSE",
+	OP_ENDIF:               "OP_ENDIF",
+	OP_VERIFY:              "OP_VERIFY",
+	OP_RETURN:              "OP_RETURN",
+	OP_DROP:                "OP_DROP",
+	OP_DUP:                 "OP_DUP",
+	OP_SWAP:                "OP_SWAP",
+	OP_SIZE:                "OP_SIZE",
+	OP_EQUAL:               "OP_EQUAL",
+	OP_EQUALVERIFY:         "OP_EQUALVERIFY",
+	OP_SHA256:              "OP_SHA256",
+	OP_KEYHASH:             "OP_KEYHASH",
+	OP_CHECKSIG:            "OP_CHECKSIG",
+	OP_CHECKSIGVERIFY:      "OP_CHECKSIGVERIFY",
+	OP_CHECKMULTISIG:       "OP_CHECKMULTISIG",
+	OP_CHECKMULTISIGVERIFY: "OP_CHECKMULTISIGVERIFY",
+	OP_CHECKLOCKTIMEVERIFY: "OP_CHECKLOCKTIMEVERIFY",
+}
+
+func init() {
+	for n := 1; n <= 16; n++ {
+		opcodeNames[OP_1+Opcode(n-1)] = fmt.Sprintf("OP_%d", n)
+	}
+}
+
+func (op Opcode) String() string {
+	if name, ok := opcodeNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("OP_UNKNOWN_%#02x", byte(op))
+}
+
+func (op Opcode) isPush() bool {
+	return op <= OP_PUSHDATA2 || op == OP_1NEGATE || (op >= OP_1 && op <= OP_16)
+}
+
+// A single instruction of a script, with the data it pushes if any
+type Instruction struct {
+	Op   Opcode
+	Data []byte
+}
+
+var (
+	scriptSizeErr  = fmt.Errorf("script is larger than %d bytes", MaxScriptSize)
+	truncatedErr   = errors.New("script ends in the middle of a push")
+	elementSizeErr = fmt.Errorf("pushed data is larger than %d bytes", MaxElementSize)
+)
+
+// Splits a script into its instructions, checking that it is well formed
+func Parse(s []byte) ([]Instruction, error) {
+	if len(s) > MaxScriptSize {
+		return nil, scriptSizeErr
+	}
+	var instructions []Instruction
+	for i := 0; i < len(s); {
+		op := Opcode(s[i])
+		i++
+		var dataLen int
+		switch {
+		case op > OP_0 && op < OP_PUSHDATA1:
+			dataLen = int(op)
+		case op == OP_PUSHDATA1:
+			if i+1 > len(s) {
+				return nil, truncatedErr
+			}
+			dataLen = int(s[i])
+			i++
+		case op == OP_PUSHDATA2:
+			if i+2 > len(s) {
+				return nil, truncatedErr
+			}
+			dataLen = int(binary.LittleEndian.Uint16(s[i:]))
+			i += 2
+		default:
+			if _, ok := opcodeNames[op]; !ok {
+				return nil, fmt.Errorf("unknown opcode %#02x", byte(op))
+			}
+			instructions = append(instructions, Instruction{Op: op})
+			continue
+		}
+		if dataLen > MaxElementSize {
+			return nil, elementSizeErr
+		}
+		if i+dataLen > len(s) {
+			return nil, truncatedErr
+		}
+		instructions = append(instructions, Instruction{Op: op, Data: s[i : i+dataLen]})
+		i += dataLen
+	}
+	return instructions, nil
+}
+
+// Returns true if the script only pushes data, as unlocking scripts must
+func IsPushOnly(s []byte) bool {
+	instructions, err := Parse(s)
+	if err != nil {
+		return false
+	}
+	for _, ins := range instructions {
+		if !ins.Op.isPush() {
+			return false
+		}
+	}
+	return true
+}
+
+// Builds scripts instruction by instruction
+type Builder struct {
+	script []byte
+}
+
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+func (b *Builder) AddOp(op Opcode) *Builder {
+	b.script = append(b.script, byte(op))
+	return b
+}
+
+// Adds the shortest push of data
+func (b *Builder) AddData(data []byte) *Builder {
+	switch {
+	case len(data) == 0:
+		b.script = append(b.script, byte(OP_0))
+	case len(data) < int(OP_PUSHDATA1):
+		b.script = append(b.script, byte(len(data)))
+	case len(data) <= 0xff:
+		b.script = append(b.script, byte(OP_PUSHDATA1), byte(len(data)))
+	default:
+		b.script = append(b.script, byte(OP_PUSHDATA2), byte(len(data)), byte(len(data)>>8))
+	}
+	b.script = append(b.script, data...)
+	return b
+}
+
+// Adds the shortest push of n
+func (b *Builder) AddInt(n int64) *Builder {
+	switch {
+	case n == 0:
+		return b.AddOp(OP_0)
+	case n == -1:
+		return b.AddOp(OP_1NEGATE)
+	case n >= 1 && n <= 16:
+		return b.AddOp(OP_1 + Opcode(n-1))
+	}
+	return b.AddData(encodeNum(n))
+}
+
+// Returns the script, or an error if it breaks the limits
+func (b *Builder) Script() ([]byte, error) {
+	if _, err := Parse(b.script); err != nil {
+		return nil, err
+	}
+	return b.script, nil
+}
+
+// Locks to a key, unlocked by '<sig>'
+func PayToPubKey(pubKey []byte) ([]byte, error) {
+	return NewBuilder().AddData(pubKey).AddOp(OP_CHECKSIG).Script()
+}
+
+// Locks to the hash of a key, unlocked by '<sig> <pubKey>'
+func PayToPubKeyHash(keyHash []byte) ([]byte, error) {
+	return NewBuilder().AddOp(OP_DUP).AddOp(OP_KEYHASH).AddData(keyHash).
+		AddOp(OP_EQUALVERIFY).AddOp(OP_CHECKSIG).Script()
+}
+
+// Locks to any m of the keys, unlocked by the signatures in the order of their keys
+func Multisig(m int, pubKeys [][]byte) ([]byte, error) {
+	if len(pubKeys) == 0 || len(pubKeys) > MaxMultisigKeys || m < 1 || m > len(pubKeys) {
+		return nil, fmt.Errorf("invalid %d-of-%d multisig", m, len(pubKeys))
+	}
+	b := NewBuilder().AddInt(int64(m))
+	for _, pubKey := range pubKeys {
+		b.AddData(pubKey)
+	}
+	return b.AddInt(int64(len(pubKeys))).AddOp(OP_CHECKMULTISIG).Script()
+}
+
+// Locks to the preimage of a sha256 hash, unlocked by '<preimage>'
+func HashLock(hash []byte) ([]byte, error) {
+	return NewBuilder().AddOp(OP_SHA256).AddData(hash).AddOp(OP_EQUAL).Script()
+}
+
+// Locks to a key until lockTime, unlocked by '<sig>' in a transaction locked
+// until at least lockTime
+func TimeLock(lockTime int64, pubKey []byte) ([]byte, error) {
+	return NewBuilder().AddInt(lockTime).AddOp(OP_CHECKLOCKTIMEVERIFY).AddOp(OP_DROP).
+		AddData(pubKey).AddOp(OP_CHECKSIG).Script()
+}
+
+// Locks to both keys, unlocked by '<payerSig> <payeeSig> 1', or to the payer
+// alone once the chain reaches timeout, unlocked by '<payerSig> 0' in a
+// transaction locked until at least timeout
+func PaymentChannel(payer, payee []byte, timeout int64) ([]byte, error) {
+	return NewBuilder().AddOp(OP_IF).
+		AddData(payee).AddOp(OP_CHECKSIGVERIFY).AddData(payer).AddOp(OP_CHECKSIG).
+		AddOp(OP_ELSE).
+		AddInt(timeout).AddOp(OP_CHECKLOCKTIMEVERIFY).AddOp(OP_DROP).AddData(payer).AddOp(OP_CHECKSIG).
+		AddOp(OP_ENDIF).Script()
+}
+
+// Returns the human readable form of a script, as parsed by Assemble
+func Disassemble(s []byte) (string, error) {
+	instructions, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	tokens := make([]string, 0, len(instructions))
+	for _, ins := range instructions {
+		if ins.Data != nil {
+			tokens = append(tokens, "0x"+hex.EncodeToString(ins.Data))
+		} else {
+			tokens = append(tokens, ins.Op.String())
+		}
+	}
+	return strings.Join(tokens, " "), nil
+}
+
+// Compiles a script from whitespace separated tokens, each an opcode name
+// (OP_DUP), data in hex (0x2a) or a decimal number (42)
+func Assemble(asm string) ([]byte, error) {
+	names := make(map[string]Opcode, len(opcodeNames))
+	for op, name := range opcodeNames {
+		names[name] = op
+	}
+	b := NewBuilder()
+	for _, token := range strings.Fields(asm) {
+		if op, ok := names[strings.ToUpper(token)]; ok {
+			if op == OP_PUSHDATA1 || op == OP_PUSHDATA2 {
+				return nil, fmt.Errorf("%s cannot be used directly, write the data in hex instead", token)
+			}
+			b.AddOp(op)
+		} else if strings.HasPrefix(token, "0x") {
+			data, err := hex.DecodeString(token[2:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid hex data %s", token)
+			}
+			b.AddData(data)
+		} else if n, err := strconv.ParseInt(token, 10, 64); err == nil {
+			b.AddInt(n)
+		} else {
+			return nil, fmt.Errorf("unknown token %s", token)
+		}
+	}
+	return b.Script()
+}
@@ -0,0 +1,61 @@
+package node
+
+import (
+	"fmt"
+	"sort"
+
+	bck "github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+// Number of blocks the median time past is computed over
+const medianTimeSpan = 11
+
+// Median timestamp of the last blocks of the chain, in unix seconds.
+//
+// Time locks are checked against it rather than against the timestamp of a
+// single block, which its miner is free to choose.
+func (n *Node) medianTimePast() int64 {
+	start := len(n.Chain) - medianTimeSpan
+	if start < 0 {
+		start = 0
+	}
+	times := make([]int64, 0, medianTimeSpan)
+	for _, block := range n.Chain[start:] {
+		times = append(times, block.Timestamp.Unix())
+	}
+	if len(times) == 0 {
+		return 0
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times[len(times)/2]
+}
+
+// Returns the height of the next block and the median time past of the chain,
+// which the lock times of new transactions are checked against
+func (n *Node) lockContext() (int, int64) {
+	return len(n.Chain) + 1, n.medianTimePast()
+}
+
+// Returns an error if tx, or any of its inputs as found in the utxos of the
+// sender, cannot be included in the next block yet
+func (n *Node) checkLocks(tx *bck.Transaction, senderUtxos bck.TxOutMap) error {
+	height, medianTime := n.lockContext()
+	if !bck.IsLockFinal(tx.LockTime, height, medianTime) {
+		return fmt.Errorf("transaction is locked until %s", bck.FormatLockTime(tx.LockTime))
+	}
+	for _, txIn := range tx.Inputs {
+		utxo, ok := senderUtxos[txIn.Id]
+		if ok && !bck.IsLockFinal(utxo.LockTime, height, medianTime) {
+			return fmt.Errorf("input %s is locked until %s", txIn.Id, bck.FormatLockTime(utxo.LockTime))
+		}
+	}
+	return nil
+}
+
+// Lets every account know which of its utxos have been unlocked by the chain
+func (n *Node) updateChainTip() {
+	height, medianTime := n.lockContext()
+	for _, w := range n.Accounts.Wallets() {
+		w.SetChainTip(height, medianTime)
+	}
+}
@@ -0,0 +1,80 @@
+package node
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+func TestTimeLockedPayment(t *testing.T) {
+	lockNode := newFundedTestNode(t, nil)
+	vesting := backend.NewWallet(backend.DefaultKeyType)
+	if err := lockNode.Accounts.Add("vesting", vesting); err != nil {
+		t.Fatal(err)
+	}
+	lockNode.updateChainTip()
+
+	// pay the vesting account with outputs locked until height 10
+	allocation, _, err := lockNode.Wallet.CreateAndSignTxWithOptions(nil, &backend.TxTargetTy{
+		Address:  vesting.Address(),
+		Amount:   100,
+		LockTime: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lockNode.ApplyTx(allocation); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Locked outputs are not spendable", func(t *testing.T) {
+		if balance := lockNode.WalletBalance(vesting, 1); balance.Locked != 100 || balance.Spendable != 0 {
+			t.Errorf("Expected 100 locked and 0 spendable, got %d and %d", balance.Locked, balance.Spendable)
+		}
+		if _, err := vesting.CreateTx(50, lockNode.Wallet.Address()); err == nil {
+			t.Error("Expected the wallet to refuse spending locked outputs")
+		}
+	})
+	t.Run("Spend locked outputs with a raw transaction", func(t *testing.T) {
+		var utxos []*backend.TxOut
+		for _, utxo := range vesting.Utxos {
+			utxos = append(utxos, utxo)
+		}
+		tx, _, err := backend.BuildTx(vesting.PrivKey.Public(), utxos, nil, &backend.TxTargetTy{
+			Address: lockNode.Wallet.Address(),
+			Amount:  50,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vesting.SignTx(tx); err != nil {
+			t.Fatal(err)
+		}
+		if err := lockNode.AcceptTx(tx); err == nil {
+			t.Error("Expected a spend of locked outputs to be refused")
+		}
+	})
+	t.Run("Submit a transaction that is not final yet", func(t *testing.T) {
+		tx, _, err := lockNode.Wallet.CreateAndSignTxWithOptions(&backend.TxOptions{LockTime: 10}, &backend.TxTargetTy{
+			Address: vesting.Address(),
+			Amount:  10,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := lockNode.AcceptTx(tx); err == nil {
+			t.Error("Expected a transaction that is not final to be refused")
+		}
+		block := backend.NewBlock(lockNode.getLastBlock().CurrentHash)
+		block.Transactions = append(block.Transactions, tx)
+		for nonce := 0; !strings.HasPrefix(backend.HexEncodeByteSlice(block.CurrentHash), strings.Repeat("0", backend.Difficulty)); nonce++ {
+			block.Nonce = strconv.Itoa(nonce)
+			block.ComputeAndFillHash()
+		}
+		if err := lockNode.IsValidBlock(block); err != lockedTxErr {
+			t.Errorf("Expected error %v, got %v", lockedTxErr, err)
+		}
+	})
+}
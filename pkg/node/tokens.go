@@ -0,0 +1,112 @@
+package node
+
+import (
+	"sort"
+	"sync"
+
+	bck "github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+type TokenInfo struct {
+	Id     string      `json:"id"`
+	Name   string      `json:"name"`
+	Issuer bck.Address `json:"issuer"`
+	Supply int         `json:"supply"`
+	TxId   string      `json:"txId"` // id of the issuance
+}
+
+// Tokens issued by the transactions of the chain.
+//
+// Thread-safe
+type Tokens struct {
+	mu     sync.RWMutex
+	tokens map[string]*TokenInfo
+}
+
+func NewTokens() *Tokens {
+	return &Tokens{
+		tokens: map[string]*TokenInfo{},
+	}
+}
+
+// Registers the token issued by tx
+func (tk *Tokens) Add(tx *bck.Transaction) {
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+	id := tx.IssuedAsset()
+	tk.tokens[id] = &TokenInfo{
+		Id:     id,
+		Name:   tx.Issuance.Name,
+		Issuer: tx.Sender(),
+		Supply: tx.Issuance.Supply,
+		TxId:   bck.HexEncodeByteSlice(tx.Id),
+	}
+}
+
+func (tk *Tokens) Remove(id string) {
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+	delete(tk.tokens, id)
+}
+
+func (tk *Tokens) Get(id string) (TokenInfo, bool) {
+	tk.mu.RLock()
+	defer tk.mu.RUnlock()
+	info, ok := tk.tokens[id]
+	if !ok {
+		return TokenInfo{}, false
+	}
+	return *info, true
+}
+
+// Returns every token, sorted by name
+func (tk *Tokens) List() []TokenInfo {
+	tk.mu.RLock()
+	defer tk.mu.RUnlock()
+	tokens := make([]TokenInfo, 0, len(tk.tokens))
+	for _, info := range tk.tokens {
+		tokens = append(tokens, *info)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].Name != tokens[j].Name {
+			return tokens[i].Name < tokens[j].Name
+		}
+		return tokens[i].Id < tokens[j].Id
+	})
+	return tokens
+}
+
+// Holdings of a wallet in one token
+type TokenBalance struct {
+	Token     TokenInfo     `json:"token"`
+	Balance   int           `json:"balance"`
+	Spendable int           `json:"spendable"` // neither reserved nor locked
+	Utxos     []minimalUtxo `json:"utxos"`
+}
+
+// Returns the holdings of w in every token, sorted like Tokens.List
+func (n *Node) TokenBalances(w *bck.Wallet) []*TokenBalance {
+	var balances []*TokenBalance
+	for asset, utxos := range w.TokenUtxos() {
+		info, ok := n.Tokens.Get(asset)
+		if !ok {
+			info = TokenInfo{Id: asset}
+		}
+		balance := &TokenBalance{Token: info, Utxos: utxosToMinimal(utxos)}
+		for _, utxo := range utxos {
+			balance.Balance += utxo.Amount
+			if !w.IsReserved(utxo) && !w.IsLocked(utxo) {
+				balance.Spendable += utxo.Amount
+			}
+		}
+		balances = append(balances, balance)
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		a, b := balances[i].Token, balances[j].Token
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Id < b.Id
+	})
+	return balances
+}
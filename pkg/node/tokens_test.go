@@ -0,0 +1,70 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+func TestTokens(t *testing.T) {
+	tokenNode := newFundedTestNode(t, nil)
+	student := backend.NewWallet(backend.DefaultKeyType)
+	balance := tokenNode.Wallet.Balance
+
+	// submits the transaction a wallet created, failing on any error
+	submit := func(tx *backend.Transaction, err error) *backend.Transaction {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tokenNode.SubmitOwnTx(tx); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	var token string
+	t.Run("Issue a token", func(t *testing.T) {
+		token = submit(tokenNode.Wallet.CreateAndSignIssuanceTx("lab credits", 1000)).IssuedAsset()
+		mineTestBlock(t, tokenNode)
+		info, ok := tokenNode.Tokens.Get(token)
+		if !ok || info.Supply != 1000 || info.Issuer != tokenNode.Wallet.Address() {
+			t.Fatalf("Expected token %s with a supply of 1000 issued by the node, got %+v", token, info)
+		}
+		if tokenNode.Wallet.Balance != balance {
+			t.Errorf("Expected the native balance to stay %d, got %d", balance, tokenNode.Wallet.Balance)
+		}
+		tokens := tokenNode.WalletBalance(tokenNode.Wallet, 1).Tokens
+		if len(tokens) != 1 || tokens[0].Balance != 1000 || tokens[0].Spendable != 1000 {
+			t.Errorf("Expected a spendable balance of 1000 in the token, got %+v", tokens)
+		}
+	})
+	t.Run("Issue a token with an invalid supply", func(t *testing.T) {
+		if _, err := tokenNode.Wallet.CreateAndSignIssuanceTx("free credits", 0); err == nil {
+			t.Error("Expected a token without supply to be refused")
+		}
+	})
+	t.Run("Send tokens", func(t *testing.T) {
+		submit(tokenNode.Wallet.CreateAndSignTokenTx(token, nil, &backend.TxTargetTy{Address: student.Address(), Amount: 30}))
+		mineTestBlock(t, tokenNode)
+		e, ok := tokenNode.Ledger.Get(student.Address())
+		if !ok {
+			t.Fatal("Expected the student to be paid")
+		}
+		wallet := newRingWallet(0, e.WalletInfoSnapshot())
+		if wallet.Balance != 0 || wallet.Tokens[token] != 30 {
+			t.Errorf("Expected the student to hold 30 of the token and no coins, got %d and %d", wallet.Tokens[token], wallet.Balance)
+		}
+		tokens := tokenNode.TokenBalances(tokenNode.Wallet)
+		if len(tokens) != 1 || tokens[0].Balance != 970 {
+			t.Errorf("Expected a balance of 970 in the token, got %+v", tokens)
+		}
+		if tokenNode.Wallet.Balance != balance {
+			t.Errorf("Expected the native balance to stay %d, got %d", balance, tokenNode.Wallet.Balance)
+		}
+	})
+	t.Run("Send more tokens than held", func(t *testing.T) {
+		if _, err := tokenNode.Wallet.CreateAndSignTokenTx(token, nil, &backend.TxTargetTy{Address: student.Address(), Amount: 971}); err == nil {
+			t.Error("Expected sending more tokens than held to fail")
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package node
+
+import (
+	"sync"
+	"time"
+
+	bck "github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+type TxStatus string
+
+const (
+	TxPending   TxStatus = "pending"   // waiting to be mined
+	TxConfirmed TxStatus = "confirmed" // part of a block in the chain
+	TxOrphaned  TxStatus = "orphaned"  // its block was reverted, waiting to be mined again
+	TxDropped   TxStatus = "dropped"   // rejected or evicted, will never be mined
+	TxReplaced  TxStatus = "replaced"  // evicted by a transaction spending the same inputs, see AcceptTx
+)
+
+type TxIndexEntry struct {
+	Tx          *bck.Transaction
+	Status      TxStatus
+	BlockHeight int       // height of the block containing the tx, -1 if not confirmed
+	Timestamp   time.Time // when the tx was first seen, or the timestamp of its block
+	ReplacedBy  string    // id of the transaction that replaced it, if any
+}
+
+// Tracks the lifecycle of every transaction seen by the node.
+//
+// Thread-safe
+type TxIndex struct {
+	mu      sync.RWMutex
+	entries map[string]*TxIndexEntry
+}
+
+func NewTxIndex() *TxIndex {
+	return &TxIndex{
+		entries: map[string]*TxIndexEntry{},
+	}
+}
+
+// Must be called with the index lock held
+func (ti *TxIndex) entry(tx *bck.Transaction) *TxIndexEntry {
+	txId := bck.HexEncodeByteSlice(tx.Id)
+	e, ok := ti.entries[txId]
+	if !ok {
+		e = &TxIndexEntry{
+			Tx:          tx,
+			BlockHeight: -1,
+			Timestamp:   time.Now(),
+		}
+		ti.entries[txId] = e
+	}
+	return e
+}
+
+func (ti *TxIndex) MarkPending(tx *bck.Transaction) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	if e := ti.entry(tx); e.Status != TxConfirmed {
+		e.Status = TxPending
+	}
+}
+
+func (ti *TxIndex) MarkConfirmed(block *bck.Block) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	for _, tx := range block.Transactions {
+		e := ti.entry(tx)
+		e.Status = TxConfirmed
+		e.BlockHeight = block.Index
+		e.Timestamp = block.Timestamp
+		e.ReplacedBy = ""
+	}
+}
+
+func (ti *TxIndex) MarkOrphaned(block *bck.Block) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	for _, tx := range block.Transactions {
+		e := ti.entry(tx)
+		e.Status = TxOrphaned
+		e.BlockHeight = -1
+	}
+}
+
+// Marks the transaction with the given id as dropped, unless it is already confirmed
+func (ti *TxIndex) MarkDropped(txId string) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	if e, ok := ti.entries[txId]; ok && e.Status != TxConfirmed {
+		e.Status = TxDropped
+		e.BlockHeight = -1
+	}
+}
+
+// Marks the transaction with the given id as replaced by the one with id byTxId,
+// unless it is already confirmed
+func (ti *TxIndex) MarkReplaced(txId, byTxId string) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	if e, ok := ti.entries[txId]; ok && e.Status != TxConfirmed {
+		e.Status = TxReplaced
+		e.BlockHeight = -1
+		e.ReplacedBy = byTxId
+	}
+}
+
+// Returns a copy of the entry of the transaction with the given id
+func (ti *TxIndex) Get(txId string) (TxIndexEntry, bool) {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+	e, ok := ti.entries[txId]
+	if !ok {
+		return TxIndexEntry{}, false
+	}
+	return *e, true
+}
+
+// Returns a copy of every entry in the index
+func (ti *TxIndex) Entries() []TxIndexEntry {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+	entries := make([]TxIndexEntry, 0, len(ti.entries))
+	for _, e := range ti.entries {
+		entries = append(entries, *e)
+	}
+	return entries
+}
+
+// Returns the ids of the utxos spent by pending or orphaned transactions
+func (ti *TxIndex) PendingInputs() stringSet {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+	spent := make(stringSet)
+	for _, e := range ti.entries {
+		if e.Status != TxPending && e.Status != TxOrphaned {
+			continue
+		}
+		for _, txIn := range e.Tx.Inputs {
+			spent.Add(txIn.Id)
+		}
+	}
+	return spent
+}
+
+// Replaces the confirmed transactions of the index with the ones of chain.
+// Transactions that were confirmed but are no longer in chain become orphaned.
+func (ti *TxIndex) Rebuild(chain []*bck.Block) {
+	ti.mu.Lock()
+	for _, e := range ti.entries {
+		if e.Status == TxConfirmed {
+			e.Status = TxOrphaned
+			e.BlockHeight = -1
+		}
+	}
+	ti.mu.Unlock()
+	for _, block := range chain {
+		ti.MarkConfirmed(block)
+	}
+}
+
+// Number of blocks on top of (and including) the block at height
+func confirmations(e TxIndexEntry, chainLen int) int {
+	if e.Status != TxConfirmed {
+		return 0
+	}
+	return chainLen - e.BlockHeight + 1
+}
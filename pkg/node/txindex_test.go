@@ -0,0 +1,92 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/kon-pap/noobcash/pkg/node/backend"
+)
+
+func TestTxIndex(t *testing.T) {
+	w := backend.NewWallet(backend.DefaultKeyType)
+	amount := 0
+	// every transaction pays a different amount, so that their ids differ
+	newTx := func() *backend.Transaction {
+		amount++
+		tx := backend.NewTransaction(w.PrivKey.Public(), amount)
+		tx.ComputeAndFillHash()
+		return tx
+	}
+	newBlock := func(index int, txs ...*backend.Transaction) *backend.Block {
+		block := backend.NewBlock(nil)
+		block.Index = index
+		block.Transactions = txs
+		return block
+	}
+
+	t.Run("Lifecycle of a transaction", func(t *testing.T) {
+		ti := NewTxIndex()
+		tx := newTx()
+		txId := backend.HexEncodeByteSlice(tx.Id)
+		if _, ok := ti.Get(txId); ok {
+			t.Fatal("Expected an unknown transaction not to be found")
+		}
+		ti.MarkPending(tx)
+		if e, _ := ti.Get(txId); e.Status != TxPending || e.BlockHeight != -1 {
+			t.Errorf("Expected a pending transaction without height, got %s at %d", e.Status, e.BlockHeight)
+		}
+		block := newBlock(3, tx)
+		ti.MarkConfirmed(block)
+		e, _ := ti.Get(txId)
+		if e.Status != TxConfirmed || e.BlockHeight != 3 {
+			t.Errorf("Expected a transaction confirmed at 3, got %s at %d", e.Status, e.BlockHeight)
+		}
+		if c := confirmations(e, 4); c != 2 {
+			t.Errorf("Expected 2 confirmations, got %d", c)
+		}
+		ti.MarkDropped(txId)
+		ti.MarkPending(tx)
+		if e, _ := ti.Get(txId); e.Status != TxConfirmed {
+			t.Errorf("Expected a confirmed transaction to stay confirmed, got %s", e.Status)
+		}
+		ti.MarkOrphaned(block)
+		if e, _ := ti.Get(txId); e.Status != TxOrphaned || e.BlockHeight != -1 {
+			t.Errorf("Expected an orphaned transaction without height, got %s at %d", e.Status, e.BlockHeight)
+		}
+	})
+	t.Run("Drop and replace", func(t *testing.T) {
+		ti := NewTxIndex()
+		dropped, replaced, replacement := newTx(), newTx(), newTx()
+		droppedId := backend.HexEncodeByteSlice(dropped.Id)
+		replacedId := backend.HexEncodeByteSlice(replaced.Id)
+		replacementId := backend.HexEncodeByteSlice(replacement.Id)
+		for _, tx := range []*backend.Transaction{dropped, replaced, replacement} {
+			ti.MarkPending(tx)
+		}
+		ti.MarkDropped(droppedId)
+		ti.MarkReplaced(replacedId, replacementId)
+		if e, _ := ti.Get(droppedId); e.Status != TxDropped {
+			t.Errorf("Expected status %s, got %s", TxDropped, e.Status)
+		}
+		if e, _ := ti.Get(replacedId); e.Status != TxReplaced || e.ReplacedBy != replacementId {
+			t.Errorf("Expected the transaction to be replaced by %s, got %s by %q", replacementId, e.Status, e.ReplacedBy)
+		}
+		// the replaced transaction still makes it into a block
+		ti.MarkConfirmed(newBlock(1, replaced))
+		if e, _ := ti.Get(replacedId); e.Status != TxConfirmed || e.ReplacedBy != "" {
+			t.Errorf("Expected the mined transaction to be confirmed, got %s by %q", e.Status, e.ReplacedBy)
+		}
+	})
+	t.Run("Rebuild from another chain", func(t *testing.T) {
+		ti := NewTxIndex()
+		kept, orphaned := newTx(), newTx()
+		ti.MarkConfirmed(newBlock(1, kept))
+		ti.MarkConfirmed(newBlock(2, orphaned))
+		ti.Rebuild([]*backend.Block{newBlock(0), newBlock(1, kept)})
+		if e, _ := ti.Get(backend.HexEncodeByteSlice(kept.Id)); e.Status != TxConfirmed || e.BlockHeight != 1 {
+			t.Errorf("Expected the transaction to stay confirmed at 1, got %s at %d", e.Status, e.BlockHeight)
+		}
+		if e, _ := ti.Get(backend.HexEncodeByteSlice(orphaned.Id)); e.Status != TxOrphaned {
+			t.Errorf("Expected status %s, got %s", TxOrphaned, e.Status)
+		}
+	})
+}
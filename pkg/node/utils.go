@@ -1,6 +1,7 @@
 package node
 
 import (
+	"bytes"
 	"container/list"
 	"fmt"
 	"io/ioutil"
@@ -112,6 +113,58 @@ func (tq *TxQueue) DequeueManyByValue(txIdsToLookFor stringSet) int {
 	return removeCnt
 }
 
+// Thread-safe enqueue of tx in place of the transactions spending any of its
+// inputs, if replace accepts to evict them
+//
+// returns the replaced transactions
+func (tq *TxQueue) EnqueueReplacing(tx *bck.Transaction, replace func(conflicts []*bck.Transaction) error) ([]*bck.Transaction, error) {
+	tq.mu.Lock()
+	defer tq.mu.Unlock()
+	var conflictElems []*list.Element
+	var conflicts []*bck.Transaction
+	for e := tq.queue.Front(); e != nil; e = e.Next() {
+		pending := e.Value.(*bck.Transaction)
+		if bytes.Equal(pending.Id, tx.Id) {
+			continue
+		}
+		for _, txIn := range pending.Inputs {
+			if tx.Inputs.Has(txIn) {
+				conflictElems = append(conflictElems, e)
+				conflicts = append(conflicts, pending)
+				break
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		if err := replace(conflicts); err != nil {
+			return nil, err
+		}
+		for _, elem := range conflictElems {
+			tq.queue.Remove(elem)
+		}
+	}
+	tq.enqueue(tx)
+	return conflicts, nil
+}
+
+// Thread-safe removal of every transaction that satisfies pred
+//
+// returns the removed transactions
+func (tq *TxQueue) RemoveIf(pred func(*bck.Transaction) bool) (removed []*bck.Transaction) {
+	tq.mu.Lock()
+	defer tq.mu.Unlock()
+	var next *list.Element
+	for e := tq.queue.Front(); e != nil; e = next {
+		next = e.Next()
+		tx := e.Value.(*bck.Transaction)
+		if pred(tx) {
+			tq.queue.Remove(e)
+			removed = append(removed, tx)
+		}
+	}
+	return
+}
+
 func (tq *TxQueue) Len() int {
 	return tq.queue.Len()
 }
@@ -178,3 +231,13 @@ func (ss stringSet) ContainsByteSlice(b []byte) bool {
 	_, ok := ss[bck.HexEncodeByteSlice(b)]
 	return ok
 }
+
+type addressSet map[bck.Address]struct{}
+
+func (as addressSet) Add(a bck.Address) {
+	as[a] = struct{}{}
+}
+func (as addressSet) Contains(a bck.Address) bool {
+	_, ok := as[a]
+	return ok
+}
@@ -18,6 +18,14 @@ HOSTNAME=localhost
 HOSTPORT=7070
 APIPORT=9090
 
+# Wallet keystores are kept under WALLET_PATH (config/node.env), one per api port,
+# encrypted with the passphrase given in NOOBCASH_PASSPHRASE
+if [ -z "$NOOBCASH_PASSPHRASE" ]; then
+    echo "Set NOOBCASH_PASSPHRASE to the passphrase of the node keystores"
+    exit 1
+fi
+export NOOBCASH_PASSPHRASE
+
 echo "Building..."
 make
 